@@ -10,6 +10,7 @@ import (
 
 	"github.com/example/gitea-jenkins-webhook/internal/config"
 	"github.com/example/gitea-jenkins-webhook/internal/gitea"
+	"github.com/example/gitea-jenkins-webhook/internal/httpclient"
 	"github.com/example/gitea-jenkins-webhook/internal/jenkins"
 )
 
@@ -27,14 +28,19 @@ func checkCommand() {
 	fs := flag.NewFlagSet("check", flag.ExitOnError)
 	configPath := fs.String("config", "", "Path to configuration file")
 	debugFlag := fs.Bool("debug", false, "Enable debug logging")
+	logFormatFlag := fs.String("log-format", "", "Log format: text or json (default: server.log_format)")
 	fs.Parse(os.Args[1:])
 
 	if *configPath == "" {
 		fmt.Fprintf(os.Stderr, "ERROR: -config flag is required\n")
 		os.Exit(1)
 	}
+	if !validLogFormat(*logFormatFlag) {
+		fmt.Fprintf(os.Stderr, "ERROR: -log-format must be text or json, got %q\n", *logFormatFlag)
+		os.Exit(1)
+	}
 
-	logger := setupLogger(*debugFlag)
+	logger := setupLogger(*debugFlag, *logFormatFlag)
 
 	result := &checkResult{}
 
@@ -55,6 +61,7 @@ func checkCommand() {
 	}
 	fmt.Println("✓ Configuration file loaded and validated")
 	result.passed++
+	logger = setupLogger(*debugFlag, logFormat(*logFormatFlag, cfg))
 
 	// Stage 3: Validate server configuration
 	if err := validateServerConfig(cfg); err != nil {
@@ -68,7 +75,9 @@ func checkCommand() {
 	ctx := context.Background()
 
 	// Stage 4: Check Jenkins accessibility
-	jClient := jenkins.NewClient(cfg.Jenkins.BaseURL, cfg.Jenkins.Username, cfg.Jenkins.APIToken, nil, logger)
+	jClient := jenkins.NewClient(cfg.Jenkins.BaseURL, cfg.Jenkins.Username, cfg.Jenkins.APIToken, httpclient.New(cfg.Jenkins.ConnectTimeout), logger)
+	jClient.SetAuthMode(cfg.Jenkins.AuthMode)
+	jClient.SetRequestTimeout(cfg.Jenkins.RequestTimeout)
 	if err := jClient.CheckAccessibility(ctx); err != nil {
 		fmt.Fprintf(os.Stderr, "✗ Jenkins is not accessible at %s: %v\n", cfg.Jenkins.BaseURL, err)
 		result.errors++
@@ -77,8 +86,23 @@ func checkCommand() {
 	fmt.Printf("✓ Jenkins is accessible at %s\n", cfg.Jenkins.BaseURL)
 	result.passed++
 
+	// Stage 4.1: Check additional Jenkins instances accessibility
+	for name, instance := range cfg.JenkinsInstances {
+		iClient := jenkins.NewClient(instance.BaseURL, instance.Username, instance.APIToken, httpclient.New(instance.ConnectTimeout), logger)
+		iClient.SetAuthMode(instance.AuthMode)
+		iClient.SetRequestTimeout(instance.RequestTimeout)
+		if err := iClient.CheckAccessibility(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "✗ Jenkins instance %q is not accessible at %s: %v\n", name, instance.BaseURL, err)
+			result.errors++
+			os.Exit(1)
+		}
+		fmt.Printf("✓ Jenkins instance %q is accessible at %s\n", name, instance.BaseURL)
+		result.passed++
+	}
+
 	// Stage 5: Check Gitea accessibility
-	gClient := gitea.NewClient(cfg.Gitea.BaseURL, cfg.Gitea.Token, nil, logger)
+	gClient := gitea.NewClient(cfg.Gitea.BaseURL, cfg.Gitea.Token, httpclient.New(cfg.Gitea.ConnectTimeout), logger)
+	gClient.SetRequestTimeout(cfg.Gitea.RequestTimeout)
 	if err := gClient.CheckAccessibility(ctx); err != nil {
 		fmt.Fprintf(os.Stderr, "✗ Gitea is not accessible at %s: %v\n", cfg.Gitea.BaseURL, err)
 		result.errors++
@@ -181,6 +205,11 @@ func checkRepository(ctx context.Context, repoRule config.RepositoryRule, jClien
 	result.passed++
 
 	// 7.2: Check job_root in Jenkins (if specified)
+	if strings.Contains(repoRule.JobRoot, "{{") {
+		fmt.Printf("  ⚠ Job root \"%s\" is a template and is resolved per event, skipping job checks\n", repoRule.JobRoot)
+		result.warnings++
+		return
+	}
 	if repoRule.JobRoot != "" {
 		if err := jClient.CheckJobRootExists(ctx, repoRule.JobRoot); err != nil {
 			if strings.Contains(err.Error(), "not found") {
@@ -4,8 +4,11 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
+
+	"github.com/example/gitea-jenkins-webhook/internal/config"
 )
 
 // main является точкой входа приложения. Обрабатывает аргументы командной строки
@@ -40,18 +43,41 @@ func printUsage() {
 	fmt.Fprintf(os.Stdout, "Use \"webhook-service <command> -h\" for more information about a command.\n")
 }
 
-// setupLogger создает и настраивает логгер с указанным уровнем логирования.
+// setupLogger создает и настраивает логгер с указанным уровнем логирования и форматом.
 // Если debug равен true, устанавливается уровень Debug, иначе - Info.
+// format выбирает формат журнала (config.LogFormatText или config.LogFormatJSON, пустое значение - текст).
 // Возвращает настроенный логгер и устанавливает его как логгер по умолчанию.
-func setupLogger(debug bool) *slog.Logger {
+func setupLogger(debug bool, format string) *slog.Logger {
 	logLevel := slog.LevelInfo
 	if debug {
 		logLevel = slog.LevelDebug
 	}
 
-	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+	logger := slog.New(newLogHandler(os.Stdout, format, &slog.HandlerOptions{
 		Level: logLevel,
 	}))
 	slog.SetDefault(logger)
 	return logger
 }
+
+// newLogHandler возвращает обработчик slog для формата журнала format:
+// JSON для config.LogFormatJSON, текстовый - для остальных значений.
+func newLogHandler(w io.Writer, format string, opts *slog.HandlerOptions) slog.Handler {
+	if format == config.LogFormatJSON {
+		return slog.NewJSONHandler(w, opts)
+	}
+	return slog.NewTextHandler(w, opts)
+}
+
+// logFormat возвращает формат журнала: значение флага --log-format, если он задан, иначе server.log_format.
+func logFormat(flagValue string, cfg *config.Config) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	return cfg.Server.LogFormat
+}
+
+// validLogFormat сообщает, является ли format допустимым значением флага --log-format.
+func validLogFormat(format string) bool {
+	return format == "" || format == config.LogFormatText || format == config.LogFormatJSON
+}
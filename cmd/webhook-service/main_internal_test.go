@@ -0,0 +1,41 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/example/gitea-jenkins-webhook/internal/config"
+)
+
+func TestNewLogHandlerFormat(t *testing.T) {
+	tests := []struct {
+		format string
+		json   bool
+	}{
+		{"", false},
+		{config.LogFormatText, false},
+		{config.LogFormatJSON, true},
+	}
+	for _, tt := range tests {
+		handler := newLogHandler(io.Discard, tt.format, nil)
+		_, isJSON := handler.(*slog.JSONHandler)
+		_, isText := handler.(*slog.TextHandler)
+		if isJSON != tt.json || isText == tt.json {
+			t.Fatalf("format %q: unexpected handler %T", tt.format, handler)
+		}
+	}
+}
+
+func TestLogFormatPrefersFlag(t *testing.T) {
+	cfg := &config.Config{Server: config.ServerConfig{LogFormat: config.LogFormatJSON}}
+	if got := logFormat("", cfg); got != config.LogFormatJSON {
+		t.Fatalf("expected config format without flag, got %q", got)
+	}
+	if got := logFormat(config.LogFormatText, cfg); got != config.LogFormatText {
+		t.Fatalf("expected flag to override config, got %q", got)
+	}
+	if validLogFormat("yaml") {
+		t.Fatal("expected unknown format to be rejected")
+	}
+}
@@ -3,15 +3,23 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/example/gitea-jenkins-webhook/internal/config"
 	"github.com/example/gitea-jenkins-webhook/internal/gitea"
+	"github.com/example/gitea-jenkins-webhook/internal/httpclient"
 	"github.com/example/gitea-jenkins-webhook/internal/jenkins"
+	"github.com/example/gitea-jenkins-webhook/internal/metrics"
+	"github.com/example/gitea-jenkins-webhook/internal/notifier"
 	"github.com/example/gitea-jenkins-webhook/internal/processor"
 	"github.com/example/gitea-jenkins-webhook/internal/server"
+	"github.com/example/gitea-jenkins-webhook/internal/sink"
+	"github.com/example/gitea-jenkins-webhook/internal/wal"
 )
 
 // runCommand запускает вебхук-сервис. Загружает конфигурацию, инициализирует клиенты
@@ -21,9 +29,15 @@ func runCommand() {
 	fs := flag.NewFlagSet("run", flag.ExitOnError)
 	configPath := fs.String("config", "config.yaml", "Path to configuration file")
 	debugFlag := fs.Bool("debug", false, "Enable debug logging")
+	dryRunFlag := fs.Bool("dry-run", false, "Log comments and commit statuses instead of posting them to Gitea")
+	logFormatFlag := fs.String("log-format", "", "Log format: text or json (default: server.log_format)")
 	fs.Parse(os.Args[1:])
 
-	logger := setupLogger(*debugFlag)
+	if !validLogFormat(*logFormatFlag) {
+		fmt.Fprintf(os.Stderr, "ERROR: -log-format must be text or json, got %q\n", *logFormatFlag)
+		os.Exit(1)
+	}
+	logger := setupLogger(*debugFlag, *logFormatFlag)
 
 	logger.Info("starting webhook service", "config_path", *configPath, "debug", *debugFlag)
 
@@ -32,24 +46,146 @@ func runCommand() {
 		logger.Error("failed to load config", "err", err)
 		os.Exit(1)
 	}
+	cfg.Server.LogFormat = logFormat(*logFormatFlag, cfg)
+	logger = setupLogger(*debugFlag, cfg.Server.LogFormat)
+	if *dryRunFlag {
+		cfg.Server.DryRun = true
+	}
+	if cfg.Server.DryRun {
+		logger.Warn("dry run enabled: comments and commit statuses are logged, not posted to Gitea")
+	}
 	logger.Info("configuration loaded successfully",
 		"server_addr", cfg.Server.ListenAddr,
 		"worker_pool_size", cfg.Server.WorkerPoolSize,
 		"queue_size", cfg.Server.QueueSize,
 		"repositories_count", len(cfg.Repositories))
 
-	jClient := jenkins.NewClient(cfg.Jenkins.BaseURL, cfg.Jenkins.Username, cfg.Jenkins.APIToken, nil, logger)
-	gClient := gitea.NewClient(cfg.Gitea.BaseURL, cfg.Gitea.Token, nil, logger)
+	jClient := jenkins.NewClient(cfg.Jenkins.BaseURL, cfg.Jenkins.Username, cfg.Jenkins.APIToken, httpclient.New(cfg.Jenkins.ConnectTimeout), logger)
+	gClient := gitea.NewClient(cfg.Gitea.BaseURL, cfg.Gitea.Token, httpclient.New(cfg.Gitea.ConnectTimeout), logger)
+	jClient.SetAuthMode(cfg.Jenkins.AuthMode)
+	jClient.SetRequestTimeout(cfg.Jenkins.RequestTimeout)
+	jClient.SetMaxTransientErrors(cfg.Jenkins.MaxTransientErrors)
+	jClient.SetRetryStatusCodes(cfg.Server.RetryStatusCodes)
+	gClient.SetConflictRetries(cfg.Gitea.ConflictRetries)
+	gClient.SetRequestTimeout(cfg.Gitea.RequestTimeout)
+	gClient.SetRetryStatusCodes(cfg.Server.RetryStatusCodes)
+
+	if selfTest := cfg.Server.StartupSelfTest; selfTest.Repo != "" && !cfg.Server.DryRun {
+		logger.Info("running startup self-test", "repo", selfTest.Repo, "issue_index", selfTest.IssueIndex)
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err := gClient.SelfTest(ctx, selfTest.Repo, selfTest.IssueIndex)
+		cancel()
+		if err != nil {
+			logger.Error("startup self-test failed", "err", err)
+			os.Exit(1)
+		}
+		logger.Info("startup self-test passed")
+	}
 
 	logger.Info("initializing processor and server")
 	proc := processor.New(cfg, jClient, gClient, logger)
+	if len(cfg.JenkinsInstances) > 0 {
+		instances := make(map[string]processor.JenkinsClient, len(cfg.JenkinsInstances))
+		for name, instance := range cfg.JenkinsInstances {
+			client := jenkins.NewClient(instance.BaseURL, instance.Username, instance.APIToken, httpclient.New(instance.ConnectTimeout), logger.With("jenkins_instance", name))
+			client.SetAuthMode(instance.AuthMode)
+			client.SetRequestTimeout(instance.RequestTimeout)
+			client.SetMaxTransientErrors(instance.MaxTransientErrors)
+			client.SetRetryStatusCodes(cfg.Server.RetryStatusCodes)
+			instances[name] = client
+		}
+		proc.SetJenkinsInstances(instances)
+	}
+	proc.SetGiteaFactory(func(baseURL, token string) processor.GiteaClient {
+		client := gitea.NewClient(baseURL, token, httpclient.New(cfg.Gitea.ConnectTimeout), logger.With("gitea_base_url", baseURL))
+		client.SetConflictRetries(cfg.Gitea.ConflictRetries)
+		client.SetRequestTimeout(cfg.Gitea.RequestTimeout)
+		client.SetRetryStatusCodes(cfg.Server.RetryStatusCodes)
+		return client
+	})
+	if len(cfg.Notifiers) > 0 {
+		notifiers := make(map[string]processor.Notifier, len(cfg.Notifiers))
+		for name, n := range cfg.Notifiers {
+			notifiers[name] = notifier.New(name, n.URL, n.Secret, nil, logger.With("notifier", name))
+		}
+		proc.SetNotifiers(notifiers)
+	}
+	if cfg.Sink.URL != "" {
+		proc.SetSink(sink.New(cfg.Sink.URL, cfg.Sink.Secret, cfg.Sink.MaxRetries, cfg.Server.RetryBackoff, nil, logger.With("component", "sink")))
+	}
 	srv := server.New(cfg, proc, logger)
+	srv.SetDependencies(map[string]server.Dependency{
+		"jenkins": jClient,
+		"gitea":   gClient,
+		"jenkins_auth": server.DependencyFunc(func(context.Context) error {
+			return proc.JenkinsAuthError()
+		}),
+	})
+	var webhookLog *wal.Log
+	if path := cfg.Server.WALFile; path != "" {
+		webhookLog, err = wal.Open(path)
+		if err != nil {
+			logger.Error("failed to open webhook wal", "err", err, "path", path)
+			os.Exit(1)
+		}
+		logger.Info("webhook wal opened", "path", path, "pending", len(webhookLog.Pending()))
+		srv.SetWAL(webhookLog)
+	}
 
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
+	var watchers sync.WaitGroup
+	if cfg.RuleSource.URL != "" {
+		source := config.NewHTTPRuleSource(cfg.RuleSource.URL, cfg.RuleSource.Token, nil)
+		watchers.Add(1)
+		go func() {
+			defer watchers.Done()
+			srv.WatchRules(ctx, source, cfg.RuleSource.Interval)
+		}()
+		logger.Info("watching remote repository rules", "url", cfg.RuleSource.URL, "interval", cfg.RuleSource.Interval)
+	}
+
+	if cfg.Path != "" {
+		reloads := make(chan os.Signal, 1)
+		signal.Notify(reloads, syscall.SIGHUP)
+		defer signal.Stop(reloads)
+		watchers.Add(1)
+		go func() {
+			defer watchers.Done()
+			srv.WatchReloadSignals(ctx, reloads)
+		}()
+	}
+
+	if path := cfg.Server.MetricsStateFile; path != "" {
+		if err := metrics.LoadFile(path); err != nil {
+			logger.Error("failed to restore metrics, counters start from zero", "err", err, "path", path)
+		} else {
+			logger.Info("metrics restored", "path", path, "persist_interval", cfg.Server.MetricsPersistInterval)
+		}
+		watchers.Add(1)
+		go func() {
+			defer watchers.Done()
+			metrics.Persist(ctx, path, cfg.Server.MetricsPersistInterval, logger)
+		}()
+	}
+
 	logger.Info("webhook service started successfully")
-	if err := srv.Run(ctx); err != nil {
+	err = srv.Run(ctx)
+	stop()
+	watchers.Wait()
+	if path := cfg.Server.MetricsStateFile; path != "" {
+		// Saved after the processor has drained, so events finished during shutdown are counted.
+		if err := metrics.SaveFile(path); err != nil {
+			logger.Error("failed to persist metrics", "err", err, "path", path)
+		}
+	}
+	if webhookLog != nil {
+		if err := webhookLog.Close(); err != nil {
+			logger.Error("failed to close webhook wal", "err", err)
+		}
+	}
+	if err != nil {
 		logger.Error("server terminated with error", "err", err)
 		os.Exit(1)
 	}
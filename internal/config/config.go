@@ -5,17 +5,126 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"strings"
+	"text/template"
 	"time"
+	_ "time/tzdata" // server.timezone must resolve in minimal images without system zoneinfo
+	"unicode"
 
 	"gopkg.in/yaml.v3"
 )
 
+// Допустимые значения server.log_format.
+const (
+	LogFormatText = "text" // Текстовый формат slog (key=value), удобен при локальной разработке
+	LogFormatJSON = "json" // JSON-формат для систем сбора журналов (Loki, ELK)
+)
+
+// Допустимые значения server.reload_in_flight.
+const (
+	ReloadInFlightPin     = "pin"          // Событие обрабатывается по правилу, действовавшему при начале обработки
+	ReloadInFlightRefresh = "refresh_rule" // Комментарий формируется по правилу из текущей конфигурации
+)
+
+// Допустимые значения server.zero_pr_number.
+const (
+	ZeroPRNumberReject    = "reject"    // Отклонить событие с ответом 400
+	ZeroPRNumberSkip      = "skip"      // Принять событие, но не обрабатывать его
+	ZeroPRNumberSynthetic = "synthetic" // Обработать событие с индексом, вычисленным по репозиторию и заголовку
+)
+
+// Допустимые значения server.duplicate_repositories.
+const (
+	DuplicateRepositoriesError = "error" // Повторяющееся имя репозитория - ошибка конфигурации
+	DuplicateRepositoriesFirst = "first" // Используется первое правило с этим именем
+	DuplicateRepositoriesLast  = "last"  // Используется последнее правило с этим именем
+)
+
+// Допустимые значения comment_kind правила репозитория.
+const (
+	CommentKindIssueComment = "issue_comment" // Обычный комментарий в обсуждении PR
+	CommentKindReview       = "review"        // Ревью pull request с типом COMMENT
+)
+
+// Допустимые значения match_select правила репозитория.
+const (
+	MatchSelectFirst        = "first"        // Первая совпавшая задача в порядке ответа API Jenkins
+	MatchSelectNewest       = "newest"       // Задача с самой поздней последней сборкой
+	MatchSelectAlphabetical = "alphabetical" // Первая совпавшая задача по полному имени
+)
+
+// Допустимые значения match_order правила репозитория.
+const (
+	MatchOrderBFS = "bfs" // Обход вложенных директорий в ширину: предпочтение задачам ближе к корню
+	MatchOrderDFS = "dfs" // Обход вложенных директорий в глубину
+)
+
+// Допустимые значения wait_mode правила репозитория.
+const (
+	WaitModePoll     = "poll"     // Периодический опрос Jenkins до появления задачи
+	WaitModeCallback = "callback" // Ожидание уведомления Jenkins на /jenkins/callback с однократным опросом по таймауту
+)
+
+// Допустимые значения update_strategy правила репозитория.
+const (
+	UpdateStrategyNewEachTime   = "new_each_time"  // Каждый итог публикуется новым комментарием
+	UpdateStrategyOverwrite     = "overwrite"      // Отслеживаемый комментарий PR заменяется последним итогом
+	UpdateStrategyAppendHistory = "append_history" // Итоги дописываются в отслеживаемый комментарий с отметкой времени
+)
+
 // ServerConfig содержит настройки HTTP-сервера.
 type ServerConfig struct {
-	ListenAddr     string `yaml:"listen_addr"`
-	WebhookSecret  string `yaml:"webhook_secret"`
-	WorkerPoolSize int    `yaml:"worker_pool_size"`
-	QueueSize      int    `yaml:"queue_size"`
+	ListenAddr              string         `yaml:"listen_addr"`
+	WebhookSecret           string         `yaml:"webhook_secret"`
+	WorkerPoolSize          int            `yaml:"worker_pool_size"`
+	QueueSize               int            `yaml:"queue_size"`
+	CommentWorkers          int            `yaml:"comment_workers"`    // Число воркеров публикации итоговых комментариев (0 - комментарии публикуют воркеры событий)
+	CommentQueueSize        int            `yaml:"comment_queue_size"` // Размер очереди публикации комментариев (по умолчанию 100)
+	AdminToken              string         `yaml:"admin_token"`
+	ZeroPRNumber            string         `yaml:"zero_pr_number"`            // Поведение при отсутствии номера PR: reject, skip или synthetic
+	MetricsEnabled          bool           `yaml:"metrics_enabled"`           // Публиковать метрики Prometheus на /metrics
+	MetricsStateFile        string         `yaml:"metrics_state_file"`        // Файл, в котором значения счетчиков сохраняются между перезапусками (пустое значение - не сохранять)
+	MetricsPersistInterval  time.Duration  `yaml:"metrics_persist_interval"`  // Период сохранения счетчиков в metrics_state_file (по умолчанию 30s)
+	MetricsExemplars        bool           `yaml:"metrics_exemplars"`         // Добавлять к метрикам exemplars с trace ID событий
+	QueueWarnRatio          float64        `yaml:"queue_warn_ratio"`          // Доля заполнения очереди, при которой выводится предупреждение
+	ReadTimeout             time.Duration  `yaml:"read_timeout"`              // Таймаут чтения запроса целиком
+	WriteTimeout            time.Duration  `yaml:"write_timeout"`             // Таймаут записи ответа
+	IdleTimeout             time.Duration  `yaml:"idle_timeout"`              // Таймаут простоя keep-alive соединения
+	CommentPrefix           string         `yaml:"comment_prefix"`            // Маркер, добавляемый в начало каждого комментария
+	CommentMarker           string         `yaml:"comment_marker"`            // Невидимая метка комментариев сервиса, по которой находится прежний комментарий PR
+	InstanceID              string         `yaml:"instance_id"`               // Идентификатор экземпляра сервиса в метке комментариев; экземпляры обновляют только свои комментарии
+	MaxPatternsPerEvent     int            `yaml:"max_patterns_per_event"`    // Максимальное число шаблонов задач, обрабатываемых для одного события (0 - без ограничения)
+	RetryBudget             int            `yaml:"retry_budget"`              // Суммарное число повторов операций Jenkins и Gitea для одного события (0 - без ограничения)
+	RetryBudgetTime         time.Duration  `yaml:"retry_budget_time"`         // Время от начала обработки события, в течение которого допустимы повторы (0 - без ограничения)
+	RetryBackoff            time.Duration  `yaml:"retry_backoff"`             // Пауза между повторами операций
+	RetryStatusCodes        []int          `yaml:"retry_status_codes"`        // Дополнительные коды ответа Jenkins и Gitea, при которых запрос повторяется
+	ShutdownDelay           time.Duration  `yaml:"shutdown_delay"`            // Время, в течение которого /health отвечает 503 перед остановкой сервера при завершении
+	GitHubCompat            bool           `yaml:"github_compat"`             // Принимать события в формате GitHub (X-GitHub-Event, X-Hub-Signature-256)
+	StartupSelfTest         SelfTestConfig `yaml:"startup_self_test"`         // Проверка публикации комментариев в Gitea при запуске
+	CommentOnOverload       bool           `yaml:"comment_on_overload"`       // Публиковать комментарий в PR, если событие отклонено из-за переполнения очереди
+	OverloadCommentTemplate string         `yaml:"overload_comment_template"` // Шаблон комментария о перегрузке сервиса
+	MaxEventAge             time.Duration  `yaml:"max_event_age"`             // Максимальный возраст события при начале обработки (0 - без ограничения)
+	EventDeadline           time.Duration  `yaml:"event_deadline"`            // Предельное время обработки одного события воркером (0 - без ограничения)
+	AckBeforeEnqueue        bool           `yaml:"ack_before_enqueue"`        // Отвечать 202 сразу после проверки вебхука, ставя событие в очередь из промежуточного буфера
+	IntakeSize              int            `yaml:"intake_size"`               // Размер промежуточного буфера при ack_before_enqueue (0 - равен queue_size)
+	DedupCacheSize          int            `yaml:"dedup_cache_size"`          // Число запоминаемых идентификаторов доставки вебхуков (по умолчанию 1000, -1 - без дедупликации)
+	DedupTTL                time.Duration  `yaml:"dedup_ttl"`                 // Окно, в течение которого повторная доставка не обрабатывается (по умолчанию 10m)
+	JenkinsCallbackToken    string         `yaml:"jenkins_callback_token"`    // Токен в параметре token запросов /jenkins/callback (пустое значение - уведомления не принимаются)
+	MaxGoroutines           int            `yaml:"max_goroutines"`            // Предел фоновых горутин процессора сверх воркеров (0 - без ограничения)
+	DryRun                  bool           `yaml:"dry_run"`                   // Записывать комментарии и статусы в лог вместо публикации в Gitea
+	Timezone                string         `yaml:"timezone"`                  // Часовой пояс IANA для форматирования времени в шаблонах комментариев (по умолчанию UTC)
+	Location                *time.Location `yaml:"-"`                         // Загруженный часовой пояс server.timezone
+	DuplicateRepositories   string         `yaml:"duplicate_repositories"`    // Поведение при повторяющихся именах репозиториев: error, first или last
+	ReloadInFlight          string         `yaml:"reload_in_flight"`          // Правило для событий, обрабатываемых во время перезагрузки: pin или refresh_rule
+	LogFormat               string         `yaml:"log_format"`                // Формат журнала: text (по умолчанию) или json
+	WALFile                 string         `yaml:"wal_file"`                  // Журнал предзаписи принятых вебхуков для воспроизведения после перезапуска (пустое значение - отключен)
+}
+
+// SelfTestConfig задает issue, в котором при запуске публикуется и сразу удаляется проверочный комментарий.
+// Если Repo пуст, проверка отключена.
+type SelfTestConfig struct {
+	Repo       string `yaml:"repo"`        // Тестовый репозиторий в формате owner/name
+	IssueIndex int64  `yaml:"issue_index"` // Номер issue или PR в тестовом репозитории
 }
 
 // JenkinsConfig содержит настройки подключения к Jenkins.
@@ -23,35 +132,153 @@ type JenkinsConfig struct {
 	BaseURL      string        `yaml:"base_url"`
 	Username     string        `yaml:"username"`
 	APIToken     string        `yaml:"api_token"`
+	AuthMode     string        `yaml:"auth_mode"` // Способ аутентификации: basic (по умолчанию) или bearer
 	PollInterval time.Duration `yaml:"poll_interval"`
 	Timeout      time.Duration `yaml:"timeout"`
+	MaxRetries   int           `yaml:"max_retries"` // Число повторов при ошибке обращения к Jenkins
+	// ConnectTimeout ограничивает установку соединения с Jenkins (TCP и TLS);
+	// время самого запроса ограничивается отдельно. 0 - значение по умолчанию (5s).
+	ConnectTimeout time.Duration `yaml:"connect_timeout"`
+	// RequestTimeout ограничивает время одного запроса к API Jenkins, в том числе каждого опроса
+	// при ожидании задачи (общее ожидание ограничивает timeout). 0 - значение по умолчанию (10s).
+	RequestTimeout time.Duration `yaml:"request_timeout"`
+	// MaxTransientErrors - число временных ошибок Jenkins (5xx, ошибка соединения), после которого
+	// ожидание задачи прекращается; до этого ошибка опроса записывается в лог и опрос повторяется.
+	// 0 - значение по умолчанию (3), -1 - ошибка прерывает ожидание сразу.
+	MaxTransientErrors int `yaml:"max_transient_errors"`
 }
 
 // GiteaConfig содержит настройки подключения к Gitea.
 type GiteaConfig struct {
-	BaseURL string `yaml:"base_url"`
-	Token   string `yaml:"token"`
+	BaseURL    string `yaml:"base_url"`
+	Token      string `yaml:"token"`
+	MaxRetries int    `yaml:"max_retries"` // Число повторов при ошибке публикации комментария
+	// ConnectTimeout ограничивает установку соединения с Gitea (TCP и TLS);
+	// время самого запроса ограничивается отдельно. 0 - значение по умолчанию (5s).
+	ConnectTimeout time.Duration `yaml:"connect_timeout"`
+	// RequestTimeout ограничивает время одного запроса к API Gitea. 0 - значение по умолчанию (10s).
+	RequestTimeout time.Duration `yaml:"request_timeout"`
+	// ConflictRetries - число повторов правки комментария после ответа 409 Conflict.
+	// 0 - значение по умолчанию (3), -1 - без повторов.
+	ConflictRetries int `yaml:"conflict_retries"`
+	// RetryMaxInterval ограничивает паузу между повторами публикации комментария: пауза начинается
+	// с server.retry_backoff и удваивается после каждого повтора. 0 - значение по умолчанию (10s).
+	RetryMaxInterval time.Duration `yaml:"retry_max_interval"`
+	// BotUser - логин пользователя Gitea, от имени которого сервис публикует комментарии. Его комментарии
+	// не запускают повторную проверку, даже если содержат retest_command. Пустое значение - без фильтра.
+	BotUser string `yaml:"bot_user"`
+}
+
+// NotifierConfig содержит настройки внешнего получателя уведомлений (Slack, Discord, произвольный webhook).
+type NotifierConfig struct {
+	URL    string `yaml:"url"`    // Адрес, на который отправляется JSON с итогом обработки
+	Secret string `yaml:"secret"` // Секрет для подписи тела запроса (заголовок X-Signature); пустой - без подписи
+}
+
+// SinkConfig содержит настройки экспорта записей об обработанных событиях.
+// Если URL пуст, экспорт отключен.
+type SinkConfig struct {
+	URL        string `yaml:"url"`         // Адрес, на который отправляется JSON-запись о каждом обработанном событии
+	Secret     string `yaml:"secret"`      // Секрет для подписи тела запроса (заголовок X-Signature)
+	MaxRetries int    `yaml:"max_retries"` // Число повторов при ошибке сети или ответе 5xx
+}
+
+// RuleSourceConfig содержит настройки удаленного источника правил репозиториев.
+// Если URL пуст, правила берутся из файла конфигурации.
+type RuleSourceConfig struct {
+	URL      string        `yaml:"url"`      // Адрес, возвращающий JSON-список правил репозиториев
+	Token    string        `yaml:"token"`    // Bearer-токен для запроса (необязательно)
+	Interval time.Duration `yaml:"interval"` // Период опроса источника
+}
+
+// JenkinsTarget описывает задачу, ожидаемую на одном из экземпляров Jenkins.
+type JenkinsTarget struct {
+	Instance   string `yaml:"instance"`    // Имя экземпляра из jenkins_instances; пустое значение - основной Jenkins
+	JobRoot    string `yaml:"job_root"`    // Корневая директория задач на экземпляре
+	JobPattern string `yaml:"job_pattern"` // Шаблон имени задачи
 }
 
 // RepositoryRule определяет правила обработки событий для конкретного репозитория.
 type RepositoryRule struct {
-	Name                   string        `yaml:"name"`
-	JobRoot                string        `yaml:"job_root"`
-	JobPattern             string        `yaml:"job_pattern"`
-	PollInterval           time.Duration `yaml:"poll_interval"`
-	Timeout                time.Duration `yaml:"timeout"`
-	SuccessCommentTemplate string        `yaml:"success_comment_template"`
-	FailureCommentTemplate string        `yaml:"failure_comment_template"`
+	Name                    string            `yaml:"name"`
+	JobRoot                 string            `yaml:"job_root"`
+	JobPattern              string            `yaml:"job_pattern"`
+	JenkinsTargets          []JenkinsTarget   `yaml:"jenkins_targets"`
+	PollInterval            time.Duration     `yaml:"poll_interval"`
+	Timeout                 time.Duration     `yaml:"timeout"`
+	SuccessCommentTemplate  string            `yaml:"success_comment_template"`
+	FailureCommentTemplate  string            `yaml:"failure_comment_template"`
+	JobFoundTemplate        string            `yaml:"job_found_template"`
+	BuildSuccessTemplate    string            `yaml:"build_success_template"`
+	BuildFailureTemplate    string            `yaml:"build_failure_template"`
+	BuildUnstableTemplate   string            `yaml:"build_unstable_template"`
+	MixedOutcomeTemplate    string            `yaml:"mixed_outcome_template"`
+	TimeoutTemplate         string            `yaml:"timeout_template"`
+	ErrorTemplate           string            `yaml:"error_template"`
+	MissingRootTemplate     string            `yaml:"missing_root_template"`
+	AuthErrorTemplate       string            `yaml:"auth_error_template"`
+	MatchTimeout            time.Duration     `yaml:"match_timeout"`
+	SuppressIdentical       bool              `yaml:"suppress_identical_comments"`
+	TreatUnstableAsSuccess  bool              `yaml:"treat_unstable_as_success"`
+	StatusIssueIndex        int64             `yaml:"status_issue_index"`
+	CommentKind             string            `yaml:"comment_kind"`
+	Branches                []string          `yaml:"branches"`
+	IgnoreSenders           []string          `yaml:"ignore_senders"`
+	SkipDrafts              bool              `yaml:"skip_drafts"`
+	SkipLabels              []string          `yaml:"skip_labels"`
+	SkipCommentTemplate     string            `yaml:"skip_comment_template"`
+	MatchSelect             string            `yaml:"match_select"`
+	PostTriggerWait         time.Duration     `yaml:"post_trigger_wait"`
+	WaitForCompletion       bool              `yaml:"wait_for_completion"`
+	RequireSuccess          bool              `yaml:"require_success"`
+	BuildDedupWindow        time.Duration     `yaml:"build_dedup_window"`
+	TriggerBuild            bool              `yaml:"trigger_build"`
+	TriggerJob              string            `yaml:"trigger_job"`
+	TriggerParameters       map[string]string `yaml:"trigger_parameters"`
+	StreamConsoleLog        bool              `yaml:"stream_console_log"`
+	ConsoleLogMaxBytes      int               `yaml:"console_log_max_bytes"`
+	ProgressCommentTemplate string            `yaml:"progress_comment_template"`
+	EmptyTreeGrace          time.Duration     `yaml:"empty_tree_grace"`
+	MaxDepth                int               `yaml:"max_depth"`
+	RootScanLimit           int               `yaml:"root_scan_limit"`
+	MatchOrder              string            `yaml:"match_order"`
+	BadgeURLTemplate        string            `yaml:"badge_url_template"`
+	UpdateStrategy          string            `yaml:"update_strategy"`
+	MaxHistoryEntries       int               `yaml:"max_history_entries"`
+	PlainText               bool              `yaml:"plain_text"`
+	CommitStatus            bool              `yaml:"commit_status"`
+	StatusContext           string            `yaml:"status_context"`
+	GiteaBaseURL            string            `yaml:"gitea_base_url"`
+	GiteaToken              string            `yaml:"gitea_token"`
+	VerboseMatches          bool              `yaml:"verbose_matches"`
+	VerboseMatchesLimit     int               `yaml:"verbose_matches_limit"`
+	Actions                 []string          `yaml:"actions"`
+	Events                  []string          `yaml:"events"`
+	WaitMode                string            `yaml:"wait_mode"`
+	CallbackParameter       string            `yaml:"callback_parameter"`
+	SuccessWhen             string            `yaml:"success_when"`
+	SuccessExpr             *SuccessExpr      `yaml:"-"` // Разобранное выражение success_when (заполняется Validate)
+	MaxCommentsPerMinute    int               `yaml:"max_comments_per_minute"`
+	IncludeMatrix           bool              `yaml:"include_matrix"`
+	MaxConcurrent           int               `yaml:"max_concurrent"`
+	GroupComment            bool              `yaml:"group_comment"`
+	RetestCommand           string            `yaml:"retest_command"`
+	RetestAllowedUsers      []string          `yaml:"retest_allowed_users"`
 }
 
 // Config представляет полную конфигурацию приложения, включая настройки сервера,
 // подключения к внешним сервисам и правила обработки репозиториев.
 type Config struct {
-	Server       ServerConfig      `yaml:"server"`
-	Jenkins      JenkinsConfig     `yaml:"jenkins"`
-	Gitea        GiteaConfig       `yaml:"gitea"`
-	Repositories []RepositoryRule  `yaml:"repositories"`
-	RepoIndex    map[string]RepoID `yaml:"-"`
+	Server           ServerConfig              `yaml:"server"`
+	Jenkins          JenkinsConfig             `yaml:"jenkins"`
+	JenkinsInstances map[string]JenkinsConfig  `yaml:"jenkins_instances"`
+	Gitea            GiteaConfig               `yaml:"gitea"`
+	Notifiers        map[string]NotifierConfig `yaml:"notifiers"`
+	RuleSource       RuleSourceConfig          `yaml:"rule_source"`
+	Sink             SinkConfig                `yaml:"sink"`
+	Repositories     []RepositoryRule          `yaml:"repositories"`
+	RepoIndex        map[string]RepoID         `yaml:"-"`
+	Path             string                    `yaml:"-"` // Путь к файлу, из которого загружена конфигурация
 }
 
 // RepoID представляет идентификатор репозитория с его правилами обработки.
@@ -60,6 +287,7 @@ type RepoID struct {
 }
 
 // Load загружает конфигурацию из YAML файла по указанному пути.
+// Ссылки вида ${NAME} и ${NAME:-default} в строковых значениях заменяются переменными окружения.
 // Выполняет валидацию и построение индекса репозиториев.
 // Возвращает загруженную и валидированную конфигурацию или ошибку.
 func Load(path string) (*Config, error) {
@@ -69,8 +297,16 @@ func Load(path string) (*Config, error) {
 		return nil, fmt.Errorf("read config: %w", err)
 	}
 
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("unmarshal config: %w", err)
+	}
+	if err := expandEnv(&doc); err != nil {
+		return nil, fmt.Errorf("expand environment variables: %w", err)
+	}
+
 	var cfg Config
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
+	if err := doc.Decode(&cfg); err != nil {
 		return nil, fmt.Errorf("unmarshal config: %w", err)
 	}
 
@@ -81,6 +317,7 @@ func Load(path string) (*Config, error) {
 	}
 
 	cfg.buildIndex()
+	cfg.Path = path
 	slog.Info("configuration validated and indexed", "repositories", len(cfg.RepoIndex))
 	return &cfg, nil
 }
@@ -97,6 +334,126 @@ func (c *Config) Validate() error {
 	if c.Server.QueueSize <= 0 {
 		c.Server.QueueSize = 100
 	}
+	for _, code := range c.Server.RetryStatusCodes {
+		if code < 100 || code > 599 {
+			return fmt.Errorf("server.retry_status_codes: invalid HTTP status code %d", code)
+		}
+	}
+	if c.Server.CommentWorkers < 0 {
+		return fmt.Errorf("server.comment_workers must not be negative")
+	}
+	if c.Server.CommentQueueSize < 0 {
+		return fmt.Errorf("server.comment_queue_size must not be negative")
+	}
+	if c.Server.CommentWorkers > 0 && c.Server.CommentQueueSize == 0 {
+		c.Server.CommentQueueSize = 100
+	}
+	if c.Server.MaxGoroutines < 0 {
+		return fmt.Errorf("server.max_goroutines must not be negative")
+	}
+	if c.Server.MetricsPersistInterval < 0 {
+		return fmt.Errorf("server.metrics_persist_interval must not be negative")
+	}
+	if c.Server.MetricsPersistInterval == 0 {
+		c.Server.MetricsPersistInterval = 30 * time.Second
+	}
+	switch {
+	case c.Server.DedupCacheSize == 0:
+		c.Server.DedupCacheSize = 1000
+	case c.Server.DedupCacheSize == -1:
+		c.Server.DedupCacheSize = 0
+	case c.Server.DedupCacheSize < 0:
+		return fmt.Errorf("server.dedup_cache_size must be positive or -1 to disable delivery de-duplication")
+	}
+	switch {
+	case c.Server.DedupTTL == 0:
+		c.Server.DedupTTL = 10 * time.Minute
+	case c.Server.DedupTTL < 0:
+		return fmt.Errorf("server.dedup_ttl must not be negative")
+	}
+	if c.Server.IntakeSize < 0 {
+		return fmt.Errorf("server.intake_size must not be negative")
+	}
+	if c.Server.ReadTimeout <= 0 {
+		c.Server.ReadTimeout = 15 * time.Second
+	}
+	if c.Server.WriteTimeout <= 0 {
+		c.Server.WriteTimeout = 15 * time.Second
+	}
+	if c.Server.IdleTimeout <= 0 {
+		c.Server.IdleTimeout = 60 * time.Second
+	}
+	if c.Server.QueueWarnRatio <= 0 {
+		c.Server.QueueWarnRatio = 0.8
+	}
+	if c.Server.QueueWarnRatio > 1 {
+		return fmt.Errorf("server.queue_warn_ratio must be in (0, 1]")
+	}
+	if c.Server.RetryBudget < 0 || c.Server.RetryBudgetTime < 0 {
+		return fmt.Errorf("server.retry_budget and server.retry_budget_time must not be negative")
+	}
+	if c.Server.Timezone == "" {
+		c.Server.Timezone = "UTC"
+	}
+	loc, err := time.LoadLocation(c.Server.Timezone)
+	if err != nil {
+		return fmt.Errorf("server.timezone: %w", err)
+	}
+	c.Server.Location = loc
+	if c.Server.MaxEventAge < 0 {
+		return fmt.Errorf("server.max_event_age must not be negative")
+	}
+	if c.Server.EventDeadline < 0 {
+		return fmt.Errorf("server.event_deadline must not be negative")
+	}
+	if c.Server.ShutdownDelay < 0 {
+		return fmt.Errorf("server.shutdown_delay must not be negative")
+	}
+	if c.Server.RetryBackoff <= 0 {
+		c.Server.RetryBackoff = time.Second
+	}
+	if c.Server.CommentOnOverload && c.Server.OverloadCommentTemplate == "" {
+		c.Server.OverloadCommentTemplate = "⚠️ CI service is overloaded and could not process this event for PR {{ .Number }}. Please check the Jenkins build status manually."
+	}
+	if c.Server.StartupSelfTest.Repo != "" && c.Server.StartupSelfTest.IssueIndex <= 0 {
+		return fmt.Errorf("server.startup_self_test.issue_index must be positive")
+	}
+	if c.Server.MaxPatternsPerEvent < 0 {
+		return fmt.Errorf("server.max_patterns_per_event must not be negative")
+	}
+	switch c.Server.LogFormat {
+	case "":
+		c.Server.LogFormat = LogFormatText
+	case LogFormatText, LogFormatJSON:
+	default:
+		return fmt.Errorf("server.log_format must be one of %s, %s", LogFormatText, LogFormatJSON)
+	}
+	switch c.Server.ReloadInFlight {
+	case "":
+		c.Server.ReloadInFlight = ReloadInFlightPin
+	case ReloadInFlightPin, ReloadInFlightRefresh:
+	default:
+		return fmt.Errorf("server.reload_in_flight must be one of %s, %s", ReloadInFlightPin, ReloadInFlightRefresh)
+	}
+	switch c.Server.ZeroPRNumber {
+	case "":
+		c.Server.ZeroPRNumber = ZeroPRNumberReject
+	case ZeroPRNumberReject, ZeroPRNumberSkip, ZeroPRNumberSynthetic:
+	default:
+		return fmt.Errorf("server.zero_pr_number must be one of %s, %s, %s", ZeroPRNumberReject, ZeroPRNumberSkip, ZeroPRNumberSynthetic)
+	}
+	if strings.IndexFunc(c.Server.InstanceID, unicode.IsSpace) >= 0 || strings.Contains(c.Server.InstanceID, "--") || strings.Contains(c.Server.InstanceID, ":") {
+		return fmt.Errorf("server.instance_id must not contain whitespace, \"--\" or \":\", got %q", c.Server.InstanceID)
+	}
+
+	switch c.Server.DuplicateRepositories {
+	case "":
+		c.Server.DuplicateRepositories = DuplicateRepositoriesError
+	case DuplicateRepositoriesError, DuplicateRepositoriesFirst, DuplicateRepositoriesLast:
+	default:
+		return fmt.Errorf("server.duplicate_repositories must be one of %s, %s, %s",
+			DuplicateRepositoriesError, DuplicateRepositoriesFirst, DuplicateRepositoriesLast)
+	}
 
 	if c.Jenkins.BaseURL == "" {
 		return fmt.Errorf("jenkins.base_url must be provided")
@@ -107,6 +464,89 @@ func (c *Config) Validate() error {
 	if c.Jenkins.Timeout <= 0 {
 		c.Jenkins.Timeout = 5 * time.Minute
 	}
+	if c.Jenkins.MaxRetries < 0 || c.Gitea.MaxRetries < 0 {
+		return fmt.Errorf("jenkins.max_retries and gitea.max_retries must not be negative")
+	}
+	if c.Jenkins.ConnectTimeout < 0 || c.Gitea.ConnectTimeout < 0 {
+		return fmt.Errorf("jenkins.connect_timeout and gitea.connect_timeout must not be negative")
+	}
+	if c.Jenkins.RequestTimeout < 0 || c.Gitea.RequestTimeout < 0 {
+		return fmt.Errorf("jenkins.request_timeout and gitea.request_timeout must not be negative")
+	}
+	if c.Jenkins.RequestTimeout == 0 {
+		c.Jenkins.RequestTimeout = 10 * time.Second
+	}
+	if c.Gitea.RequestTimeout == 0 {
+		c.Gitea.RequestTimeout = 10 * time.Second
+	}
+	if err := normalizeJenkinsAuthMode(&c.Jenkins, "jenkins"); err != nil {
+		return err
+	}
+	switch {
+	case c.Jenkins.MaxTransientErrors == 0:
+		c.Jenkins.MaxTransientErrors = 3
+	case c.Jenkins.MaxTransientErrors == -1:
+		c.Jenkins.MaxTransientErrors = 0
+	case c.Jenkins.MaxTransientErrors < -1:
+		return fmt.Errorf("jenkins.max_transient_errors must be -1 or greater")
+	}
+	if c.Gitea.RetryMaxInterval < 0 {
+		return fmt.Errorf("gitea.retry_max_interval must not be negative")
+	}
+	if c.Gitea.RetryMaxInterval == 0 {
+		c.Gitea.RetryMaxInterval = 10 * time.Second
+	}
+	switch {
+	case c.Gitea.ConflictRetries == 0:
+		c.Gitea.ConflictRetries = 3
+	case c.Gitea.ConflictRetries == -1:
+		c.Gitea.ConflictRetries = 0
+	case c.Gitea.ConflictRetries < -1:
+		return fmt.Errorf("gitea.conflict_retries must be -1 or greater")
+	}
+
+	for name, instance := range c.JenkinsInstances {
+		if name == "" {
+			return fmt.Errorf("jenkins instance name must not be empty")
+		}
+		if instance.BaseURL == "" {
+			return fmt.Errorf("jenkins_instances.%s.base_url must be provided", name)
+		}
+		if instance.ConnectTimeout < 0 {
+			return fmt.Errorf("jenkins_instances.%s.connect_timeout must not be negative", name)
+		}
+		if instance.RequestTimeout < 0 {
+			return fmt.Errorf("jenkins_instances.%s.request_timeout must not be negative", name)
+		}
+		if instance.RequestTimeout == 0 {
+			instance.RequestTimeout = c.Jenkins.RequestTimeout
+		}
+		if err := normalizeJenkinsAuthMode(&instance, "jenkins_instances."+name); err != nil {
+			return err
+		}
+		switch {
+		case instance.MaxTransientErrors == 0:
+			instance.MaxTransientErrors = c.Jenkins.MaxTransientErrors
+		case instance.MaxTransientErrors == -1:
+			instance.MaxTransientErrors = 0
+		case instance.MaxTransientErrors < -1:
+			return fmt.Errorf("jenkins_instances.%s.max_transient_errors must be -1 or greater", name)
+		}
+		c.JenkinsInstances[name] = instance
+	}
+
+	for name, notifier := range c.Notifiers {
+		if notifier.URL == "" {
+			return fmt.Errorf("notifiers.%s.url must be provided", name)
+		}
+	}
+
+	if c.Sink.MaxRetries < 0 {
+		return fmt.Errorf("sink.max_retries must not be negative")
+	}
+	if c.RuleSource.URL != "" && c.RuleSource.Interval <= 0 {
+		c.RuleSource.Interval = time.Minute
+	}
 
 	if c.Gitea.BaseURL == "" {
 		return fmt.Errorf("gitea.base_url must be provided")
@@ -115,30 +555,410 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("gitea.token must be provided")
 	}
 
+	return c.validateRepositories()
+}
+
+// validateRepositories проверяет правила репозиториев и дополняет их значениями по умолчанию
+// с учетом уже проверенных общих настроек конфигурации.
+func (c *Config) validateRepositories() error {
+	repos, err := dedupeRepositories(c.Repositories, c.Server.DuplicateRepositories)
+	if err != nil {
+		return err
+	}
+	c.Repositories = repos
+
 	for idx := range c.Repositories {
 		if c.Repositories[idx].Name == "" {
 			return fmt.Errorf("repository rule at index %d missing name", idx)
 		}
-		if c.Repositories[idx].JobPattern == "" {
+		if c.Repositories[idx].JobPattern == "" && len(c.Repositories[idx].JenkinsTargets) == 0 {
 			return fmt.Errorf("repository %s must define a job pattern", c.Repositories[idx].Name)
 		}
+		for tIdx, target := range c.Repositories[idx].Targets() {
+			if target.JobPattern == "" {
+				return fmt.Errorf("repository %s jenkins target at index %d must define a job pattern", c.Repositories[idx].Name, tIdx)
+			}
+			if _, ok := c.JenkinsInstances[target.Instance]; target.Instance != "" && !ok {
+				return fmt.Errorf("repository %s references unknown jenkins instance %q", c.Repositories[idx].Name, target.Instance)
+			}
+		}
+		if c.Repositories[idx].StatusIssueIndex < 0 {
+			return fmt.Errorf("repository %s status_issue_index must be positive", c.Repositories[idx].Name)
+		}
+		switch c.Repositories[idx].CommentKind {
+		case "":
+			c.Repositories[idx].CommentKind = CommentKindIssueComment
+		case CommentKindIssueComment:
+		case CommentKindReview:
+			if c.Repositories[idx].StatusIssueIndex > 0 {
+				return fmt.Errorf("repository %s: comment_kind %q cannot be combined with status_issue_index", c.Repositories[idx].Name, CommentKindReview)
+			}
+		default:
+			return fmt.Errorf("repository %s: comment_kind must be %s or %s", c.Repositories[idx].Name, CommentKindIssueComment, CommentKindReview)
+		}
+		switch c.Repositories[idx].MatchSelect {
+		case "":
+			c.Repositories[idx].MatchSelect = MatchSelectFirst
+		case MatchSelectFirst, MatchSelectNewest, MatchSelectAlphabetical:
+		default:
+			return fmt.Errorf("repository %s: match_select must be one of %s, %s, %s",
+				c.Repositories[idx].Name, MatchSelectFirst, MatchSelectNewest, MatchSelectAlphabetical)
+		}
+		if err := c.Repositories[idx].validateTrigger(); err != nil {
+			return fmt.Errorf("repository %s: %w", c.Repositories[idx].Name, err)
+		}
+		if err := c.Repositories[idx].validateConsoleStream(); err != nil {
+			return fmt.Errorf("repository %s: %w", c.Repositories[idx].Name, err)
+		}
+		if c.Repositories[idx].EmptyTreeGrace < 0 {
+			return fmt.Errorf("repository %s empty_tree_grace must not be negative", c.Repositories[idx].Name)
+		}
+		if c.Repositories[idx].BuildDedupWindow < 0 {
+			return fmt.Errorf("repository %s build_dedup_window must not be negative", c.Repositories[idx].Name)
+		}
+		switch {
+		case c.Repositories[idx].MaxDepth == 0:
+			c.Repositories[idx].MaxDepth = 3
+		case c.Repositories[idx].MaxDepth < -1:
+			return fmt.Errorf("repository %s max_depth must be positive or -1 to search only job_root", c.Repositories[idx].Name)
+		}
+		if c.Repositories[idx].RootScanLimit < 0 {
+			return fmt.Errorf("repository %s root_scan_limit must not be negative", c.Repositories[idx].Name)
+		}
+		switch c.Repositories[idx].UpdateStrategy {
+		case "":
+			c.Repositories[idx].UpdateStrategy = UpdateStrategyNewEachTime
+			if c.Server.CommentMarker != "" && c.Repositories[idx].CommentKind != CommentKindReview {
+				c.Repositories[idx].UpdateStrategy = UpdateStrategyOverwrite
+			}
+		case UpdateStrategyNewEachTime:
+		case UpdateStrategyOverwrite, UpdateStrategyAppendHistory:
+			if c.Repositories[idx].CommentKind == CommentKindReview {
+				return fmt.Errorf("repository %s: update_strategy %q cannot be combined with comment_kind %q",
+					c.Repositories[idx].Name, c.Repositories[idx].UpdateStrategy, CommentKindReview)
+			}
+		default:
+			return fmt.Errorf("repository %s: update_strategy must be one of %s, %s, %s",
+				c.Repositories[idx].Name, UpdateStrategyNewEachTime, UpdateStrategyOverwrite, UpdateStrategyAppendHistory)
+		}
+		if c.Repositories[idx].MaxHistoryEntries < 0 {
+			return fmt.Errorf("repository %s max_history_entries must not be negative", c.Repositories[idx].Name)
+		}
+		if c.Repositories[idx].GroupComment && c.Repositories[idx].CommentKind == CommentKindReview {
+			return fmt.Errorf("repository %s: group_comment cannot be combined with comment_kind %q",
+				c.Repositories[idx].Name, CommentKindReview)
+		}
+		if c.Repositories[idx].GiteaToken != "" && c.Repositories[idx].GiteaBaseURL == "" {
+			return fmt.Errorf("repository %s: gitea_token requires gitea_base_url", c.Repositories[idx].Name)
+		}
+		if c.Repositories[idx].VerboseMatchesLimit < 0 {
+			return fmt.Errorf("repository %s verbose_matches_limit must not be negative", c.Repositories[idx].Name)
+		}
+		if c.Repositories[idx].VerboseMatchesLimit == 0 {
+			c.Repositories[idx].VerboseMatchesLimit = 10
+		}
+		if len(c.Repositories[idx].Events) == 0 {
+			c.Repositories[idx].Events = DefaultEvents
+		}
+		for _, event := range c.Repositories[idx].Events {
+			if event != EventPullRequest && event != EventPush && event != EventIssueComment {
+				return fmt.Errorf("repository %s: events must contain only %s, %s or %s, got %q",
+					c.Repositories[idx].Name, EventPullRequest, EventPush, EventIssueComment, event)
+			}
+		}
+		if c.Repositories[idx].RetestCommand == "" {
+			c.Repositories[idx].RetestCommand = DefaultRetestCommand
+		}
+		if strings.IndexFunc(c.Repositories[idx].RetestCommand, unicode.IsSpace) >= 0 {
+			return fmt.Errorf("repository %s: retest_command must not contain whitespace, got %q",
+				c.Repositories[idx].Name, c.Repositories[idx].RetestCommand)
+		}
+		if len(c.Repositories[idx].Actions) == 0 {
+			c.Repositories[idx].Actions = DefaultActions
+		}
+		actions := make([]string, len(c.Repositories[idx].Actions))
+		for i, action := range c.Repositories[idx].Actions {
+			actions[i] = normalizeAction(action)
+		}
+		c.Repositories[idx].Actions = actions
+		if c.Repositories[idx].StatusContext == "" {
+			c.Repositories[idx].StatusContext = "continuous-integration/jenkins"
+		}
+		if c.Repositories[idx].MaxCommentsPerMinute < 0 {
+			return fmt.Errorf("repository %s: max_comments_per_minute must not be negative", c.Repositories[idx].Name)
+		}
+		if c.Repositories[idx].MaxConcurrent < 0 {
+			return fmt.Errorf("repository %s: max_concurrent must not be negative", c.Repositories[idx].Name)
+		}
+		c.Repositories[idx].SuccessExpr = nil
+		if c.Repositories[idx].SuccessWhen != "" {
+			expr, err := ParseSuccessExpr(c.Repositories[idx].SuccessWhen)
+			if err != nil {
+				return fmt.Errorf("repository %s: invalid success_when: %w", c.Repositories[idx].Name, err)
+			}
+			c.Repositories[idx].SuccessExpr = expr
+		}
+		switch c.Repositories[idx].WaitMode {
+		case "":
+			c.Repositories[idx].WaitMode = WaitModePoll
+		case WaitModePoll:
+		case WaitModeCallback:
+			if c.Server.JenkinsCallbackToken == "" {
+				return fmt.Errorf("repository %s: wait_mode %s requires server.jenkins_callback_token", c.Repositories[idx].Name, WaitModeCallback)
+			}
+		default:
+			return fmt.Errorf("repository %s: wait_mode must be %s or %s", c.Repositories[idx].Name, WaitModePoll, WaitModeCallback)
+		}
+		switch c.Repositories[idx].MatchOrder {
+		case "":
+			c.Repositories[idx].MatchOrder = MatchOrderBFS
+		case MatchOrderBFS, MatchOrderDFS:
+		default:
+			return fmt.Errorf("repository %s: match_order must be %s or %s", c.Repositories[idx].Name, MatchOrderBFS, MatchOrderDFS)
+		}
+		if c.Repositories[idx].MatchTimeout < 0 {
+			return fmt.Errorf("repository %s match_timeout must not be negative", c.Repositories[idx].Name)
+		}
 		if c.Repositories[idx].PollInterval <= 0 {
 			c.Repositories[idx].PollInterval = c.Jenkins.PollInterval
 		}
 		if c.Repositories[idx].Timeout <= 0 {
 			c.Repositories[idx].Timeout = c.Jenkins.Timeout
 		}
-		if c.Repositories[idx].SuccessCommentTemplate == "" {
-			c.Repositories[idx].SuccessCommentTemplate = "✅ Jenkins job {{ .JobName }} detected: {{ .JobURL }}"
+		c.Repositories[idx].applyTemplateDefaults()
+	}
+
+	return nil
+}
+
+// Targets возвращает список задач Jenkins, ожидаемых для репозитория. Если jenkins_targets
+// не заданы, возвращает единственную цель на основном Jenkins с job_root и job_pattern правила.
+func (r RepositoryRule) Targets() []JenkinsTarget {
+	if len(r.JenkinsTargets) > 0 {
+		return r.JenkinsTargets
+	}
+	return []JenkinsTarget{{JobRoot: r.JobRoot, JobPattern: r.JobPattern}}
+}
+
+// Способы аутентификации запросов к Jenkins (auth_mode).
+const (
+	JenkinsAuthBasic  = "basic"
+	JenkinsAuthBearer = "bearer"
+)
+
+// normalizeJenkinsAuthMode устанавливает способ аутентификации Jenkins по умолчанию (basic)
+// и проверяет заданное значение. section - имя раздела конфигурации для сообщения об ошибке.
+func normalizeJenkinsAuthMode(j *JenkinsConfig, section string) error {
+	switch j.AuthMode {
+	case "":
+		j.AuthMode = JenkinsAuthBasic
+	case JenkinsAuthBasic, JenkinsAuthBearer:
+	default:
+		return fmt.Errorf("%s.auth_mode must be %s or %s, got %q", section, JenkinsAuthBasic, JenkinsAuthBearer, j.AuthMode)
+	}
+	return nil
+}
+
+// DefaultActions - действия pull request, обрабатываемые, если actions правила не задан.
+var DefaultActions = []string{"opened", "reopened", "synchronized"}
+
+// Типы событий Gitea, допустимые в events правила.
+const (
+	EventPullRequest  = "pull_request"
+	EventPush         = "push"
+	EventIssueComment = "issue_comment" // Комментарий PR с командой повторной проверки (retest_command)
+)
+
+// DefaultRetestCommand - команда повторной проверки PR, если retest_command правила не задан.
+const DefaultRetestCommand = "/retest"
+
+// DefaultEvents - типы событий, обрабатываемые, если events правила не задан.
+var DefaultEvents = []string{EventPullRequest}
+
+// HandlesEvent сообщает, обрабатывает ли правило события Gitea типа event.
+func (r RepositoryRule) HandlesEvent(event string) bool {
+	for _, e := range r.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsRetest сообщает, может ли пользователь login запросить повторную проверку PR командой
+// retest_command. Пустой retest_allowed_users разрешает команду всем.
+func (r RepositoryRule) AllowsRetest(login string) bool {
+	if len(r.RetestAllowedUsers) == 0 {
+		return true
+	}
+	for _, u := range r.RetestAllowedUsers {
+		if u == login {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeAction приводит название действия pull request к принятому в Gitea:
+// "synchronize" (так его называют GitHub и некоторые версии Gitea) - к "synchronized".
+func normalizeAction(action string) string {
+	if action == "synchronize" {
+		return "synchronized"
+	}
+	return action
+}
+
+// HandlesAction сообщает, обрабатывает ли правило действие pull request action.
+func (r RepositoryRule) HandlesAction(action string) bool {
+	action = normalizeAction(action)
+	for _, a := range r.Actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// validateTrigger проверяет настройки запуска сборки: при trigger_build должен быть задан trigger_job,
+// а trigger_job и значения trigger_parameters должны быть корректными шаблонами.
+func (r RepositoryRule) validateTrigger() error {
+	if !r.TriggerBuild {
+		if r.TriggerJob != "" || len(r.TriggerParameters) > 0 {
+			slog.Warn("trigger_job and trigger_parameters are ignored without trigger_build", "repo", r.Name)
+		}
+		return nil
+	}
+	if r.TriggerJob == "" {
+		return fmt.Errorf("trigger_build requires trigger_job")
+	}
+	if _, err := template.New("trigger_job").Parse(r.TriggerJob); err != nil {
+		return fmt.Errorf("invalid trigger_job template: %w", err)
+	}
+	for name, tpl := range r.TriggerParameters {
+		if name == "" {
+			return fmt.Errorf("trigger_parameters must not contain an empty name")
 		}
-		if c.Repositories[idx].FailureCommentTemplate == "" {
-			c.Repositories[idx].FailureCommentTemplate = "⚠️ Jenkins job not detected for PR {{ .Number }} within timeout ({{ .Timeout }})."
+		if _, err := template.New(name).Parse(tpl); err != nil {
+			return fmt.Errorf("invalid trigger_parameters.%s template: %w", name, err)
 		}
 	}
+	return nil
+}
 
+// validateConsoleStream проверяет настройки потоковой публикации консольного вывода и заполняет
+// значения по умолчанию. Вывод публикуется только при ожидании завершения сборки и в обычный комментарий,
+// так как ревью PR нельзя редактировать.
+func (r *RepositoryRule) validateConsoleStream() error {
+	if !r.StreamConsoleLog {
+		return nil
+	}
+	if !r.WaitForCompletion {
+		return fmt.Errorf("stream_console_log requires wait_for_completion")
+	}
+	if r.CommentKind == CommentKindReview {
+		return fmt.Errorf("stream_console_log cannot be combined with comment_kind %q", CommentKindReview)
+	}
+	if r.ConsoleLogMaxBytes < 0 {
+		return fmt.Errorf("console_log_max_bytes must not be negative")
+	}
+	if r.ConsoleLogMaxBytes == 0 {
+		r.ConsoleLogMaxBytes = 16 * 1024
+	}
+	if r.ProgressCommentTemplate == "" {
+		r.ProgressCommentTemplate = "⏳ Jenkins job {{ .JobName }} is building: {{ .JobURL }}"
+	}
 	return nil
 }
 
+// applyTemplateDefaults заполняет шаблоны комментариев, не заданные явно.
+// Шаблоны для конкретных итогов наследуют значения от более общих:
+// build_success_template - от job_found_template, build_unstable_template - от build_failure_template,
+// job_found_template - от success_comment_template,
+// timeout_template и error_template - от failure_comment_template,
+// missing_root_template и auth_error_template - от error_template.
+// Если failure_comment_template не задан, error_template получает собственный текст по умолчанию,
+// так как встроенный failure_comment_template описывает таймаут, а не ошибку Jenkins. Встроенный
+// error_template говорит о недоступности Jenkins, поэтому вместе с ним missing_root_template
+// и auth_error_template получают собственные тексты по умолчанию. Встроенный
+// build_failure_template сообщает о неуспешной сборке, а не наследует текст о найденной задаче.
+// При require_success найденная задача без подтвержденной сборки не считается успехом, поэтому
+// job_found_template получает собственный текст по умолчанию, а build_success_template наследует
+// success_comment_template.
+func (r *RepositoryRule) applyTemplateDefaults() {
+	if r.ErrorTemplate == "" && r.FailureCommentTemplate == "" {
+		r.ErrorTemplate = "❌ Jenkins is unreachable, PR {{ .Number }} could not be checked: {{ .Error }}"
+		if r.MissingRootTemplate == "" {
+			r.MissingRootTemplate = "❌ Jenkins job root {{ .JobRoot }} does not exist, PR {{ .Number }} could not be checked."
+		}
+		if r.AuthErrorTemplate == "" {
+			r.AuthErrorTemplate = "❌ Jenkins rejected the service credentials, PR {{ .Number }} could not be checked: {{ .Error }}"
+		}
+	}
+	if r.SuccessCommentTemplate == "" {
+		r.SuccessCommentTemplate = "✅ Jenkins job {{ .JobName }} detected: {{ .JobURL }}"
+	}
+	if r.FailureCommentTemplate == "" {
+		r.FailureCommentTemplate = "⚠️ Jenkins job not detected for PR {{ .Number }} within timeout ({{ .Timeout }})."
+	}
+	jobFound := r.JobFoundTemplate
+	if jobFound == "" {
+		jobFound = r.SuccessCommentTemplate
+	}
+	if r.BuildSuccessTemplate == "" {
+		r.BuildSuccessTemplate = jobFound
+	}
+	if r.JobFoundTemplate == "" {
+		r.JobFoundTemplate = jobFound
+		if r.RequireSuccess {
+			r.JobFoundTemplate = "⏳ Jenkins job {{ .JobName }} found, no successful build confirmed yet: {{ .JobURL }}"
+		}
+	}
+	if r.BuildFailureTemplate == "" {
+		r.BuildFailureTemplate = "❌ Jenkins job {{ .JobName }} build did not succeed: {{ .JobURL }}"
+	}
+	if r.BuildUnstableTemplate == "" {
+		r.BuildUnstableTemplate = r.BuildFailureTemplate
+	}
+	if r.TimeoutTemplate == "" {
+		r.TimeoutTemplate = r.FailureCommentTemplate
+	}
+	if r.ErrorTemplate == "" {
+		r.ErrorTemplate = r.FailureCommentTemplate
+	}
+	if r.MissingRootTemplate == "" {
+		r.MissingRootTemplate = r.ErrorTemplate
+	}
+	if r.AuthErrorTemplate == "" {
+		r.AuthErrorTemplate = r.ErrorTemplate
+	}
+}
+
+// dedupeRepositories обрабатывает правила с повторяющимися именами согласно policy:
+// DuplicateRepositoriesError возвращает ошибку, DuplicateRepositoriesFirst и DuplicateRepositoriesLast
+// оставляют соответственно первое или последнее правило на месте первого вхождения и пишут предупреждение.
+func dedupeRepositories(rules []RepositoryRule, policy string) ([]RepositoryRule, error) {
+	positions := make(map[string]int, len(rules))
+	result := make([]RepositoryRule, 0, len(rules))
+	for idx, rule := range rules {
+		pos, seen := positions[rule.Name]
+		if !seen || rule.Name == "" {
+			positions[rule.Name] = len(result)
+			result = append(result, rule)
+			continue
+		}
+		switch policy {
+		case DuplicateRepositoriesFirst:
+			slog.Warn("duplicate repository rule ignored, first rule wins", "repo", rule.Name, "index", idx)
+		case DuplicateRepositoriesLast:
+			slog.Warn("duplicate repository rule overrides earlier one, last rule wins", "repo", rule.Name, "index", idx)
+			result[pos] = rule
+		default:
+			return nil, fmt.Errorf("repository %s is defined more than once (index %d)", rule.Name, idx)
+		}
+	}
+	return result, nil
+}
+
 // buildIndex строит индекс репозиториев для быстрого поиска правил по полному имени репозитория.
 func (c *Config) buildIndex() {
 	c.RepoIndex = make(map[string]RepoID, len(c.Repositories))
@@ -3,6 +3,7 @@ package config_test
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -43,10 +44,547 @@ repositories:
 	if cfg.Server.WorkerPoolSize != 4 {
 		t.Fatalf("default worker pool should be 4, got %d", cfg.Server.WorkerPoolSize)
 	}
+	if cfg.Server.ReadTimeout != 15*time.Second || cfg.Server.WriteTimeout != 15*time.Second || cfg.Server.IdleTimeout != time.Minute {
+		t.Fatalf("unexpected default server timeouts: %s/%s/%s", cfg.Server.ReadTimeout, cfg.Server.WriteTimeout, cfg.Server.IdleTimeout)
+	}
 	if cfg.Repositories[0].PollInterval != time.Second {
 		t.Fatalf("expected poll interval of 1s, got %s", cfg.Repositories[0].PollInterval)
 	}
+	if cfg.Repositories[0].MatchTimeout != 0 {
+		t.Fatalf("expected match timeout to be disabled by default, got %s", cfg.Repositories[0].MatchTimeout)
+	}
 	if _, ok := cfg.GetRepositoryRule("org/repo"); !ok {
 		t.Fatalf("expected repository rule to be registered")
 	}
 }
+
+func TestLoadExpandsEnvironmentVariables(t *testing.T) {
+	t.Setenv("TEST_GITEA_TOKEN", "gitea-secret")
+	t.Setenv("TEST_JENKINS_TOKEN", "jenkins-secret")
+	t.Setenv("TEST_WEBHOOK_SECRET", "")
+	cfgContent := `
+server:
+  webhook_secret: "${TEST_WEBHOOK_SECRET:-fallback-secret}"
+jenkins:
+  base_url: "${TEST_JENKINS_URL:-https://jenkins.example.com}"
+  api_token: "${TEST_JENKINS_TOKEN}"
+gitea:
+  base_url: "https://${TEST_GITEA_HOST:-gitea.example.com}"
+  token: "${TEST_GITEA_TOKEN}"
+repositories:
+  - name: "org/repo"
+    job_pattern: "^build-{{ .Number }}$"
+`
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(cfgContent), 0o600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cfg.Gitea.Token != "gitea-secret" || cfg.Jenkins.APIToken != "jenkins-secret" {
+		t.Fatalf("tokens were not expanded: %q, %q", cfg.Gitea.Token, cfg.Jenkins.APIToken)
+	}
+	if cfg.Server.WebhookSecret != "fallback-secret" {
+		t.Fatalf("expected default for empty variable, got %q", cfg.Server.WebhookSecret)
+	}
+	if cfg.Jenkins.BaseURL != "https://jenkins.example.com" || cfg.Gitea.BaseURL != "https://gitea.example.com" {
+		t.Fatalf("base URLs were not expanded: %q, %q", cfg.Jenkins.BaseURL, cfg.Gitea.BaseURL)
+	}
+	if rule, _ := cfg.GetRepositoryRule("org/repo"); rule.JobPattern != "^build-{{ .Number }}$" {
+		t.Fatalf("job pattern should be left untouched, got %q", rule.JobPattern)
+	}
+}
+
+func TestLoadFailsOnUnsetEnvironmentVariable(t *testing.T) {
+	cfgContent := `
+jenkins:
+  base_url: "https://jenkins.example.com"
+gitea:
+  base_url: "https://gitea.example.com"
+  token: "${TEST_UNSET_GITEA_TOKEN}"
+repositories:
+  - name: "org/repo"
+    job_pattern: "^build$"
+`
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(cfgContent), 0o600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	_, err := config.Load(path)
+	if err == nil || !strings.Contains(err.Error(), "TEST_UNSET_GITEA_TOKEN") {
+		t.Fatalf("expected error naming the unset variable, got %v", err)
+	}
+}
+
+func TestValidateTemplateFallbacks(t *testing.T) {
+	cfg := &config.Config{
+		Jenkins: config.JenkinsConfig{BaseURL: "https://jenkins.example.com"},
+		Gitea:   config.GiteaConfig{BaseURL: "https://gitea.example.com", Token: "secret"},
+		Repositories: []config.RepositoryRule{
+			{
+				Name:                   "org/repo",
+				JobPattern:             "^build$",
+				SuccessCommentTemplate: "legacy success",
+				FailureCommentTemplate: "legacy failure",
+				BuildFailureTemplate:   "build failed",
+				ErrorTemplate:          "error",
+			},
+		},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+
+	rule := cfg.Repositories[0]
+	checks := map[string][2]string{
+		"job_found_template":      {rule.JobFoundTemplate, "legacy success"},
+		"build_success_template":  {rule.BuildSuccessTemplate, "legacy success"},
+		"build_failure_template":  {rule.BuildFailureTemplate, "build failed"},
+		"build_unstable_template": {rule.BuildUnstableTemplate, "build failed"},
+		"timeout_template":        {rule.TimeoutTemplate, "legacy failure"},
+		"error_template":          {rule.ErrorTemplate, "error"},
+	}
+	for name, c := range checks {
+		if c[0] != c[1] {
+			t.Errorf("%s: expected %q, got %q", name, c[1], c[0])
+		}
+	}
+}
+
+func TestValidateDefaultBuildFailureTemplate(t *testing.T) {
+	cfg := &config.Config{
+		Jenkins:      config.JenkinsConfig{BaseURL: "https://jenkins.example.com"},
+		Gitea:        config.GiteaConfig{BaseURL: "https://gitea.example.com", Token: "secret"},
+		Repositories: []config.RepositoryRule{{Name: "org/repo", JobPattern: "^build$"}},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+
+	rule := cfg.Repositories[0]
+	for name, tpl := range map[string]string{
+		"build_failure_template":  rule.BuildFailureTemplate,
+		"build_unstable_template": rule.BuildUnstableTemplate,
+	} {
+		if tpl == rule.JobFoundTemplate || strings.Contains(tpl, "✅") {
+			t.Errorf("%s must not default to the success text, got %q", name, tpl)
+		}
+	}
+}
+
+func TestValidateRejectsUnknownJenkinsInstance(t *testing.T) {
+	cfg := &config.Config{
+		Jenkins: config.JenkinsConfig{BaseURL: "https://jenkins.example.com"},
+		JenkinsInstances: map[string]config.JenkinsConfig{
+			"deploy": {BaseURL: "https://deploy.example.com"},
+		},
+		Gitea: config.GiteaConfig{BaseURL: "https://gitea.example.com", Token: "secret"},
+		Repositories: []config.RepositoryRule{
+			{
+				Name: "org/repo",
+				JenkinsTargets: []config.JenkinsTarget{
+					{Instance: "deploy", JobPattern: "^deploy$"},
+					{Instance: "build", JobPattern: "^build$"},
+				},
+			},
+		},
+	}
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected error for unknown jenkins instance")
+	}
+}
+
+func TestValidateTriggerParameters(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    config.RepositoryRule
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			rule: config.RepositoryRule{TriggerBuild: true, TriggerJob: "org/PR-{{ .Number }}",
+				TriggerParameters: map[string]string{"BRANCH": "{{ .SourceBranch }}"}},
+		},
+		{
+			name:    "missing job",
+			rule:    config.RepositoryRule{TriggerBuild: true},
+			wantErr: true,
+		},
+		{
+			name: "invalid parameter template",
+			rule: config.RepositoryRule{TriggerBuild: true, TriggerJob: "org/build",
+				TriggerParameters: map[string]string{"BRANCH": "{{ .SourceBranch"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.rule.Name, tt.rule.JobPattern = "org/repo", "^build$"
+			cfg := &config.Config{
+				Jenkins:      config.JenkinsConfig{BaseURL: "https://jenkins.example.com"},
+				Gitea:        config.GiteaConfig{BaseURL: "https://gitea.example.com", Token: "secret"},
+				Repositories: []config.RepositoryRule{tt.rule},
+			}
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected validation result: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateRejectsUnknownTimezone(t *testing.T) {
+	cfg := &config.Config{
+		Server:  config.ServerConfig{Timezone: "Mars/Olympus_Mons"},
+		Jenkins: config.JenkinsConfig{BaseURL: "https://jenkins.example.com"},
+		Gitea:   config.GiteaConfig{BaseURL: "https://gitea.example.com", Token: "secret"},
+	}
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected error for unknown timezone")
+	}
+}
+
+func TestValidateMaxDepth(t *testing.T) {
+	tests := []struct {
+		depth   int
+		want    int
+		wantErr bool
+	}{
+		{depth: 0, want: 3},
+		{depth: 5, want: 5},
+		{depth: -1, want: -1},
+		{depth: -2, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		cfg := &config.Config{
+			Jenkins:      config.JenkinsConfig{BaseURL: "https://jenkins.example.com"},
+			Gitea:        config.GiteaConfig{BaseURL: "https://gitea.example.com", Token: "secret"},
+			Repositories: []config.RepositoryRule{{Name: "org/repo", JobPattern: "^job$", MaxDepth: tt.depth}},
+		}
+		err := cfg.Validate()
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("max_depth %d: unexpected error %v", tt.depth, err)
+		}
+		if err == nil && cfg.Repositories[0].MaxDepth != tt.want {
+			t.Fatalf("max_depth %d: expected %d, got %d", tt.depth, tt.want, cfg.Repositories[0].MaxDepth)
+		}
+	}
+}
+
+func TestValidateDuplicateRepositories(t *testing.T) {
+	tests := []struct {
+		policy  string
+		wantErr bool
+		want    string
+	}{
+		{policy: "", wantErr: true},
+		{policy: config.DuplicateRepositoriesError, wantErr: true},
+		{policy: config.DuplicateRepositoriesFirst, want: "^first$"},
+		{policy: config.DuplicateRepositoriesLast, want: "^last$"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			cfg := &config.Config{
+				Server:  config.ServerConfig{DuplicateRepositories: tt.policy},
+				Jenkins: config.JenkinsConfig{BaseURL: "https://jenkins.example.com"},
+				Gitea:   config.GiteaConfig{BaseURL: "https://gitea.example.com", Token: "secret"},
+				Repositories: []config.RepositoryRule{
+					{Name: "org/repo", JobPattern: "^first$"},
+					{Name: "org/other", JobPattern: "^other$"},
+					{Name: "org/repo", JobPattern: "^last$"},
+				},
+			}
+			err := cfg.Validate()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error for duplicate repository")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(cfg.Repositories) != 2 {
+				t.Fatalf("expected duplicates to be collapsed, got %d rules", len(cfg.Repositories))
+			}
+			rule, ok := cfg.GetRepositoryRule("org/repo")
+			if !ok || rule.JobPattern != tt.want {
+				t.Fatalf("expected pattern %s, got %q", tt.want, rule.JobPattern)
+			}
+		})
+	}
+}
+
+func TestSuccessExpr(t *testing.T) {
+	green := config.JobFacts{Name: "PR-12", Color: "blue", Result: "SUCCESS"}
+	unstable := config.JobFacts{Name: "PR-12", Color: "yellow", Result: "UNSTABLE"}
+	nightly := config.JobFacts{Name: "nightly", Color: "blue", Result: "SUCCESS"}
+
+	tests := []struct {
+		expr  string
+		facts config.JobFacts
+		want  bool
+	}{
+		{expr: `color == blue`, facts: green, want: true},
+		{expr: `result == SUCCESS`, facts: unstable, want: false},
+		{expr: `result != FAILURE`, facts: unstable, want: true},
+		{expr: `name matches "^PR-\d+$" AND color == blue`, facts: green, want: true},
+		{expr: `name matches "^PR-\d+$" AND color == blue`, facts: nightly, want: false},
+		{expr: `result == SUCCESS OR result == unstable`, facts: unstable, want: true},
+		{expr: `name matches ^PR- && result == SUCCESS || name matches nightly`, facts: nightly, want: true},
+		{expr: `name matches ^PR- && result == SUCCESS || name matches nightly`, facts: unstable, want: false},
+	}
+	for _, tt := range tests {
+		expr, err := config.ParseSuccessExpr(tt.expr)
+		if err != nil {
+			t.Fatalf("parse %q: %v", tt.expr, err)
+		}
+		if got := expr.Eval(tt.facts); got != tt.want {
+			t.Fatalf("%q on %+v: expected %t, got %t", tt.expr, tt.facts, tt.want, got)
+		}
+	}
+
+	for _, bad := range []string{
+		``,
+		`color = blue`,
+		`name == PR-1`,
+		`status == SUCCESS`,
+		`color == blue AND`,
+		`color == blue XOR result == SUCCESS`,
+		`name matches "(unclosed"`,
+		`name matches "PR-1`,
+	} {
+		if _, err := config.ParseSuccessExpr(bad); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestValidateCompilesSuccessWhen(t *testing.T) {
+	cfg := &config.Config{
+		Jenkins: config.JenkinsConfig{BaseURL: "https://jenkins.example.com"},
+		Gitea:   config.GiteaConfig{BaseURL: "https://gitea.example.com", Token: "secret"},
+		Repositories: []config.RepositoryRule{
+			{Name: "org/repo", JobPattern: "^build$", SuccessWhen: "result == UNSTABLE"},
+			{Name: "org/other", JobPattern: "^build$"},
+		},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+	if expr := cfg.Repositories[0].SuccessExpr; expr == nil || !expr.Eval(config.JobFacts{Result: "UNSTABLE"}) {
+		t.Fatalf("expected success_when to be compiled on the rule, got %+v", expr)
+	}
+	if cfg.Repositories[1].SuccessExpr != nil {
+		t.Fatalf("expected no expression without success_when")
+	}
+}
+
+func TestValidateRequestTimeouts(t *testing.T) {
+	cfg := &config.Config{
+		Jenkins: config.JenkinsConfig{BaseURL: "https://jenkins.example.com", RequestTimeout: 45 * time.Second},
+		JenkinsInstances: map[string]config.JenkinsConfig{
+			"deploy": {BaseURL: "https://deploy.example.com"},
+			"fast":   {BaseURL: "https://fast.example.com", RequestTimeout: 2 * time.Second},
+		},
+		Gitea: config.GiteaConfig{BaseURL: "https://gitea.example.com", Token: "secret"},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+	if cfg.Jenkins.RequestTimeout != 45*time.Second || cfg.Gitea.RequestTimeout != 10*time.Second {
+		t.Fatalf("unexpected request timeouts: jenkins %v, gitea %v", cfg.Jenkins.RequestTimeout, cfg.Gitea.RequestTimeout)
+	}
+	if got := cfg.JenkinsInstances["deploy"].RequestTimeout; got != 45*time.Second {
+		t.Fatalf("expected instance to inherit jenkins.request_timeout, got %v", got)
+	}
+	if got := cfg.JenkinsInstances["fast"].RequestTimeout; got != 2*time.Second {
+		t.Fatalf("expected instance request_timeout to be kept, got %v", got)
+	}
+
+	cfg.Gitea.RequestTimeout = -time.Second
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected error for negative gitea.request_timeout")
+	}
+}
+
+func TestValidateJenkinsAuthMode(t *testing.T) {
+	cfg := &config.Config{
+		Jenkins: config.JenkinsConfig{BaseURL: "https://jenkins.example.com", AuthMode: config.JenkinsAuthBearer},
+		JenkinsInstances: map[string]config.JenkinsConfig{
+			"deploy": {BaseURL: "https://deploy.example.com"},
+		},
+		Gitea: config.GiteaConfig{BaseURL: "https://gitea.example.com", Token: "secret"},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+	if got := cfg.JenkinsInstances["deploy"].AuthMode; got != config.JenkinsAuthBasic {
+		t.Fatalf("expected instance auth_mode to default to basic, got %q", got)
+	}
+
+	cfg.Jenkins.AuthMode = "token"
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected error for unknown jenkins.auth_mode")
+	}
+}
+
+func TestValidateCallbackWaitModeRequiresToken(t *testing.T) {
+	cfg := &config.Config{
+		Jenkins: config.JenkinsConfig{BaseURL: "https://jenkins.example.com"},
+		Gitea:   config.GiteaConfig{BaseURL: "https://gitea.example.com", Token: "secret"},
+		Repositories: []config.RepositoryRule{
+			{Name: "org/repo", JobPattern: "^build$", WaitMode: config.WaitModeCallback},
+		},
+	}
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected error for wait_mode callback without jenkins_callback_token")
+	}
+
+	cfg.Server.JenkinsCallbackToken = "cb"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+}
+
+func TestValidateInstanceID(t *testing.T) {
+	for _, id := range []string{"prod", "eu-west.1"} {
+		cfg := &config.Config{
+			Jenkins: config.JenkinsConfig{BaseURL: "https://jenkins.example.com"},
+			Gitea:   config.GiteaConfig{BaseURL: "https://gitea.example.com", Token: "secret"},
+			Server:  config.ServerConfig{InstanceID: id},
+		}
+		if err := cfg.Validate(); err != nil {
+			t.Fatalf("instance_id %q: unexpected validation error: %v", id, err)
+		}
+	}
+	for _, id := range []string{"prod env", "a--b", "prod:1"} {
+		cfg := &config.Config{
+			Jenkins: config.JenkinsConfig{BaseURL: "https://jenkins.example.com"},
+			Gitea:   config.GiteaConfig{BaseURL: "https://gitea.example.com", Token: "secret"},
+			Server:  config.ServerConfig{InstanceID: id},
+		}
+		if err := cfg.Validate(); err == nil {
+			t.Fatalf("expected error for instance_id %q", id)
+		}
+	}
+}
+
+func TestValidateInstanceIDKeepsDefaultUpdateStrategy(t *testing.T) {
+	cfg := &config.Config{
+		Jenkins:      config.JenkinsConfig{BaseURL: "https://jenkins.example.com"},
+		Gitea:        config.GiteaConfig{BaseURL: "https://gitea.example.com", Token: "secret"},
+		Server:       config.ServerConfig{InstanceID: "prod"},
+		Repositories: []config.RepositoryRule{{Name: "org/repo", JobPattern: "^PR-{{ .Number }}$"}},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+	if got := cfg.Repositories[0].UpdateStrategy; got != config.UpdateStrategyNewEachTime {
+		t.Fatalf("expected instance_id to keep update_strategy %q, got %q", config.UpdateStrategyNewEachTime, got)
+	}
+}
+
+func TestValidateCommentWorkers(t *testing.T) {
+	cfg := &config.Config{
+		Jenkins: config.JenkinsConfig{BaseURL: "https://jenkins.example.com"},
+		Gitea:   config.GiteaConfig{BaseURL: "https://gitea.example.com", Token: "secret"},
+		Server:  config.ServerConfig{CommentWorkers: 2},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+	if cfg.Server.CommentQueueSize != 100 {
+		t.Fatalf("expected default comment_queue_size 100, got %d", cfg.Server.CommentQueueSize)
+	}
+
+	cfg.Server.CommentWorkers = -1
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected error for negative server.comment_workers")
+	}
+}
+
+func TestWithRulesKeepsDisabledLimits(t *testing.T) {
+	cfg := &config.Config{
+		Jenkins: config.JenkinsConfig{BaseURL: "https://jenkins.example.com", MaxTransientErrors: -1},
+		Gitea:   config.GiteaConfig{BaseURL: "https://gitea.example.com", Token: "secret", ConflictRetries: -1},
+		Server:  config.ServerConfig{DedupCacheSize: -1},
+		JenkinsInstances: map[string]config.JenkinsConfig{
+			"deploy": {BaseURL: "https://deploy.example.com", MaxTransientErrors: -1},
+		},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+	rules := []config.RepositoryRule{{Name: "org/repo", JobPattern: "^PR-{{ .Number }}$"}}
+	next := cfg
+	for i := 0; i < 2; i++ {
+		var err error
+		if next, err = next.WithRules(rules); err != nil {
+			t.Fatalf("apply rules: %v", err)
+		}
+	}
+	if next.Server.DedupCacheSize != 0 || next.Jenkins.MaxTransientErrors != 0 || next.Gitea.ConflictRetries != 0 ||
+		next.JenkinsInstances["deploy"].MaxTransientErrors != 0 {
+		t.Fatalf("disabled limits were re-enabled: dedup %d, transient %d, conflicts %d, instance transient %d",
+			next.Server.DedupCacheSize, next.Jenkins.MaxTransientErrors, next.Gitea.ConflictRetries,
+			next.JenkinsInstances["deploy"].MaxTransientErrors)
+	}
+	if rule, ok := next.GetRepositoryRule("org/repo"); !ok || rule.Timeout == 0 {
+		t.Fatalf("expected validated rule with defaults, got %+v (found %v)", rule, ok)
+	}
+}
+
+func TestValidateRetryStatusCodes(t *testing.T) {
+	cfg := &config.Config{
+		Jenkins: config.JenkinsConfig{BaseURL: "https://jenkins.example.com"},
+		Gitea:   config.GiteaConfig{BaseURL: "https://gitea.example.com", Token: "secret"},
+		Server:  config.ServerConfig{RetryStatusCodes: []int{499, 520}},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+	cfg.Server.RetryStatusCodes = []int{5200}
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected error for invalid status code")
+	}
+}
+
+func TestValidateDedupCache(t *testing.T) {
+	tests := []struct {
+		size     int
+		wantSize int
+		wantErr  bool
+	}{
+		{size: 0, wantSize: 1000},
+		{size: 50, wantSize: 50},
+		{size: -1, wantSize: 0},
+		{size: -2, wantErr: true},
+	}
+	for _, tt := range tests {
+		cfg := &config.Config{
+			Jenkins: config.JenkinsConfig{BaseURL: "https://jenkins.example.com"},
+			Gitea:   config.GiteaConfig{BaseURL: "https://gitea.example.com", Token: "secret"},
+			Server:  config.ServerConfig{DedupCacheSize: tt.size},
+		}
+		err := cfg.Validate()
+		if tt.wantErr {
+			if err == nil {
+				t.Fatalf("dedup_cache_size %d: expected error", tt.size)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("dedup_cache_size %d: unexpected validation error: %v", tt.size, err)
+		}
+		if cfg.Server.DedupCacheSize != tt.wantSize || cfg.Server.DedupTTL != 10*time.Minute {
+			t.Fatalf("dedup_cache_size %d: got size %d, ttl %v", tt.size, cfg.Server.DedupCacheSize, cfg.Server.DedupTTL)
+		}
+	}
+}
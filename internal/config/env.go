@@ -0,0 +1,56 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envRef соответствует ссылке на переменную окружения: ${NAME} или ${NAME:-default}.
+var envRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// expandEnv подставляет значения переменных окружения во все строковые значения разобранного YAML.
+// Для ${NAME:-default} значение по умолчанию используется, если переменная не задана или пуста.
+// Возвращает ошибку, если переменная без значения по умолчанию не задана.
+func expandEnv(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		expanded, err := expandEnvString(node.Value)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", node.Line, err)
+		}
+		node.Value = expanded
+		return nil
+	}
+	for _, child := range node.Content {
+		if err := expandEnv(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expandEnvString подставляет переменные окружения в одну строку.
+func expandEnvString(s string) (string, error) {
+	var missing string
+	expanded := envRef.ReplaceAllStringFunc(s, func(ref string) string {
+		m := envRef.FindStringSubmatch(ref)
+		name, hasDefault := m[1], strings.Contains(ref, ":-")
+		if value, ok := os.LookupEnv(name); ok && (value != "" || !hasDefault) {
+			return value
+		}
+		if hasDefault {
+			return m[2]
+		}
+		if missing == "" {
+			missing = name
+		}
+		return ref
+	})
+	if missing != "" {
+		return "", fmt.Errorf("environment variable %s is not set and has no default", missing)
+	}
+	return expanded, nil
+}
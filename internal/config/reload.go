@@ -0,0 +1,143 @@
+package config
+
+import (
+	"reflect"
+	"sort"
+)
+
+// RepoDiff описывает изменения правил репозиториев между двумя конфигурациями.
+type RepoDiff struct {
+	Added   []string `json:"added"`   // Репозитории, появившиеся в новой конфигурации
+	Removed []string `json:"removed"` // Репозитории, удаленные из конфигурации
+	Changed []string `json:"changed"` // Репозитории, правила которых изменились
+	Ignored []string `json:"ignored"` // Измененные поля, которые не применяются без перезапуска
+}
+
+// Diff сравнивает правила репозиториев текущей и новой конфигурации.
+// Списки в результате отсортированы по имени репозитория.
+func Diff(prev, next *Config) RepoDiff {
+	diff := RepoDiff{Added: []string{}, Removed: []string{}, Changed: []string{}, Ignored: []string{}}
+
+	prevRules := make(map[string]RepositoryRule, len(prev.Repositories))
+	for _, rule := range prev.Repositories {
+		prevRules[rule.Name] = rule
+	}
+	nextRules := make(map[string]RepositoryRule, len(next.Repositories))
+	for _, rule := range next.Repositories {
+		nextRules[rule.Name] = rule
+	}
+
+	for name, rule := range nextRules {
+		old, ok := prevRules[name]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, name)
+		case !reflect.DeepEqual(old, rule):
+			diff.Changed = append(diff.Changed, name)
+		}
+	}
+	for name := range prevRules {
+		if _, ok := nextRules[name]; !ok {
+			diff.Removed = append(diff.Removed, name)
+		}
+	}
+
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Changed)
+	return diff
+}
+
+// KeepStaticFrom переносит из prev настройки, которые нельзя изменить без перезапуска
+// (адрес прослушивания, размер пула воркеров и очередей, режим dry_run, подключения к Jenkins и Gitea),
+// и возвращает имена полей, значения которых в новой конфигурации отличались и были проигнорированы.
+func (c *Config) KeepStaticFrom(prev *Config) []string {
+	ignored := []string{}
+	if c.Server.ListenAddr != prev.Server.ListenAddr {
+		ignored = append(ignored, "server.listen_addr")
+		c.Server.ListenAddr = prev.Server.ListenAddr
+	}
+	if c.Server.WorkerPoolSize != prev.Server.WorkerPoolSize {
+		ignored = append(ignored, "server.worker_pool_size")
+		c.Server.WorkerPoolSize = prev.Server.WorkerPoolSize
+	}
+	if c.Server.QueueSize != prev.Server.QueueSize {
+		ignored = append(ignored, "server.queue_size")
+		c.Server.QueueSize = prev.Server.QueueSize
+	}
+	if !reflect.DeepEqual(c.Server.RetryStatusCodes, prev.Server.RetryStatusCodes) {
+		ignored = append(ignored, "server.retry_status_codes")
+		c.Server.RetryStatusCodes = prev.Server.RetryStatusCodes
+	}
+	if c.Server.DedupCacheSize != prev.Server.DedupCacheSize || c.Server.DedupTTL != prev.Server.DedupTTL {
+		ignored = append(ignored, "server.dedup_cache_size")
+		c.Server.DedupCacheSize = prev.Server.DedupCacheSize
+		c.Server.DedupTTL = prev.Server.DedupTTL
+	}
+	if c.Server.CommentWorkers != prev.Server.CommentWorkers || c.Server.CommentQueueSize != prev.Server.CommentQueueSize {
+		ignored = append(ignored, "server.comment_workers")
+		c.Server.CommentWorkers = prev.Server.CommentWorkers
+		c.Server.CommentQueueSize = prev.Server.CommentQueueSize
+	}
+	if c.Server.AckBeforeEnqueue != prev.Server.AckBeforeEnqueue || c.Server.IntakeSize != prev.Server.IntakeSize {
+		ignored = append(ignored, "server.ack_before_enqueue")
+		c.Server.AckBeforeEnqueue = prev.Server.AckBeforeEnqueue
+		c.Server.IntakeSize = prev.Server.IntakeSize
+	}
+	if c.Server.MetricsStateFile != prev.Server.MetricsStateFile || c.Server.MetricsPersistInterval != prev.Server.MetricsPersistInterval {
+		ignored = append(ignored, "server.metrics_state_file")
+		c.Server.MetricsStateFile = prev.Server.MetricsStateFile
+		c.Server.MetricsPersistInterval = prev.Server.MetricsPersistInterval
+	}
+	if c.Server.WALFile != prev.Server.WALFile {
+		ignored = append(ignored, "server.wal_file")
+		c.Server.WALFile = prev.Server.WALFile
+	}
+	if c.Server.LogFormat != prev.Server.LogFormat {
+		ignored = append(ignored, "server.log_format")
+		c.Server.LogFormat = prev.Server.LogFormat
+	}
+	if c.Server.DryRun != prev.Server.DryRun {
+		ignored = append(ignored, "server.dry_run")
+		c.Server.DryRun = prev.Server.DryRun
+	}
+	if c.Server.ReadTimeout != prev.Server.ReadTimeout || c.Server.WriteTimeout != prev.Server.WriteTimeout || c.Server.IdleTimeout != prev.Server.IdleTimeout {
+		ignored = append(ignored, "server timeouts")
+		c.Server.ReadTimeout = prev.Server.ReadTimeout
+		c.Server.WriteTimeout = prev.Server.WriteTimeout
+		c.Server.IdleTimeout = prev.Server.IdleTimeout
+	}
+	if c.Jenkins.BaseURL != prev.Jenkins.BaseURL || c.Jenkins.Username != prev.Jenkins.Username || c.Jenkins.APIToken != prev.Jenkins.APIToken ||
+		c.Jenkins.AuthMode != prev.Jenkins.AuthMode || c.Jenkins.RequestTimeout != prev.Jenkins.RequestTimeout || c.Jenkins.MaxTransientErrors != prev.Jenkins.MaxTransientErrors {
+		ignored = append(ignored, "jenkins")
+		c.Jenkins.BaseURL = prev.Jenkins.BaseURL
+		c.Jenkins.Username = prev.Jenkins.Username
+		c.Jenkins.APIToken = prev.Jenkins.APIToken
+		c.Jenkins.AuthMode = prev.Jenkins.AuthMode
+		c.Jenkins.RequestTimeout = prev.Jenkins.RequestTimeout
+		c.Jenkins.MaxTransientErrors = prev.Jenkins.MaxTransientErrors
+	}
+	if !reflect.DeepEqual(c.JenkinsInstances, prev.JenkinsInstances) {
+		ignored = append(ignored, "jenkins_instances")
+		c.JenkinsInstances = prev.JenkinsInstances
+	}
+	if !reflect.DeepEqual(c.Notifiers, prev.Notifiers) {
+		ignored = append(ignored, "notifiers")
+		c.Notifiers = prev.Notifiers
+	}
+	if c.Sink != prev.Sink {
+		ignored = append(ignored, "sink")
+		c.Sink = prev.Sink
+	}
+	if c.RuleSource != prev.RuleSource {
+		ignored = append(ignored, "rule_source")
+		c.RuleSource = prev.RuleSource
+	}
+	if c.Gitea.BaseURL != prev.Gitea.BaseURL || c.Gitea.Token != prev.Gitea.Token || c.Gitea.RequestTimeout != prev.Gitea.RequestTimeout {
+		ignored = append(ignored, "gitea")
+		c.Gitea.BaseURL = prev.Gitea.BaseURL
+		c.Gitea.Token = prev.Gitea.Token
+		c.Gitea.RequestTimeout = prev.Gitea.RequestTimeout
+	}
+	return ignored
+}
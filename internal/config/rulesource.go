@@ -0,0 +1,95 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RuleSource определяет источник правил репозиториев.
+type RuleSource interface {
+	Rules(ctx context.Context) ([]RepositoryRule, error)
+}
+
+// FileRuleSource загружает правила репозиториев из файла конфигурации.
+type FileRuleSource struct {
+	Path string // Путь к файлу конфигурации
+}
+
+// Rules загружает и валидирует файл конфигурации и возвращает его правила репозиториев.
+func (s FileRuleSource) Rules(ctx context.Context) ([]RepositoryRule, error) {
+	cfg, err := Load(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.Repositories, nil
+}
+
+// HTTPRuleSource загружает правила репозиториев с удаленного HTTP-эндпоинта.
+// Эндпоинт должен возвращать JSON-массив правил с теми же именами полей, что и в файле конфигурации.
+type HTTPRuleSource struct {
+	url        string
+	token      string
+	httpClient *http.Client
+}
+
+// NewHTTPRuleSource создает источник правил для указанного адреса.
+// Если httpClient равен nil, создается клиент с таймаутом 10 секунд.
+func NewHTTPRuleSource(url, token string, httpClient *http.Client) *HTTPRuleSource {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &HTTPRuleSource{url: url, token: token, httpClient: httpClient}
+}
+
+// Rules запрашивает список правил у удаленного эндпоинта. Правила не валидируются:
+// проверка выполняется при применении через Config.WithRules.
+func (s *HTTPRuleSource) Rules(ctx context.Context) ([]RepositoryRule, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("rule source request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read rule source response: %w", err)
+	}
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("rule source status: %s", resp.Status)
+	}
+
+	// JSON is a subset of YAML, so decoding through yaml keeps field names and
+	// duration formats identical to the configuration file.
+	var rules []RepositoryRule
+	if err := yaml.Unmarshal(body, &rules); err != nil {
+		return nil, fmt.Errorf("decode rule source response: %w", err)
+	}
+	return rules, nil
+}
+
+// WithRules возвращает копию конфигурации с указанными правилами репозиториев.
+// Правила валидируются и дополняются значениями по умолчанию так же, как при загрузке файла;
+// общие настройки уже проверены и не меняются, поэтому копия разделяет их с исходной конфигурацией.
+func (c *Config) WithRules(rules []RepositoryRule) (*Config, error) {
+	next := *c
+	next.Repositories = rules
+	if err := next.validateRepositories(); err != nil {
+		return nil, err
+	}
+	next.buildIndex()
+	return &next, nil
+}
@@ -0,0 +1,161 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// JobFacts - сведения о найденной задаче Jenkins, по которым вычисляется success_when.
+type JobFacts struct {
+	Name   string // Имя задачи
+	Color  string // Цвет задачи (blue, red, yellow, ...)
+	Result string // Результат сборки (SUCCESS, FAILURE, UNSTABLE, ABORTED)
+}
+
+// SuccessExpr - разобранное выражение success_when: дизъюнкция конъюнкций предикатов
+// над именем задачи, ее цветом и результатом сборки. AND связывает сильнее OR, скобки не поддерживаются.
+type SuccessExpr struct {
+	any [][]successPredicate // OR из групп AND
+}
+
+// successPredicate - одно условие выражения success_when.
+type successPredicate struct {
+	field  string         // name, color или result
+	negate bool           // Оператор != вместо ==
+	value  string         // Значение для сравнения (color, result)
+	re     *regexp.Regexp // Шаблон для name matches
+}
+
+// ParseSuccessExpr разбирает выражение success_when, например
+// `name matches "^PR-\d+$" AND color == blue OR result == UNSTABLE`.
+// Поддерживаются предикаты `name matches <шаблон>`, `color ==|!= <цвет>`, `result ==|!= <результат>`
+// и связки AND/OR (также && и ||). Значения можно заключать в двойные кавычки.
+func ParseSuccessExpr(expr string) (*SuccessExpr, error) {
+	tokens, err := tokenizeSuccessExpr(expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty expression")
+	}
+
+	parsed := &SuccessExpr{}
+	group := []successPredicate{}
+	for len(tokens) > 0 {
+		if len(tokens) < 3 {
+			return nil, fmt.Errorf("incomplete condition %q", strings.Join(tokens, " "))
+		}
+		pred, err := parseSuccessPredicate(tokens[0], tokens[1], tokens[2])
+		if err != nil {
+			return nil, err
+		}
+		group = append(group, pred)
+		tokens = tokens[3:]
+		if len(tokens) == 0 {
+			break
+		}
+		switch strings.ToUpper(tokens[0]) {
+		case "AND", "&&":
+		case "OR", "||":
+			parsed.any = append(parsed.any, group)
+			group = []successPredicate{}
+		default:
+			return nil, fmt.Errorf("expected AND or OR, got %q", tokens[0])
+		}
+		tokens = tokens[1:]
+		if len(tokens) == 0 {
+			return nil, fmt.Errorf("expression ends with a connective")
+		}
+	}
+	parsed.any = append(parsed.any, group)
+	return parsed, nil
+}
+
+// parseSuccessPredicate разбирает условие из поля, оператора и значения.
+func parseSuccessPredicate(field, op, value string) (successPredicate, error) {
+	field = strings.ToLower(field)
+	switch field {
+	case "name":
+		if strings.ToLower(op) != "matches" {
+			return successPredicate{}, fmt.Errorf("name supports only the matches operator, got %q", op)
+		}
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return successPredicate{}, fmt.Errorf("invalid name pattern %q: %w", value, err)
+		}
+		return successPredicate{field: field, re: re}, nil
+	case "color", "result":
+		switch op {
+		case "==":
+			return successPredicate{field: field, value: value}, nil
+		case "!=":
+			return successPredicate{field: field, value: value, negate: true}, nil
+		default:
+			return successPredicate{}, fmt.Errorf("%s supports == and !=, got %q", field, op)
+		}
+	default:
+		return successPredicate{}, fmt.Errorf("unknown field %q: expected name, color or result", field)
+	}
+}
+
+// tokenizeSuccessExpr разбивает выражение на слова, операторы и значения в двойных кавычках.
+func tokenizeSuccessExpr(expr string) ([]string, error) {
+	var tokens []string
+	runes := []rune(expr)
+	for i := 0; i < len(runes); {
+		switch r := runes[i]; {
+		case unicode.IsSpace(r):
+			i++
+		case r == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, fmt.Errorf("unterminated quoted value")
+			}
+			tokens = append(tokens, string(runes[i+1:end]))
+			i = end + 1
+		default:
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) {
+				end++
+			}
+			tokens = append(tokens, string(runes[i:end]))
+			i = end
+		}
+	}
+	return tokens, nil
+}
+
+// Eval вычисляет выражение для сведений о задаче. Сравнение цвета и результата
+// не зависит от регистра.
+func (e *SuccessExpr) Eval(facts JobFacts) bool {
+	for _, group := range e.any {
+		matched := true
+		for _, pred := range group {
+			if !pred.eval(facts) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// eval вычисляет одно условие.
+func (p successPredicate) eval(facts JobFacts) bool {
+	switch p.field {
+	case "name":
+		return p.re.MatchString(facts.Name)
+	case "color":
+		return strings.EqualFold(facts.Color, p.value) != p.negate
+	default:
+		return strings.EqualFold(facts.Result, p.value) != p.negate
+	}
+}
@@ -5,20 +5,27 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"strings"
 	"time"
+
+	"github.com/example/gitea-jenkins-webhook/internal/httpclient"
 )
 
 // Client представляет клиент для работы с API Gitea.
 type Client struct {
-	baseURL string
-	token   string
-	client  *http.Client
-	log     *slog.Logger
+	baseURL         string
+	token           string
+	client          *http.Client
+	log             *slog.Logger
+	conflictRetries int           // Число повторов правки комментария после ответа 409 Conflict
+	requestTimeout  time.Duration // Ограничение времени одного запроса к API (см. SetRequestTimeout)
+
+	retryStatusCodes map[int]bool // Дополнительные повторяемые коды ответа (см. SetRetryStatusCodes)
 }
 
 // commentRequest представляет запрос на создание комментария в Gitea.
@@ -26,27 +33,95 @@ type commentRequest struct {
 	Body string `json:"body"` // Текст комментария
 }
 
+// reviewRequest представляет запрос на создание ревью pull request в Gitea.
+type reviewRequest struct {
+	Body  string `json:"body"`  // Текст ревью
+	Event string `json:"event"` // Тип ревью: COMMENT, APPROVED, REQUEST_CHANGES
+}
+
+// Comment представляет комментарий или ревью в Gitea.
+type Comment struct {
+	ID      int64  `json:"id"`       // Идентификатор комментария
+	HTMLURL string `json:"html_url"` // Ссылка на комментарий в веб-интерфейсе
+	Body    string `json:"body"`     // Текст комментария
+	User    User   `json:"user"`     // Автор комментария
+}
+
+// User представляет пользователя Gitea.
+type User struct {
+	Login string `json:"login"` // Имя пользователя
+}
+
+// HTTPError возвращается, если Gitea ответил на запрос статусом ошибки (4xx, 5xx).
+type HTTPError struct {
+	Op         string // Операция, например "post comment"
+	StatusCode int    // HTTP-код ответа
+	Status     string // Строка статуса ответа
+	Retryable  bool   // Код ответа задан в server.retry_status_codes
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("%s failed: status %s", e.Op, e.Status)
+}
+
+// Temporary сообщает, что ошибка может исчезнуть при повторе: ответ 5xx, 429 Too Many Requests
+// или код из server.retry_status_codes.
+func (e *HTTPError) Temporary() bool {
+	return e.Retryable || e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests
+}
+
+// httpError возвращает ошибку операции op для ответа resp с кодом 4xx или 5xx.
+func (c *Client) httpError(op string, resp *http.Response) *HTTPError {
+	return &HTTPError{Op: op, StatusCode: resp.StatusCode, Status: resp.Status, Retryable: c.retryStatusCodes[resp.StatusCode]}
+}
+
 // NewClient создает новый клиент для работы с API Gitea.
-// Если httpClient равен nil, создается клиент с таймаутом 10 секунд.
+// Если httpClient равен nil, создается клиент с таймаутом соединения httpclient.DefaultConnectTimeout;
+// время каждого запроса ограничивается его контекстом (см. SetRequestTimeout).
 // Если logger равен nil, используется логгер по умолчанию.
 func NewClient(baseURL, token string, httpClient *http.Client, logger *slog.Logger) *Client {
 	if httpClient == nil {
-		httpClient = &http.Client{Timeout: 10 * time.Second}
+		httpClient = httpclient.New(httpclient.DefaultConnectTimeout)
 	}
 	if logger == nil {
 		logger = slog.Default()
 	}
 	return &Client{
-		baseURL: strings.TrimRight(baseURL, "/"),
-		token:   token,
-		client:  httpClient,
-		log:     logger,
+		baseURL:         strings.TrimRight(baseURL, "/"),
+		token:           token,
+		client:          httpClient,
+		log:             logger,
+		conflictRetries: defaultConflictRetries,
+		requestTimeout:  httpclient.DefaultRequestTimeout,
+	}
+}
+
+// SetRequestTimeout задает ограничение времени одного запроса к API Gitea (gitea.request_timeout).
+// Неположительное значение восстанавливает значение по умолчанию httpclient.DefaultRequestTimeout.
+func (c *Client) SetRequestTimeout(d time.Duration) {
+	if d <= 0 {
+		d = httpclient.DefaultRequestTimeout
+	}
+	c.requestTimeout = d
+}
+
+// SetRetryStatusCodes задает дополнительные коды ответа, при которых запрос к Gitea считается
+// временно неудачным и повторяется (server.retry_status_codes), например 520 шлюза перед Gitea.
+// Должен вызываться до начала работы с клиентом.
+func (c *Client) SetRetryStatusCodes(codes []int) {
+	c.retryStatusCodes = make(map[int]bool, len(codes))
+	for _, code := range codes {
+		c.retryStatusCodes[code] = true
 	}
 }
 
 // PostComment публикует комментарий в указанном issue или pull request репозитория Gitea.
 // repoFullName должен быть в формате "owner/repo", issueIndex - номер issue/PR.
-func (c *Client) PostComment(ctx context.Context, repoFullName string, issueIndex int64, body string) error {
+// Возвращает созданный комментарий.
+func (c *Client) PostComment(ctx context.Context, repoFullName string, issueIndex int64, body string) (*Comment, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+	defer cancel()
+
 	c.log.Info("posting comment to Gitea",
 		"repo", repoFullName,
 		"issue_index", issueIndex,
@@ -55,7 +130,7 @@ func (c *Client) PostComment(ctx context.Context, repoFullName string, issueInde
 	owner, repo, err := splitRepoFullName(repoFullName)
 	if err != nil {
 		c.log.Error("failed to split repo full name", "err", err, "repo", repoFullName)
-		return err
+		return nil, err
 	}
 
 	path := fmt.Sprintf("%s/repos/%s/%s/issues/%d/comments", c.baseURL, owner, repo, issueIndex)
@@ -63,7 +138,7 @@ func (c *Client) PostComment(ctx context.Context, repoFullName string, issueInde
 	data, err := json.Marshal(payload)
 	if err != nil {
 		c.log.Error("failed to marshal comment payload", "err", err)
-		return fmt.Errorf("marshal comment payload: %w", err)
+		return nil, fmt.Errorf("marshal comment payload: %w", err)
 	}
 
 	c.log.Debug("Gitea request prepared",
@@ -74,7 +149,7 @@ func (c *Client) PostComment(ctx context.Context, repoFullName string, issueInde
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, path, bytes.NewReader(data))
 	if err != nil {
 		c.log.Error("failed to create request", "err", err)
-		return fmt.Errorf("create request: %w", err)
+		return nil, fmt.Errorf("create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", fmt.Sprintf("token %s", c.token))
@@ -87,7 +162,7 @@ func (c *Client) PostComment(ctx context.Context, repoFullName string, issueInde
 	resp, err := c.client.Do(req)
 	if err != nil {
 		c.log.Error("failed to execute Gitea request", "err", err, "url", path)
-		return fmt.Errorf("execute request: %w", err)
+		return nil, fmt.Errorf("execute request: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -104,14 +179,178 @@ func (c *Client) PostComment(ctx context.Context, repoFullName string, issueInde
 			"status_code", resp.StatusCode,
 			"status", resp.Status,
 			"response_body", string(respBody))
-		return fmt.Errorf("post comment failed: status %s", resp.Status)
+		return nil, c.httpError("post comment", resp)
+	}
+
+	// Some proxies answer 200 with an HTML error page, so a successful status alone is not enough.
+	var created Comment
+	if err := json.Unmarshal(respBody, &created); err != nil || created.ID == 0 {
+		c.log.Error("unexpected Gitea response to comment creation",
+			"status_code", resp.StatusCode,
+			"content_type", resp.Header.Get("Content-Type"),
+			"response_body", truncate(string(respBody), 200))
+		return nil, fmt.Errorf("post comment failed: unexpected response (status %s, content type %q): expected JSON with comment id",
+			resp.Status, resp.Header.Get("Content-Type"))
 	}
 
 	c.log.Info("comment posted to Gitea successfully",
 		"repo", repoFullName,
 		"issue_index", issueIndex,
+		"comment_id", created.ID,
 		"status_code", resp.StatusCode)
-	return nil
+	return &created, nil
+}
+
+// ReviewEventComment - тип ревью, который только оставляет комментарий без одобрения или запроса изменений.
+const ReviewEventComment = "COMMENT"
+
+// CreateReview создает ревью pull request с указанным текстом.
+// repoFullName должен быть в формате "owner/repo", index - номер PR, event - тип ревью (например, ReviewEventComment).
+// Возвращает созданное ревью.
+func (c *Client) CreateReview(ctx context.Context, repoFullName string, index int64, body, event string) (*Comment, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+	defer cancel()
+
+	c.log.Info("creating pull request review in Gitea",
+		"repo", repoFullName,
+		"pr_number", index,
+		"event", event,
+		"body_length", len(body))
+
+	owner, repo, err := splitRepoFullName(repoFullName)
+	if err != nil {
+		return nil, err
+	}
+
+	path := fmt.Sprintf("%s/repos/%s/%s/pulls/%d/reviews", c.baseURL, owner, repo, index)
+	data, err := json.Marshal(reviewRequest{Body: body, Event: event})
+	if err != nil {
+		return nil, fmt.Errorf("marshal review payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, path, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("token %s", c.token))
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		c.log.Error("failed to execute Gitea request", "err", err, "url", path)
+		return nil, fmt.Errorf("execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	c.log.Debug("Gitea response received",
+		"status_code", resp.StatusCode,
+		"body", string(respBody))
+
+	if resp.StatusCode >= 400 {
+		c.log.Error("Gitea API error",
+			"status_code", resp.StatusCode,
+			"status", resp.Status,
+			"response_body", string(respBody))
+		return nil, c.httpError("create review", resp)
+	}
+
+	var created Comment
+	if err := json.Unmarshal(respBody, &created); err != nil || created.ID == 0 {
+		return nil, fmt.Errorf("create review failed: unexpected response (status %s, content type %q): expected JSON with review id",
+			resp.Status, resp.Header.Get("Content-Type"))
+	}
+
+	c.log.Info("pull request review created in Gitea",
+		"repo", repoFullName,
+		"pr_number", index,
+		"review_id", created.ID)
+	return &created, nil
+}
+
+// EditComment заменяет текст существующего комментария в репозитории Gitea.
+// repoFullName должен быть в формате "owner/repo". Возвращает обновленный комментарий.
+// Если Gitea отвечает 409 Conflict (комментарий одновременно изменяется другим запросом),
+// правка повторяется до SetConflictRetries раз с растущей паузой conflictBackoff, давая
+// конкурирующему запросу завершиться.
+func (c *Client) EditComment(ctx context.Context, repoFullName string, commentID int64, body string) (*Comment, error) {
+	for attempt := 0; ; attempt++ {
+		edited, err := c.editComment(ctx, repoFullName, commentID, body)
+		if !errors.Is(err, ErrConflict) || attempt >= c.conflictRetries {
+			return edited, err
+		}
+		c.log.Warn("comment edit conflicted, retrying",
+			"repo", repoFullName,
+			"comment_id", commentID,
+			"attempt", attempt+1)
+		timer := time.NewTimer(time.Duration(attempt+1) * conflictBackoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// editComment выполняет одну попытку правки комментария.
+func (c *Client) editComment(ctx context.Context, repoFullName string, commentID int64, body string) (*Comment, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+	defer cancel()
+
+	owner, repo, err := splitRepoFullName(repoFullName)
+	if err != nil {
+		return nil, err
+	}
+
+	path := fmt.Sprintf("%s/repos/%s/%s/issues/comments/%d", c.baseURL, owner, repo, commentID)
+	data, err := json.Marshal(commentRequest{Body: body})
+	if err != nil {
+		return nil, fmt.Errorf("marshal comment payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPatch, path, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("token %s", c.token))
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		c.log.Error("failed to execute Gitea request", "err", err, "url", path)
+		return nil, fmt.Errorf("execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 400 {
+		c.log.Error("Gitea API error",
+			"status_code", resp.StatusCode,
+			"status", resp.Status,
+			"response_body", string(respBody))
+		if resp.StatusCode == http.StatusConflict {
+			return nil, fmt.Errorf("edit comment failed: %w", ErrConflict)
+		}
+		return nil, c.httpError("edit comment", resp)
+	}
+
+	var edited Comment
+	if err := json.Unmarshal(respBody, &edited); err != nil || edited.ID == 0 {
+		return nil, fmt.Errorf("edit comment failed: unexpected response (status %s, content type %q): expected JSON with comment id",
+			resp.Status, resp.Header.Get("Content-Type"))
+	}
+
+	c.log.Debug("comment edited in Gitea", "repo", repoFullName, "comment_id", edited.ID, "body_length", len(body))
+	return &edited, nil
+}
+
+// truncate обрезает строку до n байт для вывода в лог.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
 }
 
 // splitRepoFullName разделяет полное имя репозитория (формат "owner/repo") на владельца и имя репозитория.
@@ -126,7 +365,7 @@ func splitRepoFullName(fullName string) (string, string, error) {
 // CheckAccessibility проверяет доступность Gitea, выполняя запрос к эндпоинту /user.
 // Возвращает ошибку, если Gitea недоступен или аутентификация не удалась.
 func (c *Client) CheckAccessibility(ctx context.Context) error {
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, c.requestTimeout)
 	defer cancel()
 
 	endpoint := fmt.Sprintf("%s/user", c.baseURL)
@@ -158,7 +397,7 @@ func (c *Client) CheckAccessibility(ctx context.Context) error {
 // GetRepository проверяет существование репозитория в Gitea.
 // Возвращает ошибку, если репозиторий не найден, доступ запрещен или произошла другая ошибка API.
 func (c *Client) GetRepository(ctx context.Context, owner, repo string) error {
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, c.requestTimeout)
 	defer cancel()
 
 	endpoint := fmt.Sprintf("%s/repos/%s/%s", c.baseURL, owner, repo)
@@ -0,0 +1,366 @@
+package gitea_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/example/gitea-jenkins-webhook/internal/gitea"
+)
+
+func TestPostComment(t *testing.T) {
+	var gotPath string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id": 42, "body": "hello"}`))
+	}))
+	defer ts.Close()
+
+	client := gitea.NewClient(ts.URL, "token", nil, nil)
+	if _, err := client.PostComment(context.Background(), "org/repo", 7, "hello"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if gotPath != "/repos/org/repo/issues/7/comments" {
+		t.Fatalf("unexpected path: %s", gotPath)
+	}
+}
+
+func TestPostCommentRejectsHTMLSuccessResponse(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("<html><body>Bad gateway</body></html>"))
+	}))
+	defer ts.Close()
+
+	client := gitea.NewClient(ts.URL, "token", nil, nil)
+	if _, err := client.PostComment(context.Background(), "org/repo", 7, "hello"); err == nil {
+		t.Fatalf("expected error for HTML response")
+	}
+}
+
+func TestCreateReview(t *testing.T) {
+	var (
+		gotPath string
+		gotBody map[string]string
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		_ = json.NewDecoder(r.Body).Decode(&gotBody)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id": 3, "state": "COMMENT"}`))
+	}))
+	defer ts.Close()
+
+	client := gitea.NewClient(ts.URL, "token", nil, nil)
+	if _, err := client.CreateReview(context.Background(), "org/repo", 9, "review body", gitea.ReviewEventComment); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if gotPath != "/repos/org/repo/pulls/9/reviews" {
+		t.Fatalf("unexpected path: %s", gotPath)
+	}
+	if gotBody["body"] != "review body" || gotBody["event"] != "COMMENT" {
+		t.Fatalf("unexpected payload: %v", gotBody)
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	tests := []struct {
+		name         string
+		postStatus   int
+		deleteStatus int
+		wantErr      bool
+		wantCalls    []string
+	}{
+		{
+			name:         "success",
+			postStatus:   http.StatusCreated,
+			deleteStatus: http.StatusNoContent,
+			wantCalls:    []string{"POST /repos/org/selftest/issues/1/comments", "DELETE /repos/org/selftest/issues/comments/42"},
+		},
+		{
+			name:       "post forbidden",
+			postStatus: http.StatusForbidden,
+			wantErr:    true,
+			wantCalls:  []string{"POST /repos/org/selftest/issues/1/comments"},
+		},
+		{
+			name:         "delete forbidden",
+			postStatus:   http.StatusCreated,
+			deleteStatus: http.StatusForbidden,
+			wantErr:      true,
+			wantCalls:    []string{"POST /repos/org/selftest/issues/1/comments", "DELETE /repos/org/selftest/issues/comments/42"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []string
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, r.Method+" "+r.URL.Path)
+				if r.Method == http.MethodDelete {
+					w.WriteHeader(tt.deleteStatus)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.postStatus)
+				_, _ = w.Write([]byte(`{"id": 42}`))
+			}))
+			defer ts.Close()
+
+			client := gitea.NewClient(ts.URL, "token", nil, nil)
+			err := client.SelfTest(context.Background(), "org/selftest", 1)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(calls) != len(tt.wantCalls) {
+				t.Fatalf("unexpected calls: %v", calls)
+			}
+			for i := range calls {
+				if calls[i] != tt.wantCalls[i] {
+					t.Fatalf("unexpected calls: %v", calls)
+				}
+			}
+		})
+	}
+}
+
+func TestListAndUpdateComments(t *testing.T) {
+	var patched string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/org/repo/issues/7/comments":
+			_, _ = w.Write([]byte(`[{"id":1,"body":"hi","user":{"login":"alice"}},{"id":2,"body":"bot <!-- marker -->","user":{"login":"ci-bot"}}]`))
+		case r.Method == http.MethodPatch && r.URL.Path == "/repos/org/repo/issues/comments/2":
+			var req struct {
+				Body string `json:"body"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			patched = req.Body
+			_, _ = w.Write([]byte(`{"id":2}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	client := gitea.NewClient(ts.URL, "token", nil, nil)
+	comments, err := client.ListComments(context.Background(), "org/repo", 7)
+	if err != nil {
+		t.Fatalf("list comments: %v", err)
+	}
+	if len(comments) != 2 || comments[1].ID != 2 || comments[1].User.Login != "ci-bot" || comments[1].Body != "bot <!-- marker -->" {
+		t.Fatalf("unexpected comments: %+v", comments)
+	}
+	if err := client.UpdateComment(context.Background(), "org/repo", 2, "updated"); err != nil {
+		t.Fatalf("update comment: %v", err)
+	}
+	if patched != "updated" {
+		t.Fatalf("unexpected patched body: %q", patched)
+	}
+}
+
+func TestUpdateCommentRetriesOnConflict(t *testing.T) {
+	var patches int
+	var lastPatch, gap time.Duration
+	start := time.Now()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodPatch && r.URL.Path == "/repos/org/repo/issues/comments/2":
+			patches++
+			now := time.Since(start)
+			gap, lastPatch = now-lastPatch, now
+			if patches == 1 {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			_, _ = w.Write([]byte(`{"id":2,"body":"updated"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	client := gitea.NewClient(ts.URL, "token", nil, nil)
+	if err := client.UpdateComment(context.Background(), "org/repo", 2, "updated"); err != nil {
+		t.Fatalf("update comment: %v", err)
+	}
+	if patches != 2 {
+		t.Fatalf("expected 2 patches, got %d", patches)
+	}
+	if gap < 50*time.Millisecond {
+		t.Fatalf("expected a pause before retrying the conflicting edit, got %s", gap)
+	}
+
+	patches = 0
+	client.SetConflictRetries(0)
+	err := client.UpdateComment(context.Background(), "org/repo", 2, "updated")
+	if !errors.Is(err, gitea.ErrConflict) {
+		t.Fatalf("expected ErrConflict without retries, got %v", err)
+	}
+	if patches != 1 {
+		t.Fatalf("expected a single patch without retries, got %d", patches)
+	}
+}
+
+func TestCreateCommitStatus(t *testing.T) {
+	var gotPath string
+	var got gitea.CommitStatus
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer ts.Close()
+
+	client := gitea.NewClient(ts.URL, "token", nil, nil)
+	status := gitea.CommitStatus{
+		State:       gitea.StatusSuccess,
+		TargetURL:   "https://jenkins/job/PR-1/3/",
+		Context:     "continuous-integration/jenkins",
+		Description: "Jenkins build succeeded",
+	}
+	if err := client.CreateCommitStatus(context.Background(), "org", "repo", "abc123", status); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if gotPath != "/repos/org/repo/statuses/abc123" {
+		t.Fatalf("unexpected path: %s", gotPath)
+	}
+	if got != status {
+		t.Fatalf("unexpected status payload: %+v", got)
+	}
+}
+
+func TestGetPullRequest(t *testing.T) {
+	var gotPath string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"number": 7, "title": "Fix", "state": "open",
+			"head": {"ref": "feature", "sha": "abc123"}, "base": {"ref": "main", "sha": "def456"}}`))
+	}))
+	defer ts.Close()
+
+	client := gitea.NewClient(ts.URL, "token", nil, nil)
+	pr, err := client.GetPullRequest(context.Background(), "org", "repo", 7)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if gotPath != "/repos/org/repo/pulls/7" {
+		t.Fatalf("unexpected path: %s", gotPath)
+	}
+	if pr.Head.Sha != "abc123" || pr.Head.Ref != "feature" || pr.Base.Ref != "main" || pr.State != "open" {
+		t.Fatalf("unexpected pull request: %#v", pr)
+	}
+}
+
+func TestRequestTimeoutIsApplied(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(300 * time.Millisecond):
+		}
+	}))
+	defer ts.Close()
+
+	client := gitea.NewClient(ts.URL, "token", nil, nil)
+	client.SetRequestTimeout(50 * time.Millisecond)
+
+	start := time.Now()
+	if _, err := client.PostComment(context.Background(), "org/repo", 7, "hello"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected request deadline error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+		t.Fatalf("request took %v, want about 50ms", elapsed)
+	}
+}
+
+func TestListCommentsFollowsPages(t *testing.T) {
+	tests := []struct {
+		name   string
+		header func(w http.ResponseWriter, page string)
+	}{
+		{name: "link header", header: func(w http.ResponseWriter, page string) {
+			if page == "1" {
+				w.Header().Set("Link", `<https://gitea/api/v1/repos/org/repo/issues/7/comments?page=2>; rel="next"`)
+			}
+		}},
+		{name: "total count", header: func(w http.ResponseWriter, page string) {
+			w.Header().Set("X-Total-Count", "3")
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				page := r.URL.Query().Get("page")
+				if r.URL.Query().Get("limit") == "" {
+					t.Errorf("expected limit query parameter, got %q", r.URL.RawQuery)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				tt.header(w, page)
+				switch page {
+				case "1":
+					_, _ = w.Write([]byte(`[{"id":1,"body":"one"},{"id":2,"body":"two"}]`))
+				case "2":
+					_, _ = w.Write([]byte(`[{"id":3,"body":"bot <!-- marker -->"}]`))
+				default:
+					_, _ = w.Write([]byte(`[]`))
+				}
+			}))
+			defer ts.Close()
+
+			client := gitea.NewClient(ts.URL, "token", nil, nil)
+			comments, err := client.ListComments(context.Background(), "org/repo", 7)
+			if err != nil {
+				t.Fatalf("list comments: %v", err)
+			}
+			if len(comments) != 3 || comments[2].ID != 3 {
+				t.Fatalf("expected comments from both pages, got %+v", comments)
+			}
+			if requests != 2 {
+				t.Fatalf("expected 2 page requests, got %d", requests)
+			}
+		})
+	}
+}
+
+func TestRetryStatusCodesMarkErrorsTemporary(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(499)
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name  string
+		codes []int
+		want  bool
+	}{
+		{name: "configured", codes: []int{499}, want: true},
+		{name: "default", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := gitea.NewClient(ts.URL, "token", nil, nil)
+			client.SetRetryStatusCodes(tt.codes)
+			_, err := client.PostComment(context.Background(), "org/repo", 1, "body")
+			var httpErr *gitea.HTTPError
+			if !errors.As(err, &httpErr) {
+				t.Fatalf("expected HTTP error, got %v", err)
+			}
+			if httpErr.Temporary() != tt.want {
+				t.Fatalf("expected Temporary() = %v for status %d", tt.want, httpErr.StatusCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package gitea
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultConflictRetries - число повторов правки комментария после 409 Conflict по умолчанию.
+const defaultConflictRetries = 3
+
+// conflictBackoff - пауза перед первым повтором правки комментария после 409 Conflict;
+// перед каждым следующим повтором пауза увеличивается на это же значение.
+const conflictBackoff = 100 * time.Millisecond
+
+// ErrConflict возвращается, если Gitea отклонил изменение комментария из-за конфликта (409).
+var ErrConflict = errors.New("gitea comment conflict")
+
+// SetConflictRetries задает число повторов правки комментария после ответа 409 Conflict
+// (0 - без повторов). Должен вызываться до начала работы с клиентом.
+func (c *Client) SetConflictRetries(n int) {
+	c.conflictRetries = n
+}
+
+// GetComment возвращает комментарий с идентификатором commentID репозитория Gitea.
+// repoFullName должен быть в формате "owner/repo".
+func (c *Client) GetComment(ctx context.Context, repoFullName string, commentID int64) (*Comment, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+	defer cancel()
+
+	owner, repo, err := splitRepoFullName(repoFullName)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := fmt.Sprintf("%s/repos/%s/%s/issues/comments/%d", c.baseURL, owner, repo, commentID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("token %s", c.token))
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		c.log.Error("failed to execute Gitea request", "err", err, "url", endpoint)
+		return nil, fmt.Errorf("execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 400 {
+		return nil, c.httpError("get comment", resp)
+	}
+
+	var comment Comment
+	if err := json.Unmarshal(body, &comment); err != nil || comment.ID == 0 {
+		return nil, fmt.Errorf("get comment failed: unexpected response (status %s, content type %q): expected JSON with comment id",
+			resp.Status, resp.Header.Get("Content-Type"))
+	}
+	return &comment, nil
+}
+
+// Постраничная выборка комментариев: размер страницы и предел числа запрашиваемых страниц.
+const (
+	commentsPageLimit = 50
+	commentsMaxPages  = 100
+)
+
+// ListComments возвращает комментарии issue или pull request issueIndex репозитория Gitea
+// в порядке публикации. repoFullName должен быть в формате "owner/repo".
+// Комментарии запрашиваются постранично (page/limit), пока заголовки Link или X-Total-Count
+// указывают на следующую страницу, но не более commentsMaxPages страниц.
+func (c *Client) ListComments(ctx context.Context, repoFullName string, issueIndex int64) ([]Comment, error) {
+	owner, repo, err := splitRepoFullName(repoFullName)
+	if err != nil {
+		return nil, err
+	}
+
+	var comments []Comment
+	for page := 1; page <= commentsMaxPages; page++ {
+		batch, next, err := c.listCommentsPage(ctx, owner, repo, issueIndex, page, len(comments))
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, batch...)
+		if !next {
+			return comments, nil
+		}
+	}
+	c.log.Warn("comment listing stopped at page limit",
+		"repo", repoFullName,
+		"issue_index", issueIndex,
+		"max_pages", commentsMaxPages,
+		"comments", len(comments))
+	return comments, nil
+}
+
+// listCommentsPage запрашивает страницу page комментариев и сообщает, есть ли следующая.
+// fetched - число комментариев, полученных с предыдущих страниц.
+func (c *Client) listCommentsPage(ctx context.Context, owner, repo string, issueIndex int64, page, fetched int) ([]Comment, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+	defer cancel()
+
+	endpoint := fmt.Sprintf("%s/repos/%s/%s/issues/%d/comments?page=%d&limit=%d", c.baseURL, owner, repo, issueIndex, page, commentsPageLimit)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("token %s", c.token))
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		c.log.Error("failed to execute Gitea request", "err", err, "url", endpoint)
+		return nil, false, fmt.Errorf("execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 400 {
+		c.log.Error("Gitea API error",
+			"status_code", resp.StatusCode,
+			"status", resp.Status,
+			"response_body", string(body))
+		return nil, false, c.httpError("list comments", resp)
+	}
+
+	var comments []Comment
+	if err := json.Unmarshal(body, &comments); err != nil {
+		return nil, false, fmt.Errorf("list comments failed: unexpected response (status %s, content type %q): %w",
+			resp.Status, resp.Header.Get("Content-Type"), err)
+	}
+	return comments, hasNextPage(resp.Header, len(comments), fetched+len(comments)), nil
+}
+
+// hasNextPage определяет по ответу, есть ли следующая страница: по ссылке rel="next" в заголовке Link,
+// иначе по общему числу из X-Total-Count, иначе по заполненности страницы. Пустая страница - последняя.
+func hasNextPage(h http.Header, count, fetched int) bool {
+	if count == 0 {
+		return false
+	}
+	if link := h.Get("Link"); link != "" {
+		return strings.Contains(link, `rel="next"`)
+	}
+	if total, err := strconv.Atoi(h.Get("X-Total-Count")); err == nil {
+		return fetched < total
+	}
+	return count >= commentsPageLimit
+}
+
+// UpdateComment заменяет текст существующего комментария, как EditComment (включая повторы
+// после 409 Conflict), но не возвращает обновленный комментарий.
+func (c *Client) UpdateComment(ctx context.Context, repoFullName string, commentID int64, body string) error {
+	_, err := c.EditComment(ctx, repoFullName, commentID, body)
+	return err
+}
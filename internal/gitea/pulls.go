@@ -0,0 +1,70 @@
+package gitea
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// PullRequest представляет pull request, возвращаемый API Gitea.
+type PullRequest struct {
+	Number  int64    `json:"number"`   // Номер pull request
+	Title   string   `json:"title"`    // Заголовок
+	Body    string   `json:"body"`     // Описание
+	HTMLURL string   `json:"html_url"` // Ссылка на pull request в веб-интерфейсе
+	State   string   `json:"state"`    // Состояние: open или closed
+	Draft   bool     `json:"draft"`    // Признак черновика
+	Base    PRBranch `json:"base"`     // Целевая ветка
+	Head    PRBranch `json:"head"`     // Исходная ветка
+	Labels  []Label  `json:"labels"`   // Метки
+}
+
+// PRBranch представляет ветку pull request.
+type PRBranch struct {
+	Ref string `json:"ref"` // Имя ветки
+	Sha string `json:"sha"` // Последний коммит ветки
+}
+
+// Label представляет метку issue или pull request.
+type Label struct {
+	Name string `json:"name"` // Название метки
+}
+
+// GetPullRequest возвращает pull request index репозитория owner/repo с текущими
+// головной и целевой ветками.
+func (c *Client) GetPullRequest(ctx context.Context, owner, repo string, index int64) (*PullRequest, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+	defer cancel()
+
+	endpoint := fmt.Sprintf("%s/repos/%s/%s/pulls/%d", c.baseURL, owner, repo, index)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("token %s", c.token))
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		c.log.Error("failed to execute Gitea request", "err", err, "url", endpoint)
+		return nil, fmt.Errorf("execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 400 {
+		c.log.Error("Gitea API error",
+			"status_code", resp.StatusCode,
+			"status", resp.Status,
+			"response_body", string(body))
+		return nil, c.httpError("get pull request", resp)
+	}
+
+	var pr PullRequest
+	if err := json.Unmarshal(body, &pr); err != nil || pr.Number == 0 {
+		return nil, fmt.Errorf("get pull request failed: unexpected response (status %s, content type %q): expected JSON with pull request number",
+			resp.Status, resp.Header.Get("Content-Type"))
+	}
+	return &pr, nil
+}
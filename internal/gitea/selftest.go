@@ -0,0 +1,58 @@
+package gitea
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// selfTestComment - текст проверочного комментария, публикуемого при самопроверке.
+const selfTestComment = "gitea-jenkins-webhook startup self-test, this comment is deleted automatically"
+
+// DeleteComment удаляет комментарий с указанным идентификатором в репозитории Gitea.
+// repoFullName должен быть в формате "owner/repo".
+func (c *Client) DeleteComment(ctx context.Context, repoFullName string, commentID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+	defer cancel()
+
+	owner, repo, err := splitRepoFullName(repoFullName)
+	if err != nil {
+		return err
+	}
+
+	endpoint := fmt.Sprintf("%s/repos/%s/%s/issues/comments/%d", c.baseURL, owner, repo, commentID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("token %s", c.token))
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		c.log.Error("failed to execute Gitea request", "err", err, "url", endpoint)
+		return fmt.Errorf("execute request: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		c.log.Error("Gitea API error", "status_code", resp.StatusCode, "status", resp.Status, "url", endpoint)
+		return c.httpError("delete comment", resp)
+	}
+	c.log.Debug("comment deleted from Gitea", "repo", repoFullName, "comment_id", commentID)
+	return nil
+}
+
+// SelfTest проверяет права на запись в Gitea: публикует проверочный комментарий в указанном issue
+// и сразу удаляет его. Возвращает ошибку, если любой из шагов не удался.
+func (c *Client) SelfTest(ctx context.Context, repoFullName string, issueIndex int64) error {
+	comment, err := c.PostComment(ctx, repoFullName, issueIndex, selfTestComment)
+	if err != nil {
+		return fmt.Errorf("self-test post comment: %w", err)
+	}
+	if err := c.DeleteComment(ctx, repoFullName, comment.ID); err != nil {
+		return fmt.Errorf("self-test delete comment %d: %w", comment.ID, err)
+	}
+	return nil
+}
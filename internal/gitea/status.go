@@ -0,0 +1,69 @@
+package gitea
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Состояния статуса коммита Gitea.
+const (
+	StatusPending = "pending"
+	StatusSuccess = "success"
+	StatusFailure = "failure"
+	StatusError   = "error"
+)
+
+// CommitStatus описывает статус коммита, отображаемый в Gitea рядом с коммитом и в pull request.
+type CommitStatus struct {
+	State       string `json:"state"`                 // Состояние: pending, success, failure или error
+	TargetURL   string `json:"target_url,omitempty"`  // Ссылка, открываемая из статуса (сборка или задача Jenkins)
+	Context     string `json:"context"`               // Имя проверки, по которому Gitea различает статусы
+	Description string `json:"description,omitempty"` // Краткое описание состояния
+}
+
+// CreateCommitStatus устанавливает статус коммита sha в репозитории owner/repo.
+// Статус с тем же Context заменяет предыдущий.
+func (c *Client) CreateCommitStatus(ctx context.Context, owner, repo, sha string, status CommitStatus) error {
+	ctx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+	defer cancel()
+
+	endpoint := fmt.Sprintf("%s/repos/%s/%s/statuses/%s", c.baseURL, owner, repo, sha)
+	data, err := json.Marshal(status)
+	if err != nil {
+		return fmt.Errorf("marshal commit status: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("token %s", c.token))
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		c.log.Error("failed to execute Gitea request", "err", err, "url", endpoint)
+		return fmt.Errorf("execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		body, _ := io.ReadAll(resp.Body)
+		c.log.Error("Gitea API error",
+			"status_code", resp.StatusCode,
+			"status", resp.Status,
+			"response_body", string(body))
+		return c.httpError("create commit status", resp)
+	}
+
+	c.log.Debug("commit status created in Gitea",
+		"repo", owner+"/"+repo,
+		"sha", sha,
+		"state", status.State,
+		"context", status.Context)
+	return nil
+}
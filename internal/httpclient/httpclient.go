@@ -0,0 +1,32 @@
+// Package httpclient создает HTTP-клиенты для обращения к Jenkins и Gitea.
+package httpclient
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+// DefaultConnectTimeout - таймаут установки соединения по умолчанию.
+const DefaultConnectTimeout = 5 * time.Second
+
+// DefaultRequestTimeout - ограничение времени одного запроса к Jenkins или Gitea по умолчанию.
+const DefaultRequestTimeout = 10 * time.Second
+
+// New создает HTTP-клиент, у которого ограничено только время установки соединения
+// (TCP и TLS-рукопожатие) значением connectTimeout. Общий таймаут запроса у клиента не задан:
+// его ограничивает контекст каждого запроса, поэтому недоступный сервер обнаруживается быстро,
+// а медленная передача большого ответа по установленному соединению не прерывается раньше времени.
+// Если connectTimeout не положителен, используется DefaultConnectTimeout.
+func New(connectTimeout time.Duration) *http.Client {
+	if connectTimeout <= 0 {
+		connectTimeout = DefaultConnectTimeout
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   connectTimeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	transport.TLSHandshakeTimeout = connectTimeout
+	return &http.Client{Transport: transport}
+}
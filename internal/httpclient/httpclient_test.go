@@ -0,0 +1,57 @@
+package httpclient_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/example/gitea-jenkins-webhook/internal/httpclient"
+)
+
+func TestConnectTimeoutFailsFast(t *testing.T) {
+	// The kernel completes the TCP handshake but nobody answers the TLS handshake,
+	// so only the connection-level timeout can end the request before the context does.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	client := httpclient.New(100 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+ln.Addr().String()+"/", nil)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+
+	start := time.Now()
+	_, err = client.Do(req)
+	if err == nil {
+		t.Fatal("expected connection timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("connection timeout took %v, want about 100ms", elapsed)
+	}
+}
+
+func TestSlowResponseNotLimitedByConnectTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	client := httpclient.New(100 * time.Millisecond)
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("slow response failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,55 @@
+package jenkins
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// BuildResult описывает состояние последней сборки задачи Jenkins.
+type BuildResult struct {
+	Result   string `json:"result"`   // Результат сборки: SUCCESS, FAILURE, UNSTABLE, ABORTED; пусто, пока сборка идет
+	Number   int    `json:"number"`   // Номер сборки
+	Building bool   `json:"building"` // Сборка еще выполняется
+	URL      string `json:"url"`      // URL сборки
+}
+
+// GetLastBuildResult возвращает состояние последней сборки задачи jobFullName ("folder/job")
+// из /lastBuild/api/json. Если у задачи еще нет сборок (404), возвращает nil без ошибки.
+// Ответы классифицируются так же, как в GetJobs: коды server.retry_status_codes, 5xx и остальные 4xx,
+// кроме отказа в доступе, а также ошибки соединения оборачивают ErrUnavailable.
+func (c *Client) GetLastBuildResult(ctx context.Context, jobFullName string) (*BuildResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+	defer cancel()
+
+	endpoint := fmt.Sprintf("%s%s/lastBuild/api/json?tree=result,number,url,building", c.baseURL, jobPath(jobFullName))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	c.authorize(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: jenkins api request: %w", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case c.retryStatusCodes[resp.StatusCode]:
+		return nil, fmt.Errorf("%w: jenkins api status: %s", ErrUnavailable, resp.Status)
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, nil
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return nil, fmt.Errorf("%w: status %s", ErrAuthFailed, resp.Status)
+	case resp.StatusCode >= 400:
+		return nil, fmt.Errorf("%w: jenkins api status: %s", ErrUnavailable, resp.Status)
+	}
+
+	var build BuildResult
+	if err := json.NewDecoder(resp.Body).Decode(&build); err != nil {
+		return nil, fmt.Errorf("decode last build: %w", err)
+	}
+	return &build, nil
+}
@@ -5,16 +5,39 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"net/http/cookiejar"
 	"net/url"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/example/gitea-jenkins-webhook/internal/httpclient"
+	"github.com/example/gitea-jenkins-webhook/internal/metrics"
+)
+
+// ErrJobRootNotFound возвращается, если корневая директория задач не существует в Jenkins.
+var ErrJobRootNotFound = errors.New("job root not found")
+
+// ErrUnavailable возвращается при временной недоступности Jenkins: ответе 5xx, 429 или другом 4xx,
+// кроме отказа в доступе, или ошибке соединения.
+// WaitForJob не прерывает ожидание из-за такой ошибки, а повторяет опрос (см. SetMaxTransientErrors).
+var ErrUnavailable = errors.New("jenkins unavailable")
+
+// Способы аутентификации запросов к Jenkins (см. SetAuthMode).
+const (
+	AuthBasic  = "basic"  // HTTP Basic с именем пользователя и API-токеном
+	AuthBearer = "bearer" // Заголовок Authorization: Bearer с API-токеном (например, за OAuth-прокси)
 )
 
+// DefaultMaxTransientErrors - число временных ошибок, допускаемых WaitForJob за одно ожидание, по умолчанию.
+const DefaultMaxTransientErrors = 3
+
 // Client представляет клиент для работы с API Jenkins.
 type Client struct {
 	baseURL    string
@@ -22,13 +45,36 @@ type Client struct {
 	apiToken   string
 	httpClient *http.Client
 	log        *slog.Logger
+
+	authMode           string        // Способ аутентификации: AuthBasic или AuthBearer (см. SetAuthMode)
+	requestTimeout     time.Duration // Ограничение времени одного запроса к API (см. SetRequestTimeout)
+	maxTransientErrors int           // Число временных ошибок, допускаемых за одно ожидание (см. SetMaxTransientErrors)
+	retryStatusCodes   map[int]bool  // Дополнительные коды ответа, считающиеся временной ошибкой (см. SetRetryStatusCodes)
+
+	crumbMu      sync.Mutex
+	crumb        *crumb    // Кешированный токен CSRF (nil, если выдача отключена)
+	crumbExpires time.Time // Время, до которого кешированный токен используется
+
+	rootScanWarned sync.Map // Репозитории, для которых уже выведено предупреждение о большом корне (см. WithRootScanLimit)
 }
 
 // Job представляет задачу Jenkins.
 type Job struct {
-	Name     string `json:"name"`     // Имя задачи
-	URL      string `json:"url"`      // URL задачи
-	FullName string `json:"fullName"` // Полное имя задачи (включая путь)
+	Name      string   `json:"name"`                // Имя задачи
+	URL       string   `json:"url"`                 // URL задачи
+	FullName  string   `json:"fullName"`            // Полное имя задачи (включая путь)
+	Color     string   `json:"color"`               // Цвет задачи, отражающий результат последней сборки (blue, red, yellow, *_anime)
+	Class     string   `json:"_class"`              // Java-класс задачи; по нему определяются папки и multibranch-проекты
+	Matches   []string `json:"-"`                   // Подгруппы шаблона, совпавшие с именем задачи (Matches[0] - совпадение целиком)
+	LastBuild *Build   `json:"lastBuild,omitempty"` // Последняя сборка задачи (nil, если сборок не было)
+
+	ActiveConfigurations []Job `json:"activeConfigurations,omitempty"` // Конфигурации matrix-задачи (запрашиваются с WithMatrix)
+}
+
+// Build представляет сборку задачи Jenkins.
+type Build struct {
+	Number    int64 `json:"number"`    // Номер сборки
+	Timestamp int64 `json:"timestamp"` // Время начала сборки в миллисекундах Unix
 }
 
 // jobsResponse представляет ответ API Jenkins со списком задач.
@@ -37,11 +83,20 @@ type jobsResponse struct {
 }
 
 // NewClient создает новый клиент для работы с API Jenkins.
-// Если httpClient равен nil, создается клиент с таймаутом 10 секунд.
+// Если httpClient равен nil, создается клиент с таймаутом соединения httpclient.DefaultConnectTimeout;
+// время каждого запроса ограничивается его контекстом (см. SetRequestTimeout).
+// Если у httpClient нет хранилища cookie, клиент использует копию httpClient с собственным
+// хранилищем: токены CSRF Jenkins привязаны к сессии (cookie JSESSIONID), в которой выданы.
 // Если logger равен nil, используется логгер по умолчанию.
 func NewClient(baseURL string, username string, apiToken string, httpClient *http.Client, logger *slog.Logger) *Client {
 	if httpClient == nil {
-		httpClient = &http.Client{Timeout: 10 * time.Second}
+		httpClient = httpclient.New(httpclient.DefaultConnectTimeout)
+	}
+	if httpClient.Jar == nil {
+		withJar := *httpClient
+		// cookiejar.New never fails without options.
+		withJar.Jar, _ = cookiejar.New(nil)
+		httpClient = &withJar
 	}
 	if logger == nil {
 		logger = slog.Default()
@@ -52,12 +107,85 @@ func NewClient(baseURL string, username string, apiToken string, httpClient *htt
 		apiToken:   apiToken,
 		httpClient: httpClient,
 		log:        logger,
+
+		authMode:           AuthBasic,
+		requestTimeout:     httpclient.DefaultRequestTimeout,
+		maxTransientErrors: DefaultMaxTransientErrors,
+	}
+}
+
+// SetRequestTimeout задает ограничение времени одного запроса к API Jenkins (jenkins.request_timeout).
+// Ограничение действует для каждого опроса WaitForJob отдельно и не зависит от общего таймаута ожидания.
+// Неположительное значение восстанавливает значение по умолчанию httpclient.DefaultRequestTimeout.
+func (c *Client) SetRequestTimeout(d time.Duration) {
+	if d <= 0 {
+		d = httpclient.DefaultRequestTimeout
+	}
+	c.requestTimeout = d
+}
+
+// SetAuthMode задает способ аутентификации запросов (jenkins.auth_mode): AuthBasic (по умолчанию)
+// или AuthBearer, при котором API-токен передается в заголовке Authorization: Bearer, а имя пользователя
+// не используется. Пустое значение восстанавливает AuthBasic.
+func (c *Client) SetAuthMode(mode string) {
+	if mode == "" {
+		mode = AuthBasic
+	}
+	c.authMode = mode
+}
+
+// authorize добавляет в запрос учетные данные Jenkins согласно способу аутентификации.
+// Запрос без имени пользователя и токена отправляется без аутентификации.
+func (c *Client) authorize(req *http.Request) {
+	switch {
+	case c.authMode == AuthBearer && c.apiToken != "":
+		req.Header.Set("Authorization", "Bearer "+c.apiToken)
+	case c.authMode != AuthBearer && (c.username != "" || c.apiToken != ""):
+		req.SetBasicAuth(c.username, c.apiToken)
+	}
+}
+
+// SetMaxTransientErrors задает число временных ошибок (ErrUnavailable), после которого WaitForJob
+// прекращает ожидание и возвращает ошибку (jenkins.max_transient_errors). 0 - ошибка прерывает ожидание сразу.
+func (c *Client) SetMaxTransientErrors(n int) {
+	if n < 0 {
+		n = 0
 	}
+	c.maxTransientErrors = n
+}
+
+// SetRetryStatusCodes задает дополнительные коды ответа, которые считаются временной недоступностью
+// Jenkins (ErrUnavailable) наравне с 5xx и повторяются (server.retry_status_codes), например коды шлюза
+// перед Jenkins. Должен вызываться до начала работы с клиентом.
+func (c *Client) SetRetryStatusCodes(codes []int) {
+	c.retryStatusCodes = make(map[int]bool, len(codes))
+	for _, code := range codes {
+		c.retryStatusCodes[code] = true
+	}
+}
+
+// repositoryKey - ключ контекста с именем репозитория, для которого выполняется опрос.
+type repositoryKey struct{}
+
+// WithRepository возвращает контекст, в котором опросы WaitForJob учитываются в метрике
+// jenkins_poll_attempts_total с меткой repo, равной repo.
+func WithRepository(ctx context.Context, repo string) context.Context {
+	return context.WithValue(ctx, repositoryKey{}, repo)
+}
+
+// repositoryFromContext возвращает имя репозитория из контекста.
+func repositoryFromContext(ctx context.Context) string {
+	repo, _ := ctx.Value(repositoryKey{}).(string)
+	return repo
 }
 
 // WaitForJob ожидает появления задачи Jenkins, соответствующей указанному регулярному выражению.
 // Выполняет периодический опрос с указанным интервалом до истечения таймаута.
 // Возвращает найденную задачу или ошибку, если задача не найдена в течение таймаута.
+// Если в контексте задана пауза WithEmptyTreeGrace, пустой список задач на первом опросе
+// не считается отсутствием задачи: опрос повторяется после паузы, а таймаут продлевается на ее длительность.
+// Временная ошибка опроса (ErrUnavailable) записывается в лог, и ожидание продолжается до следующего опроса;
+// ошибка возвращается, только если таких ошибок больше SetMaxTransientErrors.
 func (c *Client) WaitForJob(ctx context.Context, pattern *regexp.Regexp, jobRoot string, timeout, interval time.Duration) (*Job, error) {
 	c.log.Debug("waiting for Jenkins job",
 		"pattern", pattern.String(),
@@ -65,19 +193,31 @@ func (c *Client) WaitForJob(ctx context.Context, pattern *regexp.Regexp, jobRoot
 		"timeout", timeout,
 		"poll_interval", interval)
 
-	ctx, cancel := context.WithTimeout(ctx, timeout)
+	parent, started := ctx, time.Now()
+	ctx, cancel := context.WithTimeout(parent, timeout)
 	defer cancel()
 
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
-	attempt := 0
+	grace := emptyTreeGraceFromContext(parent)
+	attempt, transient := 0, 0
 	for {
 		attempt++
+		metrics.JenkinsPollAttempts.Inc(repositoryFromContext(parent))
 		c.log.Debug("polling Jenkins for job", "attempt", attempt, "pattern", pattern.String(), "job_root", jobRoot)
 
-		job, err := c.findJob(ctx, pattern, jobRoot)
-		if err != nil {
+		job, total, err := c.findJob(ctx, pattern, jobRoot)
+		switch {
+		case err == nil:
+		case ctx.Err() == nil && errors.Is(err, ErrUnavailable) && transient < c.maxTransientErrors:
+			transient++
+			c.log.Warn("transient Jenkins error, retrying on next poll",
+				"err", err,
+				"attempt", attempt,
+				"transient_errors", transient,
+				"max_transient_errors", c.maxTransientErrors)
+		default:
 			c.log.Debug("error finding job", "err", err, "attempt", attempt)
 			return nil, err
 		}
@@ -90,6 +230,21 @@ func (c *Client) WaitForJob(ctx context.Context, pattern *regexp.Regexp, jobRoot
 			return job, nil
 		}
 
+		if attempt == 1 && err == nil && total == 0 && grace > 0 {
+			// An empty tree right away is often a transient indexing state: retry once after
+			// the grace period and do not count that pause against the timeout.
+			c.log.Info("Jenkins returned no jobs on first poll, retrying after grace period",
+				"job_root", jobRoot,
+				"grace", grace)
+			remaining := timeout - time.Since(started)
+			select {
+			case <-parent.Done():
+				return nil, parent.Err()
+			case <-time.After(grace):
+			}
+			return c.WaitForJob(WithEmptyTreeGrace(parent, 0), pattern, jobRoot, remaining, interval)
+		}
+
 		c.log.Debug("job not found, waiting for next poll", "attempt", attempt, "interval", interval)
 
 		select {
@@ -101,12 +256,21 @@ func (c *Client) WaitForJob(ctx context.Context, pattern *regexp.Regexp, jobRoot
 	}
 }
 
-// findJob ищет задачу Jenkins, соответствующую указанному регулярному выражению.
-// Проверяет как имя задачи, так и полное имя. Возвращает найденную задачу или nil, если не найдена.
-func (c *Client) findJob(ctx context.Context, pattern *regexp.Regexp, jobRoot string) (*Job, error) {
-	jobs, err := c.GetJobs(ctx, jobRoot)
+// FindJob выполняет однократный поиск задачи Jenkins, соответствующей указанному регулярному выражению.
+// Проверяет как имя задачи, так и полное имя. Если совпали несколько задач, выбирает одну по стратегии
+// из контекста (см. WithMatchSelect). Если в контексте задана глубина поиска (см. WithSearchDepth),
+// просматриваются и задачи вложенных директорий в заданном порядке обхода.
+// Возвращает найденную задачу или nil, если не найдена.
+func (c *Client) FindJob(ctx context.Context, pattern *regexp.Regexp, jobRoot string) (*Job, error) {
+	job, _, err := c.findJob(ctx, pattern, jobRoot)
+	return job, err
+}
+
+// findJob выполняет поиск задачи как FindJob и дополнительно возвращает общее число задач в директории.
+func (c *Client) findJob(ctx context.Context, pattern *regexp.Regexp, jobRoot string) (*Job, int, error) {
+	jobs, err := c.listJobs(ctx, jobRoot)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	c.log.Debug("Jenkins jobs retrieved",
@@ -114,9 +278,46 @@ func (c *Client) findJob(ctx context.Context, pattern *regexp.Regexp, jobRoot st
 		"pattern", pattern.String(),
 		"job_root", jobRoot)
 
+	strategy := matchSelectFromContext(ctx)
+	matched := c.matchJobs(ctx, pattern, jobs, strategy == "" || strategy == SelectFirst)
+
+	if len(matched) == 0 {
+		c.log.Debug("no jobs matched pattern", "pattern", pattern.String(), "jobs_checked", len(jobs))
+		return nil, len(jobs), nil
+	}
+	if len(matched) > 1 {
+		c.log.Debug("multiple jobs matched pattern", "pattern", pattern.String(), "matched", len(matched), "strategy", strategy)
+	}
+	return selectJob(strategy, matched), len(jobs), nil
+}
+
+// FindJobs выполняет однократный поиск всех задач Jenkins, соответствующих регулярному выражению,
+// по имени или полному имени. С глубиной поиска из контекста (см. WithSearchDepth) просматриваются
+// задачи вложенных директорий на любом уровне до заданной глубины; порядок результата - порядок обхода.
+// Возвращает nil, если совпадений нет.
+func (c *Client) FindJobs(ctx context.Context, pattern *regexp.Regexp, jobRoot string) ([]Job, error) {
+	jobs, err := c.listJobs(ctx, jobRoot)
+	if err != nil {
+		return nil, err
+	}
+	return c.matchJobs(ctx, pattern, jobs, false), nil
+}
+
+// matchJobs возвращает задачи, имя или полное имя которых соответствует шаблону, заполняя Matches.
+// Если first равен true, поиск останавливается на первом совпадении.
+func (c *Client) matchJobs(ctx context.Context, pattern *regexp.Regexp, jobs []Job, first bool) []Job {
+	var matched []Job
 	for _, job := range jobs {
-		matchesName := pattern.MatchString(job.Name)
-		matchesFullName := pattern.MatchString(job.FullName)
+		matchesName, err := matchString(ctx, pattern, job.Name)
+		if err != nil {
+			c.log.Warn("job name match aborted", "err", err, "job_name", job.Name, "pattern", pattern.String())
+			continue
+		}
+		matchesFullName, err := matchString(ctx, pattern, job.FullName)
+		if err != nil {
+			c.log.Warn("job full name match aborted", "err", err, "job_full_name", job.FullName, "pattern", pattern.String())
+			continue
+		}
 		c.log.Debug("checking job against pattern",
 			"job_name", job.Name,
 			"job_full_name", job.FullName,
@@ -125,22 +326,28 @@ func (c *Client) findJob(ctx context.Context, pattern *regexp.Regexp, jobRoot st
 			"matches_full_name", matchesFullName)
 
 		if matchesName || matchesFullName {
+			if matchesName {
+				job.Matches = pattern.FindStringSubmatch(job.Name)
+			} else {
+				job.Matches = pattern.FindStringSubmatch(job.FullName)
+			}
 			c.log.Debug("job matched pattern",
 				"job_name", job.Name,
 				"job_full_name", job.FullName,
 				"job_url", job.URL)
-			return &job, nil
+			matched = append(matched, job)
+			if first {
+				break
+			}
 		}
 	}
-
-	c.log.Debug("no jobs matched pattern", "pattern", pattern.String(), "jobs_checked", len(jobs))
-	return nil, nil
+	return matched
 }
 
 // CheckAccessibility проверяет доступность Jenkins, выполняя запрос к эндпоинту /api/json.
 // Возвращает ошибку, если Jenkins недоступен или аутентификация не удалась.
 func (c *Client) CheckAccessibility(ctx context.Context) error {
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, c.requestTimeout)
 	defer cancel()
 
 	endpoint := fmt.Sprintf("%s/api/json", c.baseURL)
@@ -149,9 +356,7 @@ func (c *Client) CheckAccessibility(ctx context.Context) error {
 		return fmt.Errorf("create request: %w", err)
 	}
 
-	if c.username != "" || c.apiToken != "" {
-		req.SetBasicAuth(c.username, c.apiToken)
-	}
+	c.authorize(req)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -160,7 +365,7 @@ func (c *Client) CheckAccessibility(ctx context.Context) error {
 	defer resp.Body.Close()
 
 	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
-		return fmt.Errorf("authentication failed: status %s", resp.Status)
+		return fmt.Errorf("%w: status %s", ErrAuthFailed, resp.Status)
 	}
 	if resp.StatusCode == http.StatusNotFound {
 		return fmt.Errorf("jenkins not found: status %s", resp.Status)
@@ -173,9 +378,10 @@ func (c *Client) CheckAccessibility(ctx context.Context) error {
 }
 
 // GetJobs получает список задач из указанной корневой директории Jenkins.
-// Если jobRoot пуст, возвращает задачи из корневой директории Jenkins.
+// Если jobRoot пуст, возвращает задачи из корневой директории Jenkins. С WithMatrix в контексте
+// для matrix-задач запрашиваются также их активные конфигурации.
 func (c *Client) GetJobs(ctx context.Context, jobRoot string) ([]Job, error) {
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, c.requestTimeout)
 	defer cancel()
 
 	apiPath := "/api/json"
@@ -198,7 +404,7 @@ func (c *Client) GetJobs(ctx context.Context, jobRoot string) ([]Job, error) {
 	}
 
 	query := endpoint.Query()
-	query.Set("tree", "jobs[name,url,fullName]")
+	query.Set("tree", jobsTree(ctx))
 	endpoint.RawQuery = query.Encode()
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint.String(), nil)
@@ -206,20 +412,28 @@ func (c *Client) GetJobs(ctx context.Context, jobRoot string) ([]Job, error) {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
 
-	if c.username != "" || c.apiToken != "" {
-		req.SetBasicAuth(c.username, c.apiToken)
-	}
+	c.authorize(req)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("jenkins api request: %w", err)
+		return nil, fmt.Errorf("%w: jenkins api request: %w", ErrUnavailable, err)
 	}
 	defer resp.Body.Close()
 
 	respBody, _ := io.ReadAll(resp.Body)
 
+	if c.retryStatusCodes[resp.StatusCode] {
+		return nil, fmt.Errorf("%w: jenkins api status: %s", ErrUnavailable, resp.Status)
+	}
+	if resp.StatusCode == http.StatusNotFound && jobRoot != "" {
+		return nil, fmt.Errorf("%w: %s (status %s)", ErrJobRootNotFound, jobRoot, resp.Status)
+	}
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return nil, fmt.Errorf("%w: status %s", ErrAuthFailed, resp.Status)
+	}
 	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("jenkins api status: %s", resp.Status)
+		// Rate limiting (429) and other non-auth client errors are usually gateway hiccups: keep polling.
+		return nil, fmt.Errorf("%w: jenkins api status: %s", ErrUnavailable, resp.Status)
 	}
 
 	var jobs jobsResponse
@@ -233,7 +447,7 @@ func (c *Client) GetJobs(ctx context.Context, jobRoot string) ([]Job, error) {
 // CheckJobRootExists проверяет существование указанной корневой директории задач в Jenkins.
 // Если jobRoot пуст, считается валидным (корневая директория Jenkins).
 func (c *Client) CheckJobRootExists(ctx context.Context, jobRoot string) error {
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, c.requestTimeout)
 	defer cancel()
 
 	if jobRoot == "" {
@@ -257,9 +471,7 @@ func (c *Client) CheckJobRootExists(ctx context.Context, jobRoot string) error {
 		return fmt.Errorf("create request: %w", err)
 	}
 
-	if c.username != "" || c.apiToken != "" {
-		req.SetBasicAuth(c.username, c.apiToken)
-	}
+	c.authorize(req)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -268,7 +480,7 @@ func (c *Client) CheckJobRootExists(ctx context.Context, jobRoot string) error {
 	defer resp.Body.Close()
 
 	if resp.StatusCode == http.StatusNotFound {
-		return fmt.Errorf("job root not found: status %s", resp.Status)
+		return fmt.Errorf("%w: status %s", ErrJobRootNotFound, resp.Status)
 	}
 	if resp.StatusCode == http.StatusForbidden {
 		return fmt.Errorf("access denied to job root: status %s", resp.Status)
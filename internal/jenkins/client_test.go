@@ -1,16 +1,23 @@
 package jenkins_test
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"regexp"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/example/gitea-jenkins-webhook/internal/jenkins"
+	"github.com/example/gitea-jenkins-webhook/internal/metrics"
 )
 
 func TestWaitForJob(t *testing.T) {
@@ -31,7 +38,8 @@ func TestWaitForJob(t *testing.T) {
 		Timeout: time.Second,
 	}, nil)
 
-	ctx := context.Background()
+	polls := metrics.JenkinsPollAttempts.Value("org/wait-for-job")
+	ctx := jenkins.WithRepository(context.Background(), "org/wait-for-job")
 	re := regexp.MustCompile(`job-123`)
 	job, err := client.WaitForJob(ctx, re, "", 2*time.Second, 100*time.Millisecond)
 	if err != nil {
@@ -40,6 +48,9 @@ func TestWaitForJob(t *testing.T) {
 	if job == nil || job.Name != "job-123" {
 		t.Fatalf("unexpected job: %#v", job)
 	}
+	if got := metrics.JenkinsPollAttempts.Value("org/wait-for-job") - polls; got != 2 {
+		t.Fatalf("expected 2 poll attempts counted for the repository, got %d", got)
+	}
 }
 
 func TestWaitForJobTimeout(t *testing.T) {
@@ -88,3 +99,750 @@ func TestWaitForJobWithJobRoot(t *testing.T) {
 		t.Fatalf("expected path %s, got %s", expectedPath, requestedPath)
 	}
 }
+
+func TestWaitForJobSlowMatchDoesNotHang(t *testing.T) {
+	slowName := strings.Repeat("a", 4<<10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"jobs": []jenkins.Job{{Name: slowName, FullName: slowName}},
+		})
+	}))
+	defer ts.Close()
+
+	client := jenkins.NewClient(ts.URL, "", "", &http.Client{Timeout: 5 * time.Second}, nil)
+	ctx := jenkins.WithMatchTimeout(context.Background(), time.Microsecond)
+	re := regexp.MustCompile(`^(a|aa)*b$`)
+
+	start := time.Now()
+	job, err := client.WaitForJob(ctx, re, "", 500*time.Millisecond, 100*time.Millisecond)
+	if err == nil || job != nil {
+		t.Fatalf("expected timeout without a match, got job %#v, err %v", job, err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Fatalf("slow match blocked the wait for %s", elapsed)
+	}
+}
+
+func TestWaitForJobReturnsSubmatches(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"jobs": []jenkins.Job{{Name: "PR-12-build-877", FullName: "org/PR-12-build-877"}},
+		})
+	}))
+	defer ts.Close()
+
+	client := jenkins.NewClient(ts.URL, "", "", &http.Client{Timeout: time.Second}, nil)
+	re := regexp.MustCompile(`^PR-12-build-(\d+)$`)
+	job, err := client.WaitForJob(context.Background(), re, "", time.Second, 100*time.Millisecond)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(job.Matches) != 2 || job.Matches[1] != "877" {
+		t.Fatalf("unexpected submatches: %#v", job.Matches)
+	}
+}
+
+func TestFindJobSelectsAmongMultipleMatches(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"jobs": []jenkins.Job{
+				{Name: "PR-7-b", FullName: "PR-7-b", LastBuild: &jenkins.Build{Number: 1, Timestamp: 1000}},
+				{Name: "PR-7-c", FullName: "PR-7-c", LastBuild: &jenkins.Build{Number: 4, Timestamp: 3000}},
+				{Name: "PR-7-a", FullName: "PR-7-a"},
+				{Name: "PR-8-a", FullName: "PR-8-a", LastBuild: &jenkins.Build{Number: 9, Timestamp: 9000}},
+			},
+		})
+	}))
+	defer ts.Close()
+
+	client := jenkins.NewClient(ts.URL, "", "", &http.Client{Timeout: time.Second}, nil)
+	re := regexp.MustCompile(`^PR-7-`)
+
+	tests := []struct {
+		strategy string
+		want     string
+	}{
+		{"", "PR-7-b"},
+		{jenkins.SelectFirst, "PR-7-b"},
+		{jenkins.SelectNewest, "PR-7-c"},
+		{jenkins.SelectAlphabetical, "PR-7-a"},
+	}
+	for _, tt := range tests {
+		t.Run("strategy "+tt.strategy, func(t *testing.T) {
+			ctx := jenkins.WithMatchSelect(context.Background(), tt.strategy)
+			job, err := client.FindJob(ctx, re, "")
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if job == nil || job.Name != tt.want {
+				t.Fatalf("expected %s, got %#v", tt.want, job)
+			}
+		})
+	}
+}
+
+func TestTriggerBuild(t *testing.T) {
+	tests := []struct {
+		name        string
+		crumbStatus int
+		buildStatus int
+		wantCrumb   string
+		wantErr     error
+	}{
+		{name: "with crumb", crumbStatus: http.StatusOK, buildStatus: http.StatusCreated, wantCrumb: "c0ffee"},
+		{name: "crumb issuer disabled", crumbStatus: http.StatusNotFound, buildStatus: http.StatusCreated},
+		{name: "auth failure", crumbStatus: http.StatusNotFound, buildStatus: http.StatusForbidden, wantErr: jenkins.ErrAuthFailed},
+		{name: "crumb auth failure", crumbStatus: http.StatusUnauthorized, wantErr: jenkins.ErrAuthFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				gotPath  string
+				gotForm  url.Values
+				gotCrumb string
+			)
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/crumbIssuer/api/json" {
+					w.WriteHeader(tt.crumbStatus)
+					_, _ = w.Write([]byte(`{"crumbRequestField":"Jenkins-Crumb","crumb":"c0ffee"}`))
+					return
+				}
+				gotPath = r.URL.Path
+				gotCrumb = r.Header.Get("Jenkins-Crumb")
+				_ = r.ParseForm()
+				gotForm = r.PostForm
+				w.Header().Set("Location", "https://jenkins/queue/item/7/")
+				w.WriteHeader(tt.buildStatus)
+			}))
+			defer ts.Close()
+
+			client := jenkins.NewClient(ts.URL, "user", "token", nil, nil)
+			queueURL, err := client.TriggerBuild(context.Background(), "org/PR-1", map[string]string{"BRANCH": "main"})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if gotPath != "/job/org/job/PR-1/buildWithParameters" {
+				t.Fatalf("unexpected path: %s", gotPath)
+			}
+			if gotForm.Get("BRANCH") != "main" {
+				t.Fatalf("unexpected form: %v", gotForm)
+			}
+			if gotCrumb != tt.wantCrumb {
+				t.Fatalf("expected crumb %q, got %q", tt.wantCrumb, gotCrumb)
+			}
+			if queueURL != "https://jenkins/queue/item/7/" {
+				t.Fatalf("unexpected queue url: %s", queueURL)
+			}
+		})
+	}
+}
+
+func TestTriggerBuildCachesCrumb(t *testing.T) {
+	var crumbRequests atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/crumbIssuer/api/json" {
+			crumbRequests.Add(1)
+			_, _ = w.Write([]byte(`{"crumbRequestField":"Jenkins-Crumb","crumb":"c0ffee"}`))
+			return
+		}
+		if r.Header.Get("Jenkins-Crumb") != "c0ffee" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Location", "https://jenkins/queue/item/7/")
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer ts.Close()
+
+	client := jenkins.NewClient(ts.URL, "user", "token", nil, nil)
+	for i := 0; i < 3; i++ {
+		if _, err := client.TriggerBuild(context.Background(), "PR-1", nil); err != nil {
+			t.Fatalf("trigger %d: %v", i, err)
+		}
+	}
+	if got := crumbRequests.Load(); got != 1 {
+		t.Fatalf("expected crumb to be fetched once, got %d", got)
+	}
+}
+
+func TestTriggerBuildKeepsCrumbSession(t *testing.T) {
+	var sessions atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/crumbIssuer/api/json" {
+			// Like Jenkins, bind the crumb to a new session.
+			n := sessions.Add(1)
+			http.SetCookie(w, &http.Cookie{Name: "JSESSIONID", Value: fmt.Sprintf("session-%d", n), Path: "/"})
+			_, _ = fmt.Fprintf(w, `{"crumbRequestField":"Jenkins-Crumb","crumb":"crumb-%d"}`, n)
+			return
+		}
+		session, err := r.Cookie("JSESSIONID")
+		if err != nil || "crumb-"+strings.TrimPrefix(session.Value, "session-") != r.Header.Get("Jenkins-Crumb") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Location", "https://jenkins/queue/item/7/")
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer ts.Close()
+
+	client := jenkins.NewClient(ts.URL, "user", "token", ts.Client(), nil)
+	if _, err := client.TriggerBuild(context.Background(), "PR-1", nil); err != nil {
+		t.Fatalf("expected the crumb to be accepted within its session, got %v", err)
+	}
+	if ts.Client().Jar != nil {
+		t.Fatalf("the caller's http client must not be modified")
+	}
+}
+
+func TestTriggerBuildRefreshesCrumbOnForbidden(t *testing.T) {
+	var crumbRequests atomic.Int32
+	var builds atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/crumbIssuer/api/json" {
+			n := crumbRequests.Add(1)
+			_, _ = fmt.Fprintf(w, `{"crumbRequestField":"Jenkins-Crumb","crumb":"crumb-%d"}`, n)
+			return
+		}
+		builds.Add(1)
+		// Jenkins restarted after the first build: only the second crumb is valid now.
+		if builds.Load() > 1 && r.Header.Get("Jenkins-Crumb") != "crumb-2" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Location", "https://jenkins/queue/item/7/")
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer ts.Close()
+
+	client := jenkins.NewClient(ts.URL, "user", "token", nil, nil)
+	for i := 0; i < 2; i++ {
+		if _, err := client.TriggerBuild(context.Background(), "PR-1", nil); err != nil {
+			t.Fatalf("trigger %d: %v", i, err)
+		}
+	}
+	if got := crumbRequests.Load(); got != 2 {
+		t.Fatalf("expected crumb to be refreshed once, got %d fetches", got)
+	}
+	if got := builds.Load(); got != 3 {
+		t.Fatalf("expected rejected build request to be retried once, got %d requests", got)
+	}
+}
+
+func TestProgressiveText(t *testing.T) {
+	var gotURI string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotURI = r.URL.RequestURI()
+		w.Header().Set("X-Text-Size", "42")
+		w.Header().Set("X-More-Data", "true")
+		_, _ = w.Write([]byte("Building...\n"))
+	}))
+	defer ts.Close()
+
+	client := jenkins.NewClient(ts.URL, "", "", nil, nil)
+	job := &jenkins.Job{Name: "PR-1", URL: ts.URL + "/job/PR-1/", LastBuild: &jenkins.Build{Number: 3}}
+	chunk, err := client.ProgressiveText(context.Background(), job, 30)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if gotURI != "/job/PR-1/3/logText/progressiveText?start=30" {
+		t.Fatalf("unexpected request: %s", gotURI)
+	}
+	if chunk.Text != "Building...\n" || chunk.Next != 42 || !chunk.More {
+		t.Fatalf("unexpected chunk: %+v", chunk)
+	}
+}
+
+func TestGetLastBuildResult(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   *jenkins.BuildResult
+	}{
+		{
+			name:   "finished build",
+			status: http.StatusOK,
+			body:   `{"result":"FAILURE","number":7,"building":false,"url":"https://jenkins/job/org/job/PR-1/7/"}`,
+			want:   &jenkins.BuildResult{Result: "FAILURE", Number: 7, URL: "https://jenkins/job/org/job/PR-1/7/"},
+		},
+		{
+			name:   "running build",
+			status: http.StatusOK,
+			body:   `{"result":null,"number":8,"building":true,"url":"https://jenkins/job/org/job/PR-1/8/"}`,
+			want:   &jenkins.BuildResult{Number: 8, Building: true, URL: "https://jenkins/job/org/job/PR-1/8/"},
+		},
+		{name: "no builds", status: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotURI string
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotURI = r.URL.RequestURI()
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer ts.Close()
+
+			client := jenkins.NewClient(ts.URL, "", "", nil, nil)
+			build, err := client.GetLastBuildResult(context.Background(), "org/PR-1")
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if gotURI != "/job/org/job/PR-1/lastBuild/api/json?tree=result,number,url,building" {
+				t.Fatalf("unexpected request: %s", gotURI)
+			}
+			if (build == nil) != (tt.want == nil) || (build != nil && *build != *tt.want) {
+				t.Fatalf("unexpected build: %+v, want %+v", build, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetLastBuildResultClassifiesStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		codes   []int
+		wantErr error
+	}{
+		{name: "server error", status: http.StatusBadGateway, wantErr: jenkins.ErrUnavailable},
+		{name: "rate limited", status: http.StatusTooManyRequests, wantErr: jenkins.ErrUnavailable},
+		{name: "configured code", status: http.StatusForbidden, codes: []int{http.StatusForbidden}, wantErr: jenkins.ErrUnavailable},
+		{name: "auth failure", status: http.StatusForbidden, wantErr: jenkins.ErrAuthFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			defer ts.Close()
+
+			client := jenkins.NewClient(ts.URL, "", "", nil, nil)
+			client.SetRetryStatusCodes(tt.codes)
+			if _, err := client.GetLastBuildResult(context.Background(), "org/PR-1"); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestWaitForJobRetriesEmptyTreeAfterGrace(t *testing.T) {
+	tests := []struct {
+		name    string
+		grace   time.Duration
+		timeout time.Duration
+		wantErr bool
+	}{
+		// The timeout is generous so the grace retry is not starved under the race detector.
+		{name: "grace enabled", grace: 50 * time.Millisecond, timeout: 5 * time.Second},
+		{name: "grace disabled", timeout: 100 * time.Millisecond, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				if atomic.AddInt32(&calls, 1) == 1 {
+					_, _ = w.Write([]byte(`{"jobs":[]}`))
+					return
+				}
+				_, _ = w.Write([]byte(`{"jobs":[{"name":"PR-1","url":"https://jenkins/job/PR-1/","fullName":"PR-1"}]}`))
+			}))
+			defer ts.Close()
+
+			client := jenkins.NewClient(ts.URL, "", "", nil, nil)
+			ctx := jenkins.WithEmptyTreeGrace(context.Background(), tt.grace)
+			// The poll interval exceeds the timeout, so only the grace retry can see the second response.
+			job, err := client.WaitForJob(ctx, regexp.MustCompile(`^PR-1$`), "", tt.timeout, time.Minute)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected timeout, got job %+v", job)
+				}
+				return
+			}
+			if err != nil || job == nil || job.Name != "PR-1" {
+				t.Fatalf("expected job after grace retry, got %+v, %v", job, err)
+			}
+		})
+	}
+}
+
+func TestFindJobRecursiveOrder(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/json":
+			_, _ = w.Write([]byte(`{"jobs":[
+				{"_class":"com.cloudbees.hudson.plugins.folder.Folder","name":"team","url":"https://jenkins/job/team/","fullName":"team"},
+				{"_class":"hudson.model.FreeStyleProject","name":"PR-1","url":"https://jenkins/job/PR-1/","fullName":"PR-1"}
+			]}`))
+		case "/job/team/api/json":
+			_, _ = w.Write([]byte(`{"jobs":[
+				{"_class":"hudson.model.FreeStyleProject","name":"PR-1","url":"https://jenkins/job/team/job/PR-1/","fullName":"team/PR-1"}
+			]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	client := jenkins.NewClient(ts.URL, "", "", nil, nil)
+	pattern := regexp.MustCompile(`^PR-1$`)
+	tests := []struct {
+		order string
+		depth int
+		want  string
+	}{
+		{order: jenkins.OrderBFS, depth: 1, want: "PR-1"},
+		{order: jenkins.OrderDFS, depth: 1, want: "team/PR-1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.order, func(t *testing.T) {
+			ctx := jenkins.WithSearchDepth(context.Background(), tt.depth, tt.order)
+			job, err := client.FindJob(ctx, pattern, "")
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if job == nil || job.FullName != tt.want {
+				t.Fatalf("expected %s, got %+v", tt.want, job)
+			}
+		})
+	}
+}
+
+func TestFindJobsAcrossFolderHierarchy(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/job/ci/api/json":
+			_, _ = w.Write([]byte(`{"jobs":[
+				{"_class":"com.cloudbees.hudson.plugins.folder.Folder","name":"team","fullName":"ci/team"},
+				{"_class":"hudson.model.FreeStyleProject","name":"PR-7-lint","fullName":"ci/PR-7-lint"}
+			]}`))
+		case "/job/ci/job/team/api/json":
+			_, _ = w.Write([]byte(`{"jobs":[
+				{"_class":"org.jenkinsci.plugins.workflow.multibranch.WorkflowMultiBranchProject","name":"app","fullName":"ci/team/app"},
+				{"_class":"hudson.model.FreeStyleProject","name":"PR-8","fullName":"ci/team/PR-8"}
+			]}`))
+		case "/job/ci/job/team/job/app/api/json":
+			_, _ = w.Write([]byte(`{"jobs":[
+				{"_class":"org.jenkinsci.plugins.workflow.job.WorkflowJob","name":"PR-7","fullName":"ci/team/app/PR-7"},
+				{"_class":"com.cloudbees.hudson.plugins.folder.Folder","name":"nested","fullName":"ci/team/app/nested"}
+			]}`))
+		case "/job/ci/job/team/job/app/job/nested/api/json":
+			_, _ = w.Write([]byte(`{"jobs":[
+				{"_class":"hudson.model.FreeStyleProject","name":"PR-7-deep","fullName":"ci/team/app/nested/PR-7-deep"}
+			]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	client := jenkins.NewClient(ts.URL, "", "", nil, nil)
+	pattern := regexp.MustCompile(`PR-7`)
+	tests := []struct {
+		name  string
+		depth int
+		want  []string
+	}{
+		{name: "root only", depth: 0, want: []string{"ci/PR-7-lint"}},
+		{name: "two levels", depth: 2, want: []string{"ci/PR-7-lint", "ci/team/app/PR-7"}},
+		{name: "default depth", depth: 3, want: []string{"ci/PR-7-lint", "ci/team/app/PR-7", "ci/team/app/nested/PR-7-deep"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := jenkins.WithSearchDepth(context.Background(), tt.depth, jenkins.OrderBFS)
+			jobs, err := client.FindJobs(ctx, pattern, "ci")
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			got := make([]string, len(jobs))
+			for i, job := range jobs {
+				got[i] = job.FullName
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestFindJobMatchesMatrixConfigurations(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if !strings.Contains(r.URL.Query().Get("tree"), "activeConfigurations") {
+			_, _ = w.Write([]byte(`{"jobs":[{"_class":"hudson.matrix.MatrixProject","name":"PR-1","fullName":"PR-1","color":"red"}]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"jobs":[{"_class":"hudson.matrix.MatrixProject","name":"PR-1","fullName":"PR-1","color":"red",
+			"activeConfigurations":[
+				{"_class":"hudson.matrix.MatrixConfiguration","name":"label=linux,jdk=17","fullName":"PR-1/label=linux,jdk=17","color":"blue"},
+				{"_class":"hudson.matrix.MatrixConfiguration","name":"label=windows,jdk=17","color":"red"}
+			]}]}`))
+	}))
+	defer ts.Close()
+
+	client := jenkins.NewClient(ts.URL, "", "", nil, nil)
+	tests := []struct {
+		name     string
+		matrix   bool
+		pattern  string
+		wantName string
+		wantFull string
+	}{
+		{name: "linux axis", matrix: true, pattern: `^PR-1/label=linux,`, wantName: "label=linux,jdk=17", wantFull: "PR-1/label=linux,jdk=17"},
+		{name: "full name derived from parent", matrix: true, pattern: `label=windows`, wantName: "label=windows,jdk=17", wantFull: "PR-1/label=windows,jdk=17"},
+		{name: "parent still matches", matrix: true, pattern: `^PR-1$`, wantName: "PR-1", wantFull: "PR-1"},
+		{name: "configurations ignored without flag", matrix: false, pattern: `label=linux`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := jenkins.WithMatrix(context.Background(), tt.matrix)
+			job, err := client.FindJob(ctx, regexp.MustCompile(tt.pattern), "")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantName == "" {
+				if job != nil {
+					t.Fatalf("expected no match, got %+v", job)
+				}
+				return
+			}
+			if job == nil || job.Name != tt.wantName || job.FullName != tt.wantFull {
+				t.Fatalf("expected %s (%s), got %+v", tt.wantName, tt.wantFull, job)
+			}
+		})
+	}
+}
+
+func TestRequestTimeoutLimitsEachPoll(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(2 * time.Second):
+		}
+	}))
+	defer ts.Close()
+
+	client := jenkins.NewClient(ts.URL, "user", "token", nil, nil)
+	client.SetRequestTimeout(50 * time.Millisecond)
+
+	start := time.Now()
+	_, err := client.WaitForJob(context.Background(), regexp.MustCompile("^job$"), "", 5*time.Second, 10*time.Millisecond)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected request deadline error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("poll took %v: request timeout was not applied separately from the wait timeout", elapsed)
+	}
+}
+
+func TestRootScanLimitWarnsAndMatchesWithinSample(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"jobs":[{"name":"job-1"},{"name":"job-2"},{"name":"job-3"},{"name":"job-4"},{"name":"job-5"}]}`))
+	}))
+	defer ts.Close()
+
+	var logs bytes.Buffer
+	client := jenkins.NewClient(ts.URL, "", "", nil, slog.New(slog.NewTextHandler(&logs, nil)))
+	ctx := jenkins.WithRootScanLimit(jenkins.WithRepository(context.Background(), "org/repo"), 3)
+
+	job, err := client.FindJob(ctx, regexp.MustCompile(`^job-2$`), "")
+	if err != nil || job == nil || job.Name != "job-2" {
+		t.Fatalf("expected job within the sample to match, got %+v (%v)", job, err)
+	}
+	if job, err := client.FindJob(ctx, regexp.MustCompile(`^job-5$`), ""); err != nil || job != nil {
+		t.Fatalf("expected job beyond the sample to be skipped, got %+v (%v)", job, err)
+	}
+	if got := strings.Count(logs.String(), "jenkins root has too many jobs"); got != 1 {
+		t.Fatalf("expected one warning about the large root scan, got %d in:\n%s", got, logs.String())
+	}
+	if !strings.Contains(logs.String(), "root_scan_limit=3") || !strings.Contains(logs.String(), "jobs=5") {
+		t.Fatalf("expected warning to report the limit and job count, got:\n%s", logs.String())
+	}
+
+	// A configured job_root is not limited.
+	if job, err := client.FindJob(ctx, regexp.MustCompile(`^job-5$`), "folder"); err != nil || job == nil {
+		t.Fatalf("expected job_root scan to be unlimited, got %+v (%v)", job, err)
+	}
+}
+
+func TestWaitForJobRetriesTransientErrors(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxTransient int
+		wantErr      bool
+	}{
+		{name: "within limit", maxTransient: 2},
+		{name: "limit exceeded", maxTransient: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&calls, 1) <= 2 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"jobs":[{"name":"PR-1","url":"https://jenkins/job/PR-1/"}]}`))
+			}))
+			defer ts.Close()
+
+			client := jenkins.NewClient(ts.URL, "", "", nil, nil)
+			client.SetMaxTransientErrors(tt.maxTransient)
+			job, err := client.WaitForJob(context.Background(), regexp.MustCompile(`^PR-1$`), "", 5*time.Second, 10*time.Millisecond)
+			if tt.wantErr {
+				if !errors.Is(err, jenkins.ErrUnavailable) {
+					t.Fatalf("expected unavailable error after exceeding the limit, got job %+v, err %v", job, err)
+				}
+				return
+			}
+			if err != nil || job == nil || job.Name != "PR-1" {
+				t.Fatalf("expected job after transient errors, got %+v (%v)", job, err)
+			}
+			if got := atomic.LoadInt32(&calls); got != 3 {
+				t.Fatalf("expected 3 polls, got %d", got)
+			}
+		})
+	}
+}
+
+func TestWaitForJobReturnsAuthErrorImmediately(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer ts.Close()
+
+	client := jenkins.NewClient(ts.URL, "", "", nil, nil)
+	_, err := client.WaitForJob(context.Background(), regexp.MustCompile(`^PR-1$`), "", 5*time.Second, 10*time.Millisecond)
+	if got := atomic.LoadInt32(&calls); !errors.Is(err, jenkins.ErrAuthFailed) || got != 1 {
+		t.Fatalf("expected auth error on first poll, got %v after %d polls", err, got)
+	}
+}
+
+func TestWaitForJobRetriesClientErrors(t *testing.T) {
+	for _, status := range []int{http.StatusTooManyRequests, http.StatusNotFound, http.StatusBadRequest} {
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			var calls int32
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&calls, 1) == 1 {
+					w.WriteHeader(status)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"jobs":[{"name":"PR-1","url":"https://jenkins/job/PR-1/"}]}`))
+			}))
+			defer ts.Close()
+
+			client := jenkins.NewClient(ts.URL, "", "", nil, nil)
+			if _, err := client.GetJobs(context.Background(), ""); !errors.Is(err, jenkins.ErrUnavailable) {
+				t.Fatalf("expected status %d to be transient, got %v", status, err)
+			}
+			job, err := client.WaitForJob(context.Background(), regexp.MustCompile(`^PR-1$`), "", 5*time.Second, 10*time.Millisecond)
+			if err != nil || job == nil || job.Name != "PR-1" {
+				t.Fatalf("expected job after status %d, got %+v (%v)", status, job, err)
+			}
+		})
+	}
+}
+
+func TestAuthModeSetsAuthorizationHeader(t *testing.T) {
+	tests := []struct {
+		mode string
+		want string
+	}{
+		{mode: "", want: "Basic dXNlcjp0b2tlbg=="},
+		{mode: jenkins.AuthBasic, want: "Basic dXNlcjp0b2tlbg=="},
+		{mode: jenkins.AuthBearer, want: "Bearer token"},
+	}
+
+	for _, tt := range tests {
+		t.Run("mode "+tt.mode, func(t *testing.T) {
+			var got []string
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = append(got, r.Header.Get("Authorization"))
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"jobs":[]}`))
+			}))
+			defer ts.Close()
+
+			client := jenkins.NewClient(ts.URL, "user", "token", nil, nil)
+			client.SetAuthMode(tt.mode)
+			if _, err := client.GetJobs(context.Background(), ""); err != nil {
+				t.Fatalf("get jobs: %v", err)
+			}
+			if err := client.CheckAccessibility(context.Background()); err != nil {
+				t.Fatalf("check accessibility: %v", err)
+			}
+			if err := client.CheckJobRootExists(context.Background(), "folder"); err != nil {
+				t.Fatalf("check job root: %v", err)
+			}
+			if len(got) != 3 {
+				t.Fatalf("expected 3 requests, got %d", len(got))
+			}
+			for i, header := range got {
+				if header != tt.want {
+					t.Fatalf("request %d: expected Authorization %q, got %q", i, tt.want, header)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryStatusCodesAreTransient(t *testing.T) {
+	tests := []struct {
+		name    string
+		codes   []int
+		wantErr bool
+	}{
+		{name: "configured code retried", codes: []int{http.StatusForbidden}},
+		{name: "unconfigured code fails", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&calls, 1) == 1 {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"jobs":[{"name":"PR-1","url":"https://jenkins/job/PR-1/"}]}`))
+			}))
+			defer ts.Close()
+
+			client := jenkins.NewClient(ts.URL, "", "", nil, nil)
+			client.SetRetryStatusCodes(tt.codes)
+			job, err := client.WaitForJob(context.Background(), regexp.MustCompile(`^PR-1$`), "", 5*time.Second, 10*time.Millisecond)
+			if tt.wantErr {
+				if err == nil || errors.Is(err, jenkins.ErrUnavailable) {
+					t.Fatalf("expected a permanent error, got job %+v, err %v", job, err)
+				}
+				return
+			}
+			if err != nil || job == nil || job.Name != "PR-1" {
+				t.Fatalf("expected job after the configured status was retried, got %+v (%v)", job, err)
+			}
+		})
+	}
+}
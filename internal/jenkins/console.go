@@ -0,0 +1,64 @@
+package jenkins
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ConsoleChunk - фрагмент консольного вывода сборки, полученный через progressiveText.
+type ConsoleChunk struct {
+	Text string // Новые строки вывода начиная с запрошенного смещения
+	Next int64  // Смещение в байтах для следующего запроса (заголовок X-Text-Size)
+	More bool   // Сборка еще пишет вывод (заголовок X-More-Data)
+}
+
+// buildURL возвращает адрес последней сборки задачи: по номеру, если он известен, иначе lastBuild.
+func buildURL(job *Job) string {
+	base := strings.TrimRight(job.URL, "/")
+	if job.LastBuild != nil && job.LastBuild.Number > 0 {
+		return fmt.Sprintf("%s/%d", base, job.LastBuild.Number)
+	}
+	return base + "/lastBuild"
+}
+
+// ProgressiveText получает консольный вывод последней сборки задачи начиная с байта start
+// через /logText/progressiveText. Возвращает новый фрагмент и смещение для следующего запроса.
+func (c *Client) ProgressiveText(ctx context.Context, job *Job, start int64) (ConsoleChunk, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+	defer cancel()
+
+	endpoint := fmt.Sprintf("%s/logText/progressiveText?start=%d", buildURL(job), start)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return ConsoleChunk{}, fmt.Errorf("create request: %w", err)
+	}
+	c.authorize(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return ConsoleChunk{}, fmt.Errorf("jenkins api request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return ConsoleChunk{}, fmt.Errorf("read console text: %w", err)
+	}
+	if resp.StatusCode >= 400 {
+		return ConsoleChunk{}, fmt.Errorf("jenkins api status: %s", resp.Status)
+	}
+
+	chunk := ConsoleChunk{
+		Text: string(body),
+		Next: start + int64(len(body)),
+		More: strings.EqualFold(resp.Header.Get("X-More-Data"), "true"),
+	}
+	if size, err := strconv.ParseInt(resp.Header.Get("X-Text-Size"), 10, 64); err == nil {
+		chunk.Next = size
+	}
+	return chunk, nil
+}
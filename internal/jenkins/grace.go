@@ -0,0 +1,22 @@
+package jenkins
+
+import (
+	"context"
+	"time"
+)
+
+// emptyTreeGraceKey - ключ контекста для паузы после пустого списка задач при первом опросе.
+type emptyTreeGraceKey struct{}
+
+// WithEmptyTreeGrace возвращает контекст, в котором WaitForJob при пустом списке задач
+// на первом опросе ждет указанное время и повторяет опрос, не засчитывая паузу в таймаут.
+// Пустой список может означать, что Jenkins еще индексирует директорию. Нулевое значение отключает паузу.
+func WithEmptyTreeGrace(ctx context.Context, grace time.Duration) context.Context {
+	return context.WithValue(ctx, emptyTreeGraceKey{}, grace)
+}
+
+// emptyTreeGraceFromContext возвращает паузу после пустого списка задач из контекста.
+func emptyTreeGraceFromContext(ctx context.Context) time.Duration {
+	grace, _ := ctx.Value(emptyTreeGraceKey{}).(time.Duration)
+	return grace
+}
@@ -0,0 +1,53 @@
+package jenkins
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"time"
+)
+
+// ErrMatchTimeout возвращается, если сопоставление имени задачи с шаблоном не уложилось в отведенное время.
+var ErrMatchTimeout = errors.New("pattern match timed out")
+
+// matchTimeoutKey - ключ контекста для ограничения времени сопоставления шаблона.
+type matchTimeoutKey struct{}
+
+// WithMatchTimeout возвращает контекст, в котором каждое сопоставление имени задачи
+// с шаблоном ограничено указанным временем. Нулевое значение отключает ограничение.
+func WithMatchTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, matchTimeoutKey{}, timeout)
+}
+
+// matchTimeoutFromContext возвращает ограничение времени сопоставления из контекста.
+func matchTimeoutFromContext(ctx context.Context) time.Duration {
+	timeout, _ := ctx.Value(matchTimeoutKey{}).(time.Duration)
+	return timeout
+}
+
+// matchString сопоставляет строку с шаблоном с учетом ограничения времени из контекста.
+// При превышении ограничения возвращает ErrMatchTimeout; само сопоставление
+// продолжается в фоне, но воркер больше его не ожидает.
+func matchString(ctx context.Context, pattern *regexp.Regexp, s string) (bool, error) {
+	timeout := matchTimeoutFromContext(ctx)
+	if timeout <= 0 {
+		return pattern.MatchString(s), nil
+	}
+
+	result := make(chan bool, 1)
+	go func() {
+		result <- pattern.MatchString(s)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case matched := <-result:
+		return matched, nil
+	case <-timer.C:
+		return false, ErrMatchTimeout
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
@@ -0,0 +1,49 @@
+package jenkins
+
+import (
+	"context"
+	"strings"
+)
+
+// jobFields - поля задачи, запрашиваемые у API Jenkins.
+const jobFields = "_class,name,url,fullName,color,lastBuild[number,timestamp]"
+
+// matrixKey - ключ контекста для поиска среди конфигураций matrix-задач.
+type matrixKey struct{}
+
+// WithMatrix возвращает контекст, в котором поиск задач просматривает также активные конфигурации
+// matrix-задач (activeConfigurations), например "PR-1/label=linux,jdk=17". Конфигурации следуют
+// в списке сразу за родительской задачей.
+func WithMatrix(ctx context.Context, include bool) context.Context {
+	return context.WithValue(ctx, matrixKey{}, include)
+}
+
+// matrixFromContext сообщает, нужно ли просматривать конфигурации matrix-задач.
+func matrixFromContext(ctx context.Context) bool {
+	include, _ := ctx.Value(matrixKey{}).(bool)
+	return include
+}
+
+// jobsTree возвращает значение параметра tree запроса списка задач.
+func jobsTree(ctx context.Context) string {
+	if matrixFromContext(ctx) {
+		return "jobs[" + jobFields + ",activeConfigurations[" + jobFields + "]]"
+	}
+	return "jobs[" + jobFields + "]"
+}
+
+// expandMatrix добавляет после каждой matrix-задачи ее конфигурации. Если Jenkins не вернул
+// полное имя конфигурации, оно составляется из полного имени родителя и имени конфигурации.
+func expandMatrix(jobs []Job) []Job {
+	result := make([]Job, 0, len(jobs))
+	for _, job := range jobs {
+		result = append(result, job)
+		for _, cfg := range job.ActiveConfigurations {
+			if cfg.FullName == "" {
+				cfg.FullName = strings.Trim(job.FullName, "/") + "/" + cfg.Name
+			}
+			result = append(result, cfg)
+		}
+	}
+	return result
+}
@@ -0,0 +1,58 @@
+package jenkins
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Notification - уведомление о сборке, которое отправляет плагин Jenkins Notification.
+type Notification struct {
+	Name  string            `json:"name"` // Имя задачи
+	URL   string            `json:"url"`  // Путь задачи относительно Jenkins, например "job/folder/job/PR-1/"
+	Build NotificationBuild `json:"build"`
+}
+
+// NotificationBuild описывает сборку в уведомлении плагина Jenkins Notification.
+type NotificationBuild struct {
+	FullURL    string            `json:"full_url"`   // Полный URL сборки
+	Number     int               `json:"number"`     // Номер сборки
+	Phase      string            `json:"phase"`      // Фаза сборки: QUEUED, STARTED, COMPLETED, FINALIZED
+	Status     string            `json:"status"`     // Результат завершенной сборки: SUCCESS, FAILURE, UNSTABLE, ABORTED
+	Parameters map[string]string `json:"parameters"` // Параметры сборки
+}
+
+// Job возвращает задачу, о сборке которой сообщает уведомление. Цвет задачи отражает
+// результат завершенной сборки или, пока сборка не завершена, идущую сборку.
+func (n Notification) Job() *Job {
+	job := &Job{
+		Name:     n.Name,
+		FullName: fullNameFromPath(n.URL),
+		URL:      strings.TrimSuffix(n.Build.FullURL, fmt.Sprintf("%d/", n.Build.Number)),
+		Color:    "notbuilt_anime",
+	}
+	if n.Build.Phase == "COMPLETED" || n.Build.Phase == "FINALIZED" {
+		switch n.Build.Status {
+		case "SUCCESS":
+			job.Color = "blue"
+		case "FAILURE":
+			job.Color = "red"
+		case "UNSTABLE":
+			job.Color = "yellow"
+		default:
+			job.Color = "aborted"
+		}
+	}
+	return job
+}
+
+// fullNameFromPath преобразует путь задачи вида "job/folder/job/name/" в полное имя "folder/name".
+func fullNameFromPath(path string) string {
+	var segments []string
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	for i := 0; i+1 < len(parts); i += 2 {
+		if parts[i] == "job" {
+			segments = append(segments, parts[i+1])
+		}
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,122 @@
+package jenkins
+
+import (
+	"context"
+	"strings"
+)
+
+// Порядок обхода вложенных директорий при рекурсивном поиске задач.
+const (
+	OrderBFS = "bfs" // В ширину: задачи ближе к корню просматриваются раньше
+	OrderDFS = "dfs" // В глубину: содержимое директории просматривается сразу после нее
+)
+
+// searchKey - ключ контекста для параметров рекурсивного поиска задач.
+type searchKey struct{}
+
+// search описывает параметры рекурсивного поиска задач.
+type search struct {
+	depth int    // Глубина спуска во вложенные директории (0 - только jobRoot)
+	order string // Порядок обхода: OrderBFS или OrderDFS
+}
+
+// WithSearchDepth возвращает контекст, в котором поиск задач спускается во вложенные директории
+// (папки, multibranch-проекты) на глубину до depth уровней и просматривает их в порядке order
+// (OrderBFS или OrderDFS; пустое значение соответствует OrderBFS). Нулевая глубина отключает рекурсию.
+func WithSearchDepth(ctx context.Context, depth int, order string) context.Context {
+	return context.WithValue(ctx, searchKey{}, search{depth: depth, order: order})
+}
+
+// searchFromContext возвращает параметры рекурсивного поиска из контекста.
+func searchFromContext(ctx context.Context) search {
+	s, _ := ctx.Value(searchKey{}).(search)
+	return s
+}
+
+// isFolder сообщает, содержит ли задача вложенные задачи (папка, организация, multibranch-проект).
+func isFolder(job Job) bool {
+	return strings.HasSuffix(job.Class, "Folder") || strings.HasSuffix(job.Class, "MultiBranchProject")
+}
+
+// listJobs возвращает задачи jobRoot и, если в контексте задана глубина поиска, задачи вложенных
+// директорий в порядке обхода из контекста, а с WithMatrix - и конфигурации matrix-задач.
+// Ошибка получения вложенной директории записывается в лог, директория пропускается.
+func (c *Client) listJobs(ctx context.Context, jobRoot string) ([]Job, error) {
+	jobs, err := c.GetJobs(ctx, jobRoot)
+	if err != nil {
+		return nil, err
+	}
+	jobs = c.limitRootScan(ctx, jobRoot, jobs)
+	switch s := searchFromContext(ctx); {
+	case s.depth <= 0:
+	case s.order == OrderDFS:
+		jobs = c.walkDFS(ctx, jobRoot, jobs, 1, s.depth)
+	default:
+		jobs = c.walkBFS(ctx, jobRoot, jobs, s.depth)
+	}
+	if matrixFromContext(ctx) {
+		jobs = expandMatrix(jobs)
+	}
+	return jobs, nil
+}
+
+// folderPath возвращает путь вложенной директории folder внутри parent.
+func folderPath(parent string, folder Job) string {
+	parent = strings.Trim(parent, "/")
+	if parent == "" {
+		return folder.Name
+	}
+	return parent + "/" + folder.Name
+}
+
+// walkBFS обходит вложенные директории в ширину до глубины maxDepth.
+func (c *Client) walkBFS(ctx context.Context, jobRoot string, jobs []Job, maxDepth int) []Job {
+	type level struct {
+		path  string
+		jobs  []Job
+		depth int
+	}
+	result := make([]Job, 0, len(jobs))
+	queue := []level{{path: jobRoot, jobs: jobs}}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		result = append(result, current.jobs...)
+		if current.depth >= maxDepth {
+			continue
+		}
+		for _, job := range current.jobs {
+			if !isFolder(job) {
+				continue
+			}
+			path := folderPath(current.path, job)
+			children, err := c.GetJobs(ctx, path)
+			if err != nil {
+				c.log.Warn("failed to list jobs of nested folder", "err", err, "folder", path)
+				continue
+			}
+			queue = append(queue, level{path: path, jobs: children, depth: current.depth + 1})
+		}
+	}
+	return result
+}
+
+// walkDFS обходит вложенные директории в глубину: каждая директория сразу раскрывается
+// содержимым до глубины maxDepth.
+func (c *Client) walkDFS(ctx context.Context, path string, jobs []Job, depth, maxDepth int) []Job {
+	result := make([]Job, 0, len(jobs))
+	for _, job := range jobs {
+		result = append(result, job)
+		if !isFolder(job) || depth > maxDepth {
+			continue
+		}
+		childPath := folderPath(path, job)
+		children, err := c.GetJobs(ctx, childPath)
+		if err != nil {
+			c.log.Warn("failed to list jobs of nested folder", "err", err, "folder", childPath)
+			continue
+		}
+		result = append(result, c.walkDFS(ctx, childPath, children, depth+1, maxDepth)...)
+	}
+	return result
+}
@@ -0,0 +1,36 @@
+package jenkins
+
+import "context"
+
+// rootScanLimitKey - ключ контекста с предельным числом задач, просматриваемых в корне Jenkins.
+type rootScanLimitKey struct{}
+
+// WithRootScanLimit возвращает контекст, в котором поиск задач без директории (jobRoot пуст)
+// просматривает не более limit задач корня Jenkins: остальные задачи не сопоставляются с шаблоном,
+// а в лог выводится предупреждение с советом задать job_root. Нулевое значение снимает ограничение.
+func WithRootScanLimit(ctx context.Context, limit int) context.Context {
+	return context.WithValue(ctx, rootScanLimitKey{}, limit)
+}
+
+// rootScanLimitFromContext возвращает предельное число задач корня Jenkins из контекста.
+func rootScanLimitFromContext(ctx context.Context) int {
+	limit, _ := ctx.Value(rootScanLimitKey{}).(int)
+	return limit
+}
+
+// limitRootScan ограничивает список задач корня Jenkins первыми задачами в пределах WithRootScanLimit.
+// Предупреждение выводится один раз для репозитория, чтобы не повторять его при каждом опросе.
+func (c *Client) limitRootScan(ctx context.Context, jobRoot string, jobs []Job) []Job {
+	limit := rootScanLimitFromContext(ctx)
+	if jobRoot != "" || limit <= 0 || len(jobs) <= limit {
+		return jobs
+	}
+	repo := repositoryFromContext(ctx)
+	if _, warned := c.rootScanWarned.LoadOrStore(repo, struct{}{}); !warned {
+		c.log.Warn("jenkins root has too many jobs, matching only the first ones; set job_root for the repository",
+			"repo", repo,
+			"jobs", len(jobs),
+			"root_scan_limit", limit)
+	}
+	return jobs[:limit]
+}
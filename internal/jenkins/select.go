@@ -0,0 +1,73 @@
+package jenkins
+
+import (
+	"context"
+	"sort"
+)
+
+// Стратегии выбора задачи, когда шаблону соответствуют несколько задач.
+const (
+	SelectFirst        = "first"        // Первая задача в порядке ответа API Jenkins
+	SelectNewest       = "newest"       // Задача с самой поздней последней сборкой
+	SelectAlphabetical = "alphabetical" // Первая задача по полному имени в алфавитном порядке
+)
+
+// matchSelectKey - ключ контекста для стратегии выбора задачи.
+type matchSelectKey struct{}
+
+// WithMatchSelect возвращает контекст, в котором при нескольких совпавших задачах
+// выбирается задача по указанной стратегии (SelectFirst, SelectNewest, SelectAlphabetical).
+// Пустое значение соответствует SelectFirst.
+func WithMatchSelect(ctx context.Context, strategy string) context.Context {
+	return context.WithValue(ctx, matchSelectKey{}, strategy)
+}
+
+// matchSelectFromContext возвращает стратегию выбора задачи из контекста.
+func matchSelectFromContext(ctx context.Context) string {
+	strategy, _ := ctx.Value(matchSelectKey{}).(string)
+	return strategy
+}
+
+// selectJob выбирает одну задачу из совпавших по указанной стратегии.
+// Возвращает nil, если список пуст.
+func selectJob(strategy string, jobs []Job) *Job {
+	if len(jobs) == 0 {
+		return nil
+	}
+
+	selected := 0
+	switch strategy {
+	case SelectNewest:
+		for i := range jobs {
+			if jobs[i].lastBuildTimestamp() > jobs[selected].lastBuildTimestamp() {
+				selected = i
+			}
+		}
+	case SelectAlphabetical:
+		names := make([]int, len(jobs))
+		for i := range names {
+			names[i] = i
+		}
+		sort.SliceStable(names, func(a, b int) bool {
+			return jobs[names[a]].sortName() < jobs[names[b]].sortName()
+		})
+		selected = names[0]
+	}
+	return &jobs[selected]
+}
+
+// lastBuildTimestamp возвращает время последней сборки задачи или 0, если сборок не было.
+func (j Job) lastBuildTimestamp() int64 {
+	if j.LastBuild == nil {
+		return 0
+	}
+	return j.LastBuild.Timestamp
+}
+
+// sortName возвращает имя задачи для алфавитной сортировки: полное имя, а при его отсутствии - имя.
+func (j Job) sortName() string {
+	if j.FullName != "" {
+		return j.FullName
+	}
+	return j.Name
+}
@@ -0,0 +1,170 @@
+package jenkins
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrAuthFailed возвращается, если Jenkins отклонил запрос из-за аутентификации или прав доступа (401/403).
+var ErrAuthFailed = errors.New("jenkins authentication failed")
+
+// crumb - токен защиты от CSRF, который Jenkins требует в изменяющих запросах.
+type crumb struct {
+	Field string `json:"crumbRequestField"` // Имя заголовка, например Jenkins-Crumb
+	Value string `json:"crumb"`             // Значение токена
+}
+
+// crumbTTL - время, в течение которого полученный токен CSRF (или признак отключенной выдачи) используется повторно.
+const crumbTTL = 5 * time.Minute
+
+// getCrumb возвращает токен CSRF, кешированный не дольше crumbTTL, или запрашивает новый
+// в /crumbIssuer/api/json. Если выдача токенов отключена (404), возвращает nil без ошибки.
+func (c *Client) getCrumb(ctx context.Context) (*crumb, error) {
+	c.crumbMu.Lock()
+	defer c.crumbMu.Unlock()
+	if time.Now().Before(c.crumbExpires) {
+		return c.crumb, nil
+	}
+
+	cr, err := c.fetchCrumb(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.crumb, c.crumbExpires = cr, time.Now().Add(crumbTTL)
+	return cr, nil
+}
+
+// invalidateCrumb сбрасывает кешированный токен CSRF, чтобы следующий запрос получил новый.
+func (c *Client) invalidateCrumb() {
+	c.crumbMu.Lock()
+	defer c.crumbMu.Unlock()
+	c.crumb, c.crumbExpires = nil, time.Time{}
+}
+
+// fetchCrumb запрашивает токен CSRF в /crumbIssuer/api/json. Если выдача токенов отключена (404),
+// возвращает nil без ошибки.
+func (c *Client) fetchCrumb(ctx context.Context) (*crumb, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/crumbIssuer/api/json", nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	c.authorize(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("jenkins crumb request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		c.log.Debug("Jenkins crumb issuer disabled")
+		return nil, nil
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return nil, fmt.Errorf("%w: crumb issuer status %s", ErrAuthFailed, resp.Status)
+	case resp.StatusCode >= 400:
+		return nil, fmt.Errorf("jenkins crumb issuer status: %s", resp.Status)
+	}
+
+	var cr crumb
+	if err := json.NewDecoder(resp.Body).Decode(&cr); err != nil {
+		return nil, fmt.Errorf("decode jenkins crumb: %w", err)
+	}
+	if cr.Field == "" || cr.Value == "" {
+		return nil, fmt.Errorf("jenkins crumb issuer returned an empty crumb")
+	}
+	return &cr, nil
+}
+
+// postWithCrumb отправляет изменяющий POST-запрос с токеном CSRF, если Jenkins его выдает.
+// Если Jenkins отвечает 403 на запрос с кешированным токеном (токен устарел или сменилась сессия),
+// токен запрашивается заново и запрос повторяется один раз. Тело ответа закрывает вызывающий.
+func (c *Client) postWithCrumb(ctx context.Context, endpoint, contentType, body string) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		cr, err := c.getCrumb(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("create request: %w", err)
+		}
+		req.Header.Set("Content-Type", contentType)
+		c.authorize(req)
+		if cr != nil {
+			req.Header.Set(cr.Field, cr.Value)
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("jenkins api request: %w", err)
+		}
+		if resp.StatusCode != http.StatusForbidden || cr == nil || attempt > 0 {
+			return resp, nil
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		c.log.Debug("Jenkins rejected crumb, refreshing", "endpoint", endpoint)
+		c.invalidateCrumb()
+	}
+}
+
+// jobPath преобразует полное имя задачи ("folder/job") в путь API Jenkins ("/job/folder/job/job").
+func jobPath(fullName string) string {
+	var b strings.Builder
+	for _, part := range strings.Split(strings.Trim(fullName, "/"), "/") {
+		if part != "" {
+			b.WriteString("/job/")
+			b.WriteString(url.PathEscape(part))
+		}
+	}
+	return b.String()
+}
+
+// TriggerBuild запускает сборку задачи jobFullName ("folder/job"). Если params не пусты,
+// сборка запускается через buildWithParameters с переданными параметрами, иначе через build.
+// Запрос отправляется с токеном CSRF (crumb), если Jenkins его выдает.
+// Возвращает адрес элемента очереди Jenkins из заголовка Location ответа 201 Created;
+// при отказе в доступе возвращает ошибку, оборачивающую ErrAuthFailed.
+func (c *Client) TriggerBuild(ctx context.Context, jobFullName string, params map[string]string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+	defer cancel()
+
+	endpoint := c.baseURL + jobPath(jobFullName) + "/build"
+	form := url.Values{}
+	if len(params) > 0 {
+		endpoint = c.baseURL + jobPath(jobFullName) + "/buildWithParameters"
+		for name, value := range params {
+			form.Set(name, value)
+		}
+	}
+
+	c.log.Info("triggering Jenkins build", "job", jobFullName, "parameters", len(params))
+	resp, err := c.postWithCrumb(ctx, endpoint, "application/x-www-form-urlencoded", form.Encode())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return "", fmt.Errorf("%w: trigger build %s: status %s", ErrAuthFailed, jobFullName, resp.Status)
+	case resp.StatusCode != http.StatusCreated:
+		return "", fmt.Errorf("trigger build %s: status %s", jobFullName, resp.Status)
+	}
+	queueURL := resp.Header.Get("Location")
+	if queueURL == "" {
+		return "", fmt.Errorf("trigger build %s: response has no queue location", jobFullName)
+	}
+	c.log.Info("Jenkins build queued", "job", jobFullName, "queue_url", queueURL)
+	return queueURL, nil
+}
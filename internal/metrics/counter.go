@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// Counter - монотонно возрастающий счетчик.
+type Counter struct {
+	name  string
+	help  string
+	value atomic.Uint64
+}
+
+// NewCounter создает счетчик с указанными именем и описанием.
+func NewCounter(name, help string) *Counter {
+	return &Counter{name: name, help: help}
+}
+
+// Inc увеличивает счетчик на единицу.
+func (c *Counter) Inc() {
+	c.value.Add(1)
+}
+
+// Value возвращает текущее значение счетчика.
+func (c *Counter) Value() uint64 {
+	return c.value.Load()
+}
+
+// Write выводит счетчик в текстовом формате OpenMetrics.
+func (c *Counter) Write(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s_total %d\n", c.name, c.help, c.name, c.name, c.Value())
+	return err
+}
+
+// metricName возвращает имя счетчика.
+func (c *Counter) metricName() string {
+	return c.name
+}
+
+// snapshot возвращает значение счетчика под пустым значением метки.
+func (c *Counter) snapshot() map[string]uint64 {
+	return map[string]uint64{"": c.Value()}
+}
+
+// restore прибавляет к счетчику сохраненное значение.
+func (c *Counter) restore(values map[string]uint64) {
+	c.value.Add(values[""])
+}
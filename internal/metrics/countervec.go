@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// CounterVec - набор счетчиков, различающихся значением одной метки.
+type CounterVec struct {
+	name   string
+	help   string
+	label  string
+	mu     sync.Mutex
+	values map[string]uint64
+}
+
+// NewCounterVec создает набор счетчиков с указанными именем, описанием и именем метки.
+func NewCounterVec(name, help, label string) *CounterVec {
+	return &CounterVec{name: name, help: help, label: label, values: make(map[string]uint64)}
+}
+
+// Inc увеличивает на единицу счетчик со значением метки value.
+func (c *CounterVec) Inc(value string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[value]++
+}
+
+// Value возвращает текущее значение счетчика со значением метки value.
+func (c *CounterVec) Value(value string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[value]
+}
+
+// Write выводит счетчики в текстовом формате OpenMetrics, упорядочивая их по значению метки.
+func (c *CounterVec) Write(w io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	values := make([]string, 0, len(c.values))
+	for value := range c.values {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	for _, value := range values {
+		fmt.Fprintf(&b, "%s_total%s %d\n", c.name, formatLabels(map[string]string{c.label: value}), c.values[value])
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// metricName возвращает имя набора счетчиков.
+func (c *CounterVec) metricName() string {
+	return c.name
+}
+
+// snapshot возвращает копию значений счетчиков по значению метки.
+func (c *CounterVec) snapshot() map[string]uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	values := make(map[string]uint64, len(c.values))
+	for value, n := range c.values {
+		values[value] = n
+	}
+	return values
+}
+
+// restore прибавляет сохраненные значения к счетчикам с теми же значениями метки.
+func (c *CounterVec) restore(values map[string]uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for value, n := range values {
+		c.values[value] += n
+	}
+}
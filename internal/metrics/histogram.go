@@ -0,0 +1,134 @@
+// Package metrics предоставляет метрики сервиса в текстовом формате Prometheus/OpenMetrics.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultDurationBuckets - границы корзин гистограмм длительности в секундах.
+var DefaultDurationBuckets = []float64{0.1, 0.5, 1, 5, 15, 30, 60, 120, 300, 600}
+
+// Exemplar связывает отдельное наблюдение гистограммы с внешним идентификатором (например, trace ID).
+type Exemplar struct {
+	Labels    map[string]string // Метки exemplar, например trace_id
+	Value     float64           // Наблюдаемое значение
+	Timestamp time.Time         // Время наблюдения
+}
+
+// Histogram - гистограмма с фиксированными границами корзин и поддержкой exemplars.
+type Histogram struct {
+	name      string
+	help      string
+	buckets   []float64
+	mu        sync.Mutex
+	counts    []uint64    // Количество наблюдений в каждой корзине (последняя - +Inf), не накопительно
+	exemplars []*Exemplar // Последний exemplar для каждой корзины
+	sum       float64
+	count     uint64
+}
+
+// NewHistogram создает гистограмму с указанными именем, описанием и границами корзин.
+func NewHistogram(name, help string, buckets []float64) *Histogram {
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	return &Histogram{
+		name:      name,
+		help:      help,
+		buckets:   sorted,
+		counts:    make([]uint64, len(sorted)+1),
+		exemplars: make([]*Exemplar, len(sorted)+1),
+	}
+}
+
+// Observe добавляет наблюдение в гистограмму.
+func (h *Histogram) Observe(v float64) {
+	h.observe(v, nil)
+}
+
+// ObserveWithExemplar добавляет наблюдение и сохраняет для его корзины exemplar с указанными метками.
+// Пустые метки не сохраняются.
+func (h *Histogram) ObserveWithExemplar(v float64, labels map[string]string) {
+	if len(labels) == 0 {
+		h.observe(v, nil)
+		return
+	}
+	h.observe(v, &Exemplar{Labels: labels, Value: v, Timestamp: time.Now()})
+}
+
+// observe добавляет наблюдение и, если exemplar задан, сохраняет его для корзины.
+func (h *Histogram) observe(v float64, exemplar *Exemplar) {
+	idx := sort.SearchFloat64s(h.buckets, v)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.counts[idx]++
+	h.sum += v
+	h.count++
+	if exemplar != nil {
+		h.exemplars[idx] = exemplar
+	}
+}
+
+// Write выводит гистограмму в текстовом формате OpenMetrics, включая exemplars корзин.
+func (h *Histogram) Write(w io.Writer) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# HELP %s %s\n", h.name, h.help)
+	fmt.Fprintf(&b, "# TYPE %s histogram\n", h.name)
+
+	var cumulative uint64
+	for i := range h.counts {
+		cumulative += h.counts[i]
+		le := math.Inf(1)
+		if i < len(h.buckets) {
+			le = h.buckets[i]
+		}
+		fmt.Fprintf(&b, "%s_bucket{le=\"%s\"} %d", h.name, formatFloat(le), cumulative)
+		if ex := h.exemplars[i]; ex != nil {
+			fmt.Fprintf(&b, " # %s %s %s", formatLabels(ex.Labels), formatFloat(ex.Value), formatTimestamp(ex.Timestamp))
+		}
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "%s_sum %s\n", h.name, formatFloat(h.sum))
+	fmt.Fprintf(&b, "%s_count %d\n", h.name, h.count)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// formatFloat форматирует число по правилам текстового формата Prometheus.
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// formatTimestamp форматирует время как число секунд Unix с дробной частью.
+func formatTimestamp(t time.Time) string {
+	return strconv.FormatFloat(float64(t.UnixNano())/1e9, 'f', 3, 64)
+}
+
+// formatLabels форматирует метки в виде {name="value",...} в отсортированном порядке.
+func formatLabels(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s=%q", name, labels[name]))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
@@ -0,0 +1,64 @@
+package metrics_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/example/gitea-jenkins-webhook/internal/metrics"
+)
+
+func TestHistogramWritesExemplar(t *testing.T) {
+	h := metrics.NewHistogram("test_duration_seconds", "Test histogram.", []float64{1, 5})
+	h.Observe(0.5)
+	h.ObserveWithExemplar(3, map[string]string{"trace_id": "4bf92f3577b34da6a3ce929d0e0e4736"})
+	h.Observe(10)
+
+	var out strings.Builder
+	if err := h.Write(&out); err != nil {
+		t.Fatalf("write histogram: %v", err)
+	}
+
+	for _, want := range []string{
+		`test_duration_seconds_bucket{le="1"} 1` + "\n",
+		`test_duration_seconds_bucket{le="5"} 2 # {trace_id="4bf92f3577b34da6a3ce929d0e0e4736"} 3 `,
+		`test_duration_seconds_bucket{le="+Inf"} 3` + "\n",
+		"test_duration_seconds_sum 13.5\n",
+		"test_duration_seconds_count 3\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("expected output to contain %q, got:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestCounterWrite(t *testing.T) {
+	c := metrics.NewCounter("events_dropped", "Dropped events.")
+	c.Inc()
+	c.Inc()
+
+	var b strings.Builder
+	if err := c.Write(&b); err != nil {
+		t.Fatalf("write counter: %v", err)
+	}
+	want := "# HELP events_dropped Dropped events.\n# TYPE events_dropped counter\nevents_dropped_total 2\n"
+	if b.String() != want {
+		t.Fatalf("unexpected output:\n%s", b.String())
+	}
+}
+
+func TestCounterVecWrite(t *testing.T) {
+	c := metrics.NewCounterVec("events_received", "Received events.", "action")
+	c.Inc("opened")
+	c.Inc("closed")
+	c.Inc("opened")
+
+	var b strings.Builder
+	if err := c.Write(&b); err != nil {
+		t.Fatalf("write counter vec: %v", err)
+	}
+	want := "# HELP events_received Received events.\n# TYPE events_received counter\n" +
+		"events_received_total{action=\"closed\"} 1\nevents_received_total{action=\"opened\"} 2\n"
+	if b.String() != want {
+		t.Fatalf("unexpected output:\n%s", b.String())
+	}
+}
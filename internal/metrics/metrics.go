@@ -0,0 +1,96 @@
+package metrics
+
+// ProcessingDuration - гистограмма длительности обработки событий pull request воркерами.
+var ProcessingDuration = Register(NewHistogram(
+	"processing_duration_seconds",
+	"Time spent processing a pull request event.",
+	DefaultDurationBuckets,
+))
+
+// StaleEventsDropped - счетчик событий, отброшенных воркерами из-за превышения server.max_event_age.
+var StaleEventsDropped = Register(NewCounter(
+	"stale_events_dropped",
+	"Pull request events dropped because they waited in the queue longer than max_event_age.",
+))
+
+// EventDeadlineExceeded - счетчик событий, обработка которых прервана по истечении server.event_deadline.
+var EventDeadlineExceeded = Register(NewCounter(
+	"event_deadline_exceeded",
+	"Pull request events abandoned because processing exceeded event_deadline.",
+))
+
+// DuplicateEventsDropped - счетчик событий, отброшенных из-за того, что тот же pull request уже обрабатывается.
+var DuplicateEventsDropped = Register(NewCounter(
+	"duplicate_events_dropped",
+	"Pull request events dropped because an event for the same pull request was already in flight.",
+))
+
+// WebhookEventsReceived - счетчик принятых вебхуков pull request по действию.
+var WebhookEventsReceived = Register(NewCounterVec(
+	"webhook_events_received",
+	"Pull request webhook events received, by action.",
+	"action",
+))
+
+// WebhookUnknownActions - счетчик вебхуков pull request с неизвестным действием по действию.
+var WebhookUnknownActions = Register(NewCounterVec(
+	"webhooks_unknown_action",
+	"Pull request webhook events with an action the service does not recognize, by action.",
+	"action",
+))
+
+// DuplicateDeliveries - счетчик повторных доставок вебхуков (тот же X-Gitea-Delivery), которые не обрабатывались.
+var DuplicateDeliveries = Register(NewCounter(
+	"webhook_duplicate_deliveries",
+	"Webhook redeliveries with an already accepted delivery ID that were acknowledged without processing.",
+))
+
+// WebhookEventsEnqueued - счетчик событий, поставленных в очередь обработки.
+var WebhookEventsEnqueued = Register(NewCounter(
+	"webhook_events_enqueued",
+	"Pull request webhook events added to the processing queue.",
+))
+
+// WebhookQueueFull - счетчик вебхуков, отклоненных из-за переполнения очереди.
+var WebhookQueueFull = Register(NewCounter(
+	"webhook_queue_full",
+	"Pull request webhook events rejected because the processing queue was full.",
+))
+
+// JenkinsPollAttempts - счетчик опросов Jenkins при ожидании задачи по репозиторию.
+var JenkinsPollAttempts = Register(NewCounterVec(
+	"jenkins_poll_attempts",
+	"Jenkins polls made while waiting for a pull request job, by repository.",
+	"repo",
+))
+
+// JenkinsJobFound - счетчик событий, для которых найдена задача Jenkins.
+var JenkinsJobFound = Register(NewCounter(
+	"jenkins_job_found",
+	"Pull request events for which a Jenkins job was found.",
+))
+
+// JenkinsJobTimeout - счетчик событий, для которых задача Jenkins не появилась в течение таймаута.
+var JenkinsJobTimeout = Register(NewCounter(
+	"jenkins_job_timeout",
+	"Pull request events for which no Jenkins job appeared before the timeout.",
+))
+
+// CommentQueueFull - счетчик итоговых комментариев, опубликованных воркером события из-за переполнения
+// очереди публикации комментариев.
+var CommentQueueFull = Register(NewCounter(
+	"comment_queue_full",
+	"Result comments posted by the event worker because the comment dispatch queue was full.",
+))
+
+// CommentDispatchFailed - счетчик итоговых комментариев из очереди публикации, которые не удалось опубликовать.
+var CommentDispatchFailed = Register(NewCounter(
+	"comment_dispatch_failed",
+	"Result comments from the comment dispatch queue that could not be posted to Gitea.",
+))
+
+// GiteaCommentPosted - счетчик комментариев, опубликованных в Gitea.
+var GiteaCommentPosted = Register(NewCounter(
+	"gitea_comment_posted",
+	"Comments posted to Gitea.",
+))
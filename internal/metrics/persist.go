@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// persistent - метрика, значения которой сохраняются между перезапусками (счетчики).
+type persistent interface {
+	metricName() string
+	snapshot() map[string]uint64
+	restore(values map[string]uint64)
+}
+
+// Snapshot возвращает значения всех зарегистрированных счетчиков: имя метрики → значение метки → значение.
+// Для счетчиков без меток используется пустое значение метки.
+func Snapshot() map[string]map[string]uint64 {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	snap := make(map[string]map[string]uint64)
+	for _, c := range registry {
+		if p, ok := c.(persistent); ok {
+			snap[p.metricName()] = p.snapshot()
+		}
+	}
+	return snap
+}
+
+// Restore прибавляет сохраненные значения к зарегистрированным счетчикам с теми же именами.
+// Значения неизвестных метрик пропускаются.
+func Restore(snap map[string]map[string]uint64) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	for _, c := range registry {
+		if p, ok := c.(persistent); ok {
+			if values, found := snap[p.metricName()]; found {
+				p.restore(values)
+			}
+		}
+	}
+}
+
+// SaveFile сохраняет значения счетчиков (см. Snapshot) в файл path в формате JSON.
+// Файл заменяется атомарно, чтобы прерванная запись не повредила сохраненные значения.
+func SaveFile(path string) error {
+	data, err := json.Marshal(Snapshot())
+	if err != nil {
+		return fmt.Errorf("encode metrics: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create metrics state file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write metrics state file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write metrics state file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("replace metrics state file: %w", err)
+	}
+	return nil
+}
+
+// LoadFile восстанавливает значения счетчиков из файла, сохраненного SaveFile.
+// Отсутствие файла (первый запуск) ошибкой не считается.
+func LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read metrics state file: %w", err)
+	}
+	var snap map[string]map[string]uint64
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("decode metrics state file: %w", err)
+	}
+	Restore(snap)
+	return nil
+}
+
+// Persist сохраняет значения счетчиков в файл path каждые interval до отмены контекста.
+// Ошибки сохранения записываются в лог.
+func Persist(ctx context.Context, path string, interval time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := SaveFile(path); err != nil {
+				logger.Error("failed to persist metrics", "err", err, "path", path)
+			}
+		}
+	}
+}
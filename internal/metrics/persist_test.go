@@ -0,0 +1,70 @@
+package metrics_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/example/gitea-jenkins-webhook/internal/metrics"
+)
+
+var (
+	persistedCounter = metrics.Register(metrics.NewCounter("test_persisted", "Test counter."))
+	persistedVec     = metrics.Register(metrics.NewCounterVec("test_persisted_by_repo", "Test counter vector.", "repo"))
+)
+
+func TestLoadFileRestoresCounters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	saved := `{"test_persisted":{"":5},"test_persisted_by_repo":{"org/one":3},"test_unknown":{"":7}}`
+	if err := os.WriteFile(path, []byte(saved), 0o600); err != nil {
+		t.Fatalf("write state: %v", err)
+	}
+
+	counter, vec := persistedCounter.Value(), persistedVec.Value("org/one")
+	if err := metrics.LoadFile(path); err != nil {
+		t.Fatalf("load state: %v", err)
+	}
+	if got := persistedCounter.Value() - counter; got != 5 {
+		t.Fatalf("expected counter to grow by 5, got %d", got)
+	}
+	if got := persistedVec.Value("org/one") - vec; got != 3 {
+		t.Fatalf("expected labelled counter to grow by 3, got %d", got)
+	}
+}
+
+func TestSaveFileRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	persistedCounter.Inc()
+	persistedVec.Inc("org/two")
+	if err := metrics.SaveFile(path); err != nil {
+		t.Fatalf("save state: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read state: %v", err)
+	}
+	var snap map[string]map[string]uint64
+	if err := json.Unmarshal(data, &snap); err != nil {
+		t.Fatalf("decode state: %v", err)
+	}
+	if snap["test_persisted"][""] != persistedCounter.Value() || snap["test_persisted_by_repo"]["org/two"] != persistedVec.Value("org/two") {
+		t.Fatalf("unexpected saved state: %v", snap)
+	}
+
+	// A restart restores the saved values into fresh counters; here they are added on top of the current ones.
+	counter := persistedCounter.Value()
+	if err := metrics.LoadFile(path); err != nil {
+		t.Fatalf("load state: %v", err)
+	}
+	if got := persistedCounter.Value(); got != 2*counter {
+		t.Fatalf("expected restored counter %d, got %d", 2*counter, got)
+	}
+}
+
+func TestLoadFileMissingIsNotAnError(t *testing.T) {
+	if err := metrics.LoadFile(filepath.Join(t.TempDir(), "missing.json")); err != nil {
+		t.Fatalf("expected no error for a missing state file, got %v", err)
+	}
+}
@@ -0,0 +1,39 @@
+package metrics
+
+import (
+	"io"
+	"sync"
+)
+
+// Collector - метрика, которую можно вывести в текстовом формате Prometheus.
+type Collector interface {
+	Write(w io.Writer) error
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []Collector
+)
+
+// Register добавляет метрику в реестр пакета, содержимое которого выводит WriteAll.
+// Возвращает ту же метрику, чтобы регистрировать ее при объявлении переменной.
+func Register[C Collector](c C) C {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = append(registry, c)
+	return c
+}
+
+// WriteAll выводит все зарегистрированные метрики в порядке регистрации.
+func WriteAll(w io.Writer) error {
+	registryMu.Lock()
+	collectors := append([]Collector(nil), registry...)
+	registryMu.Unlock()
+
+	for _, c := range collectors {
+		if err := c.Write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+// Package notifier предоставляет отправку итогов обработки событий во внешние системы (Slack, Discord, произвольные webhook).
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// HeaderSignature - заголовок с HMAC-SHA256 подписью тела запроса в формате "sha256=<hex>".
+const HeaderSignature = "X-Signature"
+
+// Payload представляет итог обработки события, отправляемый получателю.
+type Payload struct {
+	Repo       string `json:"repo"`                  // Полное имя репозитория
+	PRNumber   int64  `json:"pr_number"`             // Номер pull request
+	Outcome    string `json:"outcome"`               // Итог обработки
+	Reason     string `json:"reason,omitempty"`      // Причина пропуска или ошибки
+	JobName    string `json:"job_name,omitempty"`    // Имя найденной задачи Jenkins
+	JobURL     string `json:"job_url,omitempty"`     // URL найденной задачи Jenkins
+	Comment    string `json:"comment,omitempty"`     // Текст опубликованного комментария
+	DeliveryID string `json:"delivery_id,omitempty"` // Идентификатор доставки вебхука
+}
+
+// Notifier отправляет итоги обработки на один адрес.
+type Notifier struct {
+	name       string
+	url        string
+	secret     string
+	httpClient *http.Client
+	log        *slog.Logger
+}
+
+// New создает получателя уведомлений с указанными именем, адресом и секретом подписи.
+// Если httpClient равен nil, создается клиент с таймаутом 10 секунд.
+func New(name, url, secret string, httpClient *http.Client, logger *slog.Logger) *Notifier {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Notifier{
+		name:       name,
+		url:        url,
+		secret:     secret,
+		httpClient: httpClient,
+		log:        logger,
+	}
+}
+
+// Name возвращает имя получателя из конфигурации.
+func (n *Notifier) Name() string {
+	return n.name
+}
+
+// Notify отправляет итог обработки POST-запросом с JSON-телом. Если задан секрет,
+// добавляет заголовок X-Signature с HMAC-SHA256 подписью тела.
+func (n *Notifier) Notify(ctx context.Context, payload Payload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal notifier payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.secret != "" {
+		req.Header.Set(HeaderSignature, "sha256="+Sign(body, n.secret))
+	}
+
+	resp, err := n.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("notifier %s request: %w", n.name, err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("notifier %s status: %s", n.name, resp.Status)
+	}
+	n.log.Debug("notification sent", "notifier", n.name, "repo", payload.Repo, "pr_number", payload.PRNumber)
+	return nil
+}
+
+// Sign вычисляет HMAC-SHA256 подпись тела запроса и возвращает ее в шестнадцатеричном виде.
+func Sign(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,55 @@
+package notifier_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/example/gitea-jenkins-webhook/internal/notifier"
+)
+
+func TestNotifySignsPayload(t *testing.T) {
+	var (
+		gotSignature string
+		gotBody      []byte
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotSignature = r.Header.Get(notifier.HeaderSignature)
+		gotBody, _ = io.ReadAll(r.Body)
+	}))
+	defer ts.Close()
+
+	n := notifier.New("slack", ts.URL, "s3cret", ts.Client(), nil)
+	err := n.Notify(context.Background(), notifier.Payload{Repo: "org/repo", PRNumber: 4, Outcome: "job_found"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(gotBody)
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if gotSignature != want {
+		t.Fatalf("expected signature %s, got %s", want, gotSignature)
+	}
+}
+
+func TestNotifyWithoutSecretIsUnsigned(t *testing.T) {
+	var signed bool
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, signed = r.Header[notifier.HeaderSignature]
+	}))
+	defer ts.Close()
+
+	n := notifier.New("custom", ts.URL, "", ts.Client(), nil)
+	if err := n.Notify(context.Background(), notifier.Payload{Repo: "org/repo"}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if signed {
+		t.Fatalf("expected no signature header without a secret")
+	}
+}
@@ -0,0 +1,44 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/example/gitea-jenkins-webhook/internal/jenkins"
+)
+
+// recordJenkinsAuth запоминает отказ в аутентификации экземпляра Jenkins instance при ожидании задачи
+// или снимает отметку, если запрос к этому экземпляру завершился без ошибки.
+func (p *Processor) recordJenkinsAuth(instance string, err error) {
+	p.authMu.Lock()
+	defer p.authMu.Unlock()
+	switch {
+	case errors.Is(err, jenkins.ErrAuthFailed):
+		p.authFailures[instance] = err
+	case err == nil:
+		delete(p.authFailures, instance)
+	}
+}
+
+// JenkinsAuthError возвращает ошибку, если при обработке событий Jenkins отклонил запрос из-за
+// аутентификации и после этого запросы к тому же экземпляру не проходили успешно. Используется
+// проверкой готовности: смена токена после запуска делает сервис неготовым до исправления.
+func (p *Processor) JenkinsAuthError() error {
+	p.authMu.Lock()
+	defer p.authMu.Unlock()
+	instances := make([]string, 0, len(p.authFailures))
+	for instance := range p.authFailures {
+		instances = append(instances, instance)
+	}
+	sort.Strings(instances)
+	errs := make([]error, 0, len(instances))
+	for _, instance := range instances {
+		name := instance
+		if name == "" {
+			name = "default"
+		}
+		errs = append(errs, fmt.Errorf("jenkins instance %s: %w", name, p.authFailures[instance]))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,109 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/example/gitea-jenkins-webhook/internal/config"
+	"github.com/example/gitea-jenkins-webhook/internal/jenkins"
+)
+
+// callbackWaiter - событие, ожидающее уведомления Jenkins о задаче при wait_mode: callback.
+type callbackWaiter struct {
+	target    compiledTarget
+	parameter string            // Параметр сборки с номером PR (пусто - не проверяется)
+	number    string            // Номер PR события
+	found     chan *jenkins.Job // Получает задачу из первого подходящего уведомления
+}
+
+// matches сообщает, относится ли уведомление к ожидаемой задаче: имя задачи должно совпасть
+// с шаблоном цели, а при callback_parameter параметр сборки - с номером PR.
+func (w *callbackWaiter) matches(n jenkins.Notification) bool {
+	if w.parameter != "" && n.Build.Parameters[w.parameter] != w.number {
+		return false
+	}
+	return w.target.re.MatchString(n.Name)
+}
+
+// ResolveCallback передает уведомление Jenkins о сборке всем ожидающим событиям,
+// для которых оно подходит. Возвращает число событий, ожидание которых завершено.
+func (p *Processor) ResolveCallback(n jenkins.Notification) int {
+	p.callbackMu.Lock()
+	defer p.callbackMu.Unlock()
+
+	resolved := 0
+	for w := range p.callbackWaiters {
+		if !w.matches(n) {
+			continue
+		}
+		job := n.Job()
+		job.Matches = w.target.re.FindStringSubmatch(n.Name)
+		select {
+		case w.found <- job:
+			resolved++
+		default:
+		}
+		delete(p.callbackWaiters, w)
+	}
+	p.log.Info("jenkins callback received",
+		"job", n.Name,
+		"phase", n.Build.Phase,
+		"status", n.Build.Status,
+		"resolved", resolved)
+	return resolved
+}
+
+// waitForCallback ожидает уведомление Jenkins о задаче цели t в течение timeout.
+// После регистрации ожидания задача один раз ищется опросом client: уведомление могло прийти
+// до регистрации, и без опроса событие ждало бы весь timeout.
+// Возвращает nil без ошибки, если уведомление не пришло вовремя.
+func (p *Processor) waitForCallback(ctx context.Context, client JenkinsClient, rule config.RepositoryRule, t compiledTarget, timeout time.Duration) (*jenkins.Job, error) {
+	w := &callbackWaiter{
+		target:    t,
+		parameter: rule.CallbackParameter,
+		number:    strconv.FormatInt(t.number, 10),
+		found:     make(chan *jenkins.Job, 1),
+	}
+	p.callbackMu.Lock()
+	p.callbackWaiters[w] = struct{}{}
+	p.callbackMu.Unlock()
+	defer func() {
+		p.callbackMu.Lock()
+		delete(p.callbackWaiters, w)
+		p.callbackMu.Unlock()
+	}()
+
+	job, err := pollOnce(ctx, client, t)
+	switch {
+	case err == nil:
+		return job, nil
+	case !errors.Is(err, context.DeadlineExceeded):
+		p.log.Warn("initial jenkins poll failed, waiting for callback",
+			"err", err,
+			"instance", t.target.Instance,
+			"pattern", t.pattern)
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case job := <-w.found:
+		return job, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timer.C:
+		return nil, nil
+	}
+}
+
+// pollOnce однократно ищет задачу цели t, когда уведомление Jenkins не пришло.
+// Возвращает context.DeadlineExceeded, если задача не найдена.
+func pollOnce(ctx context.Context, client JenkinsClient, t compiledTarget) (*jenkins.Job, error) {
+	job, err := client.FindJob(ctx, t.re, t.jobRoot)
+	if err == nil && job == nil {
+		return nil, context.DeadlineExceeded
+	}
+	return job, err
+}
@@ -0,0 +1,94 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/example/gitea-jenkins-webhook/internal/config"
+	"github.com/example/gitea-jenkins-webhook/internal/gitea"
+	"github.com/example/gitea-jenkins-webhook/internal/metrics"
+	"github.com/example/gitea-jenkins-webhook/internal/retry"
+)
+
+// maxCommentLength - максимальная длина комментария в символах, которую принимает Gitea.
+const maxCommentLength = 65535
+
+// truncationNotice добавляется в конец комментария, усеченного до maxCommentLength.
+const truncationNotice = "\n\n…(truncated)"
+
+// finalizeComment добавляет к отрисованному комментарию в issue index репозитория repo префикс
+// server.comment_prefix и метку сервиса (commentMarker) и усекает результат до maxCommentLength символов;
+// метка сохраняется при усечении.
+func (p *Processor) finalizeComment(repo string, index int64, body string) string {
+	cfg := p.Config()
+	body = cfg.Server.CommentPrefix + body
+	suffix := ""
+	if marker := p.commentMarker(repo, index); marker != "" {
+		suffix = "\n\n" + marker
+	}
+	if utf8.RuneCountInString(body)+utf8.RuneCountInString(suffix) <= maxCommentLength {
+		return body + suffix
+	}
+	runes := []rune(body)
+	keep := maxCommentLength - utf8.RuneCountInString(truncationNotice) - utf8.RuneCountInString(suffix)
+	return string(runes[:keep]) + truncationNotice + suffix
+}
+
+// commentMarker возвращает метку комментариев сервиса в issue index репозитория repo: server.comment_marker
+// и, если задан server.instance_id, скрытую метку экземпляра <!-- gjb:instance=<id>:<repo>/<index> -->.
+// Пустая строка - метка не задана.
+func (p *Processor) commentMarker(repo string, index int64) string {
+	server := p.Config().Server
+	if server.InstanceID == "" {
+		return server.CommentMarker
+	}
+	marker := fmt.Sprintf("<!-- gjb:instance=%s:%s/%d -->", server.InstanceID, repo, index)
+	if server.CommentMarker == "" {
+		return marker
+	}
+	return server.CommentMarker + "\n" + marker
+}
+
+// publish публикует комментарий в Gitea способом, заданным comment_kind правила:
+// обычным комментарием в issue/PR или ревью pull request.
+// При ошибке сети или ответе 5xx публикация повторяется до gitea.max_retries раз в пределах бюджета
+// повторов события с растущей паузой (не более gitea.retry_max_interval); ответы 4xx не повторяются.
+// Возвращает опубликованный комментарий.
+func (p *Processor) publish(ctx context.Context, rule config.RepositoryRule, repo string, index int64, body string) (*gitea.Comment, error) {
+	if err := p.waitCommentSlot(ctx, rule, repo); err != nil {
+		return nil, err
+	}
+	cfg := p.Config()
+	var comment *gitea.Comment
+	err := retry.DoExponential(ctx, cfg.Gitea.MaxRetries, cfg.Server.RetryBackoff, cfg.Gitea.RetryMaxInterval, isRetryableGiteaError, func() error {
+		var err error
+		if rule.CommentKind == config.CommentKindReview {
+			comment, err = p.giteaFor(rule).CreateReview(ctx, repo, index, body, gitea.ReviewEventComment)
+		} else {
+			comment, err = p.giteaFor(rule).PostComment(ctx, repo, index, body)
+		}
+		if err != nil {
+			p.log.Warn("gitea request failed", "err", err, "repo", repo, "issue_index", index)
+		}
+		return err
+	})
+	if err == nil {
+		metrics.GiteaCommentPosted.Inc()
+	}
+	return comment, err
+}
+
+// isRetryableGiteaError сообщает, имеет ли смысл повторять запрос к Gitea: ошибки сети (включая
+// таймаут запроса) и ответы 5xx/429 временные, остальные ответы 4xx и отмена события - нет.
+func isRetryableGiteaError(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var httpErr *gitea.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.Temporary()
+	}
+	return true
+}
@@ -0,0 +1,94 @@
+package processor
+
+import (
+	"context"
+	"time"
+
+	"github.com/example/gitea-jenkins-webhook/pkg/webhook"
+)
+
+// parkedEvent - событие, отложенное до освобождения слота max_concurrent репозитория.
+type parkedEvent struct {
+	evt    webhook.PullRequestEvent
+	parked time.Time // Время, когда событие отложено
+}
+
+// repoSlot - слот max_concurrent репозитория, занятый обрабатываемым событием.
+type repoSlot struct {
+	repo  string
+	slots chan struct{} // Семафор репозитория (nil - ограничения нет)
+}
+
+// takeRepoSlot занимает слот max_concurrent репозитория события evt. Если свободных слотов нет,
+// событие откладывается в очередь репозитория и возвращается false: воркер не ждет слота, а берет
+// следующее событие, и отложенное событие обработает воркер, освобождающий слот (см. passRepoSlot).
+// При нулевом пределе или ненастроенном репозитории слот не требуется.
+func (p *Processor) takeRepoSlot(evt webhook.PullRequestEvent) (repoSlot, bool) {
+	repo := evt.Repository.FullName
+	rule, ok := p.Config().GetRepositoryRule(repo)
+	if !ok || rule.MaxConcurrent <= 0 {
+		return repoSlot{}, true
+	}
+
+	p.slotsMu.Lock()
+	defer p.slotsMu.Unlock()
+	slots, ok := p.repoSlots[repo]
+	if !ok || cap(slots) != rule.MaxConcurrent {
+		// A changed limit takes effect for new events; holders release into the old semaphore.
+		slots = make(chan struct{}, rule.MaxConcurrent)
+		p.repoSlots[repo] = slots
+	}
+	select {
+	case slots <- struct{}{}:
+		return repoSlot{repo: repo, slots: slots}, true
+	default:
+	}
+	p.parked[repo] = append(p.parked[repo], parkedEvent{evt: evt, parked: time.Now()})
+	p.log.Debug("repository concurrency limit reached, event parked",
+		"repo", repo,
+		"pr_number", evt.PullRequest.Number,
+		"max_concurrent", rule.MaxConcurrent,
+		"parked", len(p.parked[repo]))
+	return repoSlot{}, false
+}
+
+// passRepoSlot освобождает слот или передает его следующему отложенному событию репозитория:
+// такое событие возвращается, и его обрабатывает тот же воркер.
+func (p *Processor) passRepoSlot(slot repoSlot) (parkedEvent, bool) {
+	if slot.slots == nil {
+		return parkedEvent{}, false
+	}
+	p.slotsMu.Lock()
+	defer p.slotsMu.Unlock()
+	if queue := p.parked[slot.repo]; len(queue) > 0 {
+		if len(queue) == 1 {
+			delete(p.parked, slot.repo)
+		} else {
+			p.parked[slot.repo] = queue[1:]
+		}
+		return queue[0], true
+	}
+	<-slot.slots
+	return parkedEvent{}, false
+}
+
+// processParked обрабатывает отложенное событие, получившее слот репозитория. Событие, прождавшее слот
+// дольше timeout правила, завершается итогом timeout без опроса Jenkins.
+func (p *Processor) processParked(id int, parked parkedEvent) {
+	evt := parked.evt
+	if p.abandoned.Load() {
+		p.dropEvent(evt)
+		return
+	}
+	rule, _ := p.Config().GetRepositoryRule(evt.Repository.FullName)
+	if waited := time.Since(parked.parked); rule.Timeout > 0 && waited > rule.Timeout {
+		p.log.Warn("no free repository slot, event not processed",
+			"repo", evt.Repository.FullName,
+			"pr_number", evt.PullRequest.Number,
+			"max_concurrent", rule.MaxConcurrent,
+			"waited", waited)
+		p.finishEvent(evt, Result{Outcome: OutcomeTimeout, Reason: "repository concurrency limit", Err: context.DeadlineExceeded})
+		return
+	}
+	p.processQueued(id, evt)
+}
@@ -0,0 +1,114 @@
+package processor
+
+import (
+	"context"
+	"maps"
+	"strings"
+
+	"github.com/example/gitea-jenkins-webhook/internal/config"
+	"github.com/example/gitea-jenkins-webhook/internal/gitea"
+	"github.com/example/gitea-jenkins-webhook/internal/jenkins"
+	"github.com/example/gitea-jenkins-webhook/pkg/webhook"
+)
+
+// consoleTruncationNotice добавляется к выводу, достигшему console_log_max_bytes.
+const consoleTruncationNotice = "\n…(console log truncated)"
+
+// consoleStream - комментарий о ходе сборки, в который по мере выполнения сборки
+// дописывается консольный вывод Jenkins.
+type consoleStream struct {
+	rule      config.RepositoryRule
+	repo      string
+	index     int64
+	data      map[string]any
+	offset    int64           // Смещение в байтах, с которого запрашивается следующий фрагмент вывода
+	log       strings.Builder // Накопленный вывод, не длиннее console_log_max_bytes
+	truncated bool            // Вывод достиг ограничения, дальнейшие фрагменты не запрашиваются
+	comment   *gitea.Comment  // Опубликованный комментарий о ходе сборки
+}
+
+// newConsoleStream создает поток вывода для PR. data копируется, так как поток
+// обновляется параллельно с остальной обработкой события.
+func newConsoleStream(rule config.RepositoryRule, repo string, index int64, data map[string]any) *consoleStream {
+	return &consoleStream{rule: rule, repo: repo, index: index, data: maps.Clone(data)}
+}
+
+// updateConsoleStream запрашивает новый консольный вывод сборки и публикует или обновляет
+// комментарий о ходе сборки. Ошибки записываются в лог и не прерывают ожидание сборки.
+func (p *Processor) updateConsoleStream(ctx context.Context, s *consoleStream, client JenkinsClient, job *jenkins.Job) {
+	if s.truncated && s.comment != nil {
+		return
+	}
+	chunk, err := client.ProgressiveText(ctx, job, s.offset)
+	if err != nil {
+		p.log.Warn("failed to fetch jenkins console log", "err", err, "job", job.Name)
+		return
+	}
+	s.offset = chunk.Next
+	if chunk.Text == "" && s.comment != nil {
+		return
+	}
+	if free := s.rule.ConsoleLogMaxBytes - s.log.Len(); len(chunk.Text) > free {
+		chunk.Text, s.truncated = strings.ToValidUTF8(chunk.Text[:free], ""), true
+	}
+	s.log.WriteString(chunk.Text)
+
+	s.data["JobName"], s.data["JobURL"] = job.Name, job.URL
+	header, err := p.executeCommentTemplate("progress_comment", s.rule.ProgressCommentTemplate, s.data)
+	if err != nil {
+		p.log.Error("failed to execute progress comment template", "err", err)
+		return
+	}
+	var body strings.Builder
+	body.WriteString(header)
+	body.WriteString("\n\n```\n")
+	body.WriteString(strings.TrimRight(s.log.String(), "\n"))
+	if s.truncated {
+		body.WriteString(consoleTruncationNotice)
+	}
+	body.WriteString("\n```")
+
+	var comment *gitea.Comment
+	if s.comment == nil {
+		comment, err = p.giteaFor(s.rule).PostComment(ctx, s.repo, s.index, p.finalizeComment(s.repo, s.index, body.String()))
+	} else {
+		comment, err = p.giteaFor(s.rule).EditComment(ctx, s.repo, s.comment.ID, p.finalizeComment(s.repo, s.index, body.String()))
+	}
+	if err != nil {
+		p.log.Warn("failed to publish console log comment", "err", err, "repo", s.repo, "issue_index", s.index)
+		return
+	}
+	s.comment = comment
+}
+
+// progressComment возвращает комментарий о ходе сборки, опубликованный для одной из целей, или nil.
+func progressComment(results []TargetResult) *gitea.Comment {
+	for _, r := range results {
+		if r.ProgressComment != nil {
+			return r.ProgressComment
+		}
+	}
+	return nil
+}
+
+// finishProgressComment заменяет комментарий о ходе сборки итоговым комментарием res.Comment.
+func (p *Processor) finishProgressComment(ctx context.Context, rule config.RepositoryRule, evt webhook.PullRequestEvent, progress *gitea.Comment, res Result) Result {
+	comment, err := p.giteaFor(rule).EditComment(ctx, evt.Repository.FullName, progress.ID, res.Comment)
+	if err != nil {
+		p.log.Error("failed to replace progress comment in gitea",
+			"err", err,
+			"repo", evt.Repository.FullName,
+			"pr_number", evt.PullRequest.Number,
+			"comment_id", progress.ID)
+		res.Outcome = OutcomeCommentFailed
+		res.Reason = "edit comment"
+		res.Err = err
+		return res
+	}
+	res.CommentURL = comment.HTMLURL
+	p.log.Info("progress comment replaced with result",
+		"repo", evt.Repository.FullName,
+		"pr", evt.PullRequest.Number,
+		"comment_id", progress.ID)
+	return res
+}
@@ -0,0 +1,106 @@
+package processor
+
+import (
+	"context"
+
+	"github.com/example/gitea-jenkins-webhook/internal/gitea"
+	"github.com/example/gitea-jenkins-webhook/internal/metrics"
+	"github.com/example/gitea-jenkins-webhook/pkg/webhook"
+)
+
+// commentTask - публикация итогового комментария события, переданная воркерам публикации комментариев.
+type commentTask struct {
+	ctx  context.Context // Контекст события без отмены: публикация продолжается после завершения обработки
+	evt  webhook.PullRequestEvent
+	post func(ctx context.Context) (*gitea.Comment, error)
+	held bool // Pull request остается в обработке до публикации (см. holdInFlight)
+}
+
+// startCommentWorkers создает очередь публикации комментариев и запускает server.comment_workers воркеров.
+// При comment_workers, равном 0, комментарии публикуют воркеры событий. Вызывается под p.mu из Start.
+func (p *Processor) startCommentWorkers() {
+	server := p.Config().Server
+	if server.CommentWorkers <= 0 {
+		return
+	}
+	p.comments = make(chan commentTask, server.CommentQueueSize)
+	for i := 0; i < server.CommentWorkers; i++ {
+		p.commentWG.Add(1)
+		go p.commentWorker(i)
+	}
+	p.log.Info("comment dispatcher started",
+		"comment_workers", server.CommentWorkers,
+		"comment_queue_size", server.CommentQueueSize)
+}
+
+// stopCommentWorkers закрывает очередь публикации комментариев и ожидает, пока воркеры опубликуют
+// оставшиеся комментарии. Вызывается после завершения воркеров событий.
+func (p *Processor) stopCommentWorkers() {
+	p.dispatchMu.Lock()
+	if p.comments != nil && !p.commentsClosed {
+		close(p.comments)
+		p.commentsClosed = true
+	}
+	p.dispatchMu.Unlock()
+	p.commentWG.Wait()
+}
+
+// dispatchComment передает публикацию итогового комментария события evt воркерам публикации комментариев,
+// чтобы медленный ответ Gitea не задерживал опрос Jenkins воркером события. Возвращает false, если очередь
+// не используется (comment_workers равен 0, процессор не запущен или остановлен) или переполнена:
+// тогда комментарий публикует вызывающий воркер события. Pull request события остается в обработке,
+// пока комментарий не опубликован, поэтому комментарии одного pull request публикуются по очереди.
+func (p *Processor) dispatchComment(ctx context.Context, evt webhook.PullRequestEvent, post func(ctx context.Context) (*gitea.Comment, error)) bool {
+	p.dispatchMu.Lock()
+	defer p.dispatchMu.Unlock()
+	if p.comments == nil || p.commentsClosed {
+		return false
+	}
+	held := p.holdInFlight(evt)
+	select {
+	case p.comments <- commentTask{ctx: context.WithoutCancel(ctx), evt: evt, post: post, held: held}:
+		p.log.Debug("comment dispatched",
+			"repo", evt.Repository.FullName,
+			"pr_number", evt.PullRequest.Number,
+			"comment_queue_length", len(p.comments))
+		return true
+	default:
+		if held {
+			p.releaseInFlight(evt)
+		}
+		p.log.Warn("comment queue is full, posting from the event worker",
+			"repo", evt.Repository.FullName,
+			"pr_number", evt.PullRequest.Number,
+			"comment_queue_size", cap(p.comments))
+		metrics.CommentQueueFull.Inc()
+		return false
+	}
+}
+
+// commentWorker публикует комментарии из очереди публикации. Публикация прерывается, только если истек
+// срок остановки процессора. Неудачная публикация учитывается в метрике comment_dispatch_failed.
+// id - идентификатор воркера для логирования.
+func (p *Processor) commentWorker(id int) {
+	p.log.Debug("comment worker started", "worker_id", id)
+	defer func() {
+		p.log.Debug("comment worker stopped", "worker_id", id)
+		p.commentWG.Done()
+	}()
+	for task := range p.comments {
+		ctx, cancel := context.WithCancel(task.ctx)
+		stop := context.AfterFunc(p.eventsCtx, cancel)
+		if _, err := task.post(ctx); err != nil {
+			p.log.Error("failed to post comment to gitea",
+				"err", err,
+				"worker_id", id,
+				"repo", task.evt.Repository.FullName,
+				"pr_number", task.evt.PullRequest.Number)
+			metrics.CommentDispatchFailed.Inc()
+		}
+		stop()
+		cancel()
+		if task.held {
+			p.releaseInFlight(task.evt)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package processor
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+
+	"github.com/example/gitea-jenkins-webhook/internal/gitea"
+)
+
+// dryRunCommentID - счетчик идентификаторов комментариев, "опубликованных" в режиме dry_run.
+var dryRunCommentID atomic.Int64
+
+// dryRunGitea - клиент Gitea для режима server.dry_run: чтение выполняется настоящим клиентом,
+// а комментарии, ревью и статусы коммитов вместо публикации записываются в лог.
+type dryRunGitea struct {
+	GiteaClient
+	log *slog.Logger
+}
+
+// PostComment записывает комментарий в лог и возвращает вымышленный комментарий.
+func (d dryRunGitea) PostComment(ctx context.Context, repoFullName string, issueIndex int64, body string) (*gitea.Comment, error) {
+	d.log.Info("dry run: comment not posted", "repo", repoFullName, "pr_number", issueIndex, "body", body)
+	return &gitea.Comment{ID: dryRunCommentID.Add(1), Body: body}, nil
+}
+
+// CreateReview записывает ревью в лог и возвращает вымышленный комментарий.
+func (d dryRunGitea) CreateReview(ctx context.Context, repoFullName string, index int64, body, event string) (*gitea.Comment, error) {
+	d.log.Info("dry run: review not posted", "repo", repoFullName, "pr_number", index, "event", event, "body", body)
+	return &gitea.Comment{ID: dryRunCommentID.Add(1), Body: body}, nil
+}
+
+// EditComment записывает новый текст комментария в лог.
+func (d dryRunGitea) EditComment(ctx context.Context, repoFullName string, commentID int64, body string) (*gitea.Comment, error) {
+	d.log.Info("dry run: comment not edited", "repo", repoFullName, "comment_id", commentID, "body", body)
+	return &gitea.Comment{ID: commentID, Body: body}, nil
+}
+
+// CreateCommitStatus записывает статус коммита в лог.
+func (d dryRunGitea) CreateCommitStatus(ctx context.Context, owner, repo, sha string, status gitea.CommitStatus) error {
+	d.log.Info("dry run: commit status not set",
+		"repo", owner+"/"+repo,
+		"sha", sha,
+		"state", status.State,
+		"context", status.Context,
+		"description", status.Description)
+	return nil
+}
@@ -0,0 +1,47 @@
+package processor
+
+import (
+	"context"
+	"time"
+
+	"github.com/example/gitea-jenkins-webhook/internal/sink"
+	"github.com/example/gitea-jenkins-webhook/pkg/webhook"
+)
+
+// EventSink определяет интерфейс приемника записей об обработанных событиях.
+type EventSink interface {
+	Send(ctx context.Context, rec sink.Record) error
+}
+
+// SetSink задает приемник записей об обработанных событиях. Должен вызываться до Start.
+func (p *Processor) SetSink(s EventSink) {
+	p.sink = s
+}
+
+// export отправляет запись об обработанном событии в приемник. Пропущенные события не экспортируются.
+// Ошибки отправки записываются в лог и не влияют на итог обработки.
+func (p *Processor) export(ctx context.Context, evt webhook.PullRequestEvent, res Result) {
+	if p.sink == nil || res.Outcome == OutcomeSkipped {
+		return
+	}
+
+	rec := sink.Record{
+		Repo:        evt.Repository.FullName,
+		PRNumber:    evt.PullRequest.Number,
+		Outcome:     res.Outcome.String(),
+		Reason:      res.Reason,
+		CommentURL:  res.CommentURL,
+		DeliveryID:  evt.DeliveryID,
+		ProcessedAt: time.Now().UTC(),
+	}
+	if res.Job != nil {
+		rec.Job = &sink.Job{Name: res.Job.Name, URL: res.Job.URL, Color: res.Job.Color}
+	}
+
+	if err := p.sink.Send(ctx, rec); err != nil {
+		p.log.Error("failed to export event record",
+			"err", err,
+			"repo", rec.Repo,
+			"pr_number", rec.PRNumber)
+	}
+}
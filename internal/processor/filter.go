@@ -0,0 +1,74 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/example/gitea-jenkins-webhook/internal/config"
+	"github.com/example/gitea-jenkins-webhook/internal/state"
+	"github.com/example/gitea-jenkins-webhook/pkg/webhook"
+)
+
+// skipStatePattern - значение шаблона в ключе хранилища состояния для комментария о пропуске события.
+const skipStatePattern = "skip"
+
+// filterReason проверяет событие по фильтрам правила (ветка, отправитель, черновик, метки)
+// и возвращает причину пропуска или пустую строку, если событие должно обрабатываться.
+func filterReason(rule config.RepositoryRule, evt webhook.PullRequestEvent) string {
+	pr := evt.PullRequest
+	if len(rule.Branches) > 0 && !slices.Contains(rule.Branches, pr.Base.Ref) {
+		return fmt.Sprintf("target branch %q is not in the configured branches", pr.Base.Ref)
+	}
+	if slices.Contains(rule.IgnoreSenders, evt.Sender.Login) {
+		return fmt.Sprintf("sender %q is ignored", evt.Sender.Login)
+	}
+	if rule.SkipDrafts && pr.Draft {
+		return "pull request is a draft"
+	}
+	for _, label := range pr.Labels {
+		if slices.Contains(rule.SkipLabels, label.Name) {
+			return fmt.Sprintf("pull request has label %q", label.Name)
+		}
+	}
+	return ""
+}
+
+// postSkipComment публикует комментарий skip_comment_template о пропуске события фильтром.
+// Комментарий публикуется не более одного раза для PR; пустой шаблон отключает комментарий.
+func (p *Processor) postSkipComment(ctx context.Context, rule config.RepositoryRule, evt webhook.PullRequestEvent, issueIndex int64, data map[string]any) string {
+	if rule.SkipCommentTemplate == "" {
+		return ""
+	}
+
+	key := state.Key(evt.Repository.FullName, evt.PullRequest.Number, skipStatePattern)
+	if _, ok := p.state.Get(key); ok {
+		p.log.Debug("skip comment already posted", "repo", evt.Repository.FullName, "pr", evt.PullRequest.Number)
+		return ""
+	}
+
+	body, err := p.executeCommentTemplate("skip_comment", rule.SkipCommentTemplate, data)
+	if err != nil {
+		p.log.Error("failed to execute skip comment template", "err", err, "template", rule.SkipCommentTemplate)
+		return ""
+	}
+	if rule.PlainText {
+		body = stripMarkdown(body)
+	}
+	body = p.finalizeComment(evt.Repository.FullName, issueIndex, body)
+
+	if _, err := p.publish(ctx, rule, evt.Repository.FullName, issueIndex, body); err != nil {
+		p.log.Error("failed to post skip comment to gitea",
+			"err", err,
+			"repo", evt.Repository.FullName,
+			"pr_number", evt.PullRequest.Number)
+		return ""
+	}
+	p.state.Put(key, state.Record{
+		CommentHash: state.Hash(body),
+		Outcome:     OutcomeSkipped.String(),
+		UpdatedAt:   time.Now(),
+	})
+	return body
+}
@@ -0,0 +1,53 @@
+package processor
+
+import (
+	"strings"
+	"text/template"
+	"time"
+)
+
+// commentFuncs возвращает функции, доступные в шаблонах комментариев.
+// Время форматируется в часовом поясе loc (server.timezone).
+func commentFuncs(loc *time.Location) template.FuncMap {
+	return template.FuncMap{
+		// formatTime форматирует время по раскладке Go: {{ .ReceivedAt | formatTime "2006-01-02 15:04 MST" }}.
+		"formatTime": func(layout string, t time.Time) string {
+			return t.In(loc).Format(layout)
+		},
+		// image встраивает изображение в Markdown: {{ image "build" .BadgeURL }}.
+		"image": markdownImage,
+		// formatDuration округляет длительность до секунд: {{ formatDuration .Timeout }}.
+		"formatDuration": func(d time.Duration) string {
+			return d.Round(time.Second).String()
+		},
+	}
+}
+
+// markdownImage формирует Markdown-разметку изображения ![alt](url). Символы, которые
+// завершили бы текст или адрес раньше времени, экранируются.
+func markdownImage(alt, url string) string {
+	alt = strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`).Replace(alt)
+	url = strings.NewReplacer(" ", "%20", "(", "%28", ")", "%29").Replace(url)
+	return "![" + alt + "](" + url + ")"
+}
+
+// location возвращает часовой пояс шаблонов комментариев из текущей конфигурации.
+func (p *Processor) location() *time.Location {
+	if loc := p.Config().Server.Location; loc != nil {
+		return loc
+	}
+	return time.UTC
+}
+
+// executeCommentTemplate выполняет шаблон комментария с функциями commentFuncs.
+func (p *Processor) executeCommentTemplate(name, tpl string, data any) (string, error) {
+	t, err := template.New(name).Funcs(commentFuncs(p.location())).Parse(tpl)
+	if err != nil {
+		return "", err
+	}
+	var buf strings.Builder
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,61 @@
+package processor
+
+import (
+	"github.com/example/gitea-jenkins-webhook/internal/config"
+	"github.com/example/gitea-jenkins-webhook/internal/gitea"
+)
+
+// GiteaFactory создает клиента Gitea для адреса API и токена, переопределенных в правиле репозитория.
+type GiteaFactory func(baseURL, token string) GiteaClient
+
+// SetGiteaFactory задает способ создания клиентов Gitea для правил с gitea_base_url.
+// По умолчанию используется gitea.NewClient. Должен вызываться до Start.
+func (p *Processor) SetGiteaFactory(factory GiteaFactory) {
+	p.giteaMu.Lock()
+	defer p.giteaMu.Unlock()
+	p.giteaFactory = factory
+	p.giteaClients = nil
+}
+
+// giteaFor возвращает клиента Gitea для правила: основной клиент или, если в правиле задан
+// gitea_base_url, клиента этого сервера. Клиенты переопределенных серверов кешируются по адресу и токену.
+// Если gitea_token не задан, используется токен из секции gitea. В режиме server.dry_run
+// изменяющие запросы клиента только записываются в лог.
+func (p *Processor) giteaFor(rule config.RepositoryRule) GiteaClient {
+	client := p.ruleGitea(rule)
+	if p.Config().Server.DryRun {
+		return dryRunGitea{GiteaClient: client, log: p.log}
+	}
+	return client
+}
+
+// ruleGitea возвращает настоящего клиента Gitea для правила (см. giteaFor).
+func (p *Processor) ruleGitea(rule config.RepositoryRule) GiteaClient {
+	if rule.GiteaBaseURL == "" {
+		return p.gc
+	}
+	token := rule.GiteaToken
+	if token == "" {
+		token = p.Config().Gitea.Token
+	}
+	key := rule.GiteaBaseURL + "\x00" + token
+
+	p.giteaMu.Lock()
+	defer p.giteaMu.Unlock()
+	if client, ok := p.giteaClients[key]; ok {
+		return client
+	}
+	if p.giteaClients == nil {
+		p.giteaClients = make(map[string]GiteaClient)
+	}
+	factory := p.giteaFactory
+	if factory == nil {
+		factory = func(baseURL, token string) GiteaClient {
+			return gitea.NewClient(baseURL, token, nil, p.log.With("gitea_base_url", baseURL))
+		}
+	}
+	client := factory(rule.GiteaBaseURL, token)
+	p.giteaClients[key] = client
+	p.log.Info("created gitea client for rule override", "repo", rule.Name, "gitea_base_url", rule.GiteaBaseURL)
+	return client
+}
@@ -0,0 +1,27 @@
+package processor
+
+// spawn запускает fn в отдельной горутине, учитывая ее в p.background и p.bg, чтобы Stop дождался
+// ее завершения. Если достигнут предел server.max_goroutines, горутина не запускается и
+// возвращается false; вызывающий код должен выполнить работу сам или отказаться от нее.
+func (p *Processor) spawn(name string, fn func()) bool {
+	if limit := p.Config().Server.MaxGoroutines; limit > 0 && int(p.background.Load()) >= limit {
+		p.log.Warn("goroutine limit reached", "task", name, "limit", limit)
+		return false
+	}
+	p.background.Add(1)
+	p.bg.Add(1)
+	go func() {
+		defer func() {
+			p.background.Add(-1)
+			p.bg.Done()
+		}()
+		fn()
+	}()
+	return true
+}
+
+// Goroutines возвращает число горутин, запущенных процессором и еще не завершившихся
+// (воркеры, ожидание целей Jenkins, фоновые комментарии).
+func (p *Processor) Goroutines() int {
+	return int(p.workers.Load() + p.background.Load())
+}
@@ -0,0 +1,150 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/example/gitea-jenkins-webhook/internal/config"
+	"github.com/example/gitea-jenkins-webhook/internal/gitea"
+	"github.com/example/gitea-jenkins-webhook/internal/state"
+	"github.com/example/gitea-jenkins-webhook/pkg/webhook"
+)
+
+// commentGroup - общий комментарий PR со статусами всех целей события (group_comment правила).
+// Комментарий публикуется до ожидания задач со всеми целями в состоянии ожидания и правится
+// по мере того, как цели получают итог.
+type commentGroup struct {
+	mu      sync.Mutex
+	p       *Processor
+	rule    config.RepositoryRule
+	repo    string
+	index   int64
+	targets []compiledTarget
+	results []*TargetResult // Итоги целей по порядку (nil - цель еще ожидается)
+	comment *gitea.Comment  // Общий комментарий PR (nil - опубликовать не удалось)
+}
+
+// startCommentGroup публикует общий комментарий PR со всеми целями в состоянии ожидания.
+// Если для PR уже есть общий комментарий (из предыдущего события), он переиспользуется.
+func (p *Processor) startCommentGroup(ctx context.Context, rule config.RepositoryRule, repo string, index int64, targets []compiledTarget) *commentGroup {
+	g := &commentGroup{
+		p:       p,
+		rule:    rule,
+		repo:    repo,
+		index:   index,
+		targets: targets,
+		results: make([]*TargetResult, len(targets)),
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if prev, ok := p.state.Get(state.CommentKey(repo, index)); ok && prev.CommentID != 0 {
+		g.comment = &gitea.Comment{ID: prev.CommentID}
+	}
+	g.publish(ctx, g.render())
+	return g
+}
+
+// resolve записывает итог цели i и обновляет общий комментарий.
+func (g *commentGroup) resolve(ctx context.Context, i int, res TargetResult) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.results[i] = &res
+	g.publish(ctx, g.render())
+}
+
+// finish заменяет общий комментарий итоговым: отрисованным шаблоном итога body (без префикса)
+// и списком статусов целей.
+func (g *commentGroup) finish(ctx context.Context, body string) (*gitea.Comment, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if err := g.publish(ctx, body+"\n\n"+g.render()); err != nil {
+		return nil, err
+	}
+	return g.comment, nil
+}
+
+// publish правит общий комментарий или, если его еще нет либо изменить его не удалось,
+// публикует новый и запоминает его для PR. Вызывается под g.mu.
+func (g *commentGroup) publish(ctx context.Context, body string) error {
+	if g.rule.PlainText {
+		body = stripMarkdown(body)
+	}
+	body = g.p.finalizeComment(g.repo, g.index, body)
+	if g.comment != nil {
+		if err := g.p.waitCommentSlot(ctx, g.rule, g.repo); err != nil {
+			return err
+		}
+		comment, err := g.p.giteaFor(g.rule).EditComment(ctx, g.repo, g.comment.ID, body)
+		if err == nil {
+			g.comment = comment
+			return nil
+		}
+		g.p.log.Warn("failed to update grouped comment, posting a new one",
+			"err", err,
+			"repo", g.repo,
+			"issue_index", g.index,
+			"comment_id", g.comment.ID)
+	}
+	comment, err := g.p.publish(ctx, g.rule, g.repo, g.index, body)
+	if err != nil {
+		g.p.log.Warn("failed to post grouped comment", "err", err, "repo", g.repo, "issue_index", g.index)
+		return err
+	}
+	g.comment = comment
+	g.p.state.Put(state.CommentKey(g.repo, g.index), state.Record{CommentID: comment.ID, UpdatedAt: time.Now()})
+	return nil
+}
+
+// render отрисовывает список целей: ⏳ - цель ожидается, ✅ - задача найдена и сборка успешна
+// или еще идет, ❌ - остальные итоги. Вызывается под g.mu.
+func (g *commentGroup) render() string {
+	lines := make([]string, len(g.targets))
+	for i, t := range g.targets {
+		name := "`" + t.pattern + "`"
+		if t.target.Instance != "" {
+			name += " (" + t.target.Instance + ")"
+		}
+		res := g.results[i]
+		switch {
+		case res == nil:
+			lines[i] = fmt.Sprintf("- ⏳ %s: pending", name)
+		case res.Job != nil:
+			lines[i] = fmt.Sprintf("- %s %s: %s — [%s](%s)", groupIcon(*res), name, res.Outcome, res.Job.Name, res.Job.URL)
+		default:
+			lines[i] = fmt.Sprintf("- %s %s: %s", groupIcon(*res), name, res.Outcome)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// groupIcon возвращает значок итога цели в общем комментарии.
+func groupIcon(res TargetResult) string {
+	if res.Succeeded() {
+		return "✅"
+	}
+	return "❌"
+}
+
+// finishCommentGroup публикует итоговый комментарий события в общий комментарий PR.
+func (p *Processor) finishCommentGroup(ctx context.Context, group *commentGroup, evt webhook.PullRequestEvent, body string, res Result) Result {
+	comment, err := group.finish(ctx, body)
+	if err != nil {
+		p.log.Error("failed to publish grouped comment to gitea",
+			"err", err,
+			"repo", evt.Repository.FullName,
+			"pr_number", evt.PullRequest.Number)
+		res.Outcome = OutcomeCommentFailed
+		res.Reason = "post comment"
+		res.Err = err
+		return res
+	}
+	res.CommentURL = comment.HTMLURL
+	p.log.Info("grouped comment updated with result",
+		"repo", evt.Repository.FullName,
+		"pr", evt.PullRequest.Number,
+		"comment_id", comment.ID)
+	return res
+}
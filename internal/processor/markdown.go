@@ -0,0 +1,37 @@
+package processor
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Регулярные выражения для удаления разметки Markdown в stripMarkdown.
+var (
+	mdImage      = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	mdLink       = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+	mdBold       = regexp.MustCompile(`(\*\*|__)(\S(?:.*?\S)?)(\*\*|__)`)
+	mdItalic     = regexp.MustCompile(`(^|[^\w*])[*_](\S(?:[^*_\n]*?\S)?)[*_]`)
+	mdStrike     = regexp.MustCompile(`~~(.+?)~~`)
+	mdCode       = regexp.MustCompile("`([^`]+)`")
+	mdHeading    = regexp.MustCompile(`(?m)^#{1,6}[ \t]+`)
+	mdQuote      = regexp.MustCompile(`(?m)^>[ \t]?`)
+	mdCodeFence  = regexp.MustCompile("(?m)^[ \t]*```.*\n?")
+	mdHorizontal = regexp.MustCompile(`(?m)^[ \t]*(?:-{3,}|\*{3,}|_{3,})[ \t]*$`)
+)
+
+// stripMarkdown удаляет из текста основную разметку Markdown (plain_text правила):
+// ссылки и изображения заменяются своим текстом, снимаются выделение, зачеркивание, встроенный код,
+// заголовки, цитаты, ограждения блоков кода и горизонтальные линии. Содержимое блоков кода сохраняется.
+func stripMarkdown(s string) string {
+	s = mdCodeFence.ReplaceAllString(s, "")
+	s = mdHorizontal.ReplaceAllString(s, "")
+	s = mdImage.ReplaceAllString(s, "$1")
+	s = mdLink.ReplaceAllString(s, "$1")
+	s = mdCode.ReplaceAllString(s, "$1")
+	s = mdBold.ReplaceAllString(s, "$2")
+	s = mdStrike.ReplaceAllString(s, "$1")
+	s = mdItalic.ReplaceAllString(s, "$1$2")
+	s = mdHeading.ReplaceAllString(s, "")
+	s = mdQuote.ReplaceAllString(s, "")
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,28 @@
+package processor
+
+import "testing"
+
+func TestStripMarkdown(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "link", in: "Job [PR-1](https://jenkins/job/PR-1/) found", want: "Job PR-1 found"},
+		{name: "image", in: "![build status](https://jenkins/badge) ok", want: "build status ok"},
+		{name: "emphasis", in: "**bold**, __strong__, *italic* and _em_", want: "bold, strong, italic and em"},
+		{name: "snake case kept", in: "job_name_template is *set*", want: "job_name_template is set"},
+		{name: "strike and code", in: "~~old~~ `make test`", want: "old make test"},
+		{name: "heading and quote", in: "## Result\n> passed", want: "Result\npassed"},
+		{name: "code fence", in: "log:\n```\nstep 1\n```", want: "log:\nstep 1"},
+		{name: "list bullets kept", in: "* first\n* second", want: "* first\n* second"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stripMarkdown(tt.in); got != tt.want {
+				t.Fatalf("stripMarkdown(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
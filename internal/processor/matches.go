@@ -0,0 +1,51 @@
+package processor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/example/gitea-jenkins-webhook/internal/jenkins"
+)
+
+// matchedJobs собирает задачи, совпавшие с шаблонами всех целей (verbose_matches), без повторов.
+func matchedJobs(results []TargetResult) []jenkins.Job {
+	var jobs []jenkins.Job
+	seen := make(map[string]bool)
+	for _, r := range results {
+		for _, job := range r.Matched {
+			key := job.URL
+			if key == "" {
+				key = job.FullName
+			}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs
+}
+
+// matchesList формирует Markdown-список совпавших задач со ссылками для verbose_matches.
+// Выводится не более limit задач, об остальных сообщается отдельной строкой.
+func matchesList(jobs []jenkins.Job, limit int) string {
+	var b strings.Builder
+	b.WriteString("Matched Jenkins jobs:")
+	for i, job := range jobs {
+		if i == limit {
+			fmt.Fprintf(&b, "\n- …and %d more", len(jobs)-limit)
+			break
+		}
+		name := job.FullName
+		if name == "" {
+			name = job.Name
+		}
+		if job.URL != "" {
+			fmt.Fprintf(&b, "\n- [%s](%s)", name, job.URL)
+		} else {
+			fmt.Fprintf(&b, "\n- %s", name)
+		}
+	}
+	return b.String()
+}
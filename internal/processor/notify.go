@@ -0,0 +1,50 @@
+package processor
+
+import (
+	"context"
+
+	"github.com/example/gitea-jenkins-webhook/internal/notifier"
+	"github.com/example/gitea-jenkins-webhook/pkg/webhook"
+)
+
+// Notifier определяет интерфейс внешнего получателя итогов обработки событий.
+type Notifier interface {
+	Notify(ctx context.Context, payload notifier.Payload) error
+}
+
+// SetNotifiers задает получателей итогов обработки по именам из конфигурации.
+// Должен вызываться до Start.
+func (p *Processor) SetNotifiers(notifiers map[string]Notifier) {
+	p.notifiers = notifiers
+}
+
+// notify отправляет итог обработки события всем получателям. Пропущенные события не отправляются.
+// Ошибки отправки записываются в лог и не влияют на итог обработки.
+func (p *Processor) notify(ctx context.Context, evt webhook.PullRequestEvent, res Result) {
+	if len(p.notifiers) == 0 || res.Outcome == OutcomeSkipped {
+		return
+	}
+
+	payload := notifier.Payload{
+		Repo:       evt.Repository.FullName,
+		PRNumber:   evt.PullRequest.Number,
+		Outcome:    res.Outcome.String(),
+		Reason:     res.Reason,
+		Comment:    res.Comment,
+		DeliveryID: evt.DeliveryID,
+	}
+	if res.Job != nil {
+		payload.JobName = res.Job.Name
+		payload.JobURL = res.Job.URL
+	}
+
+	for name, n := range p.notifiers {
+		if err := n.Notify(ctx, payload); err != nil {
+			p.log.Warn("failed to send notification",
+				"err", err,
+				"notifier", name,
+				"repo", payload.Repo,
+				"pr_number", payload.PRNumber)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package processor
+
+import (
+	"strings"
+
+	"github.com/example/gitea-jenkins-webhook/internal/config"
+	"github.com/example/gitea-jenkins-webhook/internal/jenkins"
+)
+
+// Outcome описывает итог обработки одного события pull request.
+type Outcome int
+
+const (
+	// OutcomeSkipped - событие пропущено (репозиторий не настроен, неподдерживаемое действие и т.п.).
+	OutcomeSkipped Outcome = iota
+	// OutcomeJobFound - задача Jenkins найдена, результат сборки неизвестен, комментарий опубликован.
+	OutcomeJobFound
+	// OutcomeBuildSuccess - задача Jenkins найдена, последняя сборка успешна.
+	OutcomeBuildSuccess
+	// OutcomeBuildFailure - задача Jenkins найдена, последняя сборка завершилась ошибкой.
+	OutcomeBuildFailure
+	// OutcomeBuildUnstable - задача Jenkins найдена, последняя сборка нестабильна.
+	OutcomeBuildUnstable
+	// OutcomeTimeout - задача Jenkins не найдена в течение таймаута, комментарий опубликован.
+	OutcomeTimeout
+	// OutcomeError - ошибка при обработке события (шаблоны, регулярное выражение, Jenkins).
+	OutcomeError
+	// OutcomeCommentFailed - результат определен, но комментарий не удалось опубликовать.
+	OutcomeCommentFailed
+	// OutcomeMissingRoot - корневая директория задач правила не существует в Jenkins, комментарий опубликован.
+	OutcomeMissingRoot
+	// OutcomeAuthFailed - Jenkins отклонил запрос из-за аутентификации (например, после смены токена), комментарий опубликован.
+	OutcomeAuthFailed
+)
+
+// String возвращает строковое представление итога обработки для логов и метрик.
+func (o Outcome) String() string {
+	switch o {
+	case OutcomeSkipped:
+		return "skipped"
+	case OutcomeJobFound:
+		return "job_found"
+	case OutcomeBuildSuccess:
+		return "build_success"
+	case OutcomeBuildFailure:
+		return "build_failure"
+	case OutcomeBuildUnstable:
+		return "build_unstable"
+	case OutcomeTimeout:
+		return "timeout"
+	case OutcomeError:
+		return "error"
+	case OutcomeCommentFailed:
+		return "comment_failed"
+	case OutcomeMissingRoot:
+		return "missing_root"
+	case OutcomeAuthFailed:
+		return "auth_failed"
+	default:
+		return "unknown"
+	}
+}
+
+// Result содержит итог обработки события и сопутствующие детали.
+type Result struct {
+	Outcome       Outcome              // Итог обработки
+	Reason        string               // Краткое описание причины (для пропусков и ошибок)
+	Job           *jenkins.Job         // Найденная задача Jenkins (если есть)
+	Build         *jenkins.BuildResult // Завершенная сборка найденной задачи (при wait_for_completion)
+	Comment       string               // Текст опубликованного (или подготовленного) комментария
+	CommentURL    string               // Ссылка на опубликованный комментарий
+	Suppressed    bool                 // Комментарий не опубликован, так как совпадает с предыдущим
+	CommentQueued bool                 // Комментарий передан в очередь публикации (server.comment_workers) и публикуется позже
+	Targets       []TargetResult       // Результаты по каждой цели Jenkins
+	Err           error                // Ошибка, приведшая к итогу (если есть)
+}
+
+// jobOutcome определяет итог по цвету найденной задачи Jenkins.
+// Если цвет не отражает завершенную сборку (нет сборок, сборка идет, задача отключена),
+// возвращает OutcomeJobFound.
+func jobOutcome(job *jenkins.Job) Outcome {
+	if isBuilding(job) {
+		return OutcomeJobFound
+	}
+	switch job.Color {
+	case "blue":
+		return OutcomeBuildSuccess
+	case "red":
+		return OutcomeBuildFailure
+	case "yellow":
+		return OutcomeBuildUnstable
+	default:
+		return OutcomeJobFound
+	}
+}
+
+// buildOutcome определяет итог по результату завершенной сборки Jenkins.
+// SUCCESS считается успехом, UNSTABLE - нестабильной сборкой, остальные результаты - падением.
+func buildOutcome(build *jenkins.BuildResult) Outcome {
+	switch build.Result {
+	case "SUCCESS":
+		return OutcomeBuildSuccess
+	case "UNSTABLE":
+		return OutcomeBuildUnstable
+	default:
+		return OutcomeBuildFailure
+	}
+}
+
+// colorResults сопоставляет цвет задачи Jenkins результату ее последней завершенной сборки.
+var colorResults = map[string]string{
+	"blue":    "SUCCESS",
+	"red":     "FAILURE",
+	"yellow":  "UNSTABLE",
+	"aborted": "ABORTED",
+}
+
+// lastResult возвращает результат последней завершенной сборки: из build, если сборки дождались,
+// иначе по цвету задачи. Пустая строка - результат неизвестен (сборок нет или сборка идет).
+func lastResult(job *jenkins.Job, build *jenkins.BuildResult) string {
+	if build != nil {
+		return build.Result
+	}
+	return colorResults[job.Color]
+}
+
+// successWhenOutcome вычисляет success_when правила (выражение, разобранное при проверке конфигурации)
+// для найденной задачи: успех, если выражение истинно, иначе падение сборки. Возвращает false,
+// если выражение не задано или результат сборки еще неизвестен - тогда итог не меняется.
+// При require_success без завершенной сборки цвет задачи не учитывается, и результат считается неизвестным.
+func successWhenOutcome(rule config.RepositoryRule, job *jenkins.Job, build *jenkins.BuildResult) (Outcome, bool) {
+	if rule.RequireSuccess && build == nil {
+		return 0, false
+	}
+	result := lastResult(job, build)
+	if rule.SuccessExpr == nil || result == "" {
+		return 0, false
+	}
+	if rule.SuccessExpr.Eval(config.JobFacts{Name: job.Name, Color: job.Color, Result: result}) {
+		return OutcomeBuildSuccess, true
+	}
+	return OutcomeBuildFailure, true
+}
+
+// isBuilding сообщает, идет ли сейчас сборка задачи (цвет с суффиксом "_anime").
+func isBuilding(job *jenkins.Job) bool {
+	return strings.HasSuffix(job.Color, "_anime")
+}
+
+// commentTemplate возвращает шаблон комментария правила для указанного итога обработки.
+func commentTemplate(rule config.RepositoryRule, outcome Outcome) string {
+	switch outcome {
+	case OutcomeJobFound:
+		return rule.JobFoundTemplate
+	case OutcomeBuildSuccess:
+		return rule.BuildSuccessTemplate
+	case OutcomeBuildFailure:
+		return rule.BuildFailureTemplate
+	case OutcomeBuildUnstable:
+		return rule.BuildUnstableTemplate
+	case OutcomeTimeout:
+		return rule.TimeoutTemplate
+	case OutcomeMissingRoot:
+		return rule.MissingRootTemplate
+	case OutcomeAuthFailed:
+		return rule.AuthErrorTemplate
+	default:
+		return rule.ErrorTemplate
+	}
+}
@@ -0,0 +1,56 @@
+package processor
+
+import (
+	"context"
+	"time"
+
+	"github.com/example/gitea-jenkins-webhook/pkg/webhook"
+)
+
+// overloadCommentInterval - минимальный интервал между комментариями о перегрузке,
+// чтобы не усиливать нагрузку на Gitea при длительном переполнении очереди.
+const overloadCommentInterval = time.Minute
+
+// commentOverload асинхронно публикует в PR комментарий server.overload_comment_template
+// о том, что событие отклонено из-за переполнения очереди. Комментарии публикуются
+// не чаще overloadCommentInterval и только для настроенных репозиториев. Вызывается под p.mu.
+func (p *Processor) commentOverload(evt webhook.PullRequestEvent) {
+	cfg := p.Config()
+	if !cfg.Server.CommentOnOverload || time.Since(p.lastOverloadComment) < overloadCommentInterval {
+		return
+	}
+	rule, ok := cfg.GetRepositoryRule(evt.Repository.FullName)
+	if !ok {
+		return
+	}
+	p.lastOverloadComment = time.Now()
+
+	data := map[string]any{
+		"Number":     evt.PullRequest.Number,
+		"Title":      evt.PullRequest.Title,
+		"Repo":       evt.Repository.FullName,
+		"ReceivedAt": evt.Timestamp.In(p.location()),
+	}
+	body, err := p.executeCommentTemplate("overload_comment", cfg.Server.OverloadCommentTemplate, data)
+	if err != nil {
+		p.log.Error("failed to execute overload comment template", "err", err)
+		return
+	}
+	issueIndex := evt.PullRequest.Number
+	if rule.StatusIssueIndex > 0 {
+		issueIndex = rule.StatusIssueIndex
+	}
+	body = p.finalizeComment(evt.Repository.FullName, issueIndex, body)
+	gc := p.giteaFor(rule)
+	p.spawn("overload_comment", func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		// A single attempt: retries would only add load while the service is overloaded.
+		if _, err := gc.PostComment(ctx, evt.Repository.FullName, issueIndex, body); err != nil {
+			p.log.Error("failed to post overload comment to gitea",
+				"err", err,
+				"repo", evt.Repository.FullName,
+				"pr_number", evt.PullRequest.Number)
+		}
+	})
+}
@@ -0,0 +1,45 @@
+package processor
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// shortHashLength - число шестнадцатеричных символов в коротком хэше.
+const shortHashLength = 8
+
+// patternFuncs - функции, доступные в шаблонах job_pattern и job_root.
+// Результат экранируется для использования в регулярном выражении.
+var patternFuncs = template.FuncMap{
+	// reQuote экранирует метасимволы регулярного выражения в подставляемом значении:
+	// {{ reQuote .SourceBranch }} совпадает с веткой "release/1.2+hotfix" буквально.
+	"reQuote": func(v any) string {
+		return regexp.QuoteMeta(fmt.Sprint(v))
+	},
+	"sha1short": func(v any) string {
+		sum := sha1.Sum([]byte(fmt.Sprint(v)))
+		return regexp.QuoteMeta(hex.EncodeToString(sum[:])[:shortHashLength])
+	},
+	"sha256short": func(v any) string {
+		sum := sha256.Sum256([]byte(fmt.Sprint(v)))
+		return regexp.QuoteMeta(hex.EncodeToString(sum[:])[:shortHashLength])
+	},
+}
+
+// executePatternTemplate выполняет шаблон job_pattern или job_root с функциями patternFuncs.
+func executePatternTemplate(name, tpl string, data any) (string, error) {
+	t, err := template.New(name).Funcs(patternFuncs).Parse(tpl)
+	if err != nil {
+		return "", err
+	}
+	var buf strings.Builder
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
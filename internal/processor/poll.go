@@ -0,0 +1,59 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/example/gitea-jenkins-webhook/internal/jenkins"
+)
+
+// ErrRepositoryNotConfigured возвращается, если для репозитория нет правила в конфигурации.
+var ErrRepositoryNotConfigured = errors.New("repository not configured")
+
+// Poll выполняет однократный поиск задачи Jenkins для PR по шаблонам правила репозитория,
+// не дожидаясь появления задачи и не публикуя комментариев. Используется для диагностики.
+// Возвращает первую найденную задачу или nil, если ни один шаблон не совпал.
+func (p *Processor) Poll(ctx context.Context, repo string, number int64) (*jenkins.Job, error) {
+	rule, ok := p.Config().GetRepositoryRule(repo)
+	if !ok {
+		return nil, ErrRepositoryNotConfigured
+	}
+
+	ctx = jenkins.WithMatchTimeout(ctx, rule.MatchTimeout)
+	ctx = jenkins.WithMatchSelect(ctx, rule.MatchSelect)
+	ctx = jenkins.WithSearchDepth(ctx, rule.MaxDepth, rule.MatchOrder)
+	ctx = jenkins.WithMatrix(ctx, rule.IncludeMatrix)
+	data := map[string]any{
+		"Number":  number,
+		"Repo":    repo,
+		"Timeout": rule.Timeout,
+	}
+	targets, err := compileTargets(rule, data)
+	if err != nil {
+		return nil, err
+	}
+	targets = p.capTargets(targets, p.Config().Server.MaxPatternsPerEvent)
+
+	for _, t := range targets {
+		client, err := p.jenkinsFor(t.target.Instance)
+		if err != nil {
+			return nil, err
+		}
+		job, err := client.FindJob(ctx, t.re, t.jobRoot)
+		if err != nil {
+			return nil, fmt.Errorf("find job %q: %w", t.pattern, err)
+		}
+		if job != nil {
+			p.log.Info("manual poll found Jenkins job",
+				"repo", repo,
+				"pr_number", number,
+				"job", job.Name,
+				"pattern", t.pattern)
+			return job, nil
+		}
+	}
+
+	p.log.Info("manual poll found no Jenkins job", "repo", repo, "pr_number", number)
+	return nil, nil
+}
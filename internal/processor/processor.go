@@ -6,53 +6,163 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"math"
 	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"text/template"
 	"time"
 
 	"github.com/example/gitea-jenkins-webhook/internal/config"
+	"github.com/example/gitea-jenkins-webhook/internal/gitea"
 	"github.com/example/gitea-jenkins-webhook/internal/jenkins"
+	"github.com/example/gitea-jenkins-webhook/internal/metrics"
+	"github.com/example/gitea-jenkins-webhook/internal/retry"
+	"github.com/example/gitea-jenkins-webhook/internal/state"
 	"github.com/example/gitea-jenkins-webhook/pkg/webhook"
 )
 
 // JenkinsClient определяет интерфейс для работы с задачами Jenkins.
 type JenkinsClient interface {
 	WaitForJob(ctx context.Context, pattern *regexp.Regexp, jobRoot string, timeout, interval time.Duration) (*jenkins.Job, error)
+	FindJob(ctx context.Context, pattern *regexp.Regexp, jobRoot string) (*jenkins.Job, error)
+	FindJobs(ctx context.Context, pattern *regexp.Regexp, jobRoot string) ([]jenkins.Job, error)
+	TriggerBuild(ctx context.Context, jobFullName string, params map[string]string) (string, error)
+	ProgressiveText(ctx context.Context, job *jenkins.Job, start int64) (jenkins.ConsoleChunk, error)
+	GetLastBuildResult(ctx context.Context, jobFullName string) (*jenkins.BuildResult, error)
 }
 
-// GiteaClient определяет интерфейс для публикации комментариев в Gitea.
+// GiteaClient определяет интерфейс для публикации комментариев и ревью в Gitea.
 type GiteaClient interface {
-	PostComment(ctx context.Context, repoFullName string, issueIndex int64, body string) error
+	PostComment(ctx context.Context, repoFullName string, issueIndex int64, body string) (*gitea.Comment, error)
+	CreateReview(ctx context.Context, repoFullName string, index int64, body, event string) (*gitea.Comment, error)
+	EditComment(ctx context.Context, repoFullName string, commentID int64, body string) (*gitea.Comment, error)
+	ListComments(ctx context.Context, repoFullName string, issueIndex int64) ([]gitea.Comment, error)
+	CreateCommitStatus(ctx context.Context, owner, repo, sha string, status gitea.CommitStatus) error
+	GetPullRequest(ctx context.Context, owner, repo string, index int64) (*gitea.PullRequest, error)
 }
 
 // Processor обрабатывает события pull request из Gitea, ожидает появления соответствующих
 // задач в Jenkins и публикует комментарии с результатами в Gitea.
 type Processor struct {
-	cfg     *config.Config
-	log     *slog.Logger
-	jc      JenkinsClient
-	gc      GiteaClient
-	queue   chan webhook.PullRequestEvent
-	wg      sync.WaitGroup
-	started bool
-	mu      sync.Mutex
+	cfg       atomic.Pointer[config.Config]
+	log       *slog.Logger
+	jc        JenkinsClient
+	instances map[string]JenkinsClient
+	notifiers map[string]Notifier
+	sink      EventSink
+	processed func(webhook.PullRequestEvent) // Вызывается, когда событие обработано или отброшено как дубликат
+	gc        GiteaClient
+	state     state.Store
+	queue     chan webhook.PullRequestEvent
+	wg        sync.WaitGroup
+	started   bool
+	mu        sync.Mutex
+	inFlight  map[string]inFlightState // Pull request, события которых находятся в очереди, обрабатываются или ждут публикации комментария
+
+	dispatchMu     sync.Mutex
+	comments       chan commentTask // Очередь публикации итоговых комментариев (nil - comment_workers равен 0)
+	commentsClosed bool             // Очередь публикации закрыта при остановке
+	commentWG      sync.WaitGroup   // Воркеры публикации комментариев
+
+	lastQueueWarn       time.Time // Время последнего предупреждения о заполнении очереди
+	lastOverloadComment time.Time // Время последнего комментария о перегрузке
+
+	giteaMu      sync.Mutex
+	giteaFactory GiteaFactory           // Создание клиентов Gitea для правил с gitea_base_url
+	giteaClients map[string]GiteaClient // Клиенты переопределенных серверов Gitea по адресу и токену
+
+	bg         sync.WaitGroup // Фоновые горутины, запущенные через spawn
+	workers    atomic.Int32   // Число работающих воркеров
+	background atomic.Int32   // Число работающих фоновых горутин
+
+	callbackMu      sync.Mutex
+	callbackWaiters map[*callbackWaiter]struct{} // События, ожидающие уведомления Jenkins
+
+	commentMu   sync.Mutex
+	nextComment map[string]time.Time // Ближайшее время, когда репозиторию разрешен следующий комментарий
+
+	authMu       sync.Mutex
+	authFailures map[string]error // Последние ошибки аутентификации по имени экземпляра Jenkins
+
+	slotsMu   sync.Mutex
+	repoSlots map[string]chan struct{} // Семафоры max_concurrent по полному имени репозитория
+	parked    map[string][]parkedEvent // События, ожидающие слота max_concurrent, по полному имени репозитория
+
+	eventsCtx    context.Context    // Родительский контекст обработки событий воркерами
+	cancelEvents context.CancelFunc // Отменяет обработку всех событий при истечении срока остановки
+	abandoned    atomic.Bool        // Срок остановки истек: оставшиеся в очереди события не обрабатываются
+	dropped      atomic.Int64       // Число событий, отброшенных из очереди при остановке
 }
 
+// ErrQueueFull возвращается Enqueue, если очередь обработки переполнена.
+var ErrQueueFull = errors.New("processor queue is full")
+
+// queueWarnInterval - минимальный интервал между предупреждениями о заполнении очереди.
+const queueWarnInterval = time.Minute
+
 // New создает новый процессор событий с указанной конфигурацией и клиентами.
 // Если logger равен nil, используется логгер по умолчанию.
 func New(cfg *config.Config, jc JenkinsClient, gc GiteaClient, logger *slog.Logger) *Processor {
 	if logger == nil {
 		logger = slog.Default()
 	}
-	return &Processor{
-		cfg:   cfg,
-		log:   logger,
-		jc:    jc,
-		gc:    gc,
-		queue: make(chan webhook.PullRequestEvent, cfg.Server.QueueSize),
+	p := &Processor{
+		log:      logger,
+		jc:       jc,
+		gc:       gc,
+		state:    state.NewMemoryStore(),
+		queue:    make(chan webhook.PullRequestEvent, cfg.Server.QueueSize),
+		inFlight: make(map[string]inFlightState),
+
+		callbackWaiters: make(map[*callbackWaiter]struct{}),
+		nextComment:     make(map[string]time.Time),
+		repoSlots:       make(map[string]chan struct{}),
+		parked:          make(map[string][]parkedEvent),
+		authFailures:    make(map[string]error),
 	}
+	p.eventsCtx, p.cancelEvents = context.WithCancel(context.Background())
+	p.cfg.Store(cfg)
+	return p
+}
+
+// Config возвращает текущую конфигурацию процессора.
+func (p *Processor) Config() *config.Config {
+	return p.cfg.Load()
+}
+
+// SetConfig атомарно заменяет конфигурацию процессора. События, обработка которых
+// уже началась, завершаются с прежними правилами; новые события используют новую конфигурацию.
+// Размер пула воркеров и очереди не меняются до перезапуска.
+func (p *Processor) SetConfig(cfg *config.Config) {
+	p.cfg.Store(cfg)
+	p.log.Info("processor configuration updated", "repositories", len(cfg.Repositories))
+}
+
+// SetJenkinsInstances задает клиентов дополнительных экземпляров Jenkins по именам
+// из jenkins_instances. Должен вызываться до Start.
+func (p *Processor) SetJenkinsInstances(clients map[string]JenkinsClient) {
+	p.instances = clients
+}
+
+// SetProcessedHook задает функцию, вызываемую, когда событие обработано воркером или отброшено
+// Enqueue как дубликат события, которое уже в очереди. Не вызывается для событий, отброшенных
+// при истечении срока остановки. Должен вызываться до Start.
+func (p *Processor) SetProcessedHook(fn func(webhook.PullRequestEvent)) {
+	p.processed = fn
+}
+
+// markProcessed вызывает функцию SetProcessedHook для события evt, если она задана.
+func (p *Processor) markProcessed(evt webhook.PullRequestEvent) {
+	if p.processed != nil {
+		p.processed(evt)
+	}
+}
+
+// SetStateStore заменяет хранилище состояния процессора. Должен вызываться до Start.
+func (p *Processor) SetStateStore(store state.Store) {
+	p.state = store
 }
 
 // Start запускает процессор, создавая пул воркеров для обработки событий.
@@ -66,93 +176,351 @@ func (p *Processor) Start() {
 	}
 
 	p.log.Info("starting processor",
-		"worker_pool_size", p.cfg.Server.WorkerPoolSize,
-		"queue_size", p.cfg.Server.QueueSize)
-	for i := 0; i < p.cfg.Server.WorkerPoolSize; i++ {
+		"worker_pool_size", p.Config().Server.WorkerPoolSize,
+		"queue_size", p.Config().Server.QueueSize)
+	for i := 0; i < p.Config().Server.WorkerPoolSize; i++ {
 		p.wg.Add(1)
+		p.workers.Add(1)
 		go p.worker(i)
 	}
+	p.startCommentWorkers()
 	p.started = true
-	p.log.Info("processor started successfully", "workers", p.cfg.Server.WorkerPoolSize)
+	p.log.Info("processor started successfully", "workers", p.Config().Server.WorkerPoolSize)
 }
 
-// Stop останавливает процессор, закрывая очередь и ожидая завершения всех воркеров.
+// Stop останавливает процессор: закрывает очередь и ожидает, пока воркеры обработают все события
+// в очереди, будут опубликованы комментарии из очереди публикации и завершатся фоновые горутины.
 func (p *Processor) Stop() {
+	p.StopWithContext(context.Background())
+}
+
+// StopWithContext закрывает очередь и ожидает завершения воркеров и фоновых горутин. Пока ctx не завершен,
+// события из очереди обрабатываются как обычно. Когда ctx завершен, обработка всех событий отменяется
+// (ожидание задач Jenkins прерывается), а еще не начатые события очереди отбрасываются с записью их числа в лог.
+// Возвращает ошибку ctx, если срок остановки истек, иначе nil.
+func (p *Processor) StopWithContext(ctx context.Context) error {
 	p.mu.Lock()
 	if !p.started {
 		p.mu.Unlock()
-		return
+		return nil
 	}
 	p.log.Info("stopping processor, closing queue")
 	close(p.queue)
 	p.mu.Unlock()
-	p.wg.Wait()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		p.stopCommentWorkers()
+		p.bg.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+		p.log.Warn("processor stop deadline reached, cancelling in-flight events", "err", err)
+		p.abandoned.Store(true)
+		p.cancelEvents()
+		<-done
+	}
+	p.cancelEvents()
+	if dropped := p.dropped.Load(); dropped > 0 {
+		p.log.Warn("queued events dropped on shutdown", "dropped", dropped)
+	}
 	p.log.Info("processor stopped, all workers finished")
+	return err
 }
 
 // Enqueue добавляет событие в очередь обработки.
+// Событие для pull request, который уже находится в очереди или обрабатывается, отбрасывается
+// без ошибки: повторная доставка или быстрое переоткрытие PR не запускают лишний опрос Jenkins.
 // Возвращает ошибку, если процессор не запущен или очередь переполнена.
 func (p *Processor) Enqueue(evt webhook.PullRequestEvent) error {
+	duplicate, err := p.enqueue(evt, true)
+	if duplicate {
+		p.markProcessed(evt)
+	}
+	return err
+}
+
+// enqueueWaitInterval - пауза между попытками EnqueueWait поставить событие в переполненную очередь.
+const enqueueWaitInterval = 50 * time.Millisecond
+
+// EnqueueWait добавляет событие в очередь обработки, как Enqueue, но при переполнении очереди ожидает
+// свободного места до отмены ctx. Ожидание не считается отказом: комментарий о перегрузке не публикуется.
+// Используется для событий, прием которых уже подтвержден отправителю.
+func (p *Processor) EnqueueWait(ctx context.Context, evt webhook.PullRequestEvent) error {
+	for {
+		duplicate, err := p.enqueue(evt, false)
+		if duplicate {
+			p.markProcessed(evt)
+		}
+		if !errors.Is(err, ErrQueueFull) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(enqueueWaitInterval):
+		}
+	}
+}
+
+// enqueue ставит событие в очередь и сообщает, было ли оно отброшено как дубликат.
+// Если reject равен true, переполнение очереди означает отказ в событии и сопровождается
+// комментарием о перегрузке.
+func (p *Processor) enqueue(evt webhook.PullRequestEvent, reject bool) (duplicate bool, err error) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	if !p.started {
 		p.log.Error("attempted to enqueue event but processor not started")
-		return errors.New("processor not started")
+		return false, errors.New("processor not started")
+	}
+	key := inFlightKey(evt)
+	if _, ok := p.inFlight[key]; ok {
+		p.log.Debug("event for pull request already in flight, dropping",
+			"repo", evt.Repository.FullName,
+			"pr_number", evt.PullRequest.Number,
+			"action", evt.Action)
+		metrics.DuplicateEventsDropped.Inc()
+		return true, nil
 	}
 	select {
 	case p.queue <- evt:
+		p.inFlight[key] = inFlightState{}
 		p.log.Debug("event enqueued",
 			"repo", evt.Repository.FullName,
 			"pr_number", evt.PullRequest.Number,
 			"queue_length", len(p.queue))
-		return nil
+		p.warnQueueFilling()
+		return false, nil
 	default:
+		if !reject {
+			return false, ErrQueueFull
+		}
 		p.log.Warn("processor queue is full",
 			"repo", evt.Repository.FullName,
 			"pr_number", evt.PullRequest.Number,
-			"queue_size", p.cfg.Server.QueueSize)
-		return fmt.Errorf("processor queue is full")
+			"queue_size", p.Config().Server.QueueSize)
+		p.commentOverload(evt)
+		return false, ErrQueueFull
+	}
+}
+
+// inFlightKey возвращает ключ дедупликации событий одного pull request
+// или, для событий push, одной ветки.
+func inFlightKey(evt webhook.PullRequestEvent) string {
+	if evt.IsPush() {
+		return fmt.Sprintf("%s@%s", evt.Repository.FullName, evt.PullRequest.Head.Ref)
+	}
+	return fmt.Sprintf("%s#%d", evt.Repository.FullName, evt.PullRequest.Number)
+}
+
+// inFlightState - состояние pull request, событие которого находится в очереди или обрабатывается.
+type inFlightState struct {
+	done     bool // Обработка события завершена, но его комментарии еще не опубликованы
+	comments int  // Итоговые комментарии события в очереди публикации (server.comment_workers)
+}
+
+// finishInFlight снимает отметку об обработке pull request события evt. Если комментарий события
+// еще ждет публикации, отметка снимается после публикации (см. releaseInFlight), чтобы следующее
+// событие того же pull request не обгоняло его.
+func (p *Processor) finishInFlight(evt webhook.PullRequestEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key := inFlightKey(evt)
+	if st, ok := p.inFlight[key]; ok && st.comments > 0 {
+		st.done = true
+		p.inFlight[key] = st
+		return
+	}
+	delete(p.inFlight, key)
+}
+
+// holdInFlight продлевает отметку об обработке pull request события evt до публикации его комментария.
+// Возвращает false, если событие обрабатывается вне очереди и отметки нет.
+func (p *Processor) holdInFlight(evt webhook.PullRequestEvent) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key := inFlightKey(evt)
+	st, ok := p.inFlight[key]
+	if !ok {
+		return false
+	}
+	st.comments++
+	p.inFlight[key] = st
+	return true
+}
+
+// releaseInFlight отмечает, что комментарий события evt опубликован (или публикация не удалась),
+// и снимает отметку об обработке, если обработка события уже завершена.
+func (p *Processor) releaseInFlight(evt webhook.PullRequestEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key := inFlightKey(evt)
+	st, ok := p.inFlight[key]
+	if !ok {
+		return
+	}
+	st.comments--
+	if st.comments <= 0 && st.done {
+		delete(p.inFlight, key)
+		return
+	}
+	p.inFlight[key] = st
+}
+
+// warnQueueFilling выводит предупреждение, если заполнение очереди достигло порога
+// server.queue_warn_ratio. Предупреждения выводятся не чаще queueWarnInterval.
+// Вызывается под p.mu.
+func (p *Processor) warnQueueFilling() {
+	length, capacity := len(p.queue), cap(p.queue)
+	threshold := int(math.Ceil(p.Config().Server.QueueWarnRatio * float64(capacity)))
+	if length < threshold || time.Since(p.lastQueueWarn) < queueWarnInterval {
+		return
 	}
+	p.lastQueueWarn = time.Now()
+	p.log.Warn("processor queue is filling up",
+		"queue_length", length,
+		"queue_size", capacity,
+		"warn_ratio", p.Config().Server.QueueWarnRatio)
 }
 
 // worker обрабатывает события из очереди. Запускается в отдельной горутине.
 // id - уникальный идентификатор воркера для логирования.
+// Событие репозитория, исчерпавшего max_concurrent, откладывается, а не ждет слота в воркере:
+// его обрабатывает воркер, освободивший слот, поэтому один репозиторий не занимает весь пул.
 func (p *Processor) worker(id int) {
 	p.log.Debug("worker started", "worker_id", id)
 	defer func() {
 		p.log.Debug("worker stopped", "worker_id", id)
+		p.workers.Add(-1)
 		p.wg.Done()
 	}()
 	for evt := range p.queue {
-		p.log.Debug("worker processing event",
-			"worker_id", id,
+		if p.abandoned.Load() {
+			p.dropEvent(evt)
+			continue
+		}
+		slot, ok := p.takeRepoSlot(evt)
+		if !ok {
+			continue
+		}
+		p.processQueued(id, evt)
+		for {
+			next, ok := p.passRepoSlot(slot)
+			if !ok {
+				break
+			}
+			p.processParked(id, next)
+		}
+	}
+}
+
+// processQueued обрабатывает событие из очереди в воркере id и завершает его.
+func (p *Processor) processQueued(id int, evt webhook.PullRequestEvent) {
+	p.log.Debug("worker processing event",
+		"worker_id", id,
+		"repo", evt.Repository.FullName,
+		"pr_number", evt.PullRequest.Number)
+	started := time.Now()
+	res := p.processWithDeadline(evt)
+	p.observeDuration(evt, time.Since(started))
+	p.finishEvent(evt, res)
+	p.log.Debug("worker finished event",
+		"worker_id", id,
+		"repo", evt.Repository.FullName,
+		"pr_number", evt.PullRequest.Number,
+		"outcome", res.Outcome.String(),
+		"reason", res.Reason)
+}
+
+// finishEvent снимает отметку об обработке события, подтверждает его и рассылает итог res.
+func (p *Processor) finishEvent(evt webhook.PullRequestEvent, res Result) {
+	p.finishInFlight(evt)
+	p.markProcessed(evt)
+	p.notify(context.Background(), evt, res)
+	p.export(context.Background(), evt, res)
+}
+
+// dropEvent отбрасывает событие очереди, не начатое до истечения срока остановки.
+func (p *Processor) dropEvent(evt webhook.PullRequestEvent) {
+	p.dropped.Add(1)
+	p.finishInFlight(evt)
+}
+
+// processWithDeadline обрабатывает событие в воркере. Если задан server.event_deadline, контекст события
+// отменяется по его истечении: обработка прерывается, что записывается в лог и в счетчик
+// event_deadline_exceeded_total, и воркер освобождается для следующих событий.
+func (p *Processor) processWithDeadline(evt webhook.PullRequestEvent) Result {
+	deadline := p.Config().Server.EventDeadline
+	if deadline <= 0 {
+		return p.ProcessEvent(p.eventsCtx, evt)
+	}
+	ctx, cancel := context.WithTimeout(p.eventsCtx, deadline)
+	defer cancel()
+	res := p.ProcessEvent(ctx, evt)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) && p.eventsCtx.Err() == nil {
+		p.log.Warn("event processing deadline exceeded, abandoning event",
 			"repo", evt.Repository.FullName,
-			"pr_number", evt.PullRequest.Number)
-		p.processEvent(context.Background(), evt)
+			"pr_number", evt.PullRequest.Number,
+			"event_deadline", deadline,
+			"outcome", res.Outcome.String())
+		metrics.EventDeadlineExceeded.Inc()
 	}
+	return res
 }
 
-// processEvent обрабатывает одно событие pull request:
+// observeDuration записывает длительность обработки события в метрики.
+// Если включены exemplars и событие содержит trace ID, наблюдение связывается с трассировкой.
+func (p *Processor) observeDuration(evt webhook.PullRequestEvent, d time.Duration) {
+	if p.Config().Server.MetricsExemplars && evt.TraceID != "" {
+		metrics.ProcessingDuration.ObserveWithExemplar(d.Seconds(), map[string]string{"trace_id": evt.TraceID})
+		return
+	}
+	metrics.ProcessingDuration.Observe(d.Seconds())
+}
+
+// ProcessEvent обрабатывает одно событие pull request и возвращает итог обработки:
+// - пропускает события старше server.max_event_age
 // - проверяет наличие правил для репозитория
-// - обрабатывает только события opened и reopened
+// - обрабатывает только действия из actions правила (по умолчанию opened, reopened, synchronized)
+// - обрабатывает события push, только если push указан в events правила
+// - для команды повторной проверки (issue_comment) запрашивает у Gitea текущие ветки и SHA PR
 // - ожидает появления задачи Jenkins по шаблону
 // - публикует комментарий в Gitea с результатом
-func (p *Processor) processEvent(ctx context.Context, evt webhook.PullRequestEvent) {
+// - при commit_status устанавливает статус головного коммита PR (pending в начале, итоговый в конце)
+func (p *Processor) ProcessEvent(ctx context.Context, evt webhook.PullRequestEvent) (res Result) {
 	p.log.Debug("processing event",
 		"action", evt.Action,
 		"repo", evt.Repository.FullName,
 		"pr_number", evt.PullRequest.Number,
 		"sender", evt.Sender.Login)
 
+	if maxAge := p.Config().Server.MaxEventAge; maxAge > 0 && !evt.Timestamp.IsZero() {
+		if age := time.Since(evt.Timestamp); age > maxAge {
+			p.log.Warn("event is too old, skipping",
+				"repo", evt.Repository.FullName,
+				"pr_number", evt.PullRequest.Number,
+				"age", age,
+				"max_event_age", maxAge)
+			metrics.StaleEventsDropped.Inc()
+			return Result{Outcome: OutcomeSkipped, Reason: "stale event"}
+		}
+	}
+
 	if evt.Repository.FullName == "" {
 		p.log.Warn("event missing repository", "event", evt)
-		return
+		return Result{Outcome: OutcomeSkipped, Reason: "missing repository"}
 	}
 
-	rule, ok := p.cfg.GetRepositoryRule(evt.Repository.FullName)
+	rule, ok := p.Config().GetRepositoryRule(evt.Repository.FullName)
 	if !ok {
 		p.log.Info("repository not configured, skipping", "repo", evt.Repository.FullName)
-		return
+		return Result{Outcome: OutcomeSkipped, Reason: "repository not configured"}
 	}
 
 	p.log.Debug("repository rule found",
@@ -163,109 +531,287 @@ func (p *Processor) processEvent(ctx context.Context, evt webhook.PullRequestEve
 		"timeout", rule.Timeout,
 		"poll_interval", rule.PollInterval)
 
-	if evt.Action != "opened" && evt.Action != "reopened" {
-		p.log.Info("ignoring pull request action", "action", evt.Action)
-		return
+	event := config.EventPullRequest
+	switch {
+	case evt.IsPush():
+		event = config.EventPush
+	case evt.IsRetest():
+		event = config.EventIssueComment
+	}
+	if !rule.HandlesEvent(event) {
+		p.log.Info("ignoring gitea event", "event", event, "handled_events", rule.Events)
+		return Result{Outcome: OutcomeSkipped, Reason: fmt.Sprintf("unsupported event %q", event)}
+	}
+	if event == config.EventPullRequest && !rule.HandlesAction(evt.Action) {
+		p.log.Info("ignoring pull request action", "action", evt.Action, "handled_actions", rule.Actions)
+		return Result{Outcome: OutcomeSkipped, Reason: fmt.Sprintf("unsupported action %q", evt.Action)}
+	}
+	if evt.IsRetest() {
+		loaded, stop, ok := p.loadRetestPullRequest(ctx, rule, evt)
+		if !ok {
+			return stop
+		}
+		evt = loaded
 	}
 
-	ctx = context.WithValue(ctx, "repository", evt.Repository.FullName)
+	ctx = jenkins.WithRepository(ctx, evt.Repository.FullName)
+	ctx = jenkins.WithMatchTimeout(ctx, rule.MatchTimeout)
+	ctx = jenkins.WithMatchSelect(ctx, rule.MatchSelect)
+	ctx = jenkins.WithEmptyTreeGrace(ctx, rule.EmptyTreeGrace)
+	ctx = jenkins.WithSearchDepth(ctx, rule.MaxDepth, rule.MatchOrder)
+	ctx = jenkins.WithRootScanLimit(ctx, rule.RootScanLimit)
+	ctx = jenkins.WithMatrix(ctx, rule.IncludeMatrix)
+	ctx = retry.WithBudget(ctx, retry.NewBudget(p.Config().Server.RetryBudget, p.Config().Server.RetryBudgetTime))
 	p.log.Info("processing pull request",
 		"repo", evt.Repository.FullName,
 		"pr", evt.PullRequest.Number,
 		"title", evt.PullRequest.Title)
 
+	repoOwner, repoName := evt.Repository.OwnerAndName()
 	data := map[string]any{
-		"Number":  evt.PullRequest.Number,
-		"Title":   evt.PullRequest.Title,
-		"Repo":    evt.Repository.FullName,
-		"Sender":  evt.Sender.Login,
-		"Timeout": rule.Timeout,
-	}
-
-	var (
-		jobFound *jenkins.Job
-		pattern  string
-		err      error
-	)
-
-	p.log.Debug("processing job pattern",
-		"pattern_template", rule.JobPattern)
-	pattern, err = executeTemplate("pattern", rule.JobPattern, data)
-	if err != nil {
-		p.log.Error("failed to execute pattern template",
-			"err", err,
-			"pattern_template", rule.JobPattern)
-		return
+		"Number":        evt.PullRequest.Number,
+		"Title":         evt.PullRequest.Title,
+		"Repo":          evt.Repository.FullName,
+		"RepoOwner":     repoOwner,
+		"RepoName":      repoName,
+		"RepoURL":       evt.Repository.HTMLURL,
+		"Sender":        evt.Sender.Login,
+		"Action":        evt.Action,
+		"SourceBranch":  evt.PullRequest.Head.Ref,
+		"TargetBranch":  evt.PullRequest.Base.Ref,
+		"Branch":        evt.PullRequest.Head.Ref,
+		"Sha":           evt.PullRequest.Head.Sha,
+		"CommitMessage": "",
+		"Timeout":       rule.Timeout,
+		"DeliveryID":    evt.DeliveryID,
+		"ReceivedAt":    evt.Timestamp.In(p.location()),
+	}
+
+	if evt.IsPush() {
+		data["CommitMessage"] = evt.Push.CommitMessage()
+	}
+
+	// Push events have no pull request, so they are commented only in status_issue_index.
+	issueIndex := evt.PullRequest.Number
+	if rule.StatusIssueIndex > 0 {
+		issueIndex = rule.StatusIssueIndex
+	}
+
+	if reason := filterReason(rule, evt); reason != "" {
+		p.log.Info("pull request skipped by filter",
+			"repo", evt.Repository.FullName,
+			"pr", evt.PullRequest.Number,
+			"reason", reason)
+		data["SkipReason"] = reason
+		comment := ""
+		if issueIndex > 0 {
+			comment = p.postSkipComment(ctx, rule, evt, issueIndex, data)
+		}
+		return Result{Outcome: OutcomeSkipped, Reason: reason, Comment: comment}
+	}
+
+	if rule.CommitStatus {
+		p.setCommitStatus(ctx, rule, evt, gitea.StatusPending, "", "Waiting for Jenkins job")
+		defer func() { p.finishCommitStatus(ctx, rule, evt, res) }()
 	}
-	p.log.Debug("pattern template executed",
-		"compiled_pattern", pattern)
-	re, err := regexp.Compile(pattern)
+
+	targets, err := compileTargets(rule, data)
 	if err != nil {
-		p.log.Error("invalid regex pattern",
-			"pattern", pattern,
-			"err", err)
-		return
+		p.log.Error("failed to prepare job patterns", "err", err)
+		return Result{Outcome: OutcomeError, Reason: "job pattern", Err: err}
 	}
 
-	p.log.Info("waiting for jenkins job",
-		"pattern", pattern,
-		"job_root", rule.JobRoot,
-		"timeout", rule.Timeout,
-		"poll_interval", rule.PollInterval)
-	jobFound, err = p.jc.WaitForJob(ctx, re, rule.JobRoot, rule.Timeout, rule.PollInterval)
-	if err == nil && jobFound != nil {
-		p.log.Info("jenkins job detected",
-			"job", jobFound.Name,
-			"url", jobFound.URL,
-			"full_name", jobFound.FullName)
-	} else if errors.Is(err, context.DeadlineExceeded) || jobFound == nil {
-		p.log.Warn("jenkins job not found within timeout",
-			"pattern", pattern,
-			"timeout", rule.Timeout)
-	} else if err != nil {
-		p.log.Error("error waiting for jenkins job",
-			"pattern", pattern,
-			"err", err)
-	}
-
-	var commentTemplate string
+	targets = p.capTargets(targets, p.Config().Server.MaxPatternsPerEvent)
+
+	if rule.TriggerBuild {
+		if err := p.triggerBuild(ctx, rule, data, targets); err != nil {
+			p.log.Error("failed to trigger jenkins build", "err", err, "repo", evt.Repository.FullName)
+			return Result{Outcome: OutcomeError, Reason: "trigger build", Err: err}
+		}
+	}
+
+	for i := range targets {
+		targets[i].number = evt.PullRequest.Number
+	}
+
+	var group *commentGroup
+	if rule.GroupComment && len(targets) > 0 && issueIndex > 0 {
+		group = p.startCommentGroup(ctx, rule, evt.Repository.FullName, issueIndex, targets)
+		for i := range targets {
+			targets[i].group = group
+		}
+	}
+
+	if rule.StreamConsoleLog && len(targets) > 0 && issueIndex > 0 {
+		targets[0].stream = newConsoleStream(rule, evt.Repository.FullName, issueIndex, data)
+	}
+
+	res = aggregateTargets(p.waitForTargets(ctx, rule, targets))
+	jobFound := res.Job
+	if jobFound != nil {
+		metrics.JenkinsJobFound.Inc()
+	} else if res.Outcome == OutcomeTimeout {
+		metrics.JenkinsJobTimeout.Inc()
+	}
+	data["Matches"] = []string{}
 	if jobFound != nil {
-		commentTemplate = rule.SuccessCommentTemplate
 		data["JobName"] = jobFound.Name
 		data["JobURL"] = jobFound.URL
-		p.log.Debug("using success comment template",
-			"template", commentTemplate,
-			"job_name", jobFound.Name,
-			"job_url", jobFound.URL)
-	} else {
-		commentTemplate = rule.FailureCommentTemplate
-		p.log.Debug("using failure comment template",
-			"template", commentTemplate)
+		if jobFound.Matches != nil {
+			data["Matches"] = jobFound.Matches
+		}
+	}
+	if res.Build != nil {
+		data["BuildResult"] = res.Build.Result
+		data["BuildNumber"] = res.Build.Number
+	}
+	data["MatchedJobs"] = matchedJobs(res.Targets)
+	data["Targets"] = res.Targets
+	data["JobRoot"] = reportedJobRoot(res.Targets)
+	data["Outcome"] = res.Outcome.String()
+	// A timeout only carries the context deadline, so the error is reported for Jenkins failures alone.
+	data["Error"] = ""
+	if res.Err != nil && res.Outcome != OutcomeTimeout {
+		data["Error"] = res.Err.Error()
+	}
+
+	// The previous outcome lets templates describe transitions ("was failing, now passing");
+	// it is empty until a comment has been posted for the pull request.
+	patterns := make([]string, len(targets))
+	for i, t := range targets {
+		patterns[i] = t.pattern
+	}
+	pattern := strings.Join(patterns, ",")
+	stateKey := state.Key(evt.Repository.FullName, evt.PullRequest.Number, pattern)
+	prevState, _ := p.state.Get(stateKey)
+	data["PreviousOutcome"] = prevState.Outcome
+
+	if rule.BadgeURLTemplate != "" {
+		badgeURL, err := p.executeCommentTemplate("badge_url", rule.BadgeURLTemplate, data)
+		if err != nil {
+			p.log.Error("failed to execute badge url template", "err", err, "template", rule.BadgeURLTemplate)
+		} else {
+			data["BadgeURL"] = badgeURL
+			data["Badge"] = markdownImage("build status", badgeURL)
+		}
 	}
 
-	body, err := executeTemplate("comment", commentTemplate, data)
+	rule = p.commentRule(rule, evt.Repository.FullName)
+	tpl := commentTemplate(rule, res.Outcome)
+	if rule.MixedOutcomeTemplate != "" && mixedOutcome(res.Targets) {
+		tpl = rule.MixedOutcomeTemplate
+	}
+	p.log.Debug("using comment template",
+		"outcome", res.Outcome.String(),
+		"template", tpl)
+
+	body, err := p.executeCommentTemplate("comment", tpl, data)
 	if err != nil {
 		p.log.Error("failed to execute comment template",
 			"err", err,
-			"template", commentTemplate)
-		return
+			"template", tpl)
+		return Result{Outcome: OutcomeError, Reason: "comment template", Job: jobFound, Err: err}
+	}
+	if matched := matchedJobs(res.Targets); len(matched) > 0 {
+		body += "\n\n" + matchesList(matched, rule.VerboseMatchesLimit)
+	}
+	if rule.PlainText {
+		body = stripMarkdown(body)
 	}
+	raw := body
+	body = p.finalizeComment(evt.Repository.FullName, issueIndex, body)
+	res.Comment = body
 
 	p.log.Debug("comment template executed",
 		"comment_body", body,
 		"body_length", len(body))
 
-	if err := p.gc.PostComment(ctx, evt.Repository.FullName, evt.PullRequest.Number, body); err != nil {
-		p.log.Error("failed to post comment to gitea",
-			"err", err,
+	if issueIndex == 0 {
+		p.log.Info("no issue to comment on, comment not posted",
 			"repo", evt.Repository.FullName,
-			"pr_number", evt.PullRequest.Number)
-	} else {
+			"branch", evt.PullRequest.Head.Ref,
+			"sha", evt.PullRequest.Head.Sha)
+		return res
+	}
+
+	if group != nil {
+		return p.finishCommentGroup(ctx, group, evt, raw, res)
+	}
+
+	if progress := progressComment(res.Targets); progress != nil {
+		return p.finishProgressComment(ctx, rule, evt, progress, res)
+	}
+
+	commentHash := state.Hash(body)
+	if rule.SuppressIdentical {
+		if prevState.CommentHash == commentHash {
+			p.log.Info("comment identical to the previous one, skipping",
+				"repo", evt.Repository.FullName,
+				"pr", evt.PullRequest.Number,
+				"pattern", pattern)
+			res.Suppressed = true
+			return res
+		}
+	}
+
+	buildKey := ""
+	if rule.BuildDedupWindow > 0 && jobFound != nil && jobFound.LastBuild != nil {
+		buildKey = state.BuildKey(jobFound.URL, jobFound.LastBuild.Number)
+		if prev, ok := p.state.Get(buildKey); ok && time.Since(prev.UpdatedAt) < rule.BuildDedupWindow {
+			p.log.Info("build already reported on another pull request, skipping",
+				"repo", evt.Repository.FullName,
+				"pr", evt.PullRequest.Number,
+				"job", jobFound.Name,
+				"build", jobFound.LastBuild.Number)
+			res.Suppressed = true
+			return res
+		}
+	}
+
+	outcome := res.Outcome.String()
+	post := func(ctx context.Context) (*gitea.Comment, error) {
+		comment, err := p.publishTracked(ctx, rule, evt.Repository.FullName, issueIndex, raw)
+		if err != nil {
+			return nil, err
+		}
 		p.log.Info("comment posted to Gitea",
 			"repo", evt.Repository.FullName,
 			"pr", evt.PullRequest.Number,
+			"issue_index", issueIndex,
 			"comment_length", len(body))
+		p.state.Put(stateKey, state.Record{
+			CommentHash: commentHash,
+			Outcome:     outcome,
+			UpdatedAt:   time.Now(),
+		})
+		if buildKey != "" {
+			p.state.Put(buildKey, state.Record{
+				CommentHash: commentHash,
+				Outcome:     outcome,
+				UpdatedAt:   time.Now(),
+			})
+		}
+		return comment, nil
+	}
+	if p.dispatchComment(ctx, evt, post) {
+		res.CommentQueued = true
+		return res
+	}
+
+	comment, err := post(ctx)
+	if err != nil {
+		p.log.Error("failed to post comment to gitea",
+			"err", err,
+			"repo", evt.Repository.FullName,
+			"pr_number", evt.PullRequest.Number,
+			"issue_index", issueIndex)
+		res.Outcome = OutcomeCommentFailed
+		res.Reason = "post comment"
+		res.Err = err
+		return res
 	}
+	res.CommentURL = comment.HTMLURL
+	return res
 }
 
 // executeTemplate выполняет шаблон с указанными данными и возвращает результат.
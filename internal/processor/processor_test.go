@@ -1,46 +1,430 @@
 package processor_test
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"regexp"
+	"runtime"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/example/gitea-jenkins-webhook/internal/config"
+	"github.com/example/gitea-jenkins-webhook/internal/gitea"
 	"github.com/example/gitea-jenkins-webhook/internal/jenkins"
+	"github.com/example/gitea-jenkins-webhook/internal/metrics"
 	"github.com/example/gitea-jenkins-webhook/internal/processor"
+	"github.com/example/gitea-jenkins-webhook/internal/sink"
 	"github.com/example/gitea-jenkins-webhook/pkg/webhook"
 )
 
 type stubJenkins struct {
-	job *jenkins.Job
-	err error
+	job     *jenkins.Job
+	err     error
+	matched []jenkins.Job        // Все совпавшие задачи для FindJobs
+	build   *jenkins.BuildResult // Последняя сборка для GetLastBuildResult
 }
 
 func (s stubJenkins) WaitForJob(ctx context.Context, _ *regexp.Regexp, _ string, timeout, interval time.Duration) (*jenkins.Job, error) {
 	return s.job, s.err
 }
 
+func (s stubJenkins) FindJob(ctx context.Context, _ *regexp.Regexp, _ string) (*jenkins.Job, error) {
+	return s.job, s.err
+}
+
+func (stubJenkins) TriggerBuild(context.Context, string, map[string]string) (string, error) {
+	return "", nil
+}
+
+func (stubJenkins) ProgressiveText(context.Context, *jenkins.Job, int64) (jenkins.ConsoleChunk, error) {
+	return jenkins.ConsoleChunk{}, nil
+}
+
+func (s stubJenkins) GetLastBuildResult(context.Context, string) (*jenkins.BuildResult, error) {
+	return s.build, nil
+}
+
+func (s stubJenkins) FindJobs(context.Context, *regexp.Regexp, string) ([]jenkins.Job, error) {
+	return s.matched, s.err
+}
+
+// slowFailingJenkins ожидает задачу весь отведенный таймаут и возвращает временную ошибку,
+// запоминая таймаут каждой попытки.
+type slowFailingJenkins struct {
+	stubJenkins
+	mu       sync.Mutex
+	timeouts []time.Duration
+}
+
+func (s *slowFailingJenkins) WaitForJob(ctx context.Context, _ *regexp.Regexp, _ string, timeout, _ time.Duration) (*jenkins.Job, error) {
+	s.mu.Lock()
+	s.timeouts = append(s.timeouts, timeout)
+	s.mu.Unlock()
+	select {
+	case <-time.After(timeout):
+	case <-ctx.Done():
+	}
+	return nil, errors.New("connection reset by peer")
+}
+
+// flakyBuildJenkins отвечает временной ошибкой на первые запросы последней сборки.
+type flakyBuildJenkins struct {
+	stubJenkins
+	failures atomic.Int32
+}
+
+func (f *flakyBuildJenkins) GetLastBuildResult(ctx context.Context, job string) (*jenkins.BuildResult, error) {
+	if f.failures.Add(-1) >= 0 {
+		return nil, fmt.Errorf("%w: jenkins api status: 503 Service Unavailable", jenkins.ErrUnavailable)
+	}
+	return f.stubJenkins.GetLastBuildResult(ctx, job)
+}
+
+type rootRecordingJenkins struct {
+	mu    sync.Mutex
+	roots []string
+}
+
+func (r *rootRecordingJenkins) WaitForJob(_ context.Context, _ *regexp.Regexp, jobRoot string, _, _ time.Duration) (*jenkins.Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.roots = append(r.roots, jobRoot)
+	return &jenkins.Job{Name: "build"}, nil
+}
+
+func (r *rootRecordingJenkins) FindJob(ctx context.Context, pattern *regexp.Regexp, jobRoot string) (*jenkins.Job, error) {
+	return r.WaitForJob(ctx, pattern, jobRoot, 0, 0)
+}
+
+func (*rootRecordingJenkins) TriggerBuild(context.Context, string, map[string]string) (string, error) {
+	return "", nil
+}
+
+func (*rootRecordingJenkins) ProgressiveText(context.Context, *jenkins.Job, int64) (jenkins.ConsoleChunk, error) {
+	return jenkins.ConsoleChunk{}, nil
+}
+
+func (*rootRecordingJenkins) GetLastBuildResult(context.Context, string) (*jenkins.BuildResult, error) {
+	return nil, nil
+}
+
+func (*rootRecordingJenkins) FindJobs(context.Context, *regexp.Regexp, string) ([]jenkins.Job, error) {
+	return nil, nil
+}
+
+// sequenceJenkins возвращает задачи по очереди: первую - из WaitForJob, следующие - из FindJob.
+type sequenceJenkins struct {
+	mu   sync.Mutex
+	jobs []*jenkins.Job
+}
+
+func (s *sequenceJenkins) next() *jenkins.Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job := s.jobs[0]
+	if len(s.jobs) > 1 {
+		s.jobs = s.jobs[1:]
+	}
+	return job
+}
+
+func (s *sequenceJenkins) WaitForJob(context.Context, *regexp.Regexp, string, time.Duration, time.Duration) (*jenkins.Job, error) {
+	return s.next(), nil
+}
+
+func (s *sequenceJenkins) FindJob(context.Context, *regexp.Regexp, string) (*jenkins.Job, error) {
+	return s.next(), nil
+}
+
+func (*sequenceJenkins) TriggerBuild(context.Context, string, map[string]string) (string, error) {
+	return "", nil
+}
+
+func (*sequenceJenkins) ProgressiveText(context.Context, *jenkins.Job, int64) (jenkins.ConsoleChunk, error) {
+	return jenkins.ConsoleChunk{}, nil
+}
+
+func (s *sequenceJenkins) GetLastBuildResult(context.Context, string) (*jenkins.BuildResult, error) {
+	job := s.next()
+	if isBuildingColor(job.Color) {
+		return &jenkins.BuildResult{Number: 1, Building: true}, nil
+	}
+	return &jenkins.BuildResult{Number: 1, Result: colorResults[job.Color]}, nil
+}
+
+func (*sequenceJenkins) FindJobs(context.Context, *regexp.Regexp, string) ([]jenkins.Job, error) {
+	return nil, nil
+}
+
+// colorResults сопоставляет цвет завершенной задачи результату ее последней сборки.
+var colorResults = map[string]string{"blue": "SUCCESS", "red": "FAILURE", "yellow": "UNSTABLE"}
+
+func isBuildingColor(color string) bool {
+	return strings.HasSuffix(color, "_anime")
+}
+
+// countingJenkins всегда возвращает ошибку и считает вызовы.
+type countingJenkins struct {
+	calls atomic.Int32
+}
+
+func (c *countingJenkins) WaitForJob(context.Context, *regexp.Regexp, string, time.Duration, time.Duration) (*jenkins.Job, error) {
+	c.calls.Add(1)
+	return nil, errors.New("jenkins unavailable")
+}
+
+func (c *countingJenkins) FindJob(context.Context, *regexp.Regexp, string) (*jenkins.Job, error) {
+	return nil, errors.New("jenkins unavailable")
+}
+
+func (*countingJenkins) TriggerBuild(context.Context, string, map[string]string) (string, error) {
+	return "", nil
+}
+
+func (*countingJenkins) ProgressiveText(context.Context, *jenkins.Job, int64) (jenkins.ConsoleChunk, error) {
+	return jenkins.ConsoleChunk{}, nil
+}
+
+func (*countingJenkins) GetLastBuildResult(context.Context, string) (*jenkins.BuildResult, error) {
+	return nil, nil
+}
+
+func (*countingJenkins) FindJobs(context.Context, *regexp.Regexp, string) ([]jenkins.Job, error) {
+	return nil, nil
+}
+
+// countingGitea всегда возвращает ошибку публикации и считает вызовы.
+type countingGitea struct {
+	calls atomic.Int32
+}
+
+func (c *countingGitea) PostComment(context.Context, string, int64, string) (*gitea.Comment, error) {
+	c.calls.Add(1)
+	return nil, errors.New("gitea unavailable")
+}
+
+func (c *countingGitea) CreateReview(context.Context, string, int64, string, string) (*gitea.Comment, error) {
+	c.calls.Add(1)
+	return nil, errors.New("gitea unavailable")
+}
+
+func (c *countingGitea) EditComment(context.Context, string, int64, string) (*gitea.Comment, error) {
+	c.calls.Add(1)
+	return nil, errors.New("gitea unavailable")
+}
+
+func (c *countingGitea) ListComments(context.Context, string, int64) ([]gitea.Comment, error) {
+	return nil, errors.New("gitea unavailable")
+}
+
+func (c *countingGitea) CreateCommitStatus(context.Context, string, string, string, gitea.CommitStatus) error {
+	return errors.New("gitea unavailable")
+}
+
+func (c *countingGitea) GetPullRequest(context.Context, string, string, int64) (*gitea.PullRequest, error) {
+	return nil, errors.New("gitea unavailable")
+}
+
+// slowGitea задерживает публикацию комментариев до закрытия release и сообщает о начале каждой публикации.
+type slowGitea struct {
+	posting chan int64
+	release chan struct{}
+	posted  atomic.Int32
+}
+
+func newSlowGitea() *slowGitea {
+	return &slowGitea{posting: make(chan int64, 100), release: make(chan struct{})}
+}
+
+func (s *slowGitea) PostComment(_ context.Context, _ string, index int64, body string) (*gitea.Comment, error) {
+	s.posting <- index
+	<-s.release
+	s.posted.Add(1)
+	return &gitea.Comment{ID: index, Body: body}, nil
+}
+
+func (s *slowGitea) CreateReview(ctx context.Context, repo string, index int64, body, _ string) (*gitea.Comment, error) {
+	return s.PostComment(ctx, repo, index, body)
+}
+
+func (*slowGitea) EditComment(context.Context, string, int64, string) (*gitea.Comment, error) {
+	return nil, errors.New("not supported")
+}
+
+func (*slowGitea) ListComments(context.Context, string, int64) ([]gitea.Comment, error) {
+	return nil, nil
+}
+
+func (*slowGitea) CreateCommitStatus(context.Context, string, string, string, gitea.CommitStatus) error {
+	return nil
+}
+
+func (*slowGitea) GetPullRequest(context.Context, string, string, int64) (*gitea.PullRequest, error) {
+	return nil, errors.New("not supported")
+}
+
+// chanSink передает полученные записи в канал.
+type chanSink chan sink.Record
+
+func (c chanSink) Send(_ context.Context, rec sink.Record) error {
+	c <- rec
+	return nil
+}
+
+type blockingJenkins struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockingJenkins() *blockingJenkins {
+	return &blockingJenkins{started: make(chan struct{}, 100), release: make(chan struct{})}
+}
+
+func (b *blockingJenkins) WaitForJob(ctx context.Context, _ *regexp.Regexp, _ string, _, _ time.Duration) (*jenkins.Job, error) {
+	b.started <- struct{}{}
+	select {
+	case <-b.release:
+		return nil, context.DeadlineExceeded
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (b *blockingJenkins) FindJob(context.Context, *regexp.Regexp, string) (*jenkins.Job, error) {
+	return nil, nil
+}
+
+func (*blockingJenkins) TriggerBuild(context.Context, string, map[string]string) (string, error) {
+	return "", nil
+}
+
+func (*blockingJenkins) ProgressiveText(context.Context, *jenkins.Job, int64) (jenkins.ConsoleChunk, error) {
+	return jenkins.ConsoleChunk{}, nil
+}
+
+func (*blockingJenkins) GetLastBuildResult(context.Context, string) (*jenkins.BuildResult, error) {
+	return nil, nil
+}
+
+func (*blockingJenkins) FindJobs(context.Context, *regexp.Regexp, string) ([]jenkins.Job, error) {
+	return nil, nil
+}
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
 type stubGitea struct {
 	t        *testing.T
 	mu       sync.Mutex
 	comments []string
+	indexes  []int64
+	reviews  []string
+	edits    []string
+	statuses []string
+	pulls    map[int64]*gitea.PullRequest // Pull request, возвращаемые GetPullRequest
 	wg       sync.WaitGroup
+	err      error
 }
 
 func newStubGitea(t *testing.T) *stubGitea {
 	return &stubGitea{t: t}
 }
 
-func (s *stubGitea) PostComment(ctx context.Context, repoFullName string, issueIndex int64, body string) error {
+func (s *stubGitea) PostComment(ctx context.Context, repoFullName string, issueIndex int64, body string) (*gitea.Comment, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.comments = append(s.comments, body)
+	s.indexes = append(s.indexes, issueIndex)
+	s.wg.Done()
+	if s.err != nil {
+		return nil, s.err
+	}
+	id := int64(len(s.comments))
+	return &gitea.Comment{ID: id, HTMLURL: fmt.Sprintf("https://gitea.example.com/%s/issues/%d#issuecomment-%d", repoFullName, issueIndex, id)}, nil
+}
+
+func (s *stubGitea) CreateReview(ctx context.Context, repoFullName string, index int64, body, event string) (*gitea.Comment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reviews = append(s.reviews, event+":"+body)
+	s.indexes = append(s.indexes, index)
+	s.wg.Done()
+	if s.err != nil {
+		return nil, s.err
+	}
+	id := int64(len(s.reviews))
+	return &gitea.Comment{ID: id, HTMLURL: fmt.Sprintf("https://gitea.example.com/%s/pulls/%d#issuecomment-%d", repoFullName, index, id)}, nil
+}
+
+// EditComment заменяет текст ранее опубликованного комментария и запоминает правку.
+func (s *stubGitea) EditComment(ctx context.Context, repoFullName string, commentID int64, body string) (*gitea.Comment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.edits = append(s.edits, body)
 	s.wg.Done()
+	if s.err != nil {
+		return nil, s.err
+	}
+	s.comments[commentID-1] = body
+	return &gitea.Comment{ID: commentID, HTMLURL: fmt.Sprintf("https://gitea.example.com/%s/issues/comments/%d", repoFullName, commentID)}, nil
+}
+
+// CreateCommitStatus запоминает установленный статус коммита.
+func (s *stubGitea) CreateCommitStatus(_ context.Context, owner, repo, sha string, status gitea.CommitStatus) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statuses = append(s.statuses, fmt.Sprintf("%s/%s@%s %s %s %s", owner, repo, sha, status.Context, status.State, status.TargetURL))
 	return nil
 }
 
+// ListComments возвращает опубликованные комментарии; идентификатор комментария - его номер в comments.
+func (s *stubGitea) ListComments(context.Context, string, int64) ([]gitea.Comment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	comments := make([]gitea.Comment, len(s.comments))
+	for i, body := range s.comments {
+		comments[i] = gitea.Comment{ID: int64(i + 1), Body: body}
+	}
+	return comments, nil
+}
+
+// GetPullRequest возвращает pull request из pulls.
+func (s *stubGitea) GetPullRequest(_ context.Context, owner, repo string, index int64) (*gitea.PullRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pr, ok := s.pulls[index]
+	if !ok {
+		return nil, &gitea.HTTPError{Op: "get pull request", StatusCode: 404, Status: "404 Not Found"}
+	}
+	return pr, nil
+}
+
 func TestProcessor_PostsSuccessComment(t *testing.T) {
 	cfg := &config.Config{
 		Server: config.ServerConfig{
@@ -165,15 +549,2759 @@ func TestProcessor_PostsFailureCommentWhenNoJobFound(t *testing.T) {
 	}
 }
 
-func waitWithTimeout(t *testing.T, wg *sync.WaitGroup, timeout time.Duration) {
-	done := make(chan struct{})
-	go func() {
-		wg.Wait()
-		close(done)
-	}()
-	select {
-	case <-done:
-	case <-time.After(timeout):
-		t.Fatalf("timeout waiting for waitgroup")
+func TestProcessor_ProcessEventOutcomes(t *testing.T) {
+	tests := []struct {
+		name        string
+		event       webhook.PullRequestEvent
+		pattern     string
+		jenkins     stubJenkins
+		giteaErr    error
+		want        processor.Outcome
+		wantComment bool
+	}{
+		{
+			name:    "unconfigured repository",
+			event:   newEvent("opened", "other/repo", 1),
+			pattern: `^job-{{ .Number }}$`,
+			want:    processor.OutcomeSkipped,
+		},
+		{
+			name:    "unsupported action",
+			event:   newEvent("closed", "org/repo", 1),
+			pattern: `^job-{{ .Number }}$`,
+			want:    processor.OutcomeSkipped,
+		},
+		{
+			name:        "job found",
+			event:       newEvent("opened", "org/repo", 1),
+			pattern:     `^job-{{ .Number }}$`,
+			jenkins:     stubJenkins{job: &jenkins.Job{Name: "job-1", URL: "https://jenkins/job-1"}},
+			want:        processor.OutcomeJobFound,
+			wantComment: true,
+		},
+		{
+			name:        "timeout",
+			event:       newEvent("reopened", "org/repo", 1),
+			pattern:     `^job-{{ .Number }}$`,
+			jenkins:     stubJenkins{err: context.DeadlineExceeded},
+			want:        processor.OutcomeTimeout,
+			wantComment: true,
+		},
+		{
+			name:        "jenkins error",
+			event:       newEvent("opened", "org/repo", 1),
+			pattern:     `^job-{{ .Number }}$`,
+			jenkins:     stubJenkins{err: errors.New("connection refused")},
+			want:        processor.OutcomeError,
+			wantComment: true,
+		},
+		{
+			name:    "invalid regex",
+			event:   newEvent("opened", "org/repo", 1),
+			pattern: `^job-({{ .Number }}$`,
+			want:    processor.OutcomeError,
+		},
+		{
+			name:        "comment failed",
+			event:       newEvent("opened", "org/repo", 1),
+			pattern:     `^job-{{ .Number }}$`,
+			jenkins:     stubJenkins{job: &jenkins.Job{Name: "job-1"}},
+			giteaErr:    errors.New("gitea unavailable"),
+			want:        processor.OutcomeCommentFailed,
+			wantComment: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig(t, config.RepositoryRule{Name: "org/repo", JobPattern: tt.pattern})
+			gClient := newStubGitea(t)
+			gClient.err = tt.giteaErr
+			if tt.wantComment {
+				gClient.wg.Add(1)
+			}
+
+			proc := processor.New(cfg, tt.jenkins, gClient, nil)
+			res := proc.ProcessEvent(context.Background(), tt.event)
+			if res.Outcome != tt.want {
+				t.Fatalf("expected outcome %s, got %s (reason %q, err %v)", tt.want, res.Outcome, res.Reason, res.Err)
+			}
+			if got := len(gClient.comments); (got == 1) != tt.wantComment {
+				t.Fatalf("unexpected number of comments: %d", got)
+			}
+		})
+	}
+}
+
+func TestProcessor_SelectsTemplatePerOutcome(t *testing.T) {
+	rule := config.RepositoryRule{
+		Name:                  "org/repo",
+		JobPattern:            `^job-{{ .Number }}$`,
+		JobFoundTemplate:      "found {{ .JobName }}",
+		BuildSuccessTemplate:  "success {{ .JobName }}",
+		BuildFailureTemplate:  "failure {{ .JobName }}",
+		BuildUnstableTemplate: "unstable {{ .JobName }}",
+		TimeoutTemplate:       "timeout {{ .Number }}",
+		ErrorTemplate:         "error {{ .Number }}",
+	}
+
+	tests := []struct {
+		name    string
+		jenkins stubJenkins
+		want    processor.Outcome
+		comment string
+	}{
+		{"job found", stubJenkins{job: &jenkins.Job{Name: "job-3", Color: "notbuilt"}}, processor.OutcomeJobFound, "found job-3"},
+		{"building", stubJenkins{job: &jenkins.Job{Name: "job-3", Color: "blue_anime"}}, processor.OutcomeJobFound, "found job-3"},
+		{"build success", stubJenkins{job: &jenkins.Job{Name: "job-3", Color: "blue"}}, processor.OutcomeBuildSuccess, "success job-3"},
+		{"build failure", stubJenkins{job: &jenkins.Job{Name: "job-3", Color: "red"}}, processor.OutcomeBuildFailure, "failure job-3"},
+		{"build unstable", stubJenkins{job: &jenkins.Job{Name: "job-3", Color: "yellow"}}, processor.OutcomeBuildUnstable, "unstable job-3"},
+		{"timeout", stubJenkins{err: context.DeadlineExceeded}, processor.OutcomeTimeout, "timeout 3"},
+		{"error", stubJenkins{err: errors.New("boom")}, processor.OutcomeError, "error 3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig(t, rule)
+			gClient := newStubGitea(t)
+			gClient.wg.Add(1)
+
+			proc := processor.New(cfg, tt.jenkins, gClient, nil)
+			res := proc.ProcessEvent(context.Background(), newEvent("opened", "org/repo", 3))
+			if res.Outcome != tt.want {
+				t.Fatalf("expected outcome %s, got %s", tt.want, res.Outcome)
+			}
+			if len(gClient.comments) != 1 || gClient.comments[0] != tt.comment {
+				t.Fatalf("unexpected comments: %v", gClient.comments)
+			}
+		})
+	}
+}
+
+func TestProcessor_SuppressesIdenticalComments(t *testing.T) {
+	cfg := newTestConfig(t, config.RepositoryRule{
+		Name:              "org/repo",
+		JobPattern:        `^job-{{ .Number }}$`,
+		SuppressIdentical: true,
+	})
+	gClient := newStubGitea(t)
+	gClient.wg.Add(2)
+
+	jClient := &stubJenkins{job: &jenkins.Job{Name: "job-5", URL: "https://jenkins/job-5", Color: "red"}}
+	proc := processor.New(cfg, jClient, gClient, nil)
+
+	if res := proc.ProcessEvent(context.Background(), newEvent("opened", "org/repo", 5)); res.Suppressed {
+		t.Fatalf("first comment must not be suppressed")
+	}
+	if res := proc.ProcessEvent(context.Background(), newEvent("reopened", "org/repo", 5)); !res.Suppressed {
+		t.Fatalf("identical comment must be suppressed")
+	}
+
+	cfg.Repositories[0].BuildSuccessTemplate = "passed {{ .JobName }}"
+	proc.SetConfig(newTestConfig(t, cfg.Repositories[0]))
+	jClient.job = &jenkins.Job{Name: "job-5", URL: "https://jenkins/job-5", Color: "blue"}
+	if res := proc.ProcessEvent(context.Background(), newEvent("reopened", "org/repo", 5)); res.Suppressed {
+		t.Fatalf("changed comment must be posted")
+	}
+
+	if len(gClient.comments) != 2 {
+		t.Fatalf("expected 2 comments, got %d: %v", len(gClient.comments), gClient.comments)
+	}
+}
+
+func TestProcessor_DeduplicatesBuildAcrossPullRequests(t *testing.T) {
+	tests := []struct {
+		name   string
+		window time.Duration
+		want   int
+	}{
+		{name: "enabled", window: time.Hour, want: 2},
+		{name: "disabled", want: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig(t, config.RepositoryRule{
+				Name:             "org/monorepo",
+				JobPattern:       `^monorepo-build$`,
+				BuildDedupWindow: tt.window,
+			})
+			gClient := newStubGitea(t)
+			gClient.wg.Add(tt.want)
+
+			job := &jenkins.Job{Name: "monorepo-build", URL: "https://jenkins/monorepo-build", Color: "blue", LastBuild: &jenkins.Build{Number: 7}}
+			jClient := &stubJenkins{job: job}
+			proc := processor.New(cfg, jClient, gClient, nil)
+
+			if res := proc.ProcessEvent(context.Background(), newEvent("opened", "org/monorepo", 1)); res.Suppressed {
+				t.Fatalf("first comment for the build must not be suppressed")
+			}
+			if res := proc.ProcessEvent(context.Background(), newEvent("opened", "org/monorepo", 2)); res.Suppressed != (tt.window > 0) {
+				t.Fatalf("unexpected suppression for the same build on another PR: %v", res.Suppressed)
+			}
+
+			jClient.job = &jenkins.Job{Name: "monorepo-build", URL: "https://jenkins/monorepo-build", Color: "blue", LastBuild: &jenkins.Build{Number: 8}}
+			if res := proc.ProcessEvent(context.Background(), newEvent("opened", "org/monorepo", 3)); res.Suppressed {
+				t.Fatalf("new build must be reported")
+			}
+
+			if len(gClient.comments) != tt.want {
+				t.Fatalf("expected %d comments, got %d: %v", tt.want, len(gClient.comments), gClient.comments)
+			}
+		})
+	}
+}
+
+func TestProcessor_TriggersBuildWithRuleParameters(t *testing.T) {
+	cfg := newTestConfig(t, config.RepositoryRule{
+		Name:         "org/repo",
+		JobPattern:   `^PR-{{ .Number }}$`,
+		TriggerBuild: true,
+		TriggerJob:   "{{ .RepoName }}/PR-{{ .Number }}",
+		TriggerParameters: map[string]string{
+			"BRANCH": "{{ .SourceBranch }}",
+			"PR":     "{{ .Number }}",
+		},
+		JobFoundTemplate: "queued {{ .QueueURL }}",
+	})
+	gClient := newStubGitea(t)
+	gClient.wg.Add(1)
+
+	jClient := &triggerRecordingJenkins{stubJenkins: stubJenkins{job: &jenkins.Job{Name: "PR-4", URL: "https://jenkins/PR-4"}}}
+	proc := processor.New(cfg, jClient, gClient, nil)
+
+	evt := newEvent("opened", "org/repo", 4)
+	evt.PullRequest.Head.Ref = "feature/x"
+	res := proc.ProcessEvent(context.Background(), evt)
+	if res.Outcome != processor.OutcomeJobFound {
+		t.Fatalf("expected job_found, got %s (%v)", res.Outcome, res.Err)
+	}
+	if res.Comment != "queued https://jenkins/queue/item/1/" {
+		t.Fatalf("unexpected comment: %q", res.Comment)
+	}
+	if jClient.job != "repo/PR-4" {
+		t.Fatalf("unexpected triggered job: %q", jClient.job)
+	}
+	if jClient.params["BRANCH"] != "feature/x" || jClient.params["PR"] != "4" || len(jClient.params) != 2 {
+		t.Fatalf("unexpected trigger parameters: %v", jClient.params)
+	}
+}
+
+func TestProcessor_CommentsOnceWhenQueueOverloaded(t *testing.T) {
+	cfg := newTestConfig(t, config.RepositoryRule{
+		Name:            "org/repo",
+		JobPattern:      `^job-{{ .Number }}$`,
+		TimeoutTemplate: "timeout {{ .Number }}",
+	})
+	cfg.Server.QueueSize = 1
+	cfg.Server.CommentOnOverload = true
+	cfg.Server.OverloadCommentTemplate = "overloaded {{ .Number }}"
+
+	gClient := newStubGitea(t)
+	gClient.wg.Add(3)
+	jClient := newBlockingJenkins()
+	proc := processor.New(cfg, jClient, gClient, nil)
+	proc.Start()
+
+	if err := proc.Enqueue(newEvent("opened", "org/repo", 1)); err != nil {
+		t.Fatalf("unexpected enqueue error: %v", err)
+	}
+	<-jClient.started
+	if err := proc.Enqueue(newEvent("opened", "org/repo", 2)); err != nil {
+		t.Fatalf("unexpected enqueue error: %v", err)
+	}
+	for _, number := range []int64{3, 4} {
+		if err := proc.Enqueue(newEvent("opened", "org/repo", number)); err == nil {
+			t.Fatalf("expected queue full error for PR %d", number)
+		}
+	}
+
+	close(jClient.release)
+	waitWithTimeout(t, &gClient.wg, 2*time.Second)
+	proc.Stop()
+
+	var overload []string
+	for _, c := range gClient.comments {
+		if strings.HasPrefix(c, "overloaded") {
+			overload = append(overload, c)
+		}
+	}
+	if len(overload) != 1 || overload[0] != "overloaded 3" {
+		t.Fatalf("expected one overload comment, got %v", gClient.comments)
+	}
+}
+
+func TestProcessor_DropsDuplicateInFlightEvents(t *testing.T) {
+	cfg := newTestConfig(t, config.RepositoryRule{
+		Name:            "org/repo",
+		JobPattern:      `^job-{{ .Number }}$`,
+		TimeoutTemplate: "timeout {{ .Number }}",
+	})
+	cfg.Server.WorkerPoolSize = 2
+
+	gClient := newStubGitea(t)
+	gClient.wg.Add(1)
+	jClient := newBlockingJenkins()
+	proc := processor.New(cfg, jClient, gClient, nil)
+	proc.Start()
+
+	dropped := metrics.DuplicateEventsDropped.Value()
+	if err := proc.Enqueue(newEvent("opened", "org/repo", 1)); err != nil {
+		t.Fatalf("unexpected enqueue error: %v", err)
+	}
+	<-jClient.started
+	for _, action := range []string{"opened", "reopened"} {
+		if err := proc.Enqueue(newEvent(action, "org/repo", 1)); err != nil {
+			t.Fatalf("unexpected enqueue error for duplicate: %v", err)
+		}
+	}
+
+	close(jClient.release)
+	waitWithTimeout(t, &gClient.wg, 2*time.Second)
+	proc.Stop()
+
+	if n := len(jClient.started); n != 0 {
+		t.Fatalf("expected a single Jenkins poll loop, got %d extra", n)
+	}
+	if len(gClient.comments) != 1 || gClient.comments[0] != "timeout 1" {
+		t.Fatalf("expected one comment, got %v", gClient.comments)
+	}
+	if got := metrics.DuplicateEventsDropped.Value() - dropped; got != 2 {
+		t.Fatalf("expected 2 deduplicated events, got %d", got)
+	}
+}
+
+func TestProcessor_AbandonsEventAfterDeadline(t *testing.T) {
+	cfg := newTestConfig(t, config.RepositoryRule{
+		Name:       "org/repo",
+		JobPattern: `^job-{{ .Number }}$`,
+		Timeout:    time.Minute,
+	})
+	cfg.Server.EventDeadline = 50 * time.Millisecond
+
+	gClient := newStubGitea(t)
+	gClient.wg.Add(1)
+	jClient := newBlockingJenkins()
+	proc := processor.New(cfg, jClient, gClient, nil)
+	processed := make(chan webhook.PullRequestEvent, 1)
+	proc.SetProcessedHook(func(evt webhook.PullRequestEvent) { processed <- evt })
+	proc.Start()
+	defer proc.Stop()
+
+	exceeded := metrics.EventDeadlineExceeded.Value()
+	if err := proc.Enqueue(newEvent("opened", "org/repo", 1)); err != nil {
+		t.Fatalf("unexpected enqueue error: %v", err)
+	}
+	select {
+	case <-processed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("event was not abandoned after event_deadline")
+	}
+	if got := metrics.EventDeadlineExceeded.Value() - exceeded; got != 1 {
+		t.Fatalf("expected one event over the deadline, got %d", got)
+	}
+}
+
+func TestProcessor_PreviousOutcomeInTemplate(t *testing.T) {
+	transition := `{{ if eq .PreviousOutcome "" }}first: {{ .Outcome }}` +
+		`{{ else if ne .PreviousOutcome .Outcome }}was {{ .PreviousOutcome }}, now {{ .Outcome }}` +
+		`{{ else }}still {{ .Outcome }}{{ end }}`
+	cfg := newTestConfig(t, config.RepositoryRule{
+		Name:                 "org/repo",
+		JobPattern:           `^PR-{{ .Number }}$`,
+		BuildFailureTemplate: transition,
+		BuildSuccessTemplate: transition,
+	})
+	jClient := &sequenceJenkins{jobs: []*jenkins.Job{
+		{Name: "PR-1", Color: "red"},
+		{Name: "PR-1", Color: "blue"},
+		{Name: "PR-1", Color: "blue"},
+	}}
+	gClient := newStubGitea(t)
+	gClient.wg.Add(3)
+	proc := processor.New(cfg, jClient, gClient, nil)
+
+	for i := 0; i < 3; i++ {
+		proc.ProcessEvent(context.Background(), newEvent("synchronized", "org/repo", 1))
+	}
+
+	want := []string{"first: build_failure", "was build_failure, now build_success", "still build_success"}
+	if len(gClient.comments) != len(want) {
+		t.Fatalf("expected %d comments, got %v", len(want), gClient.comments)
+	}
+	for i, w := range want {
+		if !strings.Contains(gClient.comments[i], w) {
+			t.Fatalf("comment %d: expected %q, got %q", i, w, gClient.comments[i])
+		}
+	}
+}
+
+func TestProcessor_StopLeavesNoGoroutines(t *testing.T) {
+	baseline := runtime.NumGoroutine()
+
+	cfg := newTestConfig(t, config.RepositoryRule{
+		Name: "org/repo",
+		JenkinsTargets: []config.JenkinsTarget{
+			{JobRoot: "first", JobPattern: `^a-{{ .Number }}$`},
+			{JobRoot: "second", JobPattern: `^b-{{ .Number }}$`},
+		},
+		TimeoutTemplate: "timeout {{ .Number }}",
+	})
+	cfg.Server.QueueSize = 1
+	cfg.Server.WorkerPoolSize = 2
+	cfg.Server.CommentOnOverload = true
+	cfg.Server.OverloadCommentTemplate = "overloaded {{ .Number }}"
+
+	gClient := newStubGitea(t)
+	gClient.wg.Add(4)
+	jClient := newBlockingJenkins()
+	proc := processor.New(cfg, jClient, gClient, nil)
+	proc.Start()
+
+	for _, number := range []int64{1, 2} {
+		if err := proc.Enqueue(newEvent("opened", "org/repo", number)); err != nil {
+			t.Fatalf("unexpected enqueue error: %v", err)
+		}
+		<-jClient.started
+		<-jClient.started
+	}
+	// Two workers plus one background wait per event for the first target.
+	if got := proc.Goroutines(); got != 4 {
+		t.Fatalf("expected 4 processor goroutines while waiting, got %d", got)
+	}
+	_ = proc.Enqueue(newEvent("opened", "org/repo", 3))
+	if err := proc.Enqueue(newEvent("opened", "org/repo", 4)); err == nil {
+		t.Fatalf("expected queue full error")
+	}
+
+	close(jClient.release)
+	proc.Stop()
+	waitWithTimeout(t, &gClient.wg, 2*time.Second)
+
+	if got := proc.Goroutines(); got != 0 {
+		t.Fatalf("expected no processor goroutines after stop, got %d", got)
+	}
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > baseline {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<16)
+			t.Fatalf("goroutines leaked after stop: %d > %d\n%s", runtime.NumGoroutine(), baseline, buf[:runtime.Stack(buf, true)])
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestProcessor_MaxGoroutinesWaitsTargetsInline(t *testing.T) {
+	cfg := newTestConfig(t, config.RepositoryRule{
+		Name: "org/repo",
+		JenkinsTargets: []config.JenkinsTarget{
+			{JobRoot: "first", JobPattern: `^job$`},
+			{JobRoot: "second", JobPattern: `^job$`},
+			{JobRoot: "third", JobPattern: `^job$`},
+		},
+	})
+	cfg.Server.MaxGoroutines = 1
+	gClient := newStubGitea(t)
+	gClient.wg.Add(1)
+	proc := processor.New(cfg, stubJenkins{job: &jenkins.Job{Name: "job", URL: "https://jenkins/job"}}, gClient, nil)
+
+	res := proc.ProcessEvent(context.Background(), newEvent("opened", "org/repo", 1))
+	if len(res.Targets) != 3 {
+		t.Fatalf("expected 3 target results, got %d", len(res.Targets))
+	}
+	for _, target := range res.Targets {
+		if target.Outcome != processor.OutcomeJobFound {
+			t.Fatalf("unexpected target outcome: %+v", target)
+		}
+	}
+	if got := proc.Goroutines(); got != 0 {
+		t.Fatalf("expected no goroutines left, got %d", got)
+	}
+}
+
+func TestProcessor_SkipsStaleEvents(t *testing.T) {
+	cfg := newTestConfig(t, config.RepositoryRule{
+		Name:       "org/repo",
+		JobPattern: `^job-{{ .Number }}$`,
+	})
+	cfg.Server.MaxEventAge = time.Minute
+	gClient := newStubGitea(t)
+	gClient.wg.Add(1)
+	jClient := stubJenkins{job: &jenkins.Job{Name: "job-1", URL: "https://jenkins/job-1"}}
+	proc := processor.New(cfg, jClient, gClient, nil)
+
+	dropped := metrics.StaleEventsDropped.Value()
+	stale := newEvent("opened", "org/repo", 1)
+	stale.Timestamp = time.Now().Add(-time.Hour)
+	if res := proc.ProcessEvent(context.Background(), stale); res.Outcome != processor.OutcomeSkipped || res.Reason != "stale event" {
+		t.Fatalf("expected stale event to be skipped, got %s (%s)", res.Outcome, res.Reason)
+	}
+	if metrics.StaleEventsDropped.Value() != dropped+1 {
+		t.Fatalf("expected stale drop to be metered")
+	}
+
+	fresh := newEvent("opened", "org/repo", 1)
+	fresh.Timestamp = time.Now()
+	if res := proc.ProcessEvent(context.Background(), fresh); res.Outcome != processor.OutcomeJobFound {
+		t.Fatalf("expected fresh event to be processed, got %s", res.Outcome)
+	}
+	if len(gClient.comments) != 1 {
+		t.Fatalf("expected 1 comment, got %v", gClient.comments)
+	}
+}
+
+func TestProcessor_StreamsConsoleLogIntoProgressComment(t *testing.T) {
+	cfg := newTestConfig(t, config.RepositoryRule{
+		Name:                    "org/repo",
+		JobPattern:              `^job-{{ .Number }}$`,
+		BuildSuccessTemplate:    "success {{ .JobName }}",
+		WaitForCompletion:       true,
+		StreamConsoleLog:        true,
+		ConsoleLogMaxBytes:      10,
+		ProgressCommentTemplate: "building {{ .JobName }}",
+	})
+	gClient := newStubGitea(t)
+	gClient.wg.Add(3)
+	building := &jenkins.Job{Name: "job-5", Color: "blue_anime"}
+	jClient := &consoleJenkins{
+		sequenceJenkins: &sequenceJenkins{jobs: []*jenkins.Job{building, building, building, building, {Name: "job-5", Color: "blue"}}},
+		chunks:          []string{"step 1\n", "step 2\n", "step 3\n"},
+	}
+	proc := processor.New(cfg, jClient, gClient, nil)
+
+	res := proc.ProcessEvent(context.Background(), newEvent("opened", "org/repo", 5))
+	if res.Outcome != processor.OutcomeBuildSuccess {
+		t.Fatalf("expected build_success, got %s (%v)", res.Outcome, res.Err)
+	}
+	waitWithTimeout(t, &gClient.wg, time.Second)
+
+	if len(jClient.starts) != 2 || jClient.starts[0] != 0 || jClient.starts[1] != 7 {
+		t.Fatalf("unexpected progressive text offsets: %v", jClient.starts)
+	}
+	if len(gClient.edits) != 2 {
+		t.Fatalf("expected progress edit and final edit, got %v", gClient.edits)
+	}
+	if want := "building job-5\n\n```\nstep 1\nste\n…(console log truncated)\n```"; gClient.edits[0] != want {
+		t.Fatalf("unexpected progress comment:\n%s", gClient.edits[0])
+	}
+	if len(gClient.comments) != 1 || gClient.comments[0] != "success job-5" {
+		t.Fatalf("expected progress comment to be replaced with the result, got %v", gClient.comments)
+	}
+}
+
+func TestProcessor_FormatsTimeInConfiguredTimezone(t *testing.T) {
+	cfg := newTestConfig(t, config.RepositoryRule{
+		Name:             "org/repo",
+		JobPattern:       `^job-{{ .Number }}$`,
+		JobFoundTemplate: `received {{ .ReceivedAt | formatTime "2006-01-02 15:04 MST" }}, timeout {{ formatDuration .Timeout }}`,
+	})
+	cfg.Server.Timezone = "Europe/Moscow"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+	gClient := newStubGitea(t)
+	gClient.wg.Add(1)
+	proc := processor.New(cfg, stubJenkins{job: &jenkins.Job{Name: "job-1", URL: "https://jenkins/job-1"}}, gClient, nil)
+
+	evt := newEvent("opened", "org/repo", 1)
+	evt.Timestamp = time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	res := proc.ProcessEvent(context.Background(), evt)
+	if want := "received 2024-03-01 12:30 MSK, timeout 1s"; res.Comment != want {
+		t.Fatalf("expected %q, got %q", want, res.Comment)
+	}
+}
+
+func TestProcessor_EmbedsBadgeImage(t *testing.T) {
+	cfg := newTestConfig(t, config.RepositoryRule{
+		Name:             "org/repo",
+		JobPattern:       `^job-{{ .Number }}$`,
+		BadgeURLTemplate: "{{ .JobURL }}badge/icon?subject=PR {{ .Number }}",
+		JobFoundTemplate: `{{ .Badge }} {{ image "console [log]" .JobURL }}`,
+	})
+	gClient := newStubGitea(t)
+	gClient.wg.Add(1)
+	proc := processor.New(cfg, stubJenkins{job: &jenkins.Job{Name: "job-2", URL: "https://jenkins/job/job-2/"}}, gClient, nil)
+
+	res := proc.ProcessEvent(context.Background(), newEvent("opened", "org/repo", 2))
+	want := `![build status](https://jenkins/job/job-2/badge/icon?subject=PR%202) ![console \[log\]](https://jenkins/job/job-2/)`
+	if res.Comment != want {
+		t.Fatalf("expected %q, got %q", want, res.Comment)
+	}
+}
+
+func TestProcessor_AggregatesMultipleJenkinsInstances(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.JenkinsInstances = map[string]config.JenkinsConfig{
+		"build":  {BaseURL: "https://build.example.com"},
+		"deploy": {BaseURL: "https://deploy.example.com"},
+	}
+	cfg.Repositories = []config.RepositoryRule{{
+		Name: "org/repo",
+		JenkinsTargets: []config.JenkinsTarget{
+			{Instance: "build", JobPattern: `^build-{{ .Number }}$`},
+			{Instance: "deploy", JobPattern: `^deploy-{{ .Number }}$`},
+		},
+		JobFoundTemplate: "{{ range .Targets }}{{ .Instance }}={{ .Job.Name }};{{ end }}",
+		TimeoutTemplate:  "{{ range .Targets }}{{ .Instance }}:{{ .Outcome }};{{ end }}",
+	}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		deploy  stubJenkins
+		want    processor.Outcome
+		comment string
+	}{
+		{
+			name:    "both found",
+			deploy:  stubJenkins{job: &jenkins.Job{Name: "deploy-8"}},
+			want:    processor.OutcomeJobFound,
+			comment: "build=build-8;deploy=deploy-8;",
+		},
+		{
+			name:    "one missing",
+			deploy:  stubJenkins{err: context.DeadlineExceeded},
+			want:    processor.OutcomeTimeout,
+			comment: "build:job_found;deploy:timeout;",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gClient := newStubGitea(t)
+			gClient.wg.Add(1)
+
+			proc := processor.New(cfg, nil, gClient, nil)
+			proc.SetJenkinsInstances(map[string]processor.JenkinsClient{
+				"build":  stubJenkins{job: &jenkins.Job{Name: "build-8"}},
+				"deploy": tt.deploy,
+			})
+
+			res := proc.ProcessEvent(context.Background(), newEvent("opened", "org/repo", 8))
+			if res.Outcome != tt.want {
+				t.Fatalf("expected outcome %s, got %s", tt.want, res.Outcome)
+			}
+			if len(res.Targets) != 2 {
+				t.Fatalf("expected 2 target results, got %d", len(res.Targets))
+			}
+			if len(gClient.comments) != 1 || gClient.comments[0] != tt.comment {
+				t.Fatalf("unexpected comments: %v", gClient.comments)
+			}
+		})
+	}
+}
+
+func TestProcessor_RecordsDurationExemplar(t *testing.T) {
+	cfg := newTestConfig(t, config.RepositoryRule{Name: "org/repo", JobPattern: `^job-{{ .Number }}$`})
+	cfg.Server.MetricsExemplars = true
+	gClient := newStubGitea(t)
+	gClient.wg.Add(1)
+
+	proc := processor.New(cfg, stubJenkins{job: &jenkins.Job{Name: "job-9"}}, gClient, nil)
+	proc.Start()
+	defer proc.Stop()
+
+	const traceID = "0af7651916cd43dd8448eb211c80319c"
+	event := newEvent("opened", "org/repo", 9)
+	event.TraceID = traceID
+	if err := proc.Enqueue(event); err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+	waitWithTimeout(t, &gClient.wg, 2*time.Second)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		var out strings.Builder
+		_ = metrics.ProcessingDuration.Write(&out)
+		if strings.Contains(out.String(), `trace_id="`+traceID+`"`) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("exemplar with trace id not recorded:\n%s", out.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestProcessor_RendersDeliveryID(t *testing.T) {
+	cfg := newTestConfig(t, config.RepositoryRule{
+		Name:             "org/repo",
+		JobPattern:       `^job-{{ .Number }}$`,
+		JobFoundTemplate: "found [{{ .DeliveryID }}]",
+	})
+
+	tests := []struct {
+		deliveryID string
+		want       string
+	}{
+		{"f6c9f6b2-5d6e-4a4e-9a43-2f1c0d3b7e11", "found [f6c9f6b2-5d6e-4a4e-9a43-2f1c0d3b7e11]"},
+		{"", "found []"},
+	}
+	for _, tt := range tests {
+		gClient := newStubGitea(t)
+		gClient.wg.Add(1)
+		proc := processor.New(cfg, stubJenkins{job: &jenkins.Job{Name: "job-1"}}, gClient, nil)
+
+		event := newEvent("opened", "org/repo", 1)
+		event.DeliveryID = tt.deliveryID
+		proc.ProcessEvent(context.Background(), event)
+		if len(gClient.comments) != 1 || gClient.comments[0] != tt.want {
+			t.Fatalf("expected comment %q, got %v", tt.want, gClient.comments)
+		}
+	}
+}
+
+func TestProcessor_TreatUnstableAsSuccess(t *testing.T) {
+	tests := []struct {
+		treatAsSuccess bool
+		want           processor.Outcome
+		comment        string
+	}{
+		{true, processor.OutcomeBuildSuccess, "passed"},
+		{false, processor.OutcomeBuildUnstable, "failed"},
+	}
+	for _, tt := range tests {
+		cfg := newTestConfig(t, config.RepositoryRule{
+			Name:                   "org/repo",
+			JobPattern:             `^job-{{ .Number }}$`,
+			BuildSuccessTemplate:   "passed",
+			BuildFailureTemplate:   "failed",
+			TreatUnstableAsSuccess: tt.treatAsSuccess,
+		})
+		gClient := newStubGitea(t)
+		gClient.wg.Add(1)
+		proc := processor.New(cfg, stubJenkins{job: &jenkins.Job{Name: "job-1", Color: "yellow"}}, gClient, nil)
+
+		res := proc.ProcessEvent(context.Background(), newEvent("opened", "org/repo", 1))
+		if res.Outcome != tt.want {
+			t.Fatalf("treat_unstable_as_success=%v: expected outcome %s, got %s", tt.treatAsSuccess, tt.want, res.Outcome)
+		}
+		if len(gClient.comments) != 1 || gClient.comments[0] != tt.comment {
+			t.Fatalf("treat_unstable_as_success=%v: unexpected comments %v", tt.treatAsSuccess, gClient.comments)
+		}
+	}
+}
+
+func TestProcessor_RendersCaptureGroups(t *testing.T) {
+	cfg := newTestConfig(t, config.RepositoryRule{
+		Name:             "org/repo",
+		JobPattern:       `^PR-{{ .Number }}-build-(\d+)$`,
+		JobFoundTemplate: "build #{{ index .Matches 1 }}",
+	})
+	gClient := newStubGitea(t)
+	gClient.wg.Add(1)
+	job := &jenkins.Job{Name: "PR-4-build-877", Matches: []string{"PR-4-build-877", "877"}}
+	proc := processor.New(cfg, stubJenkins{job: job}, gClient, nil)
+
+	proc.ProcessEvent(context.Background(), newEvent("opened", "org/repo", 4))
+	if len(gClient.comments) != 1 || gClient.comments[0] != "build #877" {
+		t.Fatalf("unexpected comments: %v", gClient.comments)
+	}
+}
+
+func TestProcessor_WarnsOnceWhenQueueFilling(t *testing.T) {
+	cfg := newTestConfig(t, config.RepositoryRule{Name: "org/repo", JobPattern: `^job-{{ .Number }}$`})
+	cfg.Server.QueueSize = 5
+	cfg.Server.QueueWarnRatio = 0.8
+
+	var logs syncBuffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+	jClient := newBlockingJenkins()
+	gClient := newStubGitea(t)
+	gClient.wg.Add(6)
+
+	proc := processor.New(cfg, jClient, gClient, logger)
+	proc.Start()
+	defer proc.Stop()
+	defer close(jClient.release)
+
+	if err := proc.Enqueue(newEvent("opened", "org/repo", 1)); err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+	<-jClient.started
+
+	for i := int64(2); i <= 6; i++ {
+		if err := proc.Enqueue(newEvent("opened", "org/repo", i)); err != nil {
+			t.Fatalf("enqueue %d failed: %v", i, err)
+		}
+	}
+
+	if got := strings.Count(logs.String(), "processor queue is filling up"); got != 1 {
+		t.Fatalf("expected exactly one queue warning, got %d", got)
+	}
+}
+
+func TestProcessor_RendersTemplatedJobRoot(t *testing.T) {
+	tests := []struct {
+		name    string
+		jobRoot string
+		want    processor.Outcome
+		root    string
+	}{
+		{"templated", "pr-folders/{{ .Number }}", processor.OutcomeJobFound, "pr-folders/13"},
+		{"static", "team/builds", processor.OutcomeJobFound, "team/builds"},
+		{"path traversal", "pr-folders/{{ .Title }}", processor.OutcomeError, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig(t, config.RepositoryRule{Name: "org/repo", JobRoot: tt.jobRoot, JobPattern: "^build$"})
+			gClient := newStubGitea(t)
+			gClient.wg.Add(1)
+			jClient := &rootRecordingJenkins{}
+			proc := processor.New(cfg, jClient, gClient, nil)
+
+			event := newEvent("opened", "org/repo", 13)
+			event.PullRequest.Title = ".."
+			res := proc.ProcessEvent(context.Background(), event)
+			if res.Outcome != tt.want {
+				t.Fatalf("expected outcome %s, got %s (%v)", tt.want, res.Outcome, res.Err)
+			}
+			if tt.root == "" {
+				if len(jClient.roots) != 0 {
+					t.Fatalf("jenkins must not be queried with an invalid root, got %v", jClient.roots)
+				}
+				return
+			}
+			if len(jClient.roots) != 1 || jClient.roots[0] != tt.root {
+				t.Fatalf("expected job root %q, got %v", tt.root, jClient.roots)
+			}
+		})
+	}
+}
+
+func TestProcessor_PostsToStatusIssue(t *testing.T) {
+	tests := []struct {
+		statusIssue int64
+		want        int64
+	}{
+		{0, 21},
+		{100, 100},
+	}
+	for _, tt := range tests {
+		cfg := newTestConfig(t, config.RepositoryRule{
+			Name:             "org/repo",
+			JobPattern:       `^job-{{ .Number }}$`,
+			JobFoundTemplate: "PR #{{ .Number }}: {{ .JobName }}",
+			StatusIssueIndex: tt.statusIssue,
+		})
+		gClient := newStubGitea(t)
+		gClient.wg.Add(1)
+		proc := processor.New(cfg, stubJenkins{job: &jenkins.Job{Name: "job-21"}}, gClient, nil)
+
+		proc.ProcessEvent(context.Background(), newEvent("opened", "org/repo", 21))
+		if len(gClient.indexes) != 1 || gClient.indexes[0] != tt.want {
+			t.Fatalf("status_issue_index=%d: expected comment on issue %d, got %v", tt.statusIssue, tt.want, gClient.indexes)
+		}
+		if gClient.comments[0] != "PR #21: job-21" {
+			t.Fatalf("unexpected comment: %s", gClient.comments[0])
+		}
+	}
+}
+
+func TestProcessor_AddsCommentPrefixToAllComments(t *testing.T) {
+	tests := []struct {
+		name    string
+		jenkins stubJenkins
+		want    string
+	}{
+		{"success", stubJenkins{job: &jenkins.Job{Name: "job-1", Color: "blue"}}, "[ci-bot] ok"},
+		{"failure", stubJenkins{job: &jenkins.Job{Name: "job-1", Color: "red"}}, "[ci-bot] failed"},
+		{"timeout", stubJenkins{err: context.DeadlineExceeded}, "[ci-bot] timeout"},
+		{"error", stubJenkins{err: errors.New("boom")}, "[ci-bot] error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig(t, config.RepositoryRule{
+				Name:                 "org/repo",
+				JobPattern:           `^job-{{ .Number }}$`,
+				BuildSuccessTemplate: "ok",
+				BuildFailureTemplate: "failed",
+				TimeoutTemplate:      "timeout",
+				ErrorTemplate:        "error",
+			})
+			cfg.Server.CommentPrefix = "[ci-bot] "
+			gClient := newStubGitea(t)
+			gClient.wg.Add(1)
+			proc := processor.New(cfg, tt.jenkins, gClient, nil)
+
+			proc.ProcessEvent(context.Background(), newEvent("opened", "org/repo", 1))
+			if len(gClient.comments) != 1 || gClient.comments[0] != tt.want {
+				t.Fatalf("unexpected comments: %v", gClient.comments)
+			}
+		})
+	}
+}
+
+func TestProcessor_TruncationAccountsForPrefix(t *testing.T) {
+	cfg := newTestConfig(t, config.RepositoryRule{
+		Name:             "org/repo",
+		JobPattern:       `^job-{{ .Number }}$`,
+		JobFoundTemplate: strings.Repeat("x", 70000),
+	})
+	cfg.Server.CommentPrefix = "[ci-bot] "
+	gClient := newStubGitea(t)
+	gClient.wg.Add(1)
+	proc := processor.New(cfg, stubJenkins{job: &jenkins.Job{Name: "job-1"}}, gClient, nil)
+
+	proc.ProcessEvent(context.Background(), newEvent("opened", "org/repo", 1))
+	got := gClient.comments[0]
+	if !strings.HasPrefix(got, "[ci-bot] x") {
+		t.Fatalf("prefix missing from truncated comment")
+	}
+	if n := len([]rune(got)); n != 65535 {
+		t.Fatalf("expected truncated comment of 65535 characters, got %d", n)
+	}
+}
+
+func TestProcessor_PostsReviewWhenConfigured(t *testing.T) {
+	cfg := newTestConfig(t, config.RepositoryRule{
+		Name:             "org/repo",
+		JobPattern:       `^job-{{ .Number }}$`,
+		JobFoundTemplate: "found {{ .JobName }}",
+		CommentKind:      config.CommentKindReview,
+	})
+	gClient := newStubGitea(t)
+	gClient.wg.Add(1)
+	proc := processor.New(cfg, stubJenkins{job: &jenkins.Job{Name: "job-2"}}, gClient, nil)
+
+	proc.ProcessEvent(context.Background(), newEvent("opened", "org/repo", 2))
+	if len(gClient.comments) != 0 {
+		t.Fatalf("expected no issue comments, got %v", gClient.comments)
+	}
+	if len(gClient.reviews) != 1 || gClient.reviews[0] != "COMMENT:found job-2" {
+		t.Fatalf("unexpected reviews: %v", gClient.reviews)
+	}
+	if gClient.indexes[0] != 2 {
+		t.Fatalf("review posted to wrong pull request: %d", gClient.indexes[0])
+	}
+}
+
+func TestProcessor_PostsSkipCommentForFilteredEvent(t *testing.T) {
+	tests := []struct {
+		name   string
+		rule   config.RepositoryRule
+		mutate func(*webhook.PullRequestEvent)
+		want   string
+	}{
+		{
+			name:   "branch",
+			rule:   config.RepositoryRule{Branches: []string{"main"}},
+			mutate: func(e *webhook.PullRequestEvent) { e.PullRequest.Base.Ref = "feature" },
+			want:   `skipped: target branch "feature" is not in the configured branches`,
+		},
+		{
+			name:   "sender",
+			rule:   config.RepositoryRule{IgnoreSenders: []string{"bot"}},
+			mutate: func(e *webhook.PullRequestEvent) { e.Sender.Login = "bot" },
+			want:   `skipped: sender "bot" is ignored`,
+		},
+		{
+			name:   "draft",
+			rule:   config.RepositoryRule{SkipDrafts: true},
+			mutate: func(e *webhook.PullRequestEvent) { e.PullRequest.Draft = true },
+			want:   "skipped: pull request is a draft",
+		},
+		{
+			name: "label",
+			rule: config.RepositoryRule{SkipLabels: []string{"no-ci"}},
+			mutate: func(e *webhook.PullRequestEvent) {
+				e.PullRequest.Labels = []webhook.Label{{Name: "docs"}, {Name: "no-ci"}}
+			},
+			want: `skipped: pull request has label "no-ci"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := tt.rule
+			rule.Name = "org/repo"
+			rule.JobPattern = `^job$`
+			rule.SkipCommentTemplate = "skipped: {{ .SkipReason }}"
+			cfg := newTestConfig(t, rule)
+
+			gClient := newStubGitea(t)
+			gClient.wg.Add(1)
+			proc := processor.New(cfg, stubJenkins{job: &jenkins.Job{Name: "job"}}, gClient, nil)
+
+			evt := newEvent("opened", "org/repo", 3)
+			tt.mutate(&evt)
+
+			res := proc.ProcessEvent(context.Background(), evt)
+			if res.Outcome != processor.OutcomeSkipped {
+				t.Fatalf("expected skipped outcome, got %s", res.Outcome)
+			}
+			// A repeated event must not produce a second skip comment.
+			proc.ProcessEvent(context.Background(), evt)
+
+			if len(gClient.comments) != 1 || gClient.comments[0] != tt.want {
+				t.Fatalf("unexpected comments: %v", gClient.comments)
+			}
+		})
+	}
+}
+
+func TestProcessor_FilteredEventWithoutSkipTemplateIsSilent(t *testing.T) {
+	cfg := newTestConfig(t, config.RepositoryRule{Name: "org/repo", JobPattern: `^job$`, SkipDrafts: true})
+	gClient := newStubGitea(t)
+	proc := processor.New(cfg, stubJenkins{job: &jenkins.Job{Name: "job"}}, gClient, nil)
+
+	evt := newEvent("opened", "org/repo", 3)
+	evt.PullRequest.Draft = true
+	if res := proc.ProcessEvent(context.Background(), evt); res.Outcome != processor.OutcomeSkipped {
+		t.Fatalf("expected skipped outcome, got %s", res.Outcome)
+	}
+	if len(gClient.comments) != 0 {
+		t.Fatalf("expected no comments, got %v", gClient.comments)
+	}
+}
+
+func TestProcessor_WaitsForBuildCompletion(t *testing.T) {
+	tests := []struct {
+		name    string
+		wait    bool
+		final   string
+		want    processor.Outcome
+		comment string
+	}{
+		{name: "success", wait: true, final: "blue", want: processor.OutcomeBuildSuccess, comment: "success job-5 SUCCESS #1"},
+		{name: "failure", wait: true, final: "red", want: processor.OutcomeBuildFailure, comment: "failure job-5 FAILURE #1"},
+		{name: "disabled", wait: false, final: "blue", want: processor.OutcomeJobFound, comment: "found job-5 blue_anime"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig(t, config.RepositoryRule{
+				Name:                 "org/repo",
+				JobPattern:           `^job-{{ .Number }}$`,
+				JobFoundTemplate:     "found {{ .JobName }} {{ (index .Targets 0).Job.Color }}",
+				BuildSuccessTemplate: "success {{ .JobName }} {{ .BuildResult }} #{{ .BuildNumber }}",
+				BuildFailureTemplate: "failure {{ .JobName }} {{ .BuildResult }} #{{ .BuildNumber }}",
+				WaitForCompletion:    tt.wait,
+			})
+			gClient := newStubGitea(t)
+			gClient.wg.Add(1)
+			jClient := &sequenceJenkins{jobs: []*jenkins.Job{
+				{Name: "job-5", Color: "blue_anime"},
+				{Name: "job-5", Color: "blue_anime"},
+				{Name: "job-5", Color: tt.final},
+			}}
+			proc := processor.New(cfg, jClient, gClient, nil)
+
+			res := proc.ProcessEvent(context.Background(), newEvent("opened", "org/repo", 5))
+			if res.Outcome != tt.want {
+				t.Fatalf("expected outcome %s, got %s", tt.want, res.Outcome)
+			}
+			if len(gClient.comments) != 1 || gClient.comments[0] != tt.comment {
+				t.Fatalf("unexpected comments: %v", gClient.comments)
+			}
+		})
+	}
+}
+
+func TestProcessor_RendersRepositoryMetadata(t *testing.T) {
+	cfg := newTestConfig(t, config.RepositoryRule{
+		Name:             "org/repo",
+		JobPattern:       `^job$`,
+		JobFoundTemplate: "{{ .RepoOwner }} / {{ .RepoName }} at {{ .RepoURL }}",
+	})
+	gClient := newStubGitea(t)
+	gClient.wg.Add(1)
+	proc := processor.New(cfg, stubJenkins{job: &jenkins.Job{Name: "job"}}, gClient, nil)
+
+	evt := newEvent("opened", "org/repo", 1)
+	evt.Repository.HTMLURL = "https://gitea.example.com/org/repo"
+	proc.ProcessEvent(context.Background(), evt)
+
+	want := "org / repo at https://gitea.example.com/org/repo"
+	if len(gClient.comments) != 1 || gClient.comments[0] != want {
+		t.Fatalf("unexpected comments: %v", gClient.comments)
+	}
+}
+
+// buildsJenkins находит задачу и возвращает сборки builds по очереди из GetLastBuildResult
+// (последняя повторяется).
+type buildsJenkins struct {
+	stubJenkins
+	mu     sync.Mutex
+	builds []*jenkins.BuildResult
+}
+
+func (b *buildsJenkins) GetLastBuildResult(context.Context, string) (*jenkins.BuildResult, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	build := b.builds[0]
+	if len(b.builds) > 1 {
+		b.builds = b.builds[1:]
+	}
+	return build, nil
+}
+
+func TestProcessor_WaitsForTriggeredBuildNotPrevious(t *testing.T) {
+	cfg := newTestConfig(t, config.RepositoryRule{
+		Name:                 "org/repo",
+		JobPattern:           `^PR-{{ .Number }}$`,
+		TriggerBuild:         true,
+		TriggerJob:           "org/PR-{{ .Number }}",
+		WaitForCompletion:    true,
+		BuildSuccessTemplate: "success #{{ .BuildNumber }}",
+		BuildFailureTemplate: "failure #{{ .BuildNumber }}",
+	})
+	gClient := newStubGitea(t)
+	gClient.wg.Add(1)
+	jClient := &buildsJenkins{
+		stubJenkins: stubJenkins{job: &jenkins.Job{Name: "PR-3", FullName: "org/PR-3"}},
+		builds: []*jenkins.BuildResult{
+			{Number: 7, Result: "FAILURE"}, // Before the trigger
+			{Number: 7, Result: "FAILURE"}, // The triggered build is still queued
+			{Number: 8, Building: true},
+			{Number: 8, Result: "SUCCESS"},
+		},
+	}
+	proc := processor.New(cfg, jClient, gClient, nil)
+
+	res := proc.ProcessEvent(context.Background(), newEvent("opened", "org/repo", 3))
+	if res.Outcome != processor.OutcomeBuildSuccess {
+		t.Fatalf("expected build_success of the triggered build, got %s (%v)", res.Outcome, res.Err)
+	}
+	if len(gClient.comments) != 1 || gClient.comments[0] != "success #8" {
+		t.Fatalf("unexpected comments: %v", gClient.comments)
+	}
+}
+
+// flakyGitea возвращает ошибки из errs для первых публикаций, затем публикует комментарий.
+type flakyGitea struct {
+	*stubGitea
+	errs  []error
+	calls int
+}
+
+func (f *flakyGitea) PostComment(ctx context.Context, repoFullName string, issueIndex int64, body string) (*gitea.Comment, error) {
+	f.calls++
+	if f.calls <= len(f.errs) {
+		return nil, f.errs[f.calls-1]
+	}
+	return f.stubGitea.PostComment(ctx, repoFullName, issueIndex, body)
+}
+
+func TestProcessor_RetriesTransientGiteaErrors(t *testing.T) {
+	unavailable := &gitea.HTTPError{Op: "post comment", StatusCode: http.StatusServiceUnavailable, Status: "503 Service Unavailable"}
+	tests := []struct {
+		name      string
+		errs      []error
+		wantCalls int
+		want      processor.Outcome
+	}{
+		{name: "transient then success", errs: []error{unavailable, errors.New("connection reset")}, wantCalls: 3, want: processor.OutcomeJobFound},
+		{name: "permanent", errs: []error{&gitea.HTTPError{Op: "post comment", StatusCode: http.StatusNotFound, Status: "404 Not Found"}}, wantCalls: 1, want: processor.OutcomeCommentFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig(t, config.RepositoryRule{Name: "org/repo", JobPattern: `^job$`})
+			cfg.Server.RetryBackoff = time.Millisecond
+			cfg.Gitea.MaxRetries = 3
+			cfg.Gitea.RetryMaxInterval = 2 * time.Millisecond
+
+			gClient := &flakyGitea{stubGitea: newStubGitea(t), errs: tt.errs}
+			gClient.wg.Add(1)
+			jClient := stubJenkins{job: &jenkins.Job{Name: "job", URL: "https://jenkins/job"}}
+			proc := processor.New(cfg, jClient, gClient, nil)
+
+			res := proc.ProcessEvent(context.Background(), newEvent("opened", "org/repo", 1))
+			if res.Outcome != tt.want {
+				t.Fatalf("expected %s, got %s (err=%v)", tt.want, res.Outcome, res.Err)
+			}
+			if gClient.calls != tt.wantCalls {
+				t.Fatalf("expected %d post attempts, got %d", tt.wantCalls, gClient.calls)
+			}
+		})
+	}
+}
+
+func TestProcessor_RetriesShareEventBudget(t *testing.T) {
+	tests := []struct {
+		name   string
+		budget int
+		want   int32
+	}{
+		{name: "limited", budget: 3, want: 3},
+		{name: "unlimited", budget: 0, want: 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig(t, config.RepositoryRule{Name: "org/repo", JobPattern: `^job$`})
+			cfg.Server.RetryBudget = tt.budget
+			cfg.Server.RetryBackoff = time.Millisecond
+			cfg.Jenkins.MaxRetries = 4
+			cfg.Gitea.MaxRetries = 4
+
+			jClient := &countingJenkins{}
+			gClient := &countingGitea{}
+			proc := processor.New(cfg, jClient, gClient, nil)
+
+			res := proc.ProcessEvent(context.Background(), newEvent("opened", "org/repo", 1))
+			if res.Outcome != processor.OutcomeCommentFailed {
+				t.Fatalf("expected comment_failed outcome, got %s", res.Outcome)
+			}
+			// The first attempt of each operation is free; only retries draw from the budget.
+			retries := jClient.calls.Load() - 1 + gClient.calls.Load() - 1
+			if retries != tt.want {
+				t.Fatalf("expected %d retries in total, got %d (jenkins=%d, gitea=%d)",
+					tt.want, retries, jClient.calls.Load(), gClient.calls.Load())
+			}
+		})
+	}
+}
+
+func TestProcessor_ExportsProcessedEventRecord(t *testing.T) {
+	cfg := newTestConfig(t, config.RepositoryRule{Name: "org/repo", JobPattern: `^job-{{ .Number }}$`})
+	gClient := newStubGitea(t)
+	gClient.wg.Add(1)
+	records := make(chanSink, 1)
+
+	proc := processor.New(cfg, stubJenkins{job: &jenkins.Job{Name: "job-4", URL: "https://jenkins.example.com/job/job-4/", Color: "red"}}, gClient, nil)
+	proc.SetSink(records)
+	proc.Start()
+	defer proc.Stop()
+
+	evt := newEvent("opened", "org/repo", 4)
+	evt.DeliveryID = "delivery-1"
+	if err := proc.Enqueue(evt); err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+
+	select {
+	case rec := <-records:
+		if rec.Repo != "org/repo" || rec.PRNumber != 4 || rec.Outcome != "build_failure" || rec.DeliveryID != "delivery-1" {
+			t.Fatalf("unexpected record: %#v", rec)
+		}
+		if rec.Job == nil || rec.Job.Name != "job-4" || rec.Job.Color != "red" {
+			t.Fatalf("unexpected job in record: %#v", rec.Job)
+		}
+		if rec.CommentURL != "https://gitea.example.com/org/repo/issues/4#issuecomment-1" {
+			t.Fatalf("unexpected comment URL: %s", rec.CommentURL)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("sink did not receive a record")
+	}
+}
+
+func TestProcessor_MatchesHashNamedJob(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+	}{
+		{name: "sha1short", pattern: `^build-{{ sha1short .SourceBranch }}$`},
+		{name: "sha256short", pattern: `^build-{{ sha256short .SourceBranch }}$`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig(t, config.RepositoryRule{Name: "org/repo", JobPattern: tt.pattern})
+			gClient := newStubGitea(t)
+			gClient.wg.Add(1)
+			jClient := &patternRecordingJenkins{}
+			proc := processor.New(cfg, jClient, gClient, nil)
+
+			evt := newEvent("opened", "org/repo", 1)
+			evt.PullRequest.Head.Ref = "feature/login"
+			proc.ProcessEvent(context.Background(), evt)
+
+			want := map[string]string{
+				"sha1short":   "build-" + shortHash(sha1.New(), "feature/login"),
+				"sha256short": "build-" + shortHash(sha256.New(), "feature/login"),
+			}[tt.name]
+			if jClient.pattern == nil || !jClient.pattern.MatchString(want) {
+				t.Fatalf("pattern %v does not match %s", jClient.pattern, want)
+			}
+			if jClient.pattern.MatchString("build-00000000") {
+				t.Fatalf("pattern %v matches an unrelated hash", jClient.pattern)
+			}
+		})
+	}
+}
+
+func TestProcessor_ReQuoteEscapesInterpolatedBranch(t *testing.T) {
+	cfg := newTestConfig(t, config.RepositoryRule{Name: "org/repo", JobPattern: `^build-{{ reQuote .SourceBranch }}$`})
+	gClient := newStubGitea(t)
+	gClient.wg.Add(1)
+	jClient := &patternRecordingJenkins{}
+	proc := processor.New(cfg, jClient, gClient, nil)
+
+	evt := newEvent("opened", "org/repo", 1)
+	evt.PullRequest.Head.Ref = "release/1.2+hotfix"
+	if res := proc.ProcessEvent(context.Background(), evt); res.Outcome == processor.OutcomeError {
+		t.Fatalf("expected pattern to compile, got error: %v", res.Err)
+	}
+
+	if jClient.pattern == nil || !jClient.pattern.MatchString("build-release/1.2+hotfix") {
+		t.Fatalf("pattern %v does not match the branch literally", jClient.pattern)
+	}
+	for _, name := range []string{"build-release/1x2+hotfix", "build-release/1.22hotfix"} {
+		if jClient.pattern.MatchString(name) {
+			t.Fatalf("pattern %v treats branch characters as metacharacters: matches %s", jClient.pattern, name)
+		}
+	}
+}
+
+// patternRecordingJenkins запоминает последний переданный шаблон имени задачи.
+// consoleJenkins возвращает задачи как sequenceJenkins и отдает консольный вывод фрагментами.
+type consoleJenkins struct {
+	*sequenceJenkins
+	chunks []string
+	starts []int64
+}
+
+func (c *consoleJenkins) ProgressiveText(_ context.Context, _ *jenkins.Job, start int64) (jenkins.ConsoleChunk, error) {
+	c.starts = append(c.starts, start)
+	text := c.chunks[0]
+	c.chunks = c.chunks[1:]
+	return jenkins.ConsoleChunk{Text: text, Next: start + int64(len(text)), More: true}, nil
+}
+
+// triggerRecordingJenkins запоминает запущенную сборку и ее параметры.
+type triggerRecordingJenkins struct {
+	stubJenkins
+	job    string
+	params map[string]string
+}
+
+func (t *triggerRecordingJenkins) TriggerBuild(_ context.Context, job string, params map[string]string) (string, error) {
+	t.job, t.params = job, params
+	return "https://jenkins/queue/item/1/", nil
+}
+
+type patternRecordingJenkins struct {
+	pattern *regexp.Regexp
+}
+
+func (p *patternRecordingJenkins) WaitForJob(_ context.Context, pattern *regexp.Regexp, _ string, _, _ time.Duration) (*jenkins.Job, error) {
+	p.pattern = pattern
+	return &jenkins.Job{Name: "build"}, nil
+}
+
+func (p *patternRecordingJenkins) FindJob(ctx context.Context, pattern *regexp.Regexp, jobRoot string) (*jenkins.Job, error) {
+	return p.WaitForJob(ctx, pattern, jobRoot, 0, 0)
+}
+
+func (*patternRecordingJenkins) TriggerBuild(context.Context, string, map[string]string) (string, error) {
+	return "", nil
+}
+
+func (*patternRecordingJenkins) ProgressiveText(context.Context, *jenkins.Job, int64) (jenkins.ConsoleChunk, error) {
+	return jenkins.ConsoleChunk{}, nil
+}
+
+func (*patternRecordingJenkins) GetLastBuildResult(context.Context, string) (*jenkins.BuildResult, error) {
+	return nil, nil
+}
+
+func (*patternRecordingJenkins) FindJobs(context.Context, *regexp.Regexp, string) ([]jenkins.Job, error) {
+	return nil, nil
+}
+
+func shortHash(h hash.Hash, s string) string {
+	h.Write([]byte(s))
+	return hex.EncodeToString(h.Sum(nil))[:8]
+}
+
+func TestProcessor_PostsAuthErrorComment(t *testing.T) {
+	var requests atomic.Int32
+	jenkinsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			_, _ = w.Write([]byte(`{"jobs":[]}`))
+			return
+		}
+		// The token is rotated after the first poll.
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer jenkinsServer.Close()
+
+	cfg := newTestConfig(t, config.RepositoryRule{
+		Name:              "org/repo",
+		JobPattern:        `^PR-{{ .Number }}$`,
+		TimeoutTemplate:   "timeout",
+		ErrorTemplate:     "error",
+		AuthErrorTemplate: "Jenkins rejected our credentials, maintainers please check the token",
+	})
+	cfg.Jenkins.MaxRetries = 3
+	gClient := newStubGitea(t)
+	gClient.wg.Add(1)
+	jClient := jenkins.NewClient(jenkinsServer.URL, "", "", jenkinsServer.Client(), nil)
+	proc := processor.New(cfg, jClient, gClient, nil)
+
+	res := proc.ProcessEvent(context.Background(), newEvent("opened", "org/repo", 1))
+	if res.Outcome != processor.OutcomeAuthFailed {
+		t.Fatalf("expected auth_failed outcome, got %s (err %v)", res.Outcome, res.Err)
+	}
+	if !errors.Is(res.Err, jenkins.ErrAuthFailed) {
+		t.Fatalf("expected ErrAuthFailed, got %v", res.Err)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Fatalf("expected authentication failure not to be retried, got %d requests", got)
+	}
+	if len(gClient.comments) != 1 || !strings.Contains(gClient.comments[0], "maintainers please check the token") {
+		t.Fatalf("unexpected comments: %v", gClient.comments)
+	}
+	if err := proc.JenkinsAuthError(); !errors.Is(err, jenkins.ErrAuthFailed) {
+		t.Fatalf("expected processor to report jenkins auth failure, got %v", err)
+	}
+}
+
+func TestProcessor_PostsMissingRootComment(t *testing.T) {
+	jenkinsServer := httptest.NewServer(http.NotFoundHandler())
+	defer jenkinsServer.Close()
+
+	cfg := newTestConfig(t, config.RepositoryRule{
+		Name:                "org/repo",
+		JobRoot:             "missing/folder",
+		JobPattern:          `^job$`,
+		TimeoutTemplate:     "timeout",
+		ErrorTemplate:       "error",
+		MissingRootTemplate: "job root {{ .JobRoot }} does not exist",
+	})
+	cfg.Jenkins.MaxRetries = 3
+	gClient := newStubGitea(t)
+	gClient.wg.Add(1)
+	jClient := jenkins.NewClient(jenkinsServer.URL, "", "", jenkinsServer.Client(), nil)
+	proc := processor.New(cfg, jClient, gClient, nil)
+
+	res := proc.ProcessEvent(context.Background(), newEvent("opened", "org/repo", 1))
+	if res.Outcome != processor.OutcomeMissingRoot {
+		t.Fatalf("expected missing_root outcome, got %s (err %v)", res.Outcome, res.Err)
+	}
+	if !errors.Is(res.Err, jenkins.ErrJobRootNotFound) {
+		t.Fatalf("expected ErrJobRootNotFound, got %v", res.Err)
+	}
+	if len(gClient.comments) != 1 || gClient.comments[0] != "job root missing/folder does not exist" {
+		t.Fatalf("unexpected comments: %v", gClient.comments)
+	}
+}
+
+func newTestConfig(t *testing.T, rules ...config.RepositoryRule) *config.Config {
+	t.Helper()
+	cfg := &config.Config{
+		Server: config.ServerConfig{
+			WorkerPoolSize:       1,
+			QueueSize:            10,
+			JenkinsCallbackToken: "callback-token",
+		},
+		Jenkins: config.JenkinsConfig{
+			BaseURL:      "https://jenkins.example.com",
+			PollInterval: time.Millisecond,
+			Timeout:      time.Second,
+		},
+		Gitea: config.GiteaConfig{
+			BaseURL: "https://gitea.example.com",
+			Token:   "token",
+		},
+		Repositories: rules,
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+	return cfg
+}
+
+func newEvent(action, repo string, number int64) webhook.PullRequestEvent {
+	return webhook.PullRequestEvent{
+		Action: action,
+		PullRequest: webhook.PullRequest{
+			Number: number,
+			Title:  "test",
+		},
+		Repository: webhook.Repository{
+			FullName: repo,
+		},
+	}
+}
+
+func waitWithTimeout(t *testing.T, wg *sync.WaitGroup, timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		t.Fatalf("timeout waiting for waitgroup")
+	}
+}
+
+func TestProcessor_CapsPatternsPerEvent(t *testing.T) {
+	cfg := newTestConfig(t, config.RepositoryRule{
+		Name: "org/repo",
+		JenkinsTargets: []config.JenkinsTarget{
+			{JobRoot: "first", JobPattern: `^a$`},
+			{JobRoot: "second", JobPattern: `^b$`},
+			{JobRoot: "third", JobPattern: `^c$`},
+		},
+	})
+	cfg.Server.MaxPatternsPerEvent = 2
+
+	gClient := newStubGitea(t)
+	gClient.wg.Add(1)
+	jClient := &rootRecordingJenkins{}
+	proc := processor.New(cfg, jClient, gClient, nil)
+
+	res := proc.ProcessEvent(context.Background(), newEvent("opened", "org/repo", 1))
+	if len(res.Targets) != 2 {
+		t.Fatalf("expected 2 target results, got %d", len(res.Targets))
+	}
+	if len(jClient.roots) != 2 {
+		t.Fatalf("expected 2 Jenkins lookups, got %v", jClient.roots)
+	}
+	for _, root := range jClient.roots {
+		if root == "third" {
+			t.Fatalf("pattern beyond the cap was processed: %v", jClient.roots)
+		}
+	}
+}
+
+func TestProcessor_UpdateStrategy(t *testing.T) {
+	tests := []struct {
+		strategy  string
+		wantPosts int
+		wantEdits int
+		check     func(t *testing.T, comments []string)
+	}{
+		{
+			strategy:  config.UpdateStrategyNewEachTime,
+			wantPosts: 2,
+			check: func(t *testing.T, comments []string) {
+				if comments[0] != "run by alice" || comments[1] != "run by bob" {
+					t.Fatalf("unexpected comments: %v", comments)
+				}
+			},
+		},
+		{
+			strategy:  config.UpdateStrategyOverwrite,
+			wantPosts: 1,
+			wantEdits: 1,
+			check: func(t *testing.T, comments []string) {
+				if comments[0] != "run by bob" {
+					t.Fatalf("expected tracked comment to be overwritten, got %q", comments[0])
+				}
+			},
+		},
+		{
+			strategy:  config.UpdateStrategyAppendHistory,
+			wantPosts: 1,
+			wantEdits: 1,
+			check: func(t *testing.T, comments []string) {
+				entries := strings.Split(comments[0], "\n\n---\n\n")
+				if len(entries) != 2 {
+					t.Fatalf("expected two history entries, got %q", comments[0])
+				}
+				for i, want := range []string{"run by alice", "run by bob"} {
+					if !strings.HasPrefix(entries[i], "**") || !strings.HasSuffix(entries[i], " UTC**\n\n"+want) {
+						t.Fatalf("unexpected history entry %d: %q", i, entries[i])
+					}
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			cfg := newTestConfig(t, config.RepositoryRule{
+				Name:             "org/repo",
+				JobPattern:       `^job$`,
+				JobFoundTemplate: "run by {{ .Sender }}",
+				UpdateStrategy:   tt.strategy,
+			})
+			gClient := newStubGitea(t)
+			gClient.wg.Add(2)
+			proc := processor.New(cfg, stubJenkins{job: &jenkins.Job{Name: "job"}}, gClient, nil)
+
+			for i, sender := range []string{"alice", "bob"} {
+				evt := newEvent([]string{"opened", "reopened"}[i], "org/repo", 1)
+				evt.Sender.Login = sender
+				if res := proc.ProcessEvent(context.Background(), evt); res.Outcome != processor.OutcomeJobFound {
+					t.Fatalf("expected job_found, got %s (%v)", res.Outcome, res.Err)
+				}
+			}
+			waitWithTimeout(t, &gClient.wg, time.Second)
+
+			if len(gClient.comments) != tt.wantPosts || len(gClient.edits) != tt.wantEdits {
+				t.Fatalf("expected %d posts and %d edits, got comments %v, edits %v",
+					tt.wantPosts, tt.wantEdits, gClient.comments, gClient.edits)
+			}
+			tt.check(t, gClient.comments)
+		})
+	}
+}
+
+func TestProcessor_AppendHistoryTrimsToMaxEntries(t *testing.T) {
+	cfg := newTestConfig(t, config.RepositoryRule{
+		Name:              "org/repo",
+		JobPattern:        `^job$`,
+		JobFoundTemplate:  "run by {{ .Sender }}",
+		UpdateStrategy:    config.UpdateStrategyAppendHistory,
+		MaxHistoryEntries: 2,
+	})
+	cfg.Server.CommentMarker = "<!-- gjb -->"
+	gClient := newStubGitea(t)
+	gClient.wg.Add(3)
+	proc := processor.New(cfg, stubJenkins{job: &jenkins.Job{Name: "job"}}, gClient, nil)
+
+	for i, sender := range []string{"alice", "bob", "carol"} {
+		evt := newEvent([]string{"opened", "reopened", "opened"}[i], "org/repo", 1)
+		evt.Sender.Login = sender
+		if res := proc.ProcessEvent(context.Background(), evt); res.Outcome != processor.OutcomeJobFound {
+			t.Fatalf("expected job_found, got %s (%v)", res.Outcome, res.Err)
+		}
+	}
+	waitWithTimeout(t, &gClient.wg, time.Second)
+
+	if len(gClient.comments) != 1 || len(gClient.edits) != 2 {
+		t.Fatalf("expected 1 post and 2 edits, got comments %v, edits %v", gClient.comments, gClient.edits)
+	}
+	body, ok := strings.CutSuffix(gClient.comments[0], "\n\n<!-- gjb -->")
+	if !ok {
+		t.Fatalf("expected comment marker to survive trimming, got %q", gClient.comments[0])
+	}
+	entries := strings.Split(body, "\n\n---\n\n")
+	if len(entries) != 2 {
+		t.Fatalf("expected history trimmed to two entries, got %q", body)
+	}
+	for i, want := range []string{"run by bob", "run by carol"} {
+		if !strings.HasSuffix(entries[i], " UTC**\n\n"+want) {
+			t.Fatalf("unexpected history entry %d: %q", i, entries[i])
+		}
+	}
+}
+
+func TestProcessor_PlainTextStripsMarkdown(t *testing.T) {
+	cfg := newTestConfig(t, config.RepositoryRule{
+		Name:             "org/repo",
+		JobPattern:       `^job$`,
+		JobFoundTemplate: "✅ **Jenkins** job [{{ .JobName }}]({{ .JobURL }}) is _ready_",
+		PlainText:        true,
+	})
+	gClient := newStubGitea(t)
+	gClient.wg.Add(1)
+	proc := processor.New(cfg, stubJenkins{job: &jenkins.Job{Name: "job", URL: "https://jenkins/job/job/"}}, gClient, nil)
+
+	proc.ProcessEvent(context.Background(), newEvent("opened", "org/repo", 1))
+
+	if want := "✅ Jenkins job job is ready"; len(gClient.comments) != 1 || gClient.comments[0] != want {
+		t.Fatalf("unexpected comments: %q", gClient.comments)
+	}
+}
+
+func TestProcessor_UpdatesMarkedComment(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []string
+		want     []string
+		edits    int
+	}{
+		{
+			name:     "updates marked comment",
+			existing: []string{"looks good", "old result\n\n<!-- gitea-jenkins-bot -->", "thanks"},
+			want:     []string{"looks good", "found job\n\n<!-- gitea-jenkins-bot -->", "thanks"},
+			edits:    1,
+		},
+		{
+			name:     "creates comment without marked one",
+			existing: []string{"looks good"},
+			want:     []string{"looks good", "found job\n\n<!-- gitea-jenkins-bot -->"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig(t, config.RepositoryRule{
+				Name:             "org/repo",
+				JobPattern:       `^job$`,
+				JobFoundTemplate: "found {{ .JobName }}",
+			})
+			cfg.Server.CommentMarker = "<!-- gitea-jenkins-bot -->"
+			cfg.Repositories[0].UpdateStrategy = "" // re-derive the default for a configured marker
+			if err := cfg.Validate(); err != nil {
+				t.Fatalf("unexpected validation error: %v", err)
+			}
+			gClient := newStubGitea(t)
+			gClient.comments = append(gClient.comments, tt.existing...)
+			gClient.wg.Add(1)
+			proc := processor.New(cfg, stubJenkins{job: &jenkins.Job{Name: "job"}}, gClient, nil)
+
+			proc.ProcessEvent(context.Background(), newEvent("reopened", "org/repo", 1))
+			waitWithTimeout(t, &gClient.wg, time.Second)
+
+			if strings.Join(gClient.comments, "|") != strings.Join(tt.want, "|") {
+				t.Fatalf("unexpected comments: %q", gClient.comments)
+			}
+			if len(gClient.edits) != tt.edits {
+				t.Fatalf("expected %d edits, got %q", tt.edits, gClient.edits)
+			}
+		})
+	}
+}
+
+func TestProcessor_UpdatesOnlyOwnInstanceComment(t *testing.T) {
+	existing := []string{
+		"prod result\n\n<!-- gjb:instance=prod:org/repo/1 -->",
+		"staging result\n\n<!-- gjb:instance=staging:org/repo/1 -->",
+		"other pr\n\n<!-- gjb:instance=prod:org/repo/2 -->",
+	}
+	tests := []struct {
+		instance string
+		want     []string
+	}{
+		{instance: "prod", want: []string{"found job\n\n<!-- gjb:instance=prod:org/repo/1 -->", existing[1], existing[2]}},
+		{instance: "staging", want: []string{existing[0], "found job\n\n<!-- gjb:instance=staging:org/repo/1 -->", existing[2]}},
+		{instance: "dev", want: append(append([]string{}, existing...), "found job\n\n<!-- gjb:instance=dev:org/repo/1 -->")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.instance, func(t *testing.T) {
+			cfg := newTestConfig(t, config.RepositoryRule{
+				Name:             "org/repo",
+				JobPattern:       `^job$`,
+				JobFoundTemplate: "found {{ .JobName }}",
+			})
+			cfg.Server.InstanceID = tt.instance
+			cfg.Repositories[0].UpdateStrategy = config.UpdateStrategyOverwrite
+			gClient := newStubGitea(t)
+			gClient.comments = append(gClient.comments, existing...)
+			gClient.wg.Add(1)
+			proc := processor.New(cfg, stubJenkins{job: &jenkins.Job{Name: "job"}}, gClient, nil)
+
+			proc.ProcessEvent(context.Background(), newEvent("reopened", "org/repo", 1))
+			waitWithTimeout(t, &gClient.wg, time.Second)
+
+			if strings.Join(gClient.comments, "|") != strings.Join(tt.want, "|") {
+				t.Fatalf("unexpected comments: %q", gClient.comments)
+			}
+		})
+	}
+}
+
+func TestProcessor_RequireSuccess(t *testing.T) {
+	tests := []struct {
+		name    string
+		require bool
+		color   string
+		build   *jenkins.BuildResult
+		want    string
+	}{
+		{name: "existence only", color: "notbuilt", build: &jenkins.BuildResult{Number: 3, Result: "FAILURE"}, want: "found job"},
+		{name: "required and passed", require: true, color: "notbuilt", build: &jenkins.BuildResult{Number: 3, Result: "SUCCESS"}, want: "passed job #3"},
+		{name: "required and failed", require: true, color: "blue", build: &jenkins.BuildResult{Number: 3, Result: "FAILURE"}, want: "failed job #3"},
+		{name: "required while building", require: true, color: "blue", build: &jenkins.BuildResult{Number: 4, Building: true}, want: "found job"},
+		{name: "required without builds", require: true, color: "blue", want: "found job"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig(t, config.RepositoryRule{
+				Name:                 "org/repo",
+				JobPattern:           `^job$`,
+				RequireSuccess:       tt.require,
+				JobFoundTemplate:     "found {{ .JobName }}",
+				BuildSuccessTemplate: "passed {{ .JobName }} #{{ .BuildNumber }}",
+				BuildFailureTemplate: "failed {{ .JobName }} #{{ .BuildNumber }}",
+			})
+			gClient := newStubGitea(t)
+			gClient.wg.Add(1)
+			proc := processor.New(cfg, stubJenkins{job: &jenkins.Job{Name: "job", Color: tt.color}, build: tt.build}, gClient, nil)
+
+			proc.ProcessEvent(context.Background(), newEvent("opened", "org/repo", 1))
+			waitWithTimeout(t, &gClient.wg, time.Second)
+
+			if len(gClient.comments) != 1 || gClient.comments[0] != tt.want {
+				t.Fatalf("expected comment %q, got %q", tt.want, gClient.comments)
+			}
+		})
+	}
+}
+
+func TestProcessor_RequireSuccessDefaultTemplates(t *testing.T) {
+	tests := []struct {
+		name        string
+		build       *jenkins.BuildResult
+		successWhen string
+		want        string
+	}{
+		{name: "passed", build: &jenkins.BuildResult{Number: 3, Result: "SUCCESS"}, want: "✅"},
+		{name: "failed", build: &jenkins.BuildResult{Number: 3, Result: "FAILURE"}, want: "❌"},
+		{name: "no builds", want: "⏳"},
+		{name: "no builds with success_when", successWhen: `result == "SUCCESS"`, want: "⏳"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig(t, config.RepositoryRule{
+				Name:           "org/repo",
+				JobPattern:     `^job$`,
+				RequireSuccess: true,
+				SuccessWhen:    tt.successWhen,
+			})
+			gClient := newStubGitea(t)
+			gClient.wg.Add(1)
+			proc := processor.New(cfg, stubJenkins{job: &jenkins.Job{Name: "job", Color: "blue"}, build: tt.build}, gClient, nil)
+
+			proc.ProcessEvent(context.Background(), newEvent("opened", "org/repo", 1))
+			waitWithTimeout(t, &gClient.wg, time.Second)
+
+			if len(gClient.comments) != 1 || !strings.HasPrefix(gClient.comments[0], tt.want) {
+				t.Fatalf("expected comment starting with %q, got %q", tt.want, gClient.comments)
+			}
+		})
+	}
+}
+
+func TestProcessor_RequireSuccessRetriesUnavailableJenkins(t *testing.T) {
+	cfg := newTestConfig(t, config.RepositoryRule{
+		Name:                 "org/repo",
+		JobPattern:           `^job$`,
+		RequireSuccess:       true,
+		JobFoundTemplate:     "found {{ .JobName }}",
+		BuildSuccessTemplate: "passed {{ .JobName }} #{{ .BuildNumber }}",
+	})
+	cfg.Jenkins.MaxRetries = 3
+	cfg.Server.RetryBackoff = time.Millisecond
+	jClient := &flakyBuildJenkins{stubJenkins: stubJenkins{
+		job:   &jenkins.Job{Name: "job", Color: "blue"},
+		build: &jenkins.BuildResult{Number: 3, Result: "SUCCESS"},
+	}}
+	jClient.failures.Store(2)
+	gClient := newStubGitea(t)
+	gClient.wg.Add(1)
+	proc := processor.New(cfg, jClient, gClient, nil)
+
+	proc.ProcessEvent(context.Background(), newEvent("opened", "org/repo", 1))
+	waitWithTimeout(t, &gClient.wg, time.Second)
+
+	if len(gClient.comments) != 1 || gClient.comments[0] != "passed job #3" {
+		t.Fatalf("expected the build to be confirmed after transient errors, got %q", gClient.comments)
+	}
+}
+
+func TestProcessor_CommentDispatchDoesNotBlockPolling(t *testing.T) {
+	cfg := newTestConfig(t, config.RepositoryRule{
+		Name:             "org/repo",
+		JobPattern:       `^job$`,
+		JobFoundTemplate: "found {{ .JobName }}",
+	})
+	cfg.Server.CommentWorkers = 1
+	cfg.Server.CommentQueueSize = 1
+	gClient := newSlowGitea()
+	proc := processor.New(cfg, stubJenkins{job: &jenkins.Job{Name: "job"}}, gClient, nil)
+	var processed atomic.Int32
+	proc.SetProcessedHook(func(webhook.PullRequestEvent) { processed.Add(1) })
+	proc.Start()
+
+	if err := proc.Enqueue(newEvent("opened", "org/repo", 1)); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	select {
+	case <-gClient.posting:
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for the first comment to be posted")
+	}
+
+	// The comment worker is stuck on the first comment: the next event is polled and its comment
+	// waits in the queue, and the one after that overflows the queue and is posted by the event worker.
+	overflow := metrics.CommentQueueFull.Value()
+	for _, n := range []int64{2, 3} {
+		if err := proc.Enqueue(newEvent("opened", "org/repo", n)); err != nil {
+			t.Fatalf("enqueue: %v", err)
+		}
+	}
+	deadline := time.Now().Add(time.Second)
+	for processed.Load() < 2 || metrics.CommentQueueFull.Value() == overflow {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected polling to proceed while a comment is slow, processed %d events", processed.Load())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := gClient.posted.Load(); got != 0 {
+		t.Fatalf("expected no comment to be posted yet, got %d", got)
+	}
+
+	close(gClient.release)
+	proc.Stop()
+	if got := gClient.posted.Load(); got != 3 {
+		t.Fatalf("expected all 3 comments to be posted before stop returned, got %d", got)
+	}
+	if got := metrics.CommentQueueFull.Value() - overflow; got != 1 {
+		t.Fatalf("expected 1 comment posted on queue overflow, got %d", got)
+	}
+}
+
+func TestProcessor_CommentDispatchKeepsPullRequestInFlight(t *testing.T) {
+	cfg := newTestConfig(t, config.RepositoryRule{
+		Name:             "org/repo",
+		JobPattern:       `^job$`,
+		JobFoundTemplate: "found {{ .JobName }}",
+	})
+	cfg.Server.CommentWorkers = 2
+	cfg.Server.CommentQueueSize = 10
+	gClient := newSlowGitea()
+	proc := processor.New(cfg, stubJenkins{job: &jenkins.Job{Name: "job"}}, gClient, nil)
+	proc.Start()
+	defer proc.Stop()
+	release := sync.OnceFunc(func() { close(gClient.release) })
+	defer release()
+
+	if err := proc.Enqueue(newEvent("opened", "org/repo", 1)); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	select {
+	case <-gClient.posting:
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for the comment to be posted")
+	}
+
+	// The first comment is still being posted: a newer event for the same PR must not overtake it.
+	duplicates := metrics.DuplicateEventsDropped.Value()
+	if err := proc.Enqueue(newEvent("synchronized", "org/repo", 1)); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	if got := metrics.DuplicateEventsDropped.Value() - duplicates; got != 1 {
+		t.Fatalf("expected the event to be dropped while the comment is pending, got %d drops", got)
+	}
+
+	release()
+	deadline := time.Now().Add(time.Second)
+	for {
+		duplicates = metrics.DuplicateEventsDropped.Value()
+		if err := proc.Enqueue(newEvent("synchronized", "org/repo", 1)); err != nil {
+			t.Fatalf("enqueue: %v", err)
+		}
+		if metrics.DuplicateEventsDropped.Value() == duplicates {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("pull request stayed in flight after its comment was posted")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := gClient.posted.Load(); got != 1 {
+		t.Fatalf("expected the pending comment to be posted before the next event was accepted, got %d", got)
+	}
+}
+
+func TestProcessor_CommentDispatchFailureIsCounted(t *testing.T) {
+	cfg := newTestConfig(t, config.RepositoryRule{Name: "org/repo", JobPattern: `^job$`})
+	cfg.Server.CommentWorkers = 1
+	cfg.Server.CommentQueueSize = 1
+	gClient := &countingGitea{}
+	proc := processor.New(cfg, stubJenkins{job: &jenkins.Job{Name: "job"}}, gClient, nil)
+	failed := metrics.CommentDispatchFailed.Value()
+	proc.Start()
+
+	if err := proc.Enqueue(newEvent("opened", "org/repo", 1)); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	proc.Stop()
+	if got := metrics.CommentDispatchFailed.Value() - failed; got != 1 {
+		t.Fatalf("expected 1 failed comment to be counted, got %d", got)
+	}
+}
+
+func TestProcessor_JenkinsRetriesShareTimeout(t *testing.T) {
+	cfg := newTestConfig(t, config.RepositoryRule{
+		Name:            "org/repo",
+		JobPattern:      `^job$`,
+		TimeoutTemplate: "timeout",
+		ErrorTemplate:   "error",
+		Timeout:         100 * time.Millisecond,
+	})
+	cfg.Jenkins.MaxRetries = 5
+	cfg.Server.RetryBackoff = time.Millisecond
+	jClient := &slowFailingJenkins{}
+	gClient := newStubGitea(t)
+	gClient.wg.Add(1)
+	proc := processor.New(cfg, jClient, gClient, nil)
+
+	start := time.Now()
+	res := proc.ProcessEvent(context.Background(), newEvent("opened", "org/repo", 1))
+	elapsed := time.Since(start)
+	waitWithTimeout(t, &gClient.wg, time.Second)
+
+	if res.Outcome != processor.OutcomeTimeout {
+		t.Fatalf("expected timeout outcome once the rule timeout is spent, got %s (err %v)", res.Outcome, res.Err)
+	}
+	if elapsed > 400*time.Millisecond {
+		t.Fatalf("retries extended the rule timeout, processing took %s", elapsed)
+	}
+	jClient.mu.Lock()
+	defer jClient.mu.Unlock()
+	for i := 1; i < len(jClient.timeouts); i++ {
+		if jClient.timeouts[i] >= jClient.timeouts[i-1] {
+			t.Fatalf("expected each retry to get only the remaining time, got %v", jClient.timeouts)
+		}
+	}
+}
+
+func TestProcessor_DistinguishesJenkinsErrorFromTimeout(t *testing.T) {
+	tests := []struct {
+		name        string
+		jenkins     stubJenkins
+		errTemplate string
+		want        string
+	}{
+		{name: "job found", jenkins: stubJenkins{job: &jenkins.Job{Name: "job"}}, want: "found job"},
+		{name: "timeout", jenkins: stubJenkins{err: context.DeadlineExceeded}, want: "not found for PR 1"},
+		{name: "jenkins error", jenkins: stubJenkins{err: errors.New("connection refused")}, errTemplate: "jenkins failed: {{ .Error }}", want: "jenkins failed: connection refused"},
+		{name: "auth error", jenkins: stubJenkins{err: jenkins.ErrAuthFailed}, errTemplate: "jenkins failed: {{ .Error }}", want: "jenkins failed: " + jenkins.ErrAuthFailed.Error()},
+		{name: "default error template", jenkins: stubJenkins{err: errors.New("connection refused")}, want: "❌ Jenkins is unreachable, PR 1 could not be checked: connection refused"},
+		{name: "default auth error template", jenkins: stubJenkins{err: jenkins.ErrAuthFailed}, want: "❌ Jenkins rejected the service credentials, PR 1 could not be checked: " + jenkins.ErrAuthFailed.Error()},
+		{name: "default missing root template", jenkins: stubJenkins{err: jenkins.ErrJobRootNotFound}, want: "❌ Jenkins job root folder does not exist, PR 1 could not be checked."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig(t, config.RepositoryRule{
+				Name:             "org/repo",
+				JobRoot:          "folder",
+				JobPattern:       `^job$`,
+				JobFoundTemplate: "found {{ .JobName }}",
+				TimeoutTemplate:  "not found for PR {{ .Number }}{{ .Error }}",
+				ErrorTemplate:    tt.errTemplate,
+			})
+			gClient := newStubGitea(t)
+			gClient.wg.Add(1)
+			proc := processor.New(cfg, tt.jenkins, gClient, nil)
+
+			proc.ProcessEvent(context.Background(), newEvent("opened", "org/repo", 1))
+			waitWithTimeout(t, &gClient.wg, time.Second)
+
+			if len(gClient.comments) != 1 || gClient.comments[0] != tt.want {
+				t.Fatalf("expected comment %q, got %q", tt.want, gClient.comments)
+			}
+		})
+	}
+}
+
+func TestProcessor_SetsCommitStatus(t *testing.T) {
+	tests := []struct {
+		name  string
+		final string
+		want  string
+	}{
+		{name: "success", final: "blue", want: "org/repo@abc123 ci/jenkins success https://jenkins/job/job-5/"},
+		{name: "failure", final: "red", want: "org/repo@abc123 ci/jenkins failure https://jenkins/job/job-5/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig(t, config.RepositoryRule{
+				Name:          "org/repo",
+				JobPattern:    `^job-{{ .Number }}$`,
+				CommitStatus:  true,
+				StatusContext: "ci/jenkins",
+			})
+			gClient := newStubGitea(t)
+			gClient.wg.Add(1)
+			job := &jenkins.Job{Name: "job-5", URL: "https://jenkins/job/job-5/", Color: tt.final}
+			proc := processor.New(cfg, stubJenkins{job: job}, gClient, nil)
+
+			evt := newEvent("opened", "org/repo", 5)
+			evt.PullRequest.Head.Sha = "abc123"
+			proc.ProcessEvent(context.Background(), evt)
+
+			want := []string{"org/repo@abc123 ci/jenkins pending ", tt.want}
+			if strings.Join(gClient.statuses, "|") != strings.Join(want, "|") {
+				t.Fatalf("unexpected statuses: %q", gClient.statuses)
+			}
+		})
+	}
+}
+
+// ctxStatusGitea отклоняет установку статуса коммита с отмененным контекстом.
+type ctxStatusGitea struct {
+	*stubGitea
+}
+
+func (c ctxStatusGitea) CreateCommitStatus(ctx context.Context, owner, repo, sha string, status gitea.CommitStatus) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.stubGitea.CreateCommitStatus(ctx, owner, repo, sha, status)
+}
+
+// cancelingJenkins отменяет контекст события при ожидании задачи.
+type cancelingJenkins struct {
+	stubJenkins
+	cancel context.CancelFunc
+}
+
+func (c cancelingJenkins) WaitForJob(ctx context.Context, re *regexp.Regexp, root string, timeout, interval time.Duration) (*jenkins.Job, error) {
+	c.cancel()
+	return c.stubJenkins.WaitForJob(ctx, re, root, timeout, interval)
+}
+
+func TestProcessor_SetsFinalCommitStatusAfterCancel(t *testing.T) {
+	cfg := newTestConfig(t, config.RepositoryRule{
+		Name:          "org/repo",
+		JobPattern:    `^job-{{ .Number }}$`,
+		CommitStatus:  true,
+		StatusContext: "ci/jenkins",
+	})
+	gClient := newStubGitea(t)
+	gClient.wg.Add(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	job := &jenkins.Job{Name: "job-5", URL: "https://jenkins/job/job-5/", Color: "red"}
+	proc := processor.New(cfg, cancelingJenkins{stubJenkins: stubJenkins{job: job}, cancel: cancel}, ctxStatusGitea{gClient}, nil)
+
+	evt := newEvent("opened", "org/repo", 5)
+	evt.PullRequest.Head.Sha = "abc123"
+	proc.ProcessEvent(ctx, evt)
+
+	want := []string{"org/repo@abc123 ci/jenkins pending ", "org/repo@abc123 ci/jenkins failure https://jenkins/job/job-5/"}
+	if strings.Join(gClient.statuses, "|") != strings.Join(want, "|") {
+		t.Fatalf("expected final status despite the cancelled event, got %q", gClient.statuses)
+	}
+}
+
+func TestProcessor_RuleGiteaOverridePostsToOtherServer(t *testing.T) {
+	var gotPath, gotAuth string
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotAuth = r.URL.Path, r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id": 1}`))
+	}))
+	defer mirror.Close()
+
+	cfg := newTestConfig(t,
+		config.RepositoryRule{Name: "org/mirrored", JobPattern: `^job$`, GiteaBaseURL: mirror.URL, GiteaToken: "mirror-token"},
+		config.RepositoryRule{Name: "org/repo", JobPattern: `^job$`},
+	)
+	gClient := newStubGitea(t)
+	gClient.wg.Add(1)
+	proc := processor.New(cfg, stubJenkins{job: &jenkins.Job{Name: "job"}}, gClient, nil)
+
+	if res := proc.ProcessEvent(context.Background(), newEvent("opened", "org/mirrored", 3)); res.Outcome != processor.OutcomeJobFound {
+		t.Fatalf("expected job_found, got %s (%v)", res.Outcome, res.Err)
+	}
+	if gotPath != "/repos/org/mirrored/issues/3/comments" || gotAuth != "token mirror-token" {
+		t.Fatalf("unexpected request to override server: path %q, auth %q", gotPath, gotAuth)
+	}
+	if len(gClient.comments) != 0 {
+		t.Fatalf("expected no comments on the default server, got %v", gClient.comments)
+	}
+
+	proc.ProcessEvent(context.Background(), newEvent("opened", "org/repo", 4))
+	if len(gClient.comments) != 1 {
+		t.Fatalf("expected rule without override to use the default server, got %v", gClient.comments)
+	}
+}
+
+func TestProcessor_VerboseMatchesListsAllJobs(t *testing.T) {
+	cfg := newTestConfig(t, config.RepositoryRule{
+		Name:                "org/repo",
+		JobPattern:          `PR-{{ .Number }}`,
+		JobFoundTemplate:    "found {{ .JobName }}",
+		VerboseMatches:      true,
+		VerboseMatchesLimit: 2,
+	})
+	gClient := newStubGitea(t)
+	gClient.wg.Add(1)
+	jClient := stubJenkins{
+		job: &jenkins.Job{Name: "PR-1", URL: "https://jenkins/job/PR-1/"},
+		matched: []jenkins.Job{
+			{Name: "PR-1", FullName: "PR-1", URL: "https://jenkins/job/PR-1/"},
+			{Name: "PR-1-lint", FullName: "team/PR-1-lint", URL: "https://jenkins/job/team/job/PR-1-lint/"},
+			{Name: "PR-1-docs", FullName: "team/PR-1-docs", URL: "https://jenkins/job/team/job/PR-1-docs/"},
+		},
+	}
+	proc := processor.New(cfg, jClient, gClient, nil)
+
+	proc.ProcessEvent(context.Background(), newEvent("opened", "org/repo", 1))
+
+	want := "found PR-1\n\nMatched Jenkins jobs:\n" +
+		"- [PR-1](https://jenkins/job/PR-1/)\n" +
+		"- [team/PR-1-lint](https://jenkins/job/team/job/PR-1-lint/)\n" +
+		"- …and 1 more"
+	if len(gClient.comments) != 1 || gClient.comments[0] != want {
+		t.Fatalf("unexpected comments: %q", gClient.comments)
+	}
+}
+
+func TestProcessor_HandlesConfiguredActions(t *testing.T) {
+	tests := []struct {
+		action  string
+		actions []string
+		want    processor.Outcome
+	}{
+		{action: "opened", want: processor.OutcomeJobFound},
+		{action: "reopened", want: processor.OutcomeJobFound},
+		{action: "synchronized", want: processor.OutcomeJobFound},
+		{action: "synchronize", want: processor.OutcomeJobFound},
+		{action: "closed", want: processor.OutcomeSkipped},
+		{action: "synchronized", actions: []string{"opened"}, want: processor.OutcomeSkipped},
+		{action: "synchronized", actions: []string{"synchronize"}, want: processor.OutcomeJobFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s in %v", tt.action, tt.actions), func(t *testing.T) {
+			cfg := newTestConfig(t, config.RepositoryRule{
+				Name:             "org/repo",
+				JobPattern:       `^job$`,
+				JobFoundTemplate: "{{ .Action }}: {{ .Title }}",
+				Actions:          tt.actions,
+			})
+			gClient := newStubGitea(t)
+			if tt.want == processor.OutcomeJobFound {
+				gClient.wg.Add(1)
+			}
+			proc := processor.New(cfg, stubJenkins{job: &jenkins.Job{Name: "job"}}, gClient, nil)
+
+			res := proc.ProcessEvent(context.Background(), newEvent(tt.action, "org/repo", 1))
+			if res.Outcome != tt.want {
+				t.Fatalf("expected %s, got %s (%s)", tt.want, res.Outcome, res.Reason)
+			}
+			if tt.want == processor.OutcomeJobFound {
+				if want := tt.action + ": test"; len(gClient.comments) != 1 || gClient.comments[0] != want {
+					t.Fatalf("unexpected comments: %q", gClient.comments)
+				}
+			} else if len(gClient.comments) != 0 {
+				t.Fatalf("expected no comments, got %q", gClient.comments)
+			}
+		})
+	}
+}
+
+func TestProcessor_JenkinsCallbackResolvesPendingWait(t *testing.T) {
+	cfg := newTestConfig(t, config.RepositoryRule{
+		Name:                 "org/repo",
+		JobPattern:           `^PR-{{ .Number }}$`,
+		Timeout:              5 * time.Second,
+		WaitMode:             config.WaitModeCallback,
+		CallbackParameter:    "PR",
+		BuildSuccessTemplate: "success {{ .JobName }} {{ .JobURL }}",
+	})
+	gClient := newStubGitea(t)
+	gClient.wg.Add(1)
+	jClient := &countingJenkins{}
+	proc := processor.New(cfg, jClient, gClient, nil)
+
+	done := make(chan processor.Result, 1)
+	go func() { done <- proc.ProcessEvent(context.Background(), newEvent("opened", "org/repo", 7)) }()
+
+	notification := func(name, pr string) jenkins.Notification {
+		return jenkins.Notification{
+			Name: name,
+			URL:  "job/org/job/" + name + "/",
+			Build: jenkins.NotificationBuild{
+				FullURL:    "https://jenkins/job/org/job/" + name + "/3/",
+				Number:     3,
+				Phase:      "COMPLETED",
+				Status:     "SUCCESS",
+				Parameters: map[string]string{"PR": pr},
+			},
+		}
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for proc.ResolveCallback(notification("PR-7", "8")) != 0 || proc.ResolveCallback(notification("PR-8", "7")) != 0 ||
+		proc.ResolveCallback(notification("PR-7", "7")) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("callback did not resolve the pending wait")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	res := <-done
+	if res.Outcome != processor.OutcomeBuildSuccess || res.Job == nil || res.Job.FullName != "org/PR-7" {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	if jClient.calls.Load() != 0 {
+		t.Fatalf("expected no polling, got %d WaitForJob calls", jClient.calls.Load())
+	}
+	if len(gClient.comments) != 1 || gClient.comments[0] != "success PR-7 https://jenkins/job/org/job/PR-7/" {
+		t.Fatalf("unexpected comments: %v", gClient.comments)
+	}
+}
+
+func TestProcessor_JenkinsCallbackFallsBackToPolling(t *testing.T) {
+	cfg := newTestConfig(t, config.RepositoryRule{
+		Name:             "org/repo",
+		JobPattern:       `^PR-{{ .Number }}$`,
+		Timeout:          20 * time.Millisecond,
+		WaitMode:         config.WaitModeCallback,
+		JobFoundTemplate: "found {{ .JobName }}",
+	})
+	gClient := newStubGitea(t)
+	gClient.wg.Add(1)
+	jClient := stubJenkins{job: &jenkins.Job{Name: "PR-7", URL: "https://jenkins/PR-7"}}
+	proc := processor.New(cfg, jClient, gClient, nil)
+
+	res := proc.ProcessEvent(context.Background(), newEvent("opened", "org/repo", 7))
+	if res.Outcome != processor.OutcomeJobFound || res.Job == nil || res.Job.Name != "PR-7" {
+		t.Fatalf("expected polling fallback to find the job, got %+v", res)
+	}
+}
+
+func TestProcessor_JenkinsCallbackPollsBeforeWaiting(t *testing.T) {
+	cfg := newTestConfig(t, config.RepositoryRule{
+		Name:             "org/repo",
+		JobPattern:       `^PR-{{ .Number }}$`,
+		Timeout:          time.Minute,
+		WaitMode:         config.WaitModeCallback,
+		JobFoundTemplate: "found {{ .JobName }}",
+	})
+	gClient := newStubGitea(t)
+	gClient.wg.Add(1)
+	// The notification was sent before the event was processed: only the initial poll can see the job.
+	jClient := stubJenkins{job: &jenkins.Job{Name: "PR-7", URL: "https://jenkins/PR-7"}}
+	proc := processor.New(cfg, jClient, gClient, nil)
+
+	start := time.Now()
+	res := proc.ProcessEvent(context.Background(), newEvent("opened", "org/repo", 7))
+	if res.Outcome != processor.OutcomeJobFound || res.Job == nil || res.Job.Name != "PR-7" {
+		t.Fatalf("expected the initial poll to find the job, got %+v", res)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("event waited for the callback timeout: %s", elapsed)
+	}
+}
+
+func TestProcessor_SuccessWhenDecidesOutcome(t *testing.T) {
+	tests := []struct {
+		name string
+		job  jenkins.Job
+		want processor.Outcome
+	}{
+		{name: "expression holds", job: jenkins.Job{Name: "PR-1", Color: "yellow"}, want: processor.OutcomeBuildSuccess},
+		{name: "expression fails", job: jenkins.Job{Name: "PR-1-nightly", Color: "blue"}, want: processor.OutcomeBuildFailure},
+		{name: "result unknown", job: jenkins.Job{Name: "PR-1", Color: "blue_anime"}, want: processor.OutcomeJobFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig(t, config.RepositoryRule{
+				Name:        "org/repo",
+				JobPattern:  `^PR-{{ .Number }}`,
+				SuccessWhen: `name matches "^PR-\d+$" AND result != FAILURE`,
+			})
+			gClient := newStubGitea(t)
+			gClient.wg.Add(1)
+			job := tt.job
+			proc := processor.New(cfg, stubJenkins{job: &job}, gClient, nil)
+
+			if res := proc.ProcessEvent(context.Background(), newEvent("opened", "org/repo", 1)); res.Outcome != tt.want {
+				t.Fatalf("expected %s, got %s", tt.want, res.Outcome)
+			}
+		})
+	}
+}
+
+func TestProcessor_MaxCommentsPerMinuteDelaysRepoComments(t *testing.T) {
+	cfg := newTestConfig(t,
+		config.RepositoryRule{Name: "org/limited", JobPattern: `^PR-{{ .Number }}$`, MaxCommentsPerMinute: 600},
+		config.RepositoryRule{Name: "org/other", JobPattern: `^PR-{{ .Number }}$`},
+	)
+	gClient := newStubGitea(t)
+	gClient.wg.Add(5)
+	proc := processor.New(cfg, stubJenkins{job: &jenkins.Job{Name: "PR", Color: "blue"}}, gClient, nil)
+
+	start := time.Now()
+	for i := int64(1); i <= 3; i++ {
+		if res := proc.ProcessEvent(context.Background(), newEvent("opened", "org/limited", i)); res.Err != nil {
+			t.Fatalf("unexpected error: %v", res.Err)
+		}
+	}
+	// 600 comments per minute allow one comment every 100ms: the 2nd and 3rd are delayed.
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Fatalf("expected comments of a limited repo to be spaced, took %s", elapsed)
+	}
+
+	start = time.Now()
+	for i := int64(1); i <= 2; i++ {
+		proc.ProcessEvent(context.Background(), newEvent("opened", "org/other", i))
+	}
+	if elapsed := time.Since(start); elapsed > 90*time.Millisecond {
+		t.Fatalf("comments of an unlimited repo should not be delayed, took %s", elapsed)
+	}
+	if len(gClient.comments) != 5 {
+		t.Fatalf("expected all 5 comments to be posted, got %d", len(gClient.comments))
+	}
+}
+
+func TestProcessor_DryRunLogsCommentsWithoutPosting(t *testing.T) {
+	cfg := newTestConfig(t, config.RepositoryRule{
+		Name:             "org/repo",
+		JobPattern:       `^PR-{{ .Number }}$`,
+		JobFoundTemplate: "dry run comment for PR {{ .Number }}",
+	})
+	cfg.Server.DryRun = true
+
+	var logs syncBuffer
+	gClient := newStubGitea(t)
+	jClient := stubJenkins{job: &jenkins.Job{Name: "PR-7", Color: "blue_anime"}}
+	proc := processor.New(cfg, jClient, gClient, slog.New(slog.NewTextHandler(&logs, nil)))
+
+	res := proc.ProcessEvent(context.Background(), newEvent("opened", "org/repo", 7))
+	if res.Outcome != processor.OutcomeJobFound {
+		t.Fatalf("expected job_found, got %s (%v)", res.Outcome, res.Err)
+	}
+	if len(gClient.comments) != 0 {
+		t.Fatalf("expected no comments in dry run, got %v", gClient.comments)
+	}
+	out := logs.String()
+	for _, want := range []string{"dry run: comment not posted", "repo=org/repo", "pr_number=7", "dry run comment for PR 7"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected log to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestProcessor_MixedOutcomeTemplate(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.JenkinsInstances = map[string]config.JenkinsConfig{
+		"build":  {BaseURL: "https://build.example.com"},
+		"deploy": {BaseURL: "https://deploy.example.com"},
+	}
+	cfg.Repositories = []config.RepositoryRule{{
+		Name: "org/repo",
+		JenkinsTargets: []config.JenkinsTarget{
+			{Instance: "build", JobPattern: `^build-{{ .Number }}$`},
+			{Instance: "deploy", JobPattern: `^deploy-{{ .Number }}$`},
+		},
+		BuildSuccessTemplate: "all green",
+		BuildFailureTemplate: "all red",
+		TimeoutTemplate:      "timeout",
+		MixedOutcomeTemplate: "{{ range .Targets }}{{ if .Succeeded }}✅{{ else }}⚠️{{ end }} {{ .Instance }} ({{ .Outcome }})\n{{ end }}",
+	}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		build   stubJenkins
+		deploy  stubJenkins
+		want    processor.Outcome
+		comment string
+	}{
+		{
+			name:    "build passed, deploy timed out",
+			build:   stubJenkins{job: &jenkins.Job{Name: "build-8", Color: "blue"}},
+			deploy:  stubJenkins{err: context.DeadlineExceeded},
+			want:    processor.OutcomeTimeout,
+			comment: "✅ build (build_success)\n⚠️ deploy (timeout)\n",
+		},
+		{
+			name:    "both passed",
+			build:   stubJenkins{job: &jenkins.Job{Name: "build-8", Color: "blue"}},
+			deploy:  stubJenkins{job: &jenkins.Job{Name: "deploy-8", Color: "blue"}},
+			want:    processor.OutcomeBuildSuccess,
+			comment: "all green",
+		},
+		{
+			name:    "both failed",
+			build:   stubJenkins{job: &jenkins.Job{Name: "build-8", Color: "red"}},
+			deploy:  stubJenkins{err: context.DeadlineExceeded},
+			want:    processor.OutcomeTimeout,
+			comment: "timeout",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gClient := newStubGitea(t)
+			gClient.wg.Add(1)
+			proc := processor.New(cfg, nil, gClient, nil)
+			proc.SetJenkinsInstances(map[string]processor.JenkinsClient{"build": tt.build, "deploy": tt.deploy})
+
+			res := proc.ProcessEvent(context.Background(), newEvent("opened", "org/repo", 8))
+			if res.Outcome != tt.want {
+				t.Fatalf("expected %s, got %s (%v)", tt.want, res.Outcome, res.Err)
+			}
+			if len(gClient.comments) != 1 || gClient.comments[0] != tt.comment {
+				t.Fatalf("unexpected comments: %q", gClient.comments)
+			}
+		})
+	}
+}
+
+func TestProcessor_StopWithContextCancelsLongPolls(t *testing.T) {
+	cfg := newTestConfig(t, config.RepositoryRule{Name: "org/repo", JobPattern: `^job-{{ .Number }}$`})
+	cfg.Server.WorkerPoolSize = 1
+
+	var logs syncBuffer
+	jClient := newBlockingJenkins()
+	gClient := newStubGitea(t)
+	gClient.wg.Add(1)
+	proc := processor.New(cfg, jClient, gClient, slog.New(slog.NewTextHandler(&logs, nil)))
+	proc.Start()
+
+	for i := int64(1); i <= 3; i++ {
+		if err := proc.Enqueue(newEvent("opened", "org/repo", i)); err != nil {
+			t.Fatalf("enqueue %d failed: %v", i, err)
+		}
+	}
+	<-jClient.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := proc.StopWithContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected long poll to be cancelled at the deadline, stop took %s", elapsed)
+	}
+	if len(jClient.started) != 0 {
+		t.Fatalf("queued events should be dropped, not polled")
+	}
+	if !strings.Contains(logs.String(), "dropped=2") {
+		t.Fatalf("expected dropped events to be logged, got:\n%s", logs.String())
+	}
+}
+
+func TestProcessor_PushEvents(t *testing.T) {
+	push := webhook.PushEvent{
+		Ref:        "refs/heads/main",
+		After:      "abc123",
+		Commits:    []webhook.Commit{{ID: "abc123", Message: "Fix build"}},
+		Repository: webhook.Repository{FullName: "org/repo"},
+	}
+	rule := config.RepositoryRule{
+		Name:             "org/repo",
+		JobPattern:       `^{{ .Branch }}$`,
+		JobFoundTemplate: "{{ .Branch }} {{ .Sha }} {{ .CommitMessage }}",
+		StatusIssueIndex: 42,
+	}
+
+	t.Run("disabled by default", func(t *testing.T) {
+		gClient := newStubGitea(t)
+		proc := processor.New(newTestConfig(t, rule), stubJenkins{job: &jenkins.Job{Name: "main"}}, gClient, nil)
+		res := proc.ProcessEvent(context.Background(), push.AsPullRequestEvent())
+		if res.Outcome != processor.OutcomeSkipped || len(gClient.comments) != 0 {
+			t.Fatalf("expected push event to be skipped, got %s with comments %v", res.Outcome, gClient.comments)
+		}
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		enabled := rule
+		enabled.Events = []string{"pull_request", "push"}
+		gClient := newStubGitea(t)
+		gClient.wg.Add(1)
+		proc := processor.New(newTestConfig(t, enabled), stubJenkins{job: &jenkins.Job{Name: "main"}}, gClient, nil)
+		res := proc.ProcessEvent(context.Background(), push.AsPullRequestEvent())
+		if res.Outcome != processor.OutcomeJobFound {
+			t.Fatalf("expected job_found, got %s (%v)", res.Outcome, res.Err)
+		}
+		if len(gClient.comments) != 1 || gClient.indexes[0] != 42 {
+			t.Fatalf("expected one comment in status issue, got %v at %v", gClient.comments, gClient.indexes)
+		}
+		if !strings.Contains(gClient.comments[0], "main abc123 Fix build") {
+			t.Fatalf("expected push template data in comment, got %q", gClient.comments[0])
+		}
+	})
+}
+
+func TestProcessor_RetestFetchesPullRequest(t *testing.T) {
+	rule := config.RepositoryRule{
+		Name:             "org/repo",
+		Events:           []string{"pull_request", "issue_comment"},
+		JobPattern:       `^PR-{{ .Number }}$`,
+		JobFoundTemplate: "{{ .Action }} {{ .SourceBranch }} {{ .Sha }}",
+	}
+	retest := webhook.IssueCommentEvent{
+		Action:     "created",
+		Issue:      webhook.Issue{Number: 7, PullRequest: &struct{}{}},
+		Comment:    webhook.IssueNote{Body: "/retest"},
+		Repository: webhook.Repository{FullName: "org/repo"},
+	}.AsPullRequestEvent()
+
+	gClient := newStubGitea(t)
+	gClient.pulls = map[int64]*gitea.PullRequest{
+		7: {Number: 7, State: "open", Head: gitea.PRBranch{Ref: "feature", Sha: "abc123"}, Base: gitea.PRBranch{Ref: "main"}},
+		8: {Number: 8, State: "closed"},
+	}
+	gClient.wg.Add(1)
+	proc := processor.New(newTestConfig(t, rule), stubJenkins{job: &jenkins.Job{Name: "PR-7"}}, gClient, nil)
+	res := proc.ProcessEvent(context.Background(), retest)
+	if res.Outcome != processor.OutcomeJobFound {
+		t.Fatalf("expected job_found, got %s (%s: %v)", res.Outcome, res.Reason, res.Err)
+	}
+	if len(gClient.comments) != 1 || !strings.Contains(gClient.comments[0], "retest feature abc123") {
+		t.Fatalf("expected comment with fetched pull request data, got %v", gClient.comments)
+	}
+
+	closed := retest
+	closed.PullRequest.Number = 8
+	if res := proc.ProcessEvent(context.Background(), closed); res.Outcome != processor.OutcomeSkipped {
+		t.Fatalf("expected retest of closed pull request to be skipped, got %s", res.Outcome)
+	}
+	missing := retest
+	missing.PullRequest.Number = 9
+	if res := proc.ProcessEvent(context.Background(), missing); res.Outcome != processor.OutcomeError {
+		t.Fatalf("expected error when pull request cannot be fetched, got %s", res.Outcome)
+	}
+}
+
+func TestProcessor_MaxConcurrentLimitsRepository(t *testing.T) {
+	cfg := newTestConfig(t,
+		config.RepositoryRule{Name: "org/mono", JobPattern: `^PR-{{ .Number }}$`, MaxConcurrent: 1, Timeout: time.Minute},
+		config.RepositoryRule{Name: "org/other", JobPattern: `^PR-{{ .Number }}$`, Timeout: time.Minute},
+	)
+	cfg.Server.WorkerPoolSize = 2
+	cfg.GetRepositoryRule("org/mono") // build the lazy index before concurrent lookups
+	jClient := newBlockingJenkins()
+	gClient := newStubGitea(t)
+	gClient.wg.Add(3)
+	proc := processor.New(cfg, jClient, gClient, nil)
+	proc.Start()
+
+	for _, evt := range []webhook.PullRequestEvent{
+		newEvent("opened", "org/mono", 1),
+		newEvent("opened", "org/mono", 2),
+		newEvent("opened", "org/other", 3),
+	} {
+		if err := proc.Enqueue(evt); err != nil {
+			t.Fatalf("enqueue PR %d: %v", evt.PullRequest.Number, err)
+		}
+	}
+
+	// The parked org/mono event must not hold the second worker, so org/other starts alongside PR 1.
+	for i := 0; i < 2; i++ {
+		select {
+		case <-jClient.started:
+		case <-time.After(time.Second):
+			t.Fatalf("expected two events to start waiting for jenkins, got %d", i)
+		}
+	}
+	select {
+	case <-jClient.started:
+		t.Fatal("second org/mono event started while the first one holds the only slot")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(jClient.release)
+	select {
+	case <-jClient.started:
+	case <-time.After(time.Second):
+		t.Fatal("parked org/mono event did not start after the slot was released")
+	}
+	proc.Stop()
+	if len(gClient.comments) != 3 {
+		t.Fatalf("expected all three events to be commented, got %d", len(gClient.comments))
+	}
+}
+
+func TestProcessor_ReloadInFlightConsistency(t *testing.T) {
+	rule := func(tpl string) config.RepositoryRule {
+		return config.RepositoryRule{Name: "org/repo", JobPattern: `^PR-{{ .Number }}$`, TimeoutTemplate: tpl, Timeout: time.Minute}
+	}
+	tests := []struct {
+		mode string
+		want string
+	}{
+		{config.ReloadInFlightPin, "old template"},
+		{config.ReloadInFlightRefresh, "new template"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			cfg := newTestConfig(t, rule("old template"))
+			cfg.Server.ReloadInFlight = tt.mode
+			jClient := newBlockingJenkins()
+			gClient := newStubGitea(t)
+			gClient.wg.Add(1)
+			proc := processor.New(cfg, jClient, gClient, nil)
+
+			done := make(chan processor.Result, 1)
+			go func() { done <- proc.ProcessEvent(context.Background(), newEvent("opened", "org/repo", 1)) }()
+			<-jClient.started
+
+			reloaded := newTestConfig(t, rule("new template"))
+			reloaded.Server.ReloadInFlight = tt.mode
+			proc.SetConfig(reloaded)
+			close(jClient.release)
+
+			if res := <-done; res.Outcome != processor.OutcomeTimeout {
+				t.Fatalf("expected timeout outcome, got %s (%v)", res.Outcome, res.Err)
+			}
+			if len(gClient.comments) != 1 || !strings.Contains(gClient.comments[0], tt.want) {
+				t.Fatalf("expected comment with %q, got %v", tt.want, gClient.comments)
+			}
+		})
+	}
+}
+
+func TestProcessor_GroupCommentUpdatesIncrementally(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.JenkinsInstances = map[string]config.JenkinsConfig{
+		"build":  {BaseURL: "https://build.example.com"},
+		"deploy": {BaseURL: "https://deploy.example.com"},
+	}
+	cfg.Repositories = []config.RepositoryRule{{
+		Name: "org/repo",
+		JenkinsTargets: []config.JenkinsTarget{
+			{Instance: "build", JobPattern: `^build-{{ .Number }}$`},
+			{Instance: "deploy", JobPattern: `^deploy-{{ .Number }}$`},
+		},
+		GroupComment:    true,
+		TimeoutTemplate: "deploy did not start",
+	}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+
+	deploy := newBlockingJenkins()
+	gClient := newStubGitea(t)
+	gClient.wg.Add(4) // initial post, two partial updates and the final result
+	proc := processor.New(cfg, nil, gClient, nil)
+	proc.SetJenkinsInstances(map[string]processor.JenkinsClient{
+		"build":  stubJenkins{job: &jenkins.Job{Name: "build-8", URL: "https://build.example.com/job/build-8/", Color: "blue"}},
+		"deploy": deploy,
+	})
+
+	done := make(chan processor.Result, 1)
+	go func() { done <- proc.ProcessEvent(context.Background(), newEvent("opened", "org/repo", 8)) }()
+
+	<-deploy.started
+	deadline := time.Now().Add(time.Second)
+	for {
+		gClient.mu.Lock()
+		edits := len(gClient.edits)
+		gClient.mu.Unlock()
+		if edits > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the grouped comment to be updated when build resolved")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(deploy.release)
+	res := <-done
+
+	if res.Outcome != processor.OutcomeTimeout {
+		t.Fatalf("expected timeout outcome, got %s (%v)", res.Outcome, res.Err)
+	}
+	if len(gClient.comments) != 1 || len(gClient.edits) != 3 {
+		t.Fatalf("expected one shared comment edited 3 times, got comments %q edits %q", gClient.comments, gClient.edits)
+	}
+	steps := []struct {
+		body string
+		want []string
+	}{
+		{gClient.edits[0], []string{"✅ `^build-8$` (build): build_success — [build-8](https://build.example.com/job/build-8/)", "⏳ `^deploy-8$` (deploy): pending"}},
+		{gClient.edits[1], []string{"✅ `^build-8$` (build)", "❌ `^deploy-8$` (deploy): timeout"}},
+		{gClient.edits[2], []string{"deploy did not start", "❌ `^deploy-8$` (deploy): timeout"}},
+	}
+	if !strings.Contains(gClient.comments[0], "deploy did not start") {
+		t.Fatalf("expected the shared comment to end with the result, got %q", gClient.comments[0])
+	}
+	for i, step := range steps {
+		for _, want := range step.want {
+			if !strings.Contains(step.body, want) {
+				t.Fatalf("edit %d: expected %q in %q", i, want, step.body)
+			}
+		}
 	}
 }
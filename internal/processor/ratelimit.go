@@ -0,0 +1,42 @@
+package processor
+
+import (
+	"context"
+	"time"
+
+	"github.com/example/gitea-jenkins-webhook/internal/config"
+)
+
+// waitCommentSlot ограничивает частоту комментариев репозитория значением max_comments_per_minute правила:
+// комментарии одного репозитория публикуются не чаще чем раз в минуту / max_comments_per_minute,
+// лишние откладываются до освобождения слота. Возвращает ошибку контекста, если событие
+// отменено во время ожидания. При нулевом пределе возвращается сразу.
+func (p *Processor) waitCommentSlot(ctx context.Context, rule config.RepositoryRule, repo string) error {
+	if rule.MaxCommentsPerMinute <= 0 {
+		return nil
+	}
+	interval := time.Minute / time.Duration(rule.MaxCommentsPerMinute)
+
+	p.commentMu.Lock()
+	now := time.Now()
+	slot := p.nextComment[repo]
+	if slot.Before(now) {
+		slot = now
+	}
+	p.nextComment[repo] = slot.Add(interval)
+	p.commentMu.Unlock()
+
+	delay := slot.Sub(now)
+	if delay <= 0 {
+		return nil
+	}
+	p.log.Debug("comment rate limit reached, delaying comment", "repo", repo, "delay", delay)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,23 @@
+package processor
+
+import "github.com/example/gitea-jenkins-webhook/internal/config"
+
+// commentRule возвращает правило, по которому формируется и публикуется комментарий события,
+// репозитория repo, начатого с правилом rule. Модель согласованности с перезагрузкой конфигурации:
+//   - pin (по умолчанию): событие до конца обрабатывается по правилу, действовавшему при начале обработки;
+//   - refresh_rule: шаблоны, формат и способ публикации комментария берутся из текущей конфигурации,
+//     а уже выполненные шаги (поиск задач, запуск сборки) не повторяются.
+//
+// Если при refresh_rule репозиторий удален из конфигурации, используется прежнее правило.
+func (p *Processor) commentRule(rule config.RepositoryRule, repo string) config.RepositoryRule {
+	cfg := p.Config()
+	if cfg.Server.ReloadInFlight != config.ReloadInFlightRefresh {
+		return rule
+	}
+	current, ok := cfg.GetRepositoryRule(repo)
+	if !ok {
+		p.log.Debug("repository removed by reload, keeping the rule the event started with", "repo", repo)
+		return rule
+	}
+	return current
+}
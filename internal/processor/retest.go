@@ -0,0 +1,50 @@
+package processor
+
+import (
+	"context"
+
+	"github.com/example/gitea-jenkins-webhook/internal/config"
+	"github.com/example/gitea-jenkins-webhook/pkg/webhook"
+)
+
+// loadRetestPullRequest дополняет событие команды повторной проверки текущими данными PR из Gitea:
+// комментарий содержит только номер PR, а ветки и SHA могли измениться после последнего события.
+// Если PR не удалось получить или он закрыт, возвращает false и итог обработки события.
+func (p *Processor) loadRetestPullRequest(ctx context.Context, rule config.RepositoryRule, evt webhook.PullRequestEvent) (webhook.PullRequestEvent, Result, bool) {
+	owner, name := evt.Repository.OwnerAndName()
+	pr, err := p.giteaFor(rule).GetPullRequest(ctx, owner, name, evt.PullRequest.Number)
+	if err != nil {
+		p.log.Error("failed to fetch pull request for retest",
+			"err", err,
+			"repo", evt.Repository.FullName,
+			"pr_number", evt.PullRequest.Number)
+		return evt, Result{Outcome: OutcomeError, Reason: "fetch pull request", Err: err}, false
+	}
+	if pr.State == "closed" {
+		p.log.Info("retest requested for closed pull request, skipping",
+			"repo", evt.Repository.FullName,
+			"pr_number", evt.PullRequest.Number)
+		return evt, Result{Outcome: OutcomeSkipped, Reason: "pull request is closed"}, false
+	}
+
+	labels := make([]webhook.Label, len(pr.Labels))
+	for i, l := range pr.Labels {
+		labels[i] = webhook.Label{Name: l.Name}
+	}
+	evt.PullRequest = webhook.PullRequest{
+		Number: evt.PullRequest.Number,
+		Title:  pr.Title,
+		Body:   pr.Body,
+		URL:    pr.HTMLURL,
+		Draft:  pr.Draft,
+		Base:   webhook.Branch{Ref: pr.Base.Ref, Sha: pr.Base.Sha},
+		Head:   webhook.Branch{Ref: pr.Head.Ref, Sha: pr.Head.Sha},
+		Labels: labels,
+	}
+	p.log.Info("retest requested",
+		"repo", evt.Repository.FullName,
+		"pr_number", evt.PullRequest.Number,
+		"sender", evt.Sender.Login,
+		"head_sha", pr.Head.Sha)
+	return evt, Result{}, true
+}
@@ -0,0 +1,86 @@
+package processor
+
+import (
+	"context"
+	"time"
+
+	"github.com/example/gitea-jenkins-webhook/internal/config"
+	"github.com/example/gitea-jenkins-webhook/internal/gitea"
+	"github.com/example/gitea-jenkins-webhook/pkg/webhook"
+)
+
+// setCommitStatus устанавливает статус головного коммита PR с контекстом status_context правила.
+// Ошибки записываются в лог и не влияют на итог обработки события.
+func (p *Processor) setCommitStatus(ctx context.Context, rule config.RepositoryRule, evt webhook.PullRequestEvent, state, targetURL, description string) {
+	sha := evt.PullRequest.Head.Sha
+	if sha == "" {
+		p.log.Warn("pull request head sha is missing, commit status not set",
+			"repo", evt.Repository.FullName,
+			"pr", evt.PullRequest.Number)
+		return
+	}
+	owner, repo := evt.Repository.OwnerAndName()
+	status := gitea.CommitStatus{
+		State:       state,
+		TargetURL:   targetURL,
+		Context:     rule.StatusContext,
+		Description: description,
+	}
+	if err := p.giteaFor(rule).CreateCommitStatus(ctx, owner, repo, sha, status); err != nil {
+		p.log.Warn("failed to set commit status",
+			"err", err,
+			"repo", evt.Repository.FullName,
+			"sha", sha,
+			"state", state)
+	}
+}
+
+// finishCommitStatus устанавливает итоговый статус коммита по итогу обработки res.
+// Если не удалось опубликовать комментарий, статус определяется итогом ожидания задач.
+// Статус отправляется и после отмены контекста события (остановка процессора, event_deadline),
+// иначе коммит навсегда остался бы в pending; время отправки ограничено gitea.request_timeout.
+func (p *Processor) finishCommitStatus(ctx context.Context, rule config.RepositoryRule, evt webhook.PullRequestEvent, res Result) {
+	timeout := p.Config().Gitea.RequestTimeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	outcome := res.Outcome
+	if outcome == OutcomeCommentFailed && len(res.Targets) > 0 {
+		outcome = aggregateTargets(res.Targets).Outcome
+	}
+	state, description := commitStatus(outcome)
+	targetURL := ""
+	switch {
+	case res.Build != nil && res.Build.URL != "":
+		targetURL = res.Build.URL
+	case res.Job != nil:
+		targetURL = res.Job.URL
+	}
+	p.setCommitStatus(ctx, rule, evt, state, targetURL, description)
+}
+
+// commitStatus возвращает состояние и описание статуса коммита для итога обработки.
+// Если результат сборки неизвестен (задача найдена без wait_for_completion), статус остается pending.
+func commitStatus(outcome Outcome) (string, string) {
+	switch outcome {
+	case OutcomeBuildSuccess:
+		return gitea.StatusSuccess, "Jenkins build succeeded"
+	case OutcomeBuildFailure:
+		return gitea.StatusFailure, "Jenkins build failed"
+	case OutcomeBuildUnstable:
+		return gitea.StatusFailure, "Jenkins build is unstable"
+	case OutcomeJobFound:
+		return gitea.StatusPending, "Jenkins job found"
+	case OutcomeTimeout:
+		return gitea.StatusFailure, "Jenkins job not found within timeout"
+	case OutcomeMissingRoot:
+		return gitea.StatusError, "Jenkins job root not found"
+	case OutcomeAuthFailed:
+		return gitea.StatusError, "Jenkins authentication failed"
+	default:
+		return gitea.StatusError, "Jenkins job check failed"
+	}
+}
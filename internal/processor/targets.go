@@ -0,0 +1,449 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/example/gitea-jenkins-webhook/internal/config"
+	"github.com/example/gitea-jenkins-webhook/internal/gitea"
+	"github.com/example/gitea-jenkins-webhook/internal/jenkins"
+	"github.com/example/gitea-jenkins-webhook/internal/retry"
+)
+
+// TargetResult содержит результат ожидания задачи на одной цели Jenkins.
+type TargetResult struct {
+	Instance string               // Имя экземпляра Jenkins (пустое - основной)
+	Pattern  string               // Шаблон имени задачи после подстановки данных события
+	JobRoot  string               // Корневая директория задач после подстановки данных события
+	Outcome  Outcome              // Итог ожидания задачи
+	Job      *jenkins.Job         // Найденная задача (если есть)
+	Build    *jenkins.BuildResult // Завершенная сборка задачи (при wait_for_completion, если дождались, или require_success)
+	Matched  []jenkins.Job        // Все задачи, совпавшие с шаблоном (при verbose_matches)
+	Err      error                // Ошибка ожидания (если есть)
+
+	ProgressComment *gitea.Comment // Комментарий о ходе сборки с консольным выводом (если публиковался)
+}
+
+// Succeeded сообщает, что задача цели найдена и ее сборка успешна или еще не завершилась.
+func (r TargetResult) Succeeded() bool {
+	return r.Outcome == OutcomeBuildSuccess || r.Outcome == OutcomeJobFound
+}
+
+// mixedOutcome сообщает, что часть целей завершилась успешно (см. TargetResult.Succeeded),
+// а часть - нет (падение сборки, таймаут, ошибка и т.п.).
+func mixedOutcome(results []TargetResult) bool {
+	var succeeded, failed bool
+	for _, r := range results {
+		if r.Succeeded() {
+			succeeded = true
+		} else {
+			failed = true
+		}
+	}
+	return succeeded && failed
+}
+
+// compiledTarget - цель Jenkins с отрисованным и скомпилированным шаблоном имени задачи.
+type compiledTarget struct {
+	target        config.JenkinsTarget
+	jobRoot       string
+	pattern       string
+	re            *regexp.Regexp
+	triggered     bool           // Сборка запущена самим процессором, ожидание ограничено post_trigger_wait
+	triggerJob    string         // Запущенная процессором задача trigger_job
+	previousBuild int            // Номер последней сборки trigger_job до запуска (0 - сборок не было)
+	stream        *consoleStream // Поток консольного вывода сборки в комментарий (nil - отключен)
+	number        int64          // Номер PR события (для сопоставления уведомлений Jenkins)
+	group         *commentGroup  // Общий комментарий PR, обновляемый итогом цели (nil - group_comment выключен)
+}
+
+// compileTargets отрисовывает шаблоны корневых директорий и имен задач всех целей правила
+// и компилирует шаблоны имен задач.
+func compileTargets(rule config.RepositoryRule, data map[string]any) ([]compiledTarget, error) {
+	targets := rule.Targets()
+	compiled := make([]compiledTarget, 0, len(targets))
+	for _, target := range targets {
+		pattern, err := executePatternTemplate("pattern", target.JobPattern, data)
+		if err != nil {
+			return nil, fmt.Errorf("execute pattern template %q: %w", target.JobPattern, err)
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex pattern %q: %w", pattern, err)
+		}
+		jobRoot, err := executePatternTemplate("job_root", target.JobRoot, data)
+		if err != nil {
+			return nil, fmt.Errorf("execute job root template %q: %w", target.JobRoot, err)
+		}
+		if err := validateJobRoot(jobRoot); err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, compiledTarget{target: target, jobRoot: jobRoot, pattern: pattern, re: re})
+	}
+	return compiled, nil
+}
+
+// capTargets ограничивает число целей, обрабатываемых для одного события, значением limit
+// (0 - без ограничения). Отброшенные цели записываются в лог.
+func (p *Processor) capTargets(targets []compiledTarget, limit int) []compiledTarget {
+	if limit <= 0 || len(targets) <= limit {
+		return targets
+	}
+	dropped := make([]string, 0, len(targets)-limit)
+	for _, t := range targets[limit:] {
+		dropped = append(dropped, t.pattern)
+	}
+	p.log.Warn("too many job patterns for event, extra patterns are ignored",
+		"limit", limit,
+		"total", len(targets),
+		"dropped", dropped)
+	return targets[:limit]
+}
+
+// validateJobRoot проверяет отрисованный путь корневой директории задач: сегменты пути
+// не должны быть "." или "..", содержать пробельные символы или символы "?", "#", "%".
+func validateJobRoot(jobRoot string) error {
+	for _, segment := range strings.Split(strings.Trim(jobRoot, "/"), "/") {
+		if segment == "." || segment == ".." || strings.ContainsAny(segment, "?#% \t\n") {
+			return fmt.Errorf("invalid job root %q: bad segment %q", jobRoot, segment)
+		}
+	}
+	return nil
+}
+
+// jenkinsFor возвращает клиента Jenkins для указанного экземпляра.
+func (p *Processor) jenkinsFor(instance string) (JenkinsClient, error) {
+	if instance == "" {
+		return p.jc, nil
+	}
+	client, ok := p.instances[instance]
+	if !ok {
+		return nil, fmt.Errorf("jenkins instance %q is not configured", instance)
+	}
+	return client, nil
+}
+
+// waitForTargets параллельно ожидает задачи на всех целях правила
+// и возвращает результаты в порядке целей. Последняя цель ожидается в текущей горутине;
+// при достижении server.max_goroutines остальные цели тоже ожидаются последовательно.
+func (p *Processor) waitForTargets(ctx context.Context, rule config.RepositoryRule, targets []compiledTarget) []TargetResult {
+	results := make([]TargetResult, len(targets))
+	wait := func(i int, t compiledTarget) {
+		results[i] = p.waitForTarget(ctx, rule, t)
+		if t.group != nil {
+			t.group.resolve(ctx, i, results[i])
+		}
+	}
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		if i == len(targets)-1 {
+			wait(i, t)
+			break
+		}
+		wg.Add(1)
+		if !p.spawn("wait_target", func() {
+			defer wg.Done()
+			wait(i, t)
+		}) {
+			wg.Done()
+			wait(i, t)
+		}
+	}
+	wg.Wait()
+	return results
+}
+
+// waitForTarget ожидает задачу на одной цели Jenkins и определяет итог ожидания.
+func (p *Processor) waitForTarget(ctx context.Context, rule config.RepositoryRule, t compiledTarget) TargetResult {
+	res := TargetResult{Instance: t.target.Instance, Pattern: t.pattern, JobRoot: t.jobRoot}
+
+	client, err := p.jenkinsFor(t.target.Instance)
+	if err != nil {
+		res.Outcome, res.Err = OutcomeError, err
+		return res
+	}
+
+	timeout := waitTimeout(rule, t.triggered)
+	p.log.Info("waiting for jenkins job",
+		"instance", t.target.Instance,
+		"pattern", t.pattern,
+		"job_root", t.jobRoot,
+		"timeout", timeout,
+		"triggered", t.triggered,
+		"poll_interval", rule.PollInterval)
+	started := time.Now()
+	var job *jenkins.Job
+	cfg := p.Config()
+	// Retries share the rule timeout: each attempt only gets what is left of it.
+	deadline := started.Add(timeout)
+	wait := func() (*jenkins.Job, error) {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil, context.DeadlineExceeded
+		}
+		return client.WaitForJob(ctx, t.re, t.jobRoot, remaining, rule.PollInterval)
+	}
+	if rule.WaitMode == config.WaitModeCallback {
+		job, err = p.waitForCallback(ctx, client, rule, t, timeout)
+		wait = func() (*jenkins.Job, error) { return pollOnce(ctx, client, t) }
+		if job == nil && err == nil {
+			p.log.Info("no jenkins callback within timeout, falling back to polling",
+				"instance", t.target.Instance,
+				"pattern", t.pattern,
+				"timeout", timeout)
+		}
+	}
+	if job == nil && err == nil {
+		err = retry.Do(ctx, cfg.Jenkins.MaxRetries, cfg.Server.RetryBackoff, isRetryableJenkinsError, func() error {
+			var waitErr error
+			job, waitErr = wait()
+			if waitErr != nil && isRetryableJenkinsError(waitErr) {
+				p.log.Warn("jenkins request failed", "err", waitErr, "instance", t.target.Instance, "pattern", t.pattern)
+			}
+			return waitErr
+		})
+	}
+	if err == nil && job != nil && rule.WaitForCompletion {
+		res.Build = p.waitForCompletion(ctx, client, t, job, timeout-time.Since(started), rule.PollInterval)
+		if t.stream != nil {
+			res.ProgressComment = t.stream.comment
+		}
+	}
+
+	if err == nil && job != nil && rule.RequireSuccess && res.Build == nil {
+		res.Build = p.lastFinishedBuild(ctx, client, t, job)
+	}
+
+	if err == nil && job != nil && rule.VerboseMatches {
+		matched, findErr := client.FindJobs(ctx, t.re, t.jobRoot)
+		if findErr != nil {
+			p.log.Warn("failed to list all matching jenkins jobs", "err", findErr, "instance", t.target.Instance, "pattern", t.pattern)
+		}
+		res.Matched = matched
+	}
+
+	p.recordJenkinsAuth(t.target.Instance, err)
+	switch {
+	case err == nil && job != nil:
+		res.Outcome, res.Job = jobOutcome(job), job
+		switch {
+		case res.Build != nil:
+			res.Outcome = buildOutcome(res.Build)
+		case rule.RequireSuccess:
+			// Without a finished build the job color is not trusted: the job only counts as found.
+			res.Outcome = OutcomeJobFound
+		}
+		if res.Outcome == OutcomeBuildUnstable && rule.TreatUnstableAsSuccess {
+			res.Outcome = OutcomeBuildSuccess
+		}
+		if outcome, ok := successWhenOutcome(rule, job, res.Build); ok {
+			res.Outcome = outcome
+		}
+		p.log.Info("jenkins job detected",
+			"instance", t.target.Instance,
+			"job", job.Name,
+			"url", job.URL,
+			"full_name", job.FullName,
+			"color", job.Color,
+			"build_result", buildResultString(res.Build),
+			"outcome", res.Outcome.String())
+	case err == nil || errors.Is(err, context.DeadlineExceeded):
+		res.Outcome, res.Err = OutcomeTimeout, err
+		p.log.Warn("jenkins job not found within timeout",
+			"instance", t.target.Instance,
+			"pattern", t.pattern,
+			"timeout", timeout)
+	case errors.Is(err, jenkins.ErrAuthFailed):
+		res.Outcome, res.Err = OutcomeAuthFailed, err
+		p.log.Error("jenkins authentication failed",
+			"instance", t.target.Instance,
+			"pattern", t.pattern,
+			"err", err)
+	case errors.Is(err, jenkins.ErrJobRootNotFound):
+		res.Outcome, res.Err = OutcomeMissingRoot, err
+		p.log.Error("jenkins job root does not exist",
+			"instance", t.target.Instance,
+			"job_root", t.jobRoot,
+			"err", err)
+	default:
+		res.Outcome, res.Err = OutcomeError, err
+		p.log.Error("error waiting for jenkins job",
+			"instance", t.target.Instance,
+			"pattern", t.pattern,
+			"err", err)
+	}
+	return res
+}
+
+// waitForCompletion опрашивает последнюю сборку найденной задачи с интервалом interval, пока сборка
+// не завершится или не истечет оставшееся время ожидания. Возвращает завершенную сборку или nil,
+// если сборка не завершилась вовремя.
+func (p *Processor) waitForCompletion(ctx context.Context, client JenkinsClient, t compiledTarget, job *jenkins.Job, remaining, interval time.Duration) *jenkins.BuildResult {
+	if remaining <= 0 {
+		return nil
+	}
+	fullName := job.FullName
+	if fullName == "" {
+		fullName = job.Name
+	}
+	p.log.Info("waiting for jenkins build completion",
+		"instance", t.target.Instance,
+		"job", fullName,
+		"remaining", remaining)
+
+	ctx, cancel := context.WithTimeout(ctx, remaining)
+	defer cancel()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		build, err := client.GetLastBuildResult(ctx, fullName)
+		switch {
+		case err != nil:
+			p.log.Debug("error polling jenkins build", "err", err, "job", fullName)
+		case build != nil && t.staleBuild(fullName, build):
+			p.log.Debug("triggered jenkins build has not started yet",
+				"job", fullName,
+				"last_build", build.Number)
+		case build != nil && !build.Building:
+			p.log.Info("jenkins build completed",
+				"instance", t.target.Instance,
+				"job", fullName,
+				"build_number", build.Number,
+				"result", build.Result)
+			return build
+		case build != nil && t.stream != nil:
+			p.updateConsoleStream(ctx, t.stream, client, job)
+		}
+
+		select {
+		case <-ctx.Done():
+			p.log.Warn("jenkins build did not complete within timeout", "instance", t.target.Instance, "job", fullName)
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// lastFinishedBuild запрашивает последнюю сборку найденной задачи для require_success. Временная ошибка
+// Jenkins (ErrUnavailable) повторяется до jenkins.max_retries раз. Возвращает nil, если сборок нет,
+// сборка еще идет или запрос не удался.
+func (p *Processor) lastFinishedBuild(ctx context.Context, client JenkinsClient, t compiledTarget, job *jenkins.Job) *jenkins.BuildResult {
+	fullName := job.FullName
+	if fullName == "" {
+		fullName = job.Name
+	}
+	cfg := p.Config()
+	var build *jenkins.BuildResult
+	err := retry.Do(ctx, cfg.Jenkins.MaxRetries, cfg.Server.RetryBackoff, isTransientJenkinsError, func() error {
+		var getErr error
+		build, getErr = client.GetLastBuildResult(ctx, fullName)
+		return getErr
+	})
+	switch {
+	case err != nil:
+		p.log.Warn("failed to get last jenkins build", "err", err, "instance", t.target.Instance, "job", fullName)
+		return nil
+	case build == nil || build.Building || t.staleBuild(fullName, build):
+		p.log.Info("jenkins build has not finished, success not confirmed", "instance", t.target.Instance, "job", fullName)
+		return nil
+	}
+	return build
+}
+
+// staleBuild сообщает, что build задачи fullName - сборка, завершенная до запуска сборки самим процессором:
+// запущенная сборка еще стоит в очереди, и ее итог неизвестен. Для задач, отличных от trigger_job,
+// номера сборок не сравниваются.
+func (t compiledTarget) staleBuild(fullName string, build *jenkins.BuildResult) bool {
+	return t.triggered && fullName == t.triggerJob && build.Number <= t.previousBuild
+}
+
+// buildResultString возвращает результат сборки для логов ("" - завершения сборки не дождались).
+func buildResultString(build *jenkins.BuildResult) string {
+	if build == nil {
+		return ""
+	}
+	return build.Result
+}
+
+// isRetryableJenkinsError сообщает, стоит ли повторять ожидание задачи после ошибки:
+// истечение таймаута, отмена контекста, отсутствие корневой директории и отказ в аутентификации не повторяются.
+func isRetryableJenkinsError(err error) bool {
+	return !errors.Is(err, context.DeadlineExceeded) &&
+		!errors.Is(err, context.Canceled) &&
+		!errors.Is(err, jenkins.ErrJobRootNotFound) &&
+		!errors.Is(err, jenkins.ErrAuthFailed)
+}
+
+// isTransientJenkinsError сообщает, что запрос к Jenkins не удался из-за временной недоступности.
+func isTransientJenkinsError(err error) bool {
+	return errors.Is(err, jenkins.ErrUnavailable)
+}
+
+// waitTimeout возвращает время ожидания задачи на цели. Если сборку запустил сам процессор
+// и задан post_trigger_wait, используется он, чтобы дать Jenkins время зарегистрировать сборку;
+// иначе - timeout правила.
+func waitTimeout(rule config.RepositoryRule, triggered bool) time.Duration {
+	if triggered && rule.PostTriggerWait > 0 {
+		return rule.PostTriggerWait
+	}
+	return rule.Timeout
+}
+
+// reportedJobRoot возвращает корневую директорию для шаблонов: директорию первой цели,
+// для которой она не найдена, или директорию первой цели.
+func reportedJobRoot(results []TargetResult) string {
+	for _, r := range results {
+		if r.Outcome == OutcomeMissingRoot {
+			return r.JobRoot
+		}
+	}
+	if len(results) > 0 {
+		return results[0].JobRoot
+	}
+	return ""
+}
+
+// outcomeSeverity задает порядок итогов при агрегации результатов нескольких целей:
+// итог с большим значением считается более важным.
+var outcomeSeverity = map[Outcome]int{
+	OutcomeBuildSuccess:  0,
+	OutcomeJobFound:      1,
+	OutcomeBuildUnstable: 2,
+	OutcomeBuildFailure:  3,
+	OutcomeTimeout:       4,
+	OutcomeMissingRoot:   5,
+	OutcomeError:         6,
+	OutcomeAuthFailed:    7,
+}
+
+// aggregateTargets сводит результаты нескольких целей в общий итог: выбирается наиболее
+// важный итог, задача - первая найденная, ошибка - первая возникшая.
+func aggregateTargets(results []TargetResult) Result {
+	res := Result{Outcome: OutcomeBuildSuccess, Targets: results}
+	for _, r := range results {
+		if outcomeSeverity[r.Outcome] > outcomeSeverity[res.Outcome] {
+			res.Outcome = r.Outcome
+		}
+		if res.Job == nil && r.Job != nil {
+			res.Job, res.Build = r.Job, r.Build
+		}
+		if res.Err == nil && r.Err != nil {
+			res.Err = r.Err
+		}
+	}
+	switch res.Outcome {
+	case OutcomeTimeout:
+		res.Reason = "job not found within timeout"
+	case OutcomeError:
+		res.Reason = "jenkins error"
+	case OutcomeAuthFailed:
+		res.Reason = "jenkins authentication failed"
+	}
+	return res
+}
@@ -0,0 +1,24 @@
+package processor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/example/gitea-jenkins-webhook/internal/config"
+)
+
+func TestWaitTimeoutUsesPostTriggerWaitOnlyWhenTriggered(t *testing.T) {
+	rule := config.RepositoryRule{Timeout: time.Minute, PostTriggerWait: 5 * time.Minute}
+
+	if got := waitTimeout(rule, false); got != time.Minute {
+		t.Fatalf("expected rule timeout for an existing job, got %s", got)
+	}
+	if got := waitTimeout(rule, true); got != 5*time.Minute {
+		t.Fatalf("expected post-trigger wait for a triggered build, got %s", got)
+	}
+
+	rule.PostTriggerWait = 0
+	if got := waitTimeout(rule, true); got != time.Minute {
+		t.Fatalf("expected fallback to rule timeout, got %s", got)
+	}
+}
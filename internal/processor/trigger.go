@@ -0,0 +1,57 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/example/gitea-jenkins-webhook/internal/config"
+)
+
+// renderTriggerParameters отрисовывает шаблоны trigger_parameters правила с данными события.
+func renderTriggerParameters(rule config.RepositoryRule, data map[string]any) (map[string]string, error) {
+	params := make(map[string]string, len(rule.TriggerParameters))
+	for name, tpl := range rule.TriggerParameters {
+		value, err := executeTemplate(name, tpl, data)
+		if err != nil {
+			return nil, fmt.Errorf("execute trigger parameter %q template: %w", name, err)
+		}
+		params[name] = value
+	}
+	return params, nil
+}
+
+// triggerBuild запускает на основном Jenkins сборку задачи trigger_job правила
+// с параметрами trigger_parameters и помечает цели основного Jenkins как запущенные процессором.
+// Номер последней сборки задачи до запуска запоминается в целях, чтобы не принять ее итог за итог
+// запущенной сборки, пока та стоит в очереди. Адрес элемента очереди Jenkins сохраняется в data как QueueURL.
+func (p *Processor) triggerBuild(ctx context.Context, rule config.RepositoryRule, data map[string]any, targets []compiledTarget) error {
+	job, err := executeTemplate("trigger_job", rule.TriggerJob, data)
+	if err != nil {
+		return fmt.Errorf("execute trigger job template: %w", err)
+	}
+	params, err := renderTriggerParameters(rule, data)
+	if err != nil {
+		return err
+	}
+	var previous int
+	last, err := p.jc.GetLastBuildResult(ctx, job)
+	switch {
+	case err != nil:
+		p.log.Warn("failed to get last jenkins build before trigger", "err", err, "job", job)
+	case last != nil:
+		previous = last.Number
+	}
+	queueURL, err := p.jc.TriggerBuild(ctx, job, params)
+	if err != nil {
+		return err
+	}
+	p.log.Info("jenkins build triggered", "job", job, "queue_url", queueURL, "previous_build", previous)
+	data["QueueURL"] = queueURL
+	for i := range targets {
+		if targets[i].target.Instance == "" {
+			targets[i].triggered = true
+			targets[i].triggerJob, targets[i].previousBuild = job, previous
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package processor
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/example/gitea-jenkins-webhook/internal/config"
+	"github.com/example/gitea-jenkins-webhook/internal/gitea"
+	"github.com/example/gitea-jenkins-webhook/internal/state"
+)
+
+// historyTimeLayout - формат отметки времени записи в комментарии с историей итогов.
+const historyTimeLayout = "2006-01-02 15:04:05 MST"
+
+// historyStampPattern совпадает с началом записи истории итогов: отметкой времени в формате historyTimeLayout
+// (в Markdown - полужирной).
+var historyStampPattern = regexp.MustCompile(`^(\*\*)?\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2} `)
+
+// trimHistory оставляет в истории итогов body с записями, разделенными separator, не более max последних
+// записей (max <= 0 - без ограничения). Часть, которая не начинается с отметки времени, считается продолжением
+// предыдущей записи: разделитель мог встретиться в тексте самого итога.
+func trimHistory(body, separator string, max int) string {
+	if max <= 0 {
+		return body
+	}
+	var entries []string
+	for _, part := range strings.Split(body, separator) {
+		if len(entries) > 0 && !historyStampPattern.MatchString(part) {
+			entries[len(entries)-1] += separator + part
+			continue
+		}
+		entries = append(entries, part)
+	}
+	if len(entries) <= max {
+		return body
+	}
+	return strings.Join(entries[len(entries)-max:], separator)
+}
+
+// findMarkedComment ищет среди комментариев issue последний комментарий с меткой сервиса (commentMarker),
+// чтобы продолжить отслеживать его после перезапуска сервиса. С заданным server.instance_id метка
+// содержит идентификатор экземпляра, поэтому комментарии других экземпляров не находятся.
+// Возвращает запись состояния с идентификатором и текстом комментария без префикса и метки.
+func (p *Processor) findMarkedComment(ctx context.Context, rule config.RepositoryRule, repo string, index int64) (state.Record, bool) {
+	server := p.Config().Server
+	marker := p.commentMarker(repo, index)
+	if marker == "" {
+		return state.Record{}, false
+	}
+	comments, err := p.giteaFor(rule).ListComments(ctx, repo, index)
+	if err != nil {
+		p.log.Warn("failed to list comments to find the tracked one", "err", err, "repo", repo, "issue_index", index)
+		return state.Record{}, false
+	}
+	for i := len(comments) - 1; i >= 0; i-- {
+		if !strings.Contains(comments[i].Body, marker) {
+			continue
+		}
+		body := strings.TrimSuffix(comments[i].Body, "\n\n"+marker)
+		body = strings.TrimPrefix(body, server.CommentPrefix)
+		p.log.Debug("found marked comment", "repo", repo, "issue_index", index, "comment_id", comments[i].ID)
+		return state.Record{CommentID: comments[i].ID, Body: body}, true
+	}
+	return state.Record{}, false
+}
+
+// publishTracked публикует итог body (без префикса) в issue index согласно update_strategy правила:
+// new_each_time - новым комментарием, overwrite - заменяя отслеживаемый комментарий PR,
+// append_history - дописывая итог с отметкой времени в отслеживаемый комментарий и оставляя в нем
+// не более max_history_entries последних записей.
+// Если отслеживаемого комментария еще нет или изменить его не удалось (например, он удален),
+// публикуется новый комментарий, который становится отслеживаемым.
+func (p *Processor) publishTracked(ctx context.Context, rule config.RepositoryRule, repo string, index int64, body string) (*gitea.Comment, error) {
+	if rule.UpdateStrategy != config.UpdateStrategyOverwrite && rule.UpdateStrategy != config.UpdateStrategyAppendHistory {
+		return p.publish(ctx, rule, repo, index, p.finalizeComment(repo, index, body))
+	}
+
+	key := state.CommentKey(repo, index)
+	prev, tracked := p.state.Get(key)
+	if !tracked {
+		prev, tracked = p.findMarkedComment(ctx, rule, repo, index)
+	}
+	if rule.UpdateStrategy == config.UpdateStrategyAppendHistory {
+		stamp, separator := time.Now().In(p.location()).Format(historyTimeLayout), "\n\n"
+		if !rule.PlainText {
+			stamp, separator = "**"+stamp+"**", "\n\n---\n\n"
+		}
+		entry := stamp + "\n\n" + body
+		if tracked && prev.Body != "" {
+			body = trimHistory(prev.Body+separator+entry, separator, rule.MaxHistoryEntries)
+		} else {
+			body = entry
+		}
+	}
+
+	var comment *gitea.Comment
+	var err error
+	if tracked && prev.CommentID != 0 {
+		if err := p.waitCommentSlot(ctx, rule, repo); err != nil {
+			return nil, err
+		}
+		comment, err = p.giteaFor(rule).EditComment(ctx, repo, prev.CommentID, p.finalizeComment(repo, index, body))
+		if err != nil {
+			p.log.Warn("failed to update tracked comment, posting a new one",
+				"err", err,
+				"repo", repo,
+				"issue_index", index,
+				"comment_id", prev.CommentID)
+		}
+	}
+	if comment == nil {
+		comment, err = p.publish(ctx, rule, repo, index, p.finalizeComment(repo, index, body))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	p.state.Put(key, state.Record{
+		CommentID: comment.ID,
+		Body:      body,
+		UpdatedAt: time.Now(),
+	})
+	return comment, nil
+}
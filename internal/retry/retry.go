@@ -0,0 +1,93 @@
+// Package retry предоставляет повтор операций с общим бюджетом повторов на событие.
+package retry
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Budget ограничивает суммарное число повторов и общее время, доступное для повторов
+// всех операций одного события. Безопасен для конкурентного использования.
+type Budget struct {
+	mu        sync.Mutex
+	remaining int
+	unlimited bool
+	deadline  time.Time
+}
+
+// NewBudget создает бюджет на attempts повторов, которые можно выполнить в течение total.
+// Нулевое attempts снимает ограничение на число повторов, нулевое total - на время.
+func NewBudget(attempts int, total time.Duration) *Budget {
+	b := &Budget{remaining: attempts, unlimited: attempts <= 0}
+	if total > 0 {
+		b.deadline = time.Now().Add(total)
+	}
+	return b
+}
+
+// Take расходует один повтор из бюджета. Возвращает false, если повторы или время исчерпаны.
+func (b *Budget) Take() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.deadline.IsZero() && time.Now().After(b.deadline) {
+		return false
+	}
+	if b.unlimited {
+		return true
+	}
+	if b.remaining <= 0 {
+		return false
+	}
+	b.remaining--
+	return true
+}
+
+// budgetKey - ключ контекста для бюджета повторов.
+type budgetKey struct{}
+
+// WithBudget возвращает контекст, в котором все повторы расходуют указанный бюджет.
+func WithBudget(ctx context.Context, b *Budget) context.Context {
+	return context.WithValue(ctx, budgetKey{}, b)
+}
+
+// BudgetFromContext возвращает бюджет повторов из контекста или nil, если он не задан.
+func BudgetFromContext(ctx context.Context) *Budget {
+	b, _ := ctx.Value(budgetKey{}).(*Budget)
+	return b
+}
+
+// Do выполняет op и при ошибке повторяет ее до maxRetries раз с паузой backoff между попытками.
+// Каждый повтор расходует бюджет из контекста (если он задан); при исчерпании бюджета
+// или отмене контекста возвращается последняя ошибка op. Если retryable не nil,
+// повторяются только ошибки, для которых он возвращает true.
+func Do(ctx context.Context, maxRetries int, backoff time.Duration, retryable func(error) bool, op func() error) error {
+	return DoExponential(ctx, maxRetries, backoff, backoff, retryable, op)
+}
+
+// DoExponential работает как Do, но пауза между попытками начинается с backoff и удваивается
+// после каждого повтора, не превышая maxInterval.
+func DoExponential(ctx context.Context, maxRetries int, backoff, maxInterval time.Duration, retryable func(error) bool, op func() error) error {
+	budget := BudgetFromContext(ctx)
+	err := op()
+	for attempt := 0; err != nil && attempt < maxRetries; attempt++ {
+		if retryable != nil && !retryable(err) {
+			return err
+		}
+		if budget != nil && !budget.Take() {
+			return err
+		}
+		if backoff > 0 {
+			timer := time.NewTimer(backoff)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return err
+			case <-timer.C:
+			}
+			backoff = min(2*backoff, max(maxInterval, backoff))
+		}
+		err = op()
+	}
+	return err
+}
@@ -0,0 +1,80 @@
+package retry_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/example/gitea-jenkins-webhook/internal/retry"
+)
+
+func TestDoRetriesUntilSuccess(t *testing.T) {
+	calls := 0
+	err := retry.Do(context.Background(), 3, 0, nil, func() error {
+		calls++
+		if calls < 3 {
+			return errors.New("temporary")
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Fatalf("expected success after 3 calls, got err=%v calls=%d", err, calls)
+	}
+}
+
+func TestDoSharesBudgetAcrossOperations(t *testing.T) {
+	ctx := retry.WithBudget(context.Background(), retry.NewBudget(3, 0))
+	failing := errors.New("down")
+
+	first, second := 0, 0
+	_ = retry.Do(ctx, 2, 0, nil, func() error { first++; return failing })
+	_ = retry.Do(ctx, 5, 0, nil, func() error { second++; return failing })
+
+	// Each operation runs once; only 3 retries in total may follow.
+	if retries := first - 1 + second - 1; retries != 3 {
+		t.Fatalf("expected 3 retries in total, got %d (first=%d, second=%d)", retries, first, second)
+	}
+}
+
+func TestDoStopsWhenBudgetTimeExpires(t *testing.T) {
+	ctx := retry.WithBudget(context.Background(), retry.NewBudget(0, 20*time.Millisecond))
+	calls := 0
+	_ = retry.Do(ctx, 1000, 5*time.Millisecond, nil, func() error { calls++; return errors.New("down") })
+	if calls > 10 {
+		t.Fatalf("expected retries to stop when the time budget expired, got %d calls", calls)
+	}
+}
+
+func TestDoSkipsNonRetryableErrors(t *testing.T) {
+	calls := 0
+	permanent := errors.New("permanent")
+	err := retry.Do(context.Background(), 3, 0, func(err error) bool { return !errors.Is(err, permanent) }, func() error {
+		calls++
+		return permanent
+	})
+	if !errors.Is(err, permanent) || calls != 1 {
+		t.Fatalf("expected a single call, got err=%v calls=%d", err, calls)
+	}
+}
+
+func TestDoExponentialGrowsBackoffUpToMax(t *testing.T) {
+	var gaps []time.Duration
+	last := time.Now()
+	_ = retry.DoExponential(context.Background(), 4, 5*time.Millisecond, 12*time.Millisecond, nil, func() error {
+		now := time.Now()
+		gaps = append(gaps, now.Sub(last))
+		last = now
+		return errors.New("down")
+	})
+	// Backoffs are 5ms, 10ms, 12ms (capped), 12ms; each gap is at least its backoff.
+	wants := []time.Duration{0, 5 * time.Millisecond, 10 * time.Millisecond, 12 * time.Millisecond, 12 * time.Millisecond}
+	if len(gaps) != len(wants) {
+		t.Fatalf("expected %d calls, got %d", len(wants), len(gaps))
+	}
+	for i, want := range wants {
+		if gaps[i] < want {
+			t.Fatalf("gap %d: expected at least %s, got %s", i, want, gaps[i])
+		}
+	}
+}
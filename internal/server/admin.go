@@ -0,0 +1,159 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/example/gitea-jenkins-webhook/internal/config"
+	"github.com/example/gitea-jenkins-webhook/internal/jenkins"
+	"github.com/example/gitea-jenkins-webhook/internal/processor"
+)
+
+// ReloadConfig перечитывает файл конфигурации, из которого была загружена текущая конфигурация,
+// и атомарно заменяет ее в сервере и процессоре. Настройки, требующие перезапуска, сохраняются
+// прежними и перечисляются в поле Ignored результата. При ошибке загрузки или валидации
+// текущая конфигурация остается без изменений.
+func (s *Server) ReloadConfig() (config.RepoDiff, error) {
+	s.cfgMu.Lock()
+	defer s.cfgMu.Unlock()
+	prev := s.cfg.Load()
+	if prev.Path == "" {
+		return config.RepoDiff{}, fmt.Errorf("configuration was not loaded from a file")
+	}
+
+	next, err := config.Load(prev.Path)
+	if err != nil {
+		s.log.Error("config reload failed, keeping current configuration", "err", err, "path", prev.Path)
+		return config.RepoDiff{}, err
+	}
+
+	ignored := next.KeepStaticFrom(prev)
+	if next.RuleSource.URL != "" {
+		// Rules are owned by the remote source; the file only provides the rest of the settings.
+		if next, err = next.WithRules(prev.Repositories); err != nil {
+			return config.RepoDiff{}, err
+		}
+	}
+	diff := config.Diff(prev, next)
+	diff.Ignored = ignored
+	if len(ignored) > 0 {
+		s.log.Warn("config reload ignored fields that require a restart", "fields", ignored)
+	}
+
+	s.cfg.Store(next)
+	s.processor.SetConfig(next)
+	s.log.Info("configuration reloaded",
+		"path", prev.Path,
+		"added", diff.Added,
+		"removed", diff.Removed,
+		"changed", diff.Changed)
+	return diff, nil
+}
+
+// handleAdminReload обрабатывает запрос на перезагрузку конфигурации (POST /admin/reload).
+// Требует заголовок Authorization: Bearer <server.admin_token>. Возвращает JSON с изменениями
+// правил репозиториев или 400, если новая конфигурация некорректна.
+func (s *Server) handleAdminReload(w http.ResponseWriter, r *http.Request) {
+	if !s.authorizeAdmin(w, r) {
+		return
+	}
+
+	diff, err := s.ReloadConfig()
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, diff)
+}
+
+// pollRequest - тело запроса POST /admin/poll.
+type pollRequest struct {
+	Repo     string `json:"repo"`
+	PRNumber int64  `json:"pr_number"`
+}
+
+// pollResponse - ответ POST /admin/poll. Job равен null, если задача не найдена.
+type pollResponse struct {
+	Repo     string       `json:"repo"`
+	PRNumber int64        `json:"pr_number"`
+	Job      *jenkins.Job `json:"job"`
+}
+
+// handleAdminPoll обрабатывает запрос на однократный поиск задачи Jenkins для PR (POST /admin/poll).
+// Только читает состояние Jenkins: комментарии не публикуются. Возвращает найденную задачу
+// или null, 404 для ненастроенного репозитория и 502 при ошибке обращения к Jenkins.
+func (s *Server) handleAdminPoll(w http.ResponseWriter, r *http.Request) {
+	if !s.authorizeAdmin(w, r) {
+		return
+	}
+
+	var req pollRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid payload: %v", err)})
+		return
+	}
+	if req.Repo == "" || req.PRNumber <= 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "repo and positive pr_number are required"})
+		return
+	}
+
+	job, err := s.processor.Poll(r.Context(), req.Repo, req.PRNumber)
+	if err != nil {
+		status := http.StatusBadGateway
+		if errors.Is(err, processor.ErrRepositoryNotConfigured) {
+			status = http.StatusNotFound
+		}
+		s.log.Warn("manual poll failed", "err", err, "repo", req.Repo, "pr_number", req.PRNumber)
+		writeJSON(w, status, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, pollResponse{Repo: req.Repo, PRNumber: req.PRNumber, Job: job})
+}
+
+// authorizeAdmin проверяет токен администратора в запросе. Если токен не настроен,
+// административные эндпоинты считаются отключенными и возвращается 404.
+// Возвращает false, если ответ уже отправлен.
+func (s *Server) authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	token := s.cfg.Load().Server.AdminToken
+	if token == "" {
+		http.NotFound(w, r)
+		return false
+	}
+
+	provided := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+		s.log.Warn("unauthorized admin request", "path", r.URL.Path, "remote_addr", r.RemoteAddr)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// writeJSON отправляет ответ с указанным статусом и телом в формате JSON.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// WatchReloadSignals перезагружает конфигурацию через ReloadConfig при каждом сигнале из канала
+// (в сервисе - SIGHUP) до отмены контекста. Ошибки перезагрузки записываются в лог,
+// текущая конфигурация при этом сохраняется.
+func (s *Server) WatchReloadSignals(ctx context.Context, signals <-chan os.Signal) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-signals:
+			s.log.Info("reloading configuration on signal", "signal", sig)
+			// ReloadConfig logs the outcome itself, including load and validation errors.
+			_, _ = s.ReloadConfig()
+		}
+	}
+}
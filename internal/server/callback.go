@@ -0,0 +1,51 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/example/gitea-jenkins-webhook/internal/jenkins"
+)
+
+// callbackResponse - ответ на уведомление Jenkins.
+type callbackResponse struct {
+	Resolved int `json:"resolved"` // Число событий, ожидание которых завершено уведомлением
+}
+
+// handleJenkinsCallback принимает уведомления плагина Jenkins Notification о сборках (POST /jenkins/callback)
+// и завершает ожидание событий правил с wait_mode: callback. Параметр запроса token должен совпадать
+// с server.jenkins_callback_token; без токена уведомления не принимаются (404), иначе любой, кто может
+// обратиться к сервису, подделал бы успешную сборку.
+func (s *Server) handleJenkinsCallback(w http.ResponseWriter, r *http.Request) {
+	token := s.cfg.Load().Server.JenkinsCallbackToken
+	if token == "" {
+		s.log.Warn("jenkins callback received, but server.jenkins_callback_token is not set", "remote_addr", r.RemoteAddr)
+		http.Error(w, "jenkins callback is disabled", http.StatusNotFound)
+		return
+	}
+	provided := r.URL.Query().Get("token")
+	if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+		s.log.Warn("unauthorized jenkins callback", "remote_addr", r.RemoteAddr)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var n jenkins.Notification
+	if err := json.NewDecoder(r.Body).Decode(&n); errors.Is(err, io.EOF) {
+		s.log.Debug("empty jenkins callback body", "remote_addr", r.RemoteAddr)
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "empty request body"})
+		return
+	} else if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid payload: %v", err)})
+		return
+	}
+	if n.Name == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "job name is required"})
+		return
+	}
+	writeJSON(w, http.StatusOK, callbackResponse{Resolved: s.processor.ResolveCallback(n)})
+}
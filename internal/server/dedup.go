@@ -0,0 +1,70 @@
+package server
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// deliveryCache - кеш идентификаторов недавно принятых доставок вебхуков (X-Gitea-Delivery) ограниченного
+// размера: при переполнении вытесняется наиболее давно принятый идентификатор, а записи старше ttl
+// не считаются повтором. Безопасен для одновременного использования.
+type deliveryCache struct {
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	order *list.List               // Записи deliveryEntry от недавно принятых к давним
+	items map[string]*list.Element // Записи по идентификатору доставки
+}
+
+// deliveryEntry - запись кеша доставок.
+type deliveryEntry struct {
+	id       string
+	accepted time.Time
+}
+
+// newDeliveryCache создает кеш не более чем на size идентификаторов доставок со сроком жизни ttl.
+func newDeliveryCache(size int, ttl time.Duration) *deliveryCache {
+	return &deliveryCache{size: size, ttl: ttl, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+// Add запоминает доставку id и сообщает, была ли она уже принята в пределах ttl.
+// Повтор не продлевает срок жизни записи: окно отсчитывается от первого приема.
+func (c *deliveryCache) Add(id string) (seen bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if el, ok := c.items[id]; ok {
+		entry := el.Value.(*deliveryEntry)
+		if now.Sub(entry.accepted) < c.ttl {
+			return true
+		}
+		entry.accepted = now
+		c.order.MoveToFront(el)
+		return false
+	}
+	c.items[id] = c.order.PushFront(&deliveryEntry{id: id, accepted: now})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*deliveryEntry).id)
+	}
+	return false
+}
+
+// Remove забывает доставку id, например если она отклонена и отправитель повторит ее.
+func (c *deliveryCache) Remove(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[id]; ok {
+		c.order.Remove(el)
+		delete(c.items, id)
+	}
+}
+
+// forgetDelivery забывает отклоненную доставку, чтобы ее повтор был принят.
+func (s *Server) forgetDelivery(id string) {
+	if s.deliveries != nil && id != "" {
+		s.deliveries.Remove(id)
+	}
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+
+	"github.com/example/gitea-jenkins-webhook/internal/metrics"
+	"github.com/example/gitea-jenkins-webhook/pkg/webhook"
+)
+
+// accept помещает проверенное событие в промежуточный буфер при server.ack_before_enqueue.
+// Возвращает false, если буфер переполнен.
+func (s *Server) accept(evt webhook.PullRequestEvent) bool {
+	select {
+	case s.intake <- evt:
+		return true
+	default:
+		return false
+	}
+}
+
+// runIntake переносит события из промежуточного буфера в очередь процессора, пока буфер не закрыт.
+// Если очередь процессора переполнена, событие ожидает свободного места: принятое событие не теряется,
+// а ожидание не считается отказом (не учитывается в webhook_queue_full и не комментируется как перегрузка).
+func (s *Server) runIntake() {
+	defer func() {
+		s.intakeRunning.Store(false)
+		close(s.intakeDone)
+	}()
+	for evt := range s.intake {
+		err := s.processor.EnqueueWait(s.intakeCtx, evt)
+		switch {
+		case err == nil:
+			metrics.WebhookEventsEnqueued.Inc()
+		case s.intakeCtx.Err() != nil && evt.WALID != 0:
+			s.log.Warn("shutdown deadline reached, accepted event left in wal for replay",
+				"repo", evt.Repository.FullName,
+				"pr_number", evt.PullRequest.Number,
+				"wal_id", evt.WALID)
+		case s.intakeCtx.Err() != nil:
+			s.log.Error("shutdown deadline reached, accepted event dropped",
+				"repo", evt.Repository.FullName,
+				"pr_number", evt.PullRequest.Number)
+		default:
+			s.log.Error("enqueue accepted event", "err", err,
+				"repo", evt.Repository.FullName,
+				"pr_number", evt.PullRequest.Number)
+		}
+	}
+}
+
+// drainIntake закрывает промежуточный буфер и ожидает, пока все принятые события попадут в очередь процессора.
+// Если ctx завершается раньше, постановка прекращается: оставшиеся события остаются неподтвержденными
+// в журнале предзаписи (server.wal_file) и воспроизводятся при следующем запуске, без журнала - теряются.
+// Вызывается после остановки HTTP-сервера, когда новые события уже не принимаются.
+func (s *Server) drainIntake(ctx context.Context) {
+	if s.intake == nil {
+		return
+	}
+	s.log.Info("draining intake buffer", "pending", len(s.intake))
+	close(s.intake)
+	select {
+	case <-s.intakeDone:
+		return
+	case <-ctx.Done():
+	}
+	s.log.Warn("intake buffer not drained within the shutdown deadline", "pending", len(s.intake))
+	s.stopIntake()
+	<-s.intakeDone
+}
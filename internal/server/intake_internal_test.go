@@ -0,0 +1,92 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/example/gitea-jenkins-webhook/internal/config"
+	"github.com/example/gitea-jenkins-webhook/internal/gitea"
+	"github.com/example/gitea-jenkins-webhook/internal/jenkins"
+	"github.com/example/gitea-jenkins-webhook/internal/processor"
+	"github.com/example/gitea-jenkins-webhook/internal/wal"
+)
+
+func TestStopProcessingHonoursDeadlineWithFullIntake(t *testing.T) {
+	release := make(chan struct{})
+	jenkinsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer jenkinsServer.Close()
+	defer close(release)
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := `
+server:
+  ack_before_enqueue: true
+  worker_pool_size: 1
+  queue_size: 1
+  intake_size: 10
+jenkins:
+  base_url: "https://jenkins.example.com"
+gitea:
+  base_url: "https://gitea.example.com"
+  token: "secret"
+repositories:
+  - name: "org/one"
+    job_pattern: "^one-{{ .Number }}$"
+    timeout: 1m
+`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	log, err := wal.Open(filepath.Join(t.TempDir(), "webhooks.wal"))
+	if err != nil {
+		t.Fatalf("open wal: %v", err)
+	}
+	defer log.Close()
+
+	jClient := jenkins.NewClient(jenkinsServer.URL, "", "", jenkinsServer.Client(), nil)
+	gClient := gitea.NewClient("https://gitea.example.com", "token", nil, nil)
+	s := New(cfg, processor.New(cfg, jClient, gClient, nil), nil)
+	s.SetWAL(log)
+	s.processor.Start()
+	s.intakeRunning.Store(true)
+	go s.runIntake()
+
+	for number := 1; number <= 5; number++ {
+		body := fmt.Sprintf(`{"action":"opened","pull_request":{"number":%d,"title":"t"},"repository":{"full_name":"org/one"}}`, number)
+		req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body))
+		req.Header.Set("X-Gitea-Event", "pull_request")
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, req)
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("expected 202 for PR %d, got %d: %s", number, rec.Code, rec.Body.String())
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	s.stopProcessing(ctx)
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Fatalf("shutdown deadline was not honoured, stopping took %s", elapsed)
+	}
+	// One event is being processed and one is queued; the rest never left the intake buffer.
+	if pending := len(log.Pending()); pending < 3 {
+		t.Fatalf("expected undelivered events to stay in the wal for replay, got %d pending entries", pending)
+	}
+}
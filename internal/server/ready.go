@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	readyCheckTimeout = 2 * time.Second // Ограничение времени проверки одной зависимости
+	readyCacheTTL     = 5 * time.Second // Время, в течение которого результат проверки готовности используется повторно
+)
+
+// Dependency - внешний сервис, доступность которого проверяется эндпоинтом /ready (клиенты Jenkins и Gitea).
+type Dependency interface {
+	CheckAccessibility(ctx context.Context) error
+}
+
+// DependencyFunc позволяет использовать обычную функцию как Dependency.
+type DependencyFunc func(ctx context.Context) error
+
+// CheckAccessibility вызывает f(ctx).
+func (f DependencyFunc) CheckAccessibility(ctx context.Context) error {
+	return f(ctx)
+}
+
+// readyResponse - ответ GET /ready.
+type readyResponse struct {
+	Ready  bool              `json:"ready"`            // Все зависимости доступны
+	Failed []string          `json:"failed"`           // Имена недоступных зависимостей
+	Errors map[string]string `json:"errors,omitempty"` // Ошибки проверки по имени зависимости
+}
+
+// readiness хранит последний результат проверки готовности.
+type readiness struct {
+	mu        sync.Mutex
+	deps      map[string]Dependency
+	result    readyResponse
+	checkedAt time.Time
+}
+
+// SetDependencies задает внешние сервисы, доступность которых проверяет /ready, по имени (например, jenkins и gitea).
+func (s *Server) SetDependencies(deps map[string]Dependency) {
+	s.ready.mu.Lock()
+	defer s.ready.mu.Unlock()
+	s.ready.deps = deps
+	s.ready.checkedAt = time.Time{}
+}
+
+// checkReady проверяет все зависимости параллельно, каждую не дольше readyCheckTimeout.
+// Результат кешируется на readyCacheTTL, чтобы частые пробы балансировщика не нагружали Jenkins и Gitea;
+// одновременные запросы ожидают одной проверки.
+func (s *Server) checkReady(ctx context.Context) readyResponse {
+	s.ready.mu.Lock()
+	defer s.ready.mu.Unlock()
+	if !s.ready.checkedAt.IsZero() && time.Since(s.ready.checkedAt) < readyCacheTTL {
+		return s.ready.result
+	}
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		failures = make(map[string]string)
+	)
+	for name, dep := range s.ready.deps {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, readyCheckTimeout)
+			defer cancel()
+			if err := dep.CheckAccessibility(checkCtx); err != nil {
+				mu.Lock()
+				failures[name] = err.Error()
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	res := readyResponse{Ready: len(failures) == 0, Failed: []string{}}
+	for name := range failures {
+		res.Failed = append(res.Failed, name)
+	}
+	sort.Strings(res.Failed)
+	if len(failures) > 0 {
+		res.Errors = failures
+		s.log.Warn("readiness check failed", "failed", res.Failed)
+	}
+	s.ready.result, s.ready.checkedAt = res, time.Now()
+	return res
+}
+
+// handleReady обрабатывает проверку готовности (GET /ready): возвращает 200, если все зависимости
+// доступны, иначе 503 со списком недоступных. Во время завершения работы всегда возвращает 503.
+// /health при этом остается проверкой жизнеспособности и зависимости не опрашивает.
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	if s.shuttingDown.Load() {
+		writeJSON(w, http.StatusServiceUnavailable, readyResponse{Failed: []string{}, Errors: map[string]string{"server": "shutting down"}})
+		return
+	}
+	res := s.checkReady(r.Context())
+	status := http.StatusOK
+	if !res.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, res)
+}
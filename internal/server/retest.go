@@ -0,0 +1,35 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/example/gitea-jenkins-webhook/internal/config"
+	"github.com/example/gitea-jenkins-webhook/pkg/webhook"
+)
+
+// retestIgnoreReason возвращает причину, по которой комментарий события issue_comment не запускает
+// повторную проверку PR, или пустую строку, если комментарий содержит retest_command правила
+// репозитория от пользователя из retest_allowed_users. Комментарии самого сервиса (gitea.bot_user)
+// игнорируются, чтобы шаблон, повторяющий команду, не запускал проверку по кругу. Прочие комментарии
+// не ставятся в очередь, чтобы не вытеснять события того же PR при дедупликации.
+func retestIgnoreReason(cfg *config.Config, c webhook.IssueCommentEvent) string {
+	rule, ok := cfg.GetRepositoryRule(c.Repository.FullName)
+	switch {
+	case !ok:
+		return "repository not configured"
+	case !rule.HandlesEvent(config.EventIssueComment):
+		return fmt.Sprintf("event %q is not in the configured events", config.EventIssueComment)
+	case c.Action != "created":
+		return fmt.Sprintf("comment action %q", c.Action)
+	case !c.IsPullRequest():
+		return "comment is not on a pull request"
+	case cfg.Gitea.BotUser != "" && strings.EqualFold(c.Author(), cfg.Gitea.BotUser):
+		return "comment was posted by the service itself"
+	case !c.HasCommand(rule.RetestCommand):
+		return fmt.Sprintf("comment has no %s command", rule.RetestCommand)
+	case !rule.AllowsRetest(c.Author()):
+		return fmt.Sprintf("user %q may not request a retest", c.Author())
+	}
+	return ""
+}
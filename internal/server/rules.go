@@ -0,0 +1,63 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/example/gitea-jenkins-webhook/internal/config"
+)
+
+// ApplyRules валидирует правила репозиториев и, если они отличаются от текущих, атомарно
+// заменяет ими правила в сервере и процессоре. Остальные настройки не меняются.
+// При ошибке валидации текущая конфигурация остается без изменений.
+func (s *Server) ApplyRules(rules []config.RepositoryRule) (config.RepoDiff, error) {
+	s.cfgMu.Lock()
+	defer s.cfgMu.Unlock()
+	prev := s.cfg.Load()
+	next, err := prev.WithRules(rules)
+	if err != nil {
+		return config.RepoDiff{}, err
+	}
+
+	diff := config.Diff(prev, next)
+	if len(diff.Added) == 0 && len(diff.Removed) == 0 && len(diff.Changed) == 0 {
+		return diff, nil
+	}
+
+	s.cfg.Store(next)
+	s.processor.SetConfig(next)
+	s.log.Info("repository rules updated",
+		"added", diff.Added,
+		"removed", diff.Removed,
+		"changed", diff.Changed)
+	return diff, nil
+}
+
+// WatchRules периодически запрашивает правила у источника и применяет их через ApplyRules
+// до отмены контекста. Ошибки получения и валидации правил записываются в лог,
+// текущие правила при этом сохраняются.
+func (s *Server) WatchRules(ctx context.Context, src config.RuleSource, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.refreshRules(ctx, src)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refreshRules выполняет одно обновление правил из источника.
+func (s *Server) refreshRules(ctx context.Context, src config.RuleSource) {
+	rules, err := src.Rules(ctx)
+	if err != nil {
+		s.log.Error("failed to fetch repository rules, keeping current rules", "err", err)
+		return
+	}
+	if _, err := s.ApplyRules(rules); err != nil {
+		s.log.Error("fetched repository rules are invalid, keeping current rules", "err", err)
+	}
+}
@@ -0,0 +1,71 @@
+package server_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/example/gitea-jenkins-webhook/internal/config"
+)
+
+func TestWatchRulesAppliesUpdatedRules(t *testing.T) {
+	var version atomic.Int32
+	version.Store(1)
+	rulesServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer rules-token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch version.Load() {
+		case 1:
+			_, _ = w.Write([]byte(`[{"name":"org/remote","job_pattern":"^remote-{{ .Number }}$","timeout":"2m"}]`))
+		case 2:
+			// Invalid rules must not replace the current ones.
+			_, _ = w.Write([]byte(`[{"name":"org/broken","job_pattern":"^broken-{{ .Number }}$","comment_kind":"unknown"}]`))
+		default:
+			_, _ = w.Write([]byte(`[{"name":"org/updated","job_pattern":"^updated-{{ .Number }}$"}]`))
+		}
+	}))
+	defer rulesServer.Close()
+
+	srv, proc := newTestServer(t, writeConfig(t, baseConfig))
+	source := config.NewHTTPRuleSource(rulesServer.URL, "rules-token", rulesServer.Client())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.WatchRules(ctx, source, 10*time.Millisecond)
+
+	waitForRule(t, proc.Config, "org/remote")
+	rule, _ := proc.Config().GetRepositoryRule("org/remote")
+	if rule.Timeout != 2*time.Minute {
+		t.Fatalf("expected timeout from remote rule, got %s", rule.Timeout)
+	}
+	if _, ok := proc.Config().GetRepositoryRule("org/one"); ok {
+		t.Fatalf("file rules must be replaced by remote rules")
+	}
+
+	version.Store(2)
+	time.Sleep(50 * time.Millisecond)
+	if _, ok := proc.Config().GetRepositoryRule("org/remote"); !ok {
+		t.Fatalf("invalid remote rules replaced the current ones")
+	}
+
+	version.Store(3)
+	waitForRule(t, proc.Config, "org/updated")
+}
+
+func waitForRule(t *testing.T, cfg func() *config.Config, name string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, ok := cfg().GetRepositoryRule(name); ok {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("rule %s was not applied", name)
+}
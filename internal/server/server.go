@@ -7,67 +7,122 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/example/gitea-jenkins-webhook/internal/config"
+	"github.com/example/gitea-jenkins-webhook/internal/metrics"
 	"github.com/example/gitea-jenkins-webhook/internal/processor"
+	"github.com/example/gitea-jenkins-webhook/internal/wal"
 	"github.com/example/gitea-jenkins-webhook/pkg/webhook"
 )
 
 const (
-	headerEvent     = "X-Gitea-Event"     // HTTP-заголовок с типом события Gitea
-	headerSignature = "X-Gitea-Signature" // HTTP-заголовок с подписью вебхука
+	headerEvent       = "X-Gitea-Event"     // HTTP-заголовок с типом события Gitea
+	headerSignature   = "X-Gitea-Signature" // HTTP-заголовок с подписью вебхука
+	headerTraceParent = "traceparent"       // HTTP-заголовок W3C Trace Context
+	headerDelivery    = "X-Gitea-Delivery"  // HTTP-заголовок с идентификатором доставки вебхука
+
+	headerGitHubEvent     = "X-GitHub-Event"      // HTTP-заголовок с типом события GitHub
+	headerGitHubSignature = "X-Hub-Signature-256" // HTTP-заголовок с подписью вебхука GitHub
+	headerGitHubDelivery  = "X-GitHub-Delivery"   // HTTP-заголовок с идентификатором доставки вебхука GitHub
 )
 
+// shutdownTimeout - общий срок завершения HTTP-сервера и обработки событий процессором после сигнала остановки.
+const shutdownTimeout = 10 * time.Second
+
 // Server представляет HTTP-сервер для обработки вебхуков от Gitea.
 type Server struct {
-	cfg       *config.Config
-	processor *processor.Processor
-	server    *http.Server
-	log       *slog.Logger
+	cfg          atomic.Pointer[config.Config]
+	cfgMu        sync.Mutex // Сериализует замену конфигурации (ReloadConfig, ApplyRules)
+	processor    *processor.Processor
+	server       *http.Server
+	log          *slog.Logger
+	shuttingDown atomic.Bool
+
+	intake        chan webhook.PullRequestEvent // Промежуточный буфер событий при server.ack_before_enqueue
+	intakeDone    chan struct{}                 // Закрывается, когда буфер опустошен после закрытия
+	intakeRunning atomic.Bool                   // Горутина буфера приема работает
+	intakeCtx     context.Context               // Отменяется, когда срок завершения истек до опустошения буфера
+	stopIntake    context.CancelFunc
+
+	ready      readiness      // Зависимости и кешированный результат проверки /ready
+	wal        *wal.Log       // Журнал предзаписи принятых вебхуков (nil - отключен)
+	deliveries *deliveryCache // Недавно принятые доставки вебхуков (nil - отключено)
 }
 
 // New создает новый HTTP-сервер с указанной конфигурацией и процессором событий.
 // Если logger равен nil, используется логгер по умолчанию.
-// Регистрирует обработчики для /health и /webhook.
+// Регистрирует обработчики для /health, /status, /metrics, /webhook, /jenkins/callback и /admin/*.
 func New(cfg *config.Config, proc *processor.Processor, logger *slog.Logger) *Server {
 	if logger == nil {
 		logger = slog.Default()
 	}
 	mux := http.NewServeMux()
 	s := &Server{
-		cfg:       cfg,
 		processor: proc,
 		log:       logger,
 	}
+	s.cfg.Store(cfg)
+	if cfg.Server.AckBeforeEnqueue {
+		size := cfg.Server.IntakeSize
+		if size == 0 {
+			size = cfg.Server.QueueSize
+		}
+		s.intake = make(chan webhook.PullRequestEvent, size)
+		s.intakeDone = make(chan struct{})
+		s.intakeCtx, s.stopIntake = context.WithCancel(context.Background())
+	}
+	if cfg.Server.DedupCacheSize > 0 {
+		s.deliveries = newDeliveryCache(cfg.Server.DedupCacheSize, cfg.Server.DedupTTL)
+	}
 	mux.HandleFunc("GET /health", s.handleHealth)
+	mux.HandleFunc("GET /ready", s.handleReady)
+	mux.HandleFunc("GET /metrics", s.handleMetrics)
+	mux.HandleFunc("GET /status", s.handleStatus)
 	mux.HandleFunc("POST /webhook", s.handleWebhook)
+	mux.HandleFunc("POST /admin/reload", s.handleAdminReload)
+	mux.HandleFunc("POST /admin/poll", s.handleAdminPoll)
+	mux.HandleFunc("POST /jenkins/callback", s.handleJenkinsCallback)
 
 	s.server = &http.Server{
 		Addr:              cfg.Server.ListenAddr,
 		Handler:           mux,
 		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
 	}
 	return s
 }
 
+// Handler возвращает HTTP-обработчик сервера со всеми зарегистрированными маршрутами.
+func (s *Server) Handler() http.Handler {
+	return s.server.Handler
+}
+
 // Run запускает HTTP-сервер и обрабатывает сигналы завершения для корректного завершения работы.
-// Запускает процессор перед стартом сервера и останавливает его при завершении.
+// Запускает процессор перед стартом сервера и останавливает его при завершении: события, не обработанные
+// за оставшуюся часть срока завершения shutdownTimeout, отменяются.
+// При server.ack_before_enqueue события из промежуточного буфера ставятся в очередь до остановки процессора.
+// Неподтвержденные записи журнала предзаписи воспроизводятся в фоне, не задерживая запуск HTTP-сервера;
+// при завершении воспроизведение прекращается до остановки процессора.
 // Возвращает ошибку, если произошла ошибка при запуске или завершении сервера.
 func (s *Server) Run(ctx context.Context) error {
 	s.log.Info("starting processor")
 	s.processor.Start()
-	defer func() {
-		s.log.Info("stopping processor")
-		s.processor.Stop()
-	}()
+	if s.intake != nil {
+		s.intakeRunning.Store(true)
+		go s.runIntake()
+	}
 
 	errCh := make(chan error, 1)
 	go func() {
@@ -78,105 +133,307 @@ func (s *Server) Run(ctx context.Context) error {
 		}
 	}()
 
+	// Replay can wait for queue space for as long as workers poll Jenkins, so it must not hold up the listener.
+	replayCtx, stopReplay := context.WithCancel(ctx)
+	defer stopReplay()
+	replayDone := make(chan struct{})
+	go func() {
+		defer close(replayDone)
+		s.replayWAL(replayCtx)
+	}()
+
 	select {
 	case <-ctx.Done():
+		<-replayDone
+		s.BeginShutdown()
+		if delay := s.cfg.Load().Server.ShutdownDelay; delay > 0 {
+			s.log.Info("draining before shutdown, health checks report unavailable", "delay", delay)
+			time.Sleep(delay)
+		}
 		s.log.Info("shutting down HTTP server", "reason", ctx.Err())
-		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		// The shutdown budget is shared by the HTTP server and the processor: the processor gets what is left of it.
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
 		defer cancel()
-		if err := s.server.Shutdown(shutdownCtx); err != nil {
+		err := s.server.Shutdown(shutdownCtx)
+		s.stopProcessing(shutdownCtx)
+		if err != nil {
 			s.log.Error("server shutdown error", "err", err)
 			return fmt.Errorf("server shutdown: %w", err)
 		}
 		s.log.Info("HTTP server shut down successfully")
 		return nil
 	case err := <-errCh:
+		stopReplay()
+		<-replayDone
+		s.stopProcessing(context.Background())
 		return err
 	}
 }
 
+// stopProcessing ставит в очередь события промежуточного буфера (при server.ack_before_enqueue)
+// и останавливает процессор; по завершении ctx постановка прекращается, а необработанные события отменяются.
+func (s *Server) stopProcessing(ctx context.Context) {
+	if s.intake != nil {
+		s.drainIntake(ctx)
+	}
+	s.log.Info("stopping processor")
+	if err := s.processor.StopWithContext(ctx); err != nil {
+		s.log.Warn("processor did not drain within the shutdown deadline", "err", err)
+	}
+}
+
+// BeginShutdown отмечает начало завершения работы: с этого момента /health возвращает 503,
+// чтобы балансировщик перестал направлять трафик на экземпляр.
+func (s *Server) BeginShutdown() {
+	s.shuttingDown.Store(true)
+}
+
 // handleHealth обрабатывает запросы проверки здоровья сервиса (GET /health).
-// Всегда возвращает статус 200 OK с телом "ok".
+// Возвращает статус 200 OK с телом "ok" или 503, если началось завершение работы.
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	s.log.Debug("health check request",
 		"method", r.Method,
 		"remote_addr", r.RemoteAddr,
 		"user_agent", r.UserAgent())
 	s.log.Debug("health check request headers", "headers", r.Header)
+	if s.shuttingDown.Load() {
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		s.log.Debug("health check response sent", "status", http.StatusServiceUnavailable)
+		return
+	}
 	w.WriteHeader(http.StatusOK)
 	_, _ = w.Write([]byte("ok"))
 	s.log.Debug("health check response sent", "status", http.StatusOK)
 }
 
+// statusResponse - состояние сервиса для GET /status.
+type statusResponse struct {
+	Goroutines        int `json:"goroutines"`         // Горутины сервиса: воркеры, фоновые задачи процессора и буфер приема
+	MaxGoroutines     int `json:"max_goroutines"`     // Предел фоновых горутин процессора (0 - без ограничения)
+	RuntimeGoroutines int `json:"runtime_goroutines"` // Все горутины процесса, включая HTTP-соединения
+}
+
+// handleStatus отдает JSON с числом горутин, запущенных сервисом (GET /status).
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	goroutines := s.processor.Goroutines()
+	if s.intakeRunning.Load() {
+		goroutines++
+	}
+	writeJSON(w, http.StatusOK, statusResponse{
+		Goroutines:        goroutines,
+		MaxGoroutines:     s.cfg.Load().Server.MaxGoroutines,
+		RuntimeGoroutines: runtime.NumGoroutine(),
+	})
+}
+
+// handleMetrics отдает метрики сервиса в текстовом формате Prometheus (GET /metrics).
+// Если server.metrics_enabled выключен, отвечает 404.
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if !s.cfg.Load().Server.MetricsEnabled {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := metrics.WriteAll(w); err != nil {
+		s.log.Warn("write metrics", "err", err)
+	}
+}
+
 // handleWebhook обрабатывает вебхуки от Gitea (POST /webhook).
 // Проверяет тип события, валидирует подпись (если настроен секрет),
 // декодирует payload и добавляет событие в очередь обработки.
 func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
-	s.log.Info("webhook request received",
+	event := r.Header.Get(headerEvent)
+	signatureHeader, deliveryHeader := headerSignature, headerDelivery
+	github := false
+	if event == "" && s.cfg.Load().Server.GitHubCompat && r.Header.Get(headerGitHubEvent) != "" {
+		event = r.Header.Get(headerGitHubEvent)
+		signatureHeader, deliveryHeader = headerGitHubSignature, headerGitHubDelivery
+		github = true
+	}
+	deliveryID := r.Header.Get(deliveryHeader)
+	log := s.log.With("delivery_id", deliveryID)
+	log.Info("webhook request received",
 		"method", r.Method,
 		"remote_addr", r.RemoteAddr,
 		"user_agent", r.UserAgent())
-	s.log.Debug("webhook request headers", "headers", r.Header)
-
-	event := r.Header.Get(headerEvent)
-	s.log.Debug("webhook event type", "event", event)
-	if event != "pull_request" {
-		s.log.Info("unsupported gitea event", "event", event)
+	log.Debug("webhook request headers", "headers", r.Header)
+	log.Debug("webhook event type", "event", event, "github", github)
+	if event != "pull_request" && ((event != "push" && event != "issue_comment") || github) {
+		// Ping and other events need no processing: answer once, without a body.
+		if event == "ping" {
+			log.Info("gitea ping received")
+		} else {
+			log.Info("unsupported gitea event", "event", event)
+		}
 		w.WriteHeader(http.StatusNoContent)
-		http.Error(w, "failed to read body", http.StatusBadRequest)
 		return
 	}
 
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		s.log.Error("read webhook body", "err", err)
+		log.Error("read webhook body", "err", err)
 		http.Error(w, "failed to read body", http.StatusBadRequest)
 		return
 	}
 	defer r.Body.Close()
 
-	s.log.Debug("webhook request body", "body", string(body), "size_bytes", len(body))
+	log.Debug("webhook request body", "body", string(body), "size_bytes", len(body))
+	if len(bytes.TrimSpace(body)) == 0 {
+		log.Debug("empty webhook body", "event", event, "remote_addr", r.RemoteAddr)
+		http.Error(w, "empty request body", http.StatusBadRequest)
+		return
+	}
 
-	if s.cfg.Server.WebhookSecret != "" {
-		signature := r.Header.Get(headerSignature)
-		s.log.Debug("verifying webhook signature", "signature_header", signature)
-		if err := verifySignature(body, signature, s.cfg.Server.WebhookSecret); err != nil {
-			s.log.Warn("invalid webhook signature", "err", err)
+	if secret := s.cfg.Load().Server.WebhookSecret; secret != "" {
+		signature := r.Header.Get(signatureHeader)
+		log.Debug("verifying webhook signature", "signature_header", signature)
+		if err := verifySignature(body, signature, secret); err != nil {
+			log.Warn("invalid webhook signature", "err", err)
 			http.Error(w, "invalid signature", http.StatusUnauthorized)
 			return
 		}
-		s.log.Debug("webhook signature verified successfully")
+		log.Debug("webhook signature verified successfully")
 	} else {
-		s.log.Debug("webhook secret not configured, skipping signature verification")
+		log.Debug("webhook secret not configured, skipping signature verification")
+	}
+
+	// Gitea redelivers with the same ID: a delivery accepted within the window is acknowledged, not enqueued again.
+	// A delivery rejected below is forgotten so that its redelivery is processed.
+	if s.deliveries != nil && deliveryID != "" {
+		if s.deliveries.Add(deliveryID) {
+			log.Info("duplicate webhook delivery, ignoring", "event", event)
+			metrics.DuplicateDeliveries.Inc()
+			w.WriteHeader(http.StatusOK)
+			return
+		}
 	}
 
-	var prEvent webhook.PullRequestEvent
-	if err := json.NewDecoder(bytes.NewReader(body)).Decode(&prEvent); err != nil {
-		s.log.Error("decode webhook payload", "err", err)
+	prEvent, variant, err := decodeEvent(event, body, github)
+	if err != nil {
+		log.Error("decode webhook payload", "err", err)
+		s.forgetDelivery(deliveryID)
 		http.Error(w, "invalid payload", http.StatusBadRequest)
 		return
 	}
+	log.Debug("webhook payload variant detected", "variant", variant)
+	if prEvent.IsRetest() {
+		if reason := retestIgnoreReason(s.cfg.Load(), *prEvent.Comment); reason != "" {
+			log.Debug("issue comment does not request a retest, ignoring",
+				"repo", prEvent.Repository.FullName,
+				"pr_number", prEvent.PullRequest.Number,
+				"reason", reason)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
 	prEvent.Timestamp = time.Now()
+	prEvent.TraceID = parseTraceID(r.Header.Get(headerTraceParent))
+	prEvent.DeliveryID = deliveryID
+
+	prEvent.PullRequest.Number = prEvent.PRNumber()
+	if prEvent.PullRequest.Number == 0 && !prEvent.IsPush() {
+		switch s.cfg.Load().Server.ZeroPRNumber {
+		case config.ZeroPRNumberSkip:
+			log.Info("webhook event has no pull request number, skipping", "repo", prEvent.Repository.FullName)
+			w.WriteHeader(http.StatusAccepted)
+			return
+		case config.ZeroPRNumberSynthetic:
+			prEvent.PullRequest.Number = prEvent.SyntheticNumber()
+			log.Warn("webhook event has no pull request number, using synthetic index",
+				"repo", prEvent.Repository.FullName,
+				"index", prEvent.PullRequest.Number)
+		default:
+			log.Warn("webhook event has no pull request number", "repo", prEvent.Repository.FullName)
+			s.forgetDelivery(deliveryID)
+			http.Error(w, "missing pull request number", http.StatusBadRequest)
+			return
+		}
+	}
 
-	s.log.Info("webhook payload decoded",
+	s.appendWAL(&prEvent, walRecord{
+		Event:      event,
+		GitHub:     github,
+		Body:       body,
+		TraceID:    prEvent.TraceID,
+		DeliveryID: prEvent.DeliveryID,
+		ReceivedAt: prEvent.Timestamp,
+	})
+
+	metrics.WebhookEventsReceived.Inc(prEvent.Action)
+	if !prEvent.KnownAction() {
+		// New Gitea versions may add actions; count them to see which ones are worth supporting.
+		metrics.WebhookUnknownActions.Inc(prEvent.Action)
+		log.Debug("webhook has an unknown pull request action",
+			"action", prEvent.Action,
+			"repo", prEvent.Repository.FullName,
+			"pr_number", prEvent.PullRequest.Number)
+	}
+	log.Info("webhook payload decoded",
 		"action", prEvent.Action,
 		"repo", prEvent.Repository.FullName,
 		"pr_number", prEvent.PullRequest.Number,
 		"sender", prEvent.Sender.Login)
-	s.log.Debug("webhook event details",
+	log.Debug("webhook event details",
 		"event", prEvent,
 		"timestamp", prEvent.Timestamp)
 
+	if s.intake != nil {
+		if !s.accept(prEvent) {
+			log.Error("intake buffer is full",
+				"repo", prEvent.Repository.FullName,
+				"pr_number", prEvent.PullRequest.Number,
+				"intake_size", cap(s.intake))
+			// The sender is told to retry, so the rejected delivery must not be replayed as well.
+			s.ackWAL(prEvent)
+			s.forgetDelivery(deliveryID)
+			http.Error(w, "service unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		log.Info("webhook event accepted",
+			"repo", prEvent.Repository.FullName,
+			"pr_number", prEvent.PullRequest.Number)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
 	if err := s.processor.Enqueue(prEvent); err != nil {
-		s.log.Error("enqueue event", "err", err)
+		log.Error("enqueue event", "err", err)
+		s.ackWAL(prEvent)
+		s.forgetDelivery(deliveryID)
+		if errors.Is(err, processor.ErrQueueFull) {
+			metrics.WebhookQueueFull.Inc()
+		}
 		http.Error(w, "service unavailable", http.StatusServiceUnavailable)
 		return
 	}
 
-	s.log.Info("webhook event enqueued successfully",
+	metrics.WebhookEventsEnqueued.Inc()
+	log.Info("webhook event enqueued successfully",
 		"repo", prEvent.Repository.FullName,
 		"pr_number", prEvent.PullRequest.Number)
 	w.WriteHeader(http.StatusAccepted)
-	s.log.Debug("webhook response sent", "status", http.StatusAccepted)
+	log.Debug("webhook response sent", "status", http.StatusAccepted)
+}
+
+// decodeEvent разбирает тело события pull_request в формате Gitea или, если github равен true, GitHub.
+// Событие push от Gitea преобразуется в PullRequestEvent с действием "push",
+// а комментарий (issue_comment) - в PullRequestEvent с действием "retest".
+// Вместе с событием возвращает обнаруженный вариант формата для журнала.
+func decodeEvent(event string, body []byte, github bool) (webhook.PullRequestEvent, string, error) {
+	if event == "push" {
+		push, err := webhook.DecodePushEvent(body)
+		return push.AsPullRequestEvent(), "push", err
+	}
+	if event == "issue_comment" {
+		comment, err := webhook.DecodeIssueCommentEvent(body)
+		return comment.AsPullRequestEvent(), "issue_comment", err
+	}
+	if github {
+		evt, err := webhook.DecodeGitHubPullRequest(body)
+		return evt, "github", err
+	}
+	return webhook.DecodeGiteaPullRequest(body)
 }
 
 // verifySignature проверяет подпись вебхука от Gitea.
@@ -209,3 +466,16 @@ func normalizeSignature(sig string) string {
 	}
 	return s
 }
+
+// parseTraceID извлекает trace ID из значения заголовка traceparent
+// (формат "версия-traceid-spanid-флаги"). Возвращает пустую строку, если заголовок некорректен.
+func parseTraceID(traceparent string) string {
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 || len(parts[1]) != 32 {
+		return ""
+	}
+	if _, err := hex.DecodeString(parts[1]); err != nil || parts[1] == strings.Repeat("0", 32) {
+		return ""
+	}
+	return parts[1]
+}
@@ -0,0 +1,880 @@
+package server_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/example/gitea-jenkins-webhook/internal/config"
+	"github.com/example/gitea-jenkins-webhook/internal/gitea"
+	"github.com/example/gitea-jenkins-webhook/internal/jenkins"
+	"github.com/example/gitea-jenkins-webhook/internal/metrics"
+	"github.com/example/gitea-jenkins-webhook/internal/processor"
+	"github.com/example/gitea-jenkins-webhook/internal/server"
+	"github.com/example/gitea-jenkins-webhook/internal/wal"
+)
+
+const baseConfig = `
+server:
+  admin_token: "admin"
+jenkins:
+  base_url: "https://jenkins.example.com"
+gitea:
+  base_url: "https://gitea.example.com"
+  token: "secret"
+repositories:
+  - name: "org/one"
+    job_pattern: "^one-{{ .Number }}$"
+  - name: "org/two"
+    job_pattern: "^two-{{ .Number }}$"
+`
+
+func TestAdminReloadAppliesNewRules(t *testing.T) {
+	path := writeConfig(t, baseConfig)
+	srv, proc := newTestServer(t, path)
+
+	writeConfig(t, `
+server:
+  admin_token: "admin"
+  queue_size: 5
+jenkins:
+  base_url: "https://jenkins.example.com"
+gitea:
+  base_url: "https://gitea.example.com"
+  token: "secret"
+repositories:
+  - name: "org/one"
+    job_pattern: "^one-changed-{{ .Number }}$"
+  - name: "org/three"
+    job_pattern: "^three-{{ .Number }}$"
+`, path)
+
+	rec := doReload(srv, "admin")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var diff config.RepoDiff
+	if err := json.NewDecoder(rec.Body).Decode(&diff); err != nil {
+		t.Fatalf("decode diff: %v", err)
+	}
+	if len(diff.Added) != 1 || diff.Added[0] != "org/three" {
+		t.Fatalf("unexpected added: %v", diff.Added)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0] != "org/two" {
+		t.Fatalf("unexpected removed: %v", diff.Removed)
+	}
+	if len(diff.Changed) != 1 || diff.Changed[0] != "org/one" {
+		t.Fatalf("unexpected changed: %v", diff.Changed)
+	}
+	if len(diff.Ignored) != 1 || diff.Ignored[0] != "server.queue_size" {
+		t.Fatalf("unexpected ignored: %v", diff.Ignored)
+	}
+
+	rule, ok := proc.Config().GetRepositoryRule("org/one")
+	if !ok || rule.JobPattern != "^one-changed-{{ .Number }}$" {
+		t.Fatalf("processor did not receive new rule: %#v", rule)
+	}
+	if _, ok := proc.Config().GetRepositoryRule("org/two"); ok {
+		t.Fatalf("removed rule is still present")
+	}
+}
+
+func TestReloadSignalAppliesNewRules(t *testing.T) {
+	path := writeConfig(t, baseConfig)
+	srv, proc := newTestServer(t, path)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		srv.WatchReloadSignals(ctx, signals)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	writeConfig(t, `
+server:
+  admin_token: "admin"
+jenkins:
+  base_url: "https://jenkins.example.com"
+gitea:
+  base_url: "https://gitea.example.com"
+  token: "secret"
+repositories:
+  - name: "org/one"
+    job_pattern: "^one-reloaded-{{ .Number }}$"
+`, path)
+	signals <- syscall.SIGHUP
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		rule, ok := proc.Config().GetRepositoryRule("org/one")
+		if ok && rule.JobPattern == "^one-reloaded-{{ .Number }}$" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("processor did not receive reloaded rule: %#v", rule)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, ok := proc.Config().GetRepositoryRule("org/two"); ok {
+		t.Fatalf("removed rule is still present")
+	}
+}
+
+func TestAdminReloadInvalidConfigKeepsOld(t *testing.T) {
+	path := writeConfig(t, baseConfig)
+	srv, proc := newTestServer(t, path)
+
+	writeConfig(t, "repositories: [", path)
+
+	rec := doReload(srv, "admin")
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+	if _, ok := proc.Config().GetRepositoryRule("org/two"); !ok {
+		t.Fatalf("expected old configuration to be kept")
+	}
+}
+
+func TestAdminReloadRequiresToken(t *testing.T) {
+	path := writeConfig(t, baseConfig)
+	srv, _ := newTestServer(t, path)
+
+	if rec := doReload(srv, "wrong"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", rec.Code)
+	}
+}
+
+func TestWebhookZeroPRNumber(t *testing.T) {
+	tests := []struct {
+		policy string
+		want   int
+	}{
+		{"", http.StatusBadRequest},
+		{"reject", http.StatusBadRequest},
+		{"skip", http.StatusAccepted},
+	}
+
+	for _, tt := range tests {
+		t.Run("policy "+tt.policy, func(t *testing.T) {
+			path := writeConfig(t, strings.Replace(baseConfig, "server:\n", "server:\n  zero_pr_number: \""+tt.policy+"\"\n", 1))
+			srv, _ := newTestServer(t, path)
+
+			rec := postWebhook(srv, "pull_request", `{"action":"opened","pull_request":{"title":"t"},"repository":{"full_name":"org/one"}}`)
+			if rec.Code != tt.want {
+				t.Fatalf("expected %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
+
+func TestWebhookEmptyBody(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{name: "empty", body: "", want: "empty request body"},
+		{name: "whitespace", body: " \n", want: "empty request body"},
+		{name: "malformed", body: "{", want: "invalid payload"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, _ := newTestServer(t, writeConfig(t, strings.Replace(baseConfig, "server:\n", "server:\n  webhook_secret: \"hook-secret\"\n", 1)))
+			req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(tt.body))
+			req.Header.Set("X-Gitea-Event", "pull_request")
+			if strings.TrimSpace(tt.body) != "" {
+				mac := hmac.New(sha256.New, []byte("hook-secret"))
+				mac.Write([]byte(tt.body))
+				req.Header.Set("X-Gitea-Signature", hex.EncodeToString(mac.Sum(nil)))
+			}
+			rec := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), tt.want) {
+				t.Fatalf("expected 400 %q, got %d: %s", tt.want, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestAdminPoll(t *testing.T) {
+	jenkinsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"jobs":[{"name":"one-5","url":"https://jenkins.example.com/job/one-5/","fullName":"one-5","color":"blue"}]}`))
+	}))
+	defer jenkinsServer.Close()
+
+	path := writeConfig(t, baseConfig)
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	jClient := jenkins.NewClient(jenkinsServer.URL, "", "", jenkinsServer.Client(), nil)
+	srv := server.New(cfg, processor.New(cfg, jClient, nil, nil), nil)
+
+	tests := []struct {
+		name    string
+		body    string
+		want    int
+		wantJob string
+	}{
+		{name: "match", body: `{"repo":"org/one","pr_number":5}`, want: http.StatusOK, wantJob: "one-5"},
+		{name: "no match", body: `{"repo":"org/one","pr_number":6}`, want: http.StatusOK},
+		{name: "unknown repo", body: `{"repo":"org/unknown","pr_number":5}`, want: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/admin/poll", strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer admin")
+			rec := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("expected %d, got %d: %s", tt.want, rec.Code, rec.Body.String())
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+			var resp struct {
+				Job *jenkins.Job `json:"job"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			switch {
+			case tt.wantJob == "" && resp.Job != nil:
+				t.Fatalf("expected no job, got %#v", resp.Job)
+			case tt.wantJob != "" && (resp.Job == nil || resp.Job.Name != tt.wantJob):
+				t.Fatalf("expected job %s, got %#v", tt.wantJob, resp.Job)
+			}
+		})
+	}
+}
+
+func TestHealthReportsUnavailableDuringShutdown(t *testing.T) {
+	srv, _ := newTestServer(t, writeConfig(t, baseConfig))
+
+	health := func() int {
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+		return rec.Code
+	}
+
+	if code := health(); code != http.StatusOK {
+		t.Fatalf("expected 200 before shutdown, got %d", code)
+	}
+	srv.BeginShutdown()
+	if code := health(); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 after shutdown began, got %d", code)
+	}
+}
+
+func TestStatusReportsGoroutines(t *testing.T) {
+	srv, proc := newTestServer(t, writeConfig(t, strings.Replace(baseConfig, "server:\n", "server:\n  worker_pool_size: 3\n  max_goroutines: 8\n", 1)))
+	proc.Start()
+	defer proc.Stop()
+
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var status struct {
+		Goroutines        int `json:"goroutines"`
+		MaxGoroutines     int `json:"max_goroutines"`
+		RuntimeGoroutines int `json:"runtime_goroutines"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+		t.Fatalf("decode status: %v", err)
+	}
+	if status.Goroutines != 3 || status.MaxGoroutines != 8 || status.RuntimeGoroutines < status.Goroutines {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	scrape := func(srv *server.Server) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		return rec
+	}
+
+	disabled, _ := newTestServer(t, writeConfig(t, baseConfig))
+	if rec := scrape(disabled); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 with metrics disabled, got %d", rec.Code)
+	}
+
+	srv, proc := newTestServer(t, writeConfig(t, strings.Replace(baseConfig, "server:\n", "server:\n  metrics_enabled: true\n", 1)))
+	proc.Start()
+	defer proc.Stop()
+
+	received := metrics.WebhookEventsReceived.Value("edited")
+	enqueued := metrics.WebhookEventsEnqueued.Value()
+	rec := postWebhook(srv, "pull_request", `{"action":"edited","pull_request":{"number":5,"title":"t"},"repository":{"full_name":"org/unknown"}}`)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := metrics.WebhookEventsReceived.Value("edited") - received; got != 1 {
+		t.Fatalf("expected 1 received event, got %d", got)
+	}
+	if got := metrics.WebhookEventsEnqueued.Value() - enqueued; got != 1 {
+		t.Fatalf("expected 1 enqueued event, got %d", got)
+	}
+
+	rec = scrape(srv)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	for _, want := range []string{
+		fmt.Sprintf("webhook_events_received_total{action=\"edited\"} %d\n", received+1),
+		"# TYPE webhook_events_enqueued counter\n",
+		"# TYPE webhook_queue_full counter\n",
+		"# TYPE jenkins_poll_attempts counter\n",
+		"# TYPE jenkins_job_found counter\n",
+		"# TYPE jenkins_job_timeout counter\n",
+		"# TYPE gitea_comment_posted counter\n",
+		"# TYPE processing_duration_seconds histogram\n",
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Fatalf("expected metrics to contain %q, got:\n%s", want, rec.Body.String())
+		}
+	}
+}
+
+func TestAckBeforeEnqueueProcessesAllEventsOnShutdown(t *testing.T) {
+	jenkinsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A slow Jenkins keeps the processor queue full while the intake buffer waits for space.
+		time.Sleep(20 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"jobs":[{"name":"one-1","url":"https://jenkins/one-1/"},{"name":"one-2","url":"https://jenkins/one-2/"},` +
+			`{"name":"one-3","url":"https://jenkins/one-3/"},{"name":"one-4","url":"https://jenkins/one-4/"}]}`))
+	}))
+	defer jenkinsServer.Close()
+
+	var mu sync.Mutex
+	var commented []string
+	giteaServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		commented = append(commented, r.URL.Path)
+		id := len(commented)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"id":%d}`, id)
+	}))
+	defer giteaServer.Close()
+
+	path := writeConfig(t, strings.Replace(baseConfig, "server:\n",
+		"server:\n  listen_addr: \"127.0.0.1:0\"\n  ack_before_enqueue: true\n  worker_pool_size: 1\n  queue_size: 1\n  intake_size: 10\n"+
+			"  comment_on_overload: true\n", 1))
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	jClient := jenkins.NewClient(jenkinsServer.URL, "", "", jenkinsServer.Client(), nil)
+	gClient := gitea.NewClient(giteaServer.URL, "token", giteaServer.Client(), nil)
+	srv := server.New(cfg, processor.New(cfg, jClient, gClient, nil), nil)
+
+	queueFull := metrics.WebhookQueueFull.Value()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- srv.Run(ctx) }()
+
+	for number := 1; number <= 4; number++ {
+		body := fmt.Sprintf(`{"action":"opened","pull_request":{"number":%d,"title":"t"},"repository":{"full_name":"org/one"}}`, number)
+		if rec := postWebhook(srv, "pull_request", body); rec.Code != http.StatusAccepted {
+			t.Fatalf("expected 202 for PR %d, got %d: %s", number, rec.Code, rec.Body.String())
+		}
+	}
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("run: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout waiting for server to stop")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(commented) != 4 {
+		t.Fatalf("expected all 4 accepted events to be processed without overload comments, got comments %v", commented)
+	}
+	if got := metrics.WebhookQueueFull.Value(); got != queueFull {
+		t.Fatalf("accepted events waiting for queue space must not count as rejected, webhook_queue_full grew by %d", got-queueFull)
+	}
+}
+
+func TestJenkinsCallback(t *testing.T) {
+	srv, _ := newTestServer(t, writeConfig(t, strings.Replace(baseConfig, "server:\n", "server:\n  jenkins_callback_token: \"cb\"\n", 1)))
+
+	tests := []struct {
+		name  string
+		query string
+		body  string
+		want  int
+	}{
+		{name: "missing token", body: `{"name":"one-1"}`, want: http.StatusUnauthorized},
+		{name: "invalid payload", query: "?token=cb", body: `{`, want: http.StatusBadRequest},
+		{name: "empty body", query: "?token=cb", body: "", want: http.StatusBadRequest},
+		{name: "no pending events", query: "?token=cb", body: `{"name":"one-1","build":{"phase":"STARTED","number":1}}`, want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/jenkins/callback"+tt.query, strings.NewReader(tt.body)))
+			if rec.Code != tt.want {
+				t.Fatalf("expected %d, got %d: %s", tt.want, rec.Code, rec.Body.String())
+			}
+			if tt.name == "empty body" && !strings.Contains(rec.Body.String(), "empty request body") {
+				t.Fatalf("unexpected response: %s", rec.Body.String())
+			}
+			if tt.want == http.StatusOK && !strings.Contains(rec.Body.String(), `"resolved":0`) {
+				t.Fatalf("unexpected response: %s", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestJenkinsCallbackDisabledWithoutToken(t *testing.T) {
+	srv, _ := newTestServer(t, writeConfig(t, baseConfig))
+
+	rec := httptest.NewRecorder()
+	body := `{"name":"one-1","build":{"phase":"COMPLETED","status":"SUCCESS","number":1}}`
+	srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/jenkins/callback", strings.NewReader(body)))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 without jenkins_callback_token, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestWebhookAcceptsGitHubPayloadInCompatMode(t *testing.T) {
+	body := `{"action":"opened","number":3,"pull_request":{"number":3,"title":"t","html_url":"https://github.com/org/unknown/pull/3"},"repository":{"full_name":"org/unknown"}}`
+	mac := hmac.New(sha256.New, []byte("hook-secret"))
+	mac.Write([]byte(body))
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	tests := []struct {
+		name      string
+		compat    bool
+		signature string
+		want      int
+	}{
+		{name: "compat enabled", compat: true, signature: signature, want: http.StatusAccepted},
+		{name: "bad signature", compat: true, signature: "sha256=00", want: http.StatusUnauthorized},
+		{name: "compat disabled", compat: false, signature: signature, want: http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := fmt.Sprintf("server:\n  webhook_secret: \"hook-secret\"\n  github_compat: %t\n", tt.compat)
+			srv, proc := newTestServer(t, writeConfig(t, strings.Replace(baseConfig, "server:\n", server, 1)))
+			proc.Start()
+			defer proc.Stop()
+
+			req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body))
+			req.Header.Set("X-GitHub-Event", "pull_request")
+			req.Header.Set("X-Hub-Signature-256", tt.signature)
+			rec := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("expected %d, got %d: %s", tt.want, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestWebhookCountsUnknownActions(t *testing.T) {
+	srv, proc := newTestServer(t, writeConfig(t, baseConfig))
+	proc.Start()
+	defer proc.Stop()
+
+	unknown := metrics.WebhookUnknownActions.Value("converted_to_draft")
+	known := metrics.WebhookUnknownActions.Value("opened")
+	rec := postWebhook(srv, "pull_request", `{"action":"converted_to_draft","pull_request":{"number":5,"title":"t"},"repository":{"full_name":"org/one"}}`)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = postWebhook(srv, "pull_request", `{"action":"opened","pull_request":{"number":6,"title":"t"},"repository":{"full_name":"org/unknown"}}`)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := metrics.WebhookUnknownActions.Value("converted_to_draft") - unknown; got != 1 {
+		t.Fatalf("expected unknown action to be counted once, got %d", got)
+	}
+	if got := metrics.WebhookUnknownActions.Value("opened") - known; got != 0 {
+		t.Fatalf("expected known action not to be counted, got %d", got)
+	}
+}
+
+func TestWebhookIgnoresRedeliveredDeliveryID(t *testing.T) {
+	srv, proc := newTestServer(t, writeConfig(t, baseConfig))
+	proc.Start()
+	defer proc.Stop()
+
+	post := func(delivery string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(`{"action":"opened","pull_request":{"number":5,"title":"t"},"repository":{"full_name":"org/unknown"}}`))
+		req.Header.Set("X-Gitea-Event", "pull_request")
+		req.Header.Set("X-Gitea-Delivery", delivery)
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	enqueued := metrics.WebhookEventsEnqueued.Value()
+	duplicates := metrics.DuplicateDeliveries.Value()
+	if rec := post("3f1c2d4e-delivery"); rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202 for the first delivery, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := post("3f1c2d4e-delivery"); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 for the redelivery, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := metrics.WebhookEventsEnqueued.Value() - enqueued; got != 1 {
+		t.Fatalf("expected the delivery to be enqueued once, got %d", got)
+	}
+	if got := metrics.DuplicateDeliveries.Value() - duplicates; got != 1 {
+		t.Fatalf("expected 1 duplicate delivery, got %d", got)
+	}
+}
+
+func TestWebhookAcceptsRedeliveryAfterRejectedPayload(t *testing.T) {
+	srv, proc := newTestServer(t, writeConfig(t, baseConfig))
+	proc.Start()
+	defer proc.Stop()
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body))
+		req.Header.Set("X-Gitea-Event", "pull_request")
+		req.Header.Set("X-Gitea-Delivery", "7a9e0b1c-delivery")
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, body := range []string{
+		`{"action":"opened","pull_request":`,
+		`{"action":"opened","pull_request":{"number":0,"title":"t"},"repository":{"full_name":"org/unknown"}}`,
+	} {
+		if rec := post(body); rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %s, got %d: %s", body, rec.Code, rec.Body.String())
+		}
+	}
+	rec := post(`{"action":"opened","pull_request":{"number":5,"title":"t"},"repository":{"full_name":"org/unknown"}}`)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202 for the redelivery after a rejected payload, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestWebhookRetestIgnoresBotComments(t *testing.T) {
+	giteaServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"number":5,"state":"closed"}`))
+	}))
+	defer giteaServer.Close()
+
+	cfg := strings.Replace(baseConfig, `  token: "secret"`, `  token: "secret"
+  bot_user: "jenkins-bot"`, 1)
+	cfg = strings.Replace(cfg, `    job_pattern: "^one-{{ .Number }}$"`, `    job_pattern: "^one-{{ .Number }}$"
+    events: [pull_request, issue_comment]`, 1)
+	loaded, err := config.Load(writeConfig(t, cfg))
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	proc := processor.New(loaded, nil, gitea.NewClient(giteaServer.URL, "secret", nil, nil), nil)
+	srv := server.New(loaded, proc, nil)
+	proc.Start()
+	defer proc.Stop()
+
+	comment := func(user, body string) string {
+		return fmt.Sprintf(`{"action":"created","issue":{"number":5,"pull_request":{}},"comment":{"body":%q,"user":{"login":%q}},"repository":{"full_name":"org/one"},"sender":{"login":%q}}`,
+			body, user, user)
+	}
+	for _, tc := range []struct {
+		name, body string
+		want       int
+	}{
+		{"bot comment echoing the command", comment("Jenkins-Bot", "Result posted.\n/retest"), http.StatusNoContent},
+		{"user comment", comment("alice", "/retest"), http.StatusAccepted},
+	} {
+		if rec := postWebhook(srv, "issue_comment", tc.body); rec.Code != tc.want {
+			t.Fatalf("%s: expected %d, got %d: %s", tc.name, tc.want, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func newTestServer(t *testing.T, path string) (*server.Server, *processor.Processor) {
+	t.Helper()
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	proc := processor.New(cfg, nil, nil, nil)
+	return server.New(cfg, proc, nil), proc
+}
+
+func postWebhook(srv *server.Server, event, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body))
+	req.Header.Set("X-Gitea-Event", event)
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	return rec
+}
+
+func doReload(srv *server.Server, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/admin/reload", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	return rec
+}
+
+func writeConfig(t *testing.T, content string, path ...string) string {
+	t.Helper()
+	target := filepath.Join(t.TempDir(), "config.yaml")
+	if len(path) > 0 {
+		target = path[0]
+	}
+	if err := os.WriteFile(target, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	return target
+}
+
+func TestReadyChecksDependencies(t *testing.T) {
+	upstream := func(status int, hits *atomic.Int32) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits.Add(1)
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte(`{}`))
+		}))
+	}
+
+	tests := []struct {
+		name       string
+		jenkins    int
+		gitea      int
+		want       int
+		wantFailed []string
+	}{
+		{name: "both up", jenkins: http.StatusOK, gitea: http.StatusOK, want: http.StatusOK, wantFailed: []string{}},
+		{name: "jenkins down", jenkins: http.StatusBadGateway, gitea: http.StatusOK, want: http.StatusServiceUnavailable, wantFailed: []string{"jenkins"}},
+		{name: "gitea unauthorized", jenkins: http.StatusOK, gitea: http.StatusUnauthorized, want: http.StatusServiceUnavailable, wantFailed: []string{"gitea"}},
+		{name: "both down", jenkins: http.StatusInternalServerError, gitea: http.StatusInternalServerError, want: http.StatusServiceUnavailable, wantFailed: []string{"gitea", "jenkins"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var jenkinsHits, giteaHits atomic.Int32
+			jenkinsServer := upstream(tt.jenkins, &jenkinsHits)
+			defer jenkinsServer.Close()
+			giteaServer := upstream(tt.gitea, &giteaHits)
+			defer giteaServer.Close()
+
+			srv, _ := newTestServer(t, writeConfig(t, baseConfig))
+			srv.SetDependencies(map[string]server.Dependency{
+				"jenkins": jenkins.NewClient(jenkinsServer.URL, "", "", jenkinsServer.Client(), nil),
+				"gitea":   gitea.NewClient(giteaServer.URL, "token", giteaServer.Client(), nil),
+			})
+
+			for i := 0; i < 2; i++ {
+				rec := httptest.NewRecorder()
+				srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+				if rec.Code != tt.want {
+					t.Fatalf("expected %d, got %d: %s", tt.want, rec.Code, rec.Body.String())
+				}
+				var body struct {
+					Ready  bool     `json:"ready"`
+					Failed []string `json:"failed"`
+				}
+				if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+					t.Fatalf("decode response: %v", err)
+				}
+				if body.Ready != (tt.want == http.StatusOK) || strings.Join(body.Failed, ",") != strings.Join(tt.wantFailed, ",") {
+					t.Fatalf("unexpected response: %+v", body)
+				}
+			}
+			if jenkinsHits.Load() != 1 || giteaHits.Load() != 1 {
+				t.Fatalf("expected the second probe to use the cached result, got %d jenkins and %d gitea checks", jenkinsHits.Load(), giteaHits.Load())
+			}
+
+			rec := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("health must not depend on upstreams, got %d", rec.Code)
+			}
+		})
+	}
+}
+
+func TestWebhookAcceptsPushEvents(t *testing.T) {
+	srv, proc := newTestServer(t, writeConfig(t, baseConfig))
+	proc.Start()
+	defer proc.Stop()
+
+	body := `{"ref":"refs/heads/main","after":"abc123","commits":[{"id":"abc123","message":"Fix build"}],"repository":{"full_name":"org/unknown"}}`
+	if rec := postWebhook(srv, "push", body); rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202 for push event, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := postWebhook(srv, "push", `{"ref":`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for malformed push payload, got %d", rec.Code)
+	}
+}
+
+func TestWALReplaysEventsAfterRestart(t *testing.T) {
+	jenkinsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"jobs":[{"name":"one-1","url":"https://jenkins/one-1/"},{"name":"one-2","url":"https://jenkins/one-2/"}]}`))
+	}))
+	defer jenkinsServer.Close()
+
+	var commented atomic.Int32
+	giteaServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := commented.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"id":%d}`, id)
+	}))
+	defer giteaServer.Close()
+
+	walPath := filepath.Join(t.TempDir(), "webhooks.wal")
+	path := writeConfig(t, strings.Replace(baseConfig, "server:\n",
+		"server:\n  listen_addr: \"127.0.0.1:0\"\n  ack_before_enqueue: true\n", 1))
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+
+	// First run: deliveries are accepted, but the process dies before the intake buffer is drained.
+	firstLog, err := wal.Open(walPath)
+	if err != nil {
+		t.Fatalf("open wal: %v", err)
+	}
+	first := server.New(cfg, processor.New(cfg, nil, nil, nil), nil)
+	first.SetWAL(firstLog)
+	for number := 1; number <= 2; number++ {
+		body := fmt.Sprintf(`{"action":"opened","pull_request":{"number":%d,"title":"t"},"repository":{"full_name":"org/one"}}`, number)
+		if rec := postWebhook(first, "pull_request", body); rec.Code != http.StatusAccepted {
+			t.Fatalf("expected 202 for PR %d, got %d: %s", number, rec.Code, rec.Body.String())
+		}
+	}
+	firstLog.Close()
+
+	// Second run replays both deliveries from the wal.
+	secondLog, err := wal.Open(walPath)
+	if err != nil {
+		t.Fatalf("reopen wal: %v", err)
+	}
+	defer secondLog.Close()
+	if pending := secondLog.Pending(); len(pending) != 2 {
+		t.Fatalf("expected 2 pending wal entries after restart, got %d", len(pending))
+	}
+	jClient := jenkins.NewClient(jenkinsServer.URL, "", "", jenkinsServer.Client(), nil)
+	gClient := gitea.NewClient(giteaServer.URL, "token", giteaServer.Client(), nil)
+	second := server.New(cfg, processor.New(cfg, jClient, gClient, nil), nil)
+	second.SetWAL(secondLog)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- second.Run(ctx) }()
+	deadline := time.Now().Add(5 * time.Second)
+	for commented.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	if got := commented.Load(); got != 2 {
+		t.Fatalf("expected both replayed events to be commented, got %d comments", got)
+	}
+	if pending := secondLog.Pending(); len(pending) != 0 {
+		t.Fatalf("expected processed events to be acked, got %d pending", len(pending))
+	}
+}
+
+func TestWebhookUnsupportedEventsRespondNoContent(t *testing.T) {
+	srv, _ := newTestServer(t, writeConfig(t, baseConfig))
+
+	for _, event := range []string{"ping", "issues", ""} {
+		t.Run("event "+event, func(t *testing.T) {
+			rec := postWebhook(srv, event, `{"zen":"keep it simple"}`)
+			if rec.Code != http.StatusNoContent {
+				t.Fatalf("expected 204, got %d", rec.Code)
+			}
+			if rec.Body.Len() != 0 {
+				t.Fatalf("expected empty body, got %q", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestWebhookRetestCommentAllowlist(t *testing.T) {
+	var fetched atomic.Int32
+	giteaServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetched.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"number":5,"state":"closed"}`))
+	}))
+	defer giteaServer.Close()
+
+	cfg := strings.Replace(baseConfig, `https://gitea.example.com`, giteaServer.URL, 1)
+	cfg = strings.Replace(cfg, `    job_pattern: "^one-{{ .Number }}$"`, `    job_pattern: "^one-{{ .Number }}$"
+    events: [pull_request, issue_comment]
+    retest_allowed_users: [alice]`, 1)
+	loaded, err := config.Load(writeConfig(t, cfg))
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	proc := processor.New(loaded, nil, gitea.NewClient(giteaServer.URL, "secret", nil, nil), nil)
+	srv := server.New(loaded, proc, nil)
+	proc.Start()
+	defer proc.Stop()
+
+	comment := func(repo, user, body string) string {
+		return fmt.Sprintf(`{"action":"created","issue":{"number":5,"pull_request":{}},"comment":{"body":%q,"user":{"login":%q}},"repository":{"full_name":%q},"sender":{"login":%q}}`,
+			body, user, repo, user)
+	}
+	for _, tc := range []struct {
+		name, body string
+		want       int
+	}{
+		{"allowed user", comment("org/one", "alice", "Flaky test.\n/retest"), http.StatusAccepted},
+		{"user not in allowlist", comment("org/one", "mallory", "/retest"), http.StatusNoContent},
+		{"no command", comment("org/one", "alice", "please /retest"), http.StatusNoContent},
+		{"issue_comment not enabled", comment("org/two", "alice", "/retest"), http.StatusNoContent},
+	} {
+		if rec := postWebhook(srv, "issue_comment", tc.body); rec.Code != tc.want {
+			t.Fatalf("%s: expected %d, got %d: %s", tc.name, tc.want, rec.Code, rec.Body.String())
+		}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for fetched.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if fetched.Load() != 1 {
+		t.Fatalf("expected pull request to be fetched once for the accepted retest, got %d", fetched.Load())
+	}
+}
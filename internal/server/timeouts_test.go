@@ -0,0 +1,31 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/example/gitea-jenkins-webhook/internal/config"
+	"github.com/example/gitea-jenkins-webhook/internal/processor"
+)
+
+func TestNewAppliesHTTPTimeouts(t *testing.T) {
+	cfg := &config.Config{
+		Server: config.ServerConfig{
+			ReadTimeout:  3 * time.Second,
+			WriteTimeout: 7 * time.Second,
+			IdleTimeout:  time.Minute,
+			QueueSize:    1,
+		},
+	}
+	s := New(cfg, processor.New(cfg, nil, nil, nil), nil)
+
+	if s.server.ReadTimeout != 3*time.Second {
+		t.Fatalf("unexpected read timeout: %s", s.server.ReadTimeout)
+	}
+	if s.server.WriteTimeout != 7*time.Second {
+		t.Fatalf("unexpected write timeout: %s", s.server.WriteTimeout)
+	}
+	if s.server.IdleTimeout != time.Minute {
+		t.Fatalf("unexpected idle timeout: %s", s.server.IdleTimeout)
+	}
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/example/gitea-jenkins-webhook/internal/config"
+	"github.com/example/gitea-jenkins-webhook/internal/metrics"
+	"github.com/example/gitea-jenkins-webhook/internal/wal"
+	"github.com/example/gitea-jenkins-webhook/pkg/webhook"
+)
+
+// walRecord - запись журнала предзаписи: проверенное тело вебхука и сведения из заголовков запроса.
+type walRecord struct {
+	Event      string          `json:"event"`
+	GitHub     bool            `json:"github,omitempty"`
+	Body       json.RawMessage `json:"body"`
+	TraceID    string          `json:"trace_id,omitempty"`
+	DeliveryID string          `json:"delivery_id,omitempty"`
+	ReceivedAt time.Time       `json:"received_at"`
+}
+
+// SetWAL задает журнал предзаписи (server.wal_file): принятые вебхуки записываются в него до постановки
+// в очередь, записи подтверждаются после обработки, а неподтвержденные воспроизводятся при запуске Run.
+// Должен вызываться до Run.
+func (s *Server) SetWAL(l *wal.Log) {
+	s.wal = l
+	s.processor.SetProcessedHook(s.ackWAL)
+}
+
+// appendWAL записывает событие в журнал предзаписи и сохраняет номер записи в evt.WALID.
+// Ошибка записи не отклоняет вебхук: событие обрабатывается без гарантии воспроизведения.
+func (s *Server) appendWAL(evt *webhook.PullRequestEvent, rec walRecord) {
+	if s.wal == nil {
+		return
+	}
+	id, err := s.wal.Append(rec)
+	if err != nil {
+		s.log.Error("append webhook to wal", "err", err, "repo", evt.Repository.FullName)
+		return
+	}
+	evt.WALID = id
+}
+
+// ackWAL подтверждает запись журнала предзаписи события evt.
+func (s *Server) ackWAL(evt webhook.PullRequestEvent) {
+	if s.wal == nil || evt.WALID == 0 {
+		return
+	}
+	if err := s.wal.Ack(evt.WALID); err != nil {
+		s.log.Warn("ack webhook in wal", "err", err, "wal_id", evt.WALID)
+	}
+}
+
+// replayWAL ставит в очередь процессора события, записанные в журнал предзаписи, но не обработанные
+// до перезапуска. Если очередь переполнена, событие ожидает свободного места, как в буфере приема.
+// Когда ctx завершен, воспроизведение прекращается, а не поставленные в очередь записи остаются
+// в журнале до следующего запуска.
+func (s *Server) replayWAL(ctx context.Context) {
+	if s.wal == nil {
+		return
+	}
+	entries := s.wal.Pending()
+	if len(entries) == 0 {
+		return
+	}
+	s.log.Info("replaying unprocessed webhooks from wal", "count", len(entries))
+	for _, entry := range entries {
+		evt, err := s.eventFromWAL(entry.Payload)
+		if err != nil {
+			s.log.Error("decode wal entry, dropping", "err", err, "wal_id", entry.ID)
+			_ = s.wal.Ack(entry.ID)
+			continue
+		}
+		evt.WALID = entry.ID
+		if err := s.processor.EnqueueWait(ctx, evt); err != nil {
+			if ctx.Err() != nil {
+				s.log.Warn("wal replay interrupted, remaining entries stay pending", "err", err, "wal_id", entry.ID)
+				return
+			}
+			s.log.Error("enqueue replayed event", "err", err, "wal_id", entry.ID)
+			continue
+		}
+		metrics.WebhookEventsEnqueued.Inc()
+	}
+}
+
+// eventFromWAL восстанавливает событие из записи журнала предзаписи так же, как handleWebhook.
+func (s *Server) eventFromWAL(payload json.RawMessage) (webhook.PullRequestEvent, error) {
+	var rec walRecord
+	if err := json.Unmarshal(payload, &rec); err != nil {
+		return webhook.PullRequestEvent{}, err
+	}
+	evt, _, err := decodeEvent(rec.Event, rec.Body, rec.GitHub)
+	if err != nil {
+		return webhook.PullRequestEvent{}, err
+	}
+	evt.Timestamp = rec.ReceivedAt
+	evt.TraceID = rec.TraceID
+	evt.DeliveryID = rec.DeliveryID
+	evt.PullRequest.Number = evt.PRNumber()
+	if evt.PullRequest.Number == 0 && !evt.IsPush() && s.cfg.Load().Server.ZeroPRNumber == config.ZeroPRNumberSynthetic {
+		evt.PullRequest.Number = evt.SyntheticNumber()
+	}
+	return evt, nil
+}
@@ -0,0 +1,115 @@
+// Package sink предоставляет экспорт записей об обработанных событиях во внешние системы
+// в машиночитаемом виде.
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/example/gitea-jenkins-webhook/internal/notifier"
+	"github.com/example/gitea-jenkins-webhook/internal/retry"
+)
+
+// Job описывает найденную задачу Jenkins в записи.
+type Job struct {
+	Name  string `json:"name"`  // Имя задачи
+	URL   string `json:"url"`   // URL задачи
+	Color string `json:"color"` // Цвет задачи (результат последней сборки)
+}
+
+// Record представляет запись об обработанном событии.
+type Record struct {
+	Repo        string    `json:"repo"`                  // Полное имя репозитория
+	PRNumber    int64     `json:"pr_number"`             // Номер pull request
+	Outcome     string    `json:"outcome"`               // Итог обработки
+	Reason      string    `json:"reason,omitempty"`      // Причина пропуска или ошибки
+	Job         *Job      `json:"job"`                   // Найденная задача или null
+	CommentURL  string    `json:"comment_url,omitempty"` // Ссылка на опубликованный комментарий
+	DeliveryID  string    `json:"delivery_id,omitempty"` // Идентификатор доставки вебхука
+	ProcessedAt time.Time `json:"processed_at"`          // Время завершения обработки
+}
+
+// Sink отправляет записи об обработанных событиях на настроенный адрес.
+type Sink struct {
+	url        string
+	secret     string
+	maxRetries int
+	backoff    time.Duration
+	httpClient *http.Client
+	log        *slog.Logger
+}
+
+// New создает приемник записей. Если задан secret, тело запроса подписывается заголовком
+// X-Signature так же, как у уведомлений. При ошибках сети и ответах 5xx отправка
+// повторяется до maxRetries раз с паузой backoff.
+// Если httpClient равен nil, создается клиент с таймаутом 10 секунд.
+func New(url, secret string, maxRetries int, backoff time.Duration, httpClient *http.Client, logger *slog.Logger) *Sink {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Sink{
+		url:        url,
+		secret:     secret,
+		maxRetries: maxRetries,
+		backoff:    backoff,
+		httpClient: httpClient,
+		log:        logger,
+	}
+}
+
+// errPermanent помечает ошибки, которые не имеет смысла повторять (ответы 4xx).
+var errPermanent = errors.New("permanent sink error")
+
+// Send отправляет запись POST-запросом с JSON-телом.
+func (s *Sink) Send(ctx context.Context, rec Record) error {
+	body, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("marshal sink record: %w", err)
+	}
+
+	retryable := func(err error) bool { return !errors.Is(err, errPermanent) }
+	return retry.Do(ctx, s.maxRetries, s.backoff, retryable, func() error {
+		err := s.post(ctx, body)
+		if err != nil {
+			s.log.Warn("failed to export event record", "err", err, "repo", rec.Repo, "pr_number", rec.PRNumber)
+		}
+		return err
+	})
+}
+
+// post выполняет одну попытку отправки тела записи.
+func (s *Sink) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.secret != "" {
+		req.Header.Set(notifier.HeaderSignature, "sha256="+notifier.Sign(body, s.secret))
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("sink request: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode >= 500:
+		return fmt.Errorf("sink status: %s", resp.Status)
+	case resp.StatusCode >= 400:
+		return fmt.Errorf("%w: status %s", errPermanent, resp.Status)
+	}
+	return nil
+}
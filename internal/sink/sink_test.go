@@ -0,0 +1,73 @@
+package sink_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/example/gitea-jenkins-webhook/internal/notifier"
+	"github.com/example/gitea-jenkins-webhook/internal/sink"
+)
+
+func TestSendDeliversSignedRecordWithRetry(t *testing.T) {
+	var (
+		calls     atomic.Int32
+		received  sink.Record
+		signature string
+		body      []byte
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get(notifier.HeaderSignature)
+		_ = json.Unmarshal(body, &received)
+	}))
+	defer ts.Close()
+
+	s := sink.New(ts.URL, "sink-secret", 2, time.Millisecond, ts.Client(), nil)
+	err := s.Send(context.Background(), sink.Record{
+		Repo:       "org/repo",
+		PRNumber:   12,
+		Outcome:    "build_success",
+		Job:        &sink.Job{Name: "PR-12", URL: "https://jenkins.example.com/job/PR-12/", Color: "blue"},
+		CommentURL: "https://gitea.example.com/org/repo/pulls/12#issuecomment-1",
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Fatalf("expected one retry after 503, got %d calls", calls.Load())
+	}
+	if received.Repo != "org/repo" || received.PRNumber != 12 || received.Outcome != "build_success" ||
+		received.Job == nil || received.Job.Name != "PR-12" || received.CommentURL == "" {
+		t.Fatalf("unexpected record: %#v", received)
+	}
+	if want := "sha256=" + notifier.Sign(body, "sink-secret"); signature != want {
+		t.Fatalf("expected signature %s, got %s", want, signature)
+	}
+}
+
+func TestSendDoesNotRetryClientErrors(t *testing.T) {
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, "bad", http.StatusBadRequest)
+	}))
+	defer ts.Close()
+
+	s := sink.New(ts.URL, "", 3, time.Millisecond, ts.Client(), nil)
+	if err := s.Send(context.Background(), sink.Record{Repo: "org/repo"}); err == nil {
+		t.Fatalf("expected error for 400 response")
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("expected a single attempt, got %d", calls.Load())
+	}
+}
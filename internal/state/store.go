@@ -0,0 +1,73 @@
+// Package state предоставляет хранилище состояния обработки pull request между событиями.
+package state
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Record хранит сведения о последнем результате обработки для ключа.
+type Record struct {
+	CommentHash string    // Хеш последнего опубликованного комментария
+	Outcome     string    // Последний итог обработки
+	UpdatedAt   time.Time // Время последнего обновления записи
+	CommentID   int64     // Идентификатор отслеживаемого комментария (для update_strategy)
+	Body        string    // Текст отслеживаемого комментария без префикса (для append_history)
+}
+
+// Store определяет интерфейс хранилища состояния.
+type Store interface {
+	Get(key string) (Record, bool)
+	Put(key string, rec Record)
+}
+
+// Key формирует ключ состояния для шаблона задачи в pull request репозитория.
+func Key(repo string, number int64, pattern string) string {
+	return fmt.Sprintf("%s#%d|%s", repo, number, pattern)
+}
+
+// BuildKey формирует ключ состояния для сборки задачи Jenkins, общий для всех pull request,
+// к которым относится эта сборка.
+func BuildKey(jobURL string, build int64) string {
+	return fmt.Sprintf("build|%s#%d", jobURL, build)
+}
+
+// CommentKey формирует ключ состояния отслеживаемого комментария pull request.
+func CommentKey(repo string, number int64) string {
+	return fmt.Sprintf("comment|%s#%d", repo, number)
+}
+
+// Hash возвращает хеш текста комментария для сравнения результатов.
+func Hash(body string) string {
+	sum := sha256.Sum256([]byte(body))
+	return hex.EncodeToString(sum[:])
+}
+
+// MemoryStore - потокобезопасное хранилище состояния в памяти процесса.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	records map[string]Record
+}
+
+// NewMemoryStore создает пустое хранилище состояния в памяти.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[string]Record)}
+}
+
+// Get возвращает запись для ключа и флаг ее наличия.
+func (s *MemoryStore) Get(key string) (Record, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rec, ok := s.records[key]
+	return rec, ok
+}
+
+// Put сохраняет запись для ключа, заменяя предыдущую.
+func (s *MemoryStore) Put(key string, rec Record) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[key] = rec
+}
@@ -0,0 +1,212 @@
+// Package wal предоставляет журнал предзаписи принятых вебхуков: запись добавляется в файл
+// до постановки события в очередь и подтверждается после его обработки, а неподтвержденные
+// записи воспроизводятся после перезапуска (доставка не реже одного раза).
+package wal
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// compactThreshold - число записей в файле, после которого журнал без неподтвержденных записей усекается.
+const compactThreshold = 1000
+
+// Entry - неподтвержденная запись журнала.
+type Entry struct {
+	ID      uint64          // Номер записи, передаваемый в Ack
+	Payload json.RawMessage // Данные, переданные в Append
+}
+
+// line - строка файла журнала: добавление записи (Payload задан) или ее подтверждение (Ack равен true).
+type line struct {
+	ID      uint64          `json:"id"`
+	Ack     bool            `json:"ack,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// Log - журнал предзаписи в файле. Безопасен для одновременного использования.
+type Log struct {
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	nextID  uint64
+	pending map[uint64]json.RawMessage
+	lines   int // Число строк в файле с момента последнего сжатия
+}
+
+// Open открывает журнал в файле path, создавая его при отсутствии. Неподтвержденные записи
+// прежнего запуска доступны через Pending; файл сжимается до них.
+func Open(path string) (*Log, error) {
+	l := &Log{path: path, nextID: 1, pending: make(map[uint64]json.RawMessage)}
+	if err := l.load(); err != nil {
+		return nil, err
+	}
+	if err := l.rewrite(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// load читает записи из файла журнала. Отсутствующий файл - пустой журнал; оборванная последняя
+// строка (сбой во время записи) пропускается.
+func (l *Log) load() error {
+	f, err := os.Open(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("open wal: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var ln line
+		if err := json.Unmarshal(scanner.Bytes(), &ln); err != nil {
+			continue
+		}
+		if ln.ID >= l.nextID {
+			l.nextID = ln.ID + 1
+		}
+		if ln.Ack {
+			delete(l.pending, ln.ID)
+			continue
+		}
+		l.pending[ln.ID] = ln.Payload
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read wal: %w", err)
+	}
+	return nil
+}
+
+// rewrite атомарно заменяет файл журнала неподтвержденными записями и открывает его для дозаписи.
+// Вызывается при открытии или под l.mu.
+func (l *Log) rewrite() error {
+	tmp, err := os.CreateTemp(filepath.Dir(l.path), filepath.Base(l.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create wal: %w", err)
+	}
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, e := range l.entries() {
+		if err := enc.Encode(line{ID: e.ID, Payload: e.Payload}); err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return fmt.Errorf("write wal: %w", err)
+		}
+	}
+	if err := w.Flush(); err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("write wal: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), l.path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("replace wal: %w", err)
+	}
+
+	if l.file != nil {
+		l.file.Close()
+	}
+	l.file, err = os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("open wal: %w", err)
+	}
+	l.lines = len(l.pending)
+	return nil
+}
+
+// entries возвращает неподтвержденные записи в порядке добавления. Вызывается под l.mu.
+func (l *Log) entries() []Entry {
+	entries := make([]Entry, 0, len(l.pending))
+	for id, payload := range l.pending {
+		entries = append(entries, Entry{ID: id, Payload: payload})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+	return entries
+}
+
+// Append сериализует payload в JSON, дописывает запись в журнал и сбрасывает ее на диск.
+// Возвращает номер записи для Ack.
+func (l *Log) Append(payload any) (uint64, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return 0, fmt.Errorf("encode wal entry: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	id := l.nextID
+	if err := l.write(line{ID: id, Payload: data}); err != nil {
+		return 0, err
+	}
+	l.nextID++
+	l.pending[id] = data
+	return id, nil
+}
+
+// Ack подтверждает обработку записи id: после перезапуска она не воспроизводится.
+// Подтверждение неизвестной записи игнорируется.
+func (l *Log) Ack(id uint64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.pending[id]; !ok {
+		return nil
+	}
+	if err := l.write(line{ID: id, Ack: true}); err != nil {
+		return err
+	}
+	delete(l.pending, id)
+	if len(l.pending) == 0 && l.lines >= compactThreshold {
+		return l.rewrite()
+	}
+	return nil
+}
+
+// write дописывает строку в файл журнала и сбрасывает ее на диск. Вызывается под l.mu.
+func (l *Log) write(ln line) error {
+	data, err := json.Marshal(ln)
+	if err != nil {
+		return fmt.Errorf("encode wal entry: %w", err)
+	}
+	if _, err := l.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("write wal: %w", err)
+	}
+	if err := l.file.Sync(); err != nil {
+		return fmt.Errorf("sync wal: %w", err)
+	}
+	l.lines++
+	return nil
+}
+
+// Pending возвращает неподтвержденные записи в порядке добавления.
+func (l *Log) Pending() []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.entries()
+}
+
+// Close закрывает файл журнала. Неподтвержденные записи остаются в файле.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
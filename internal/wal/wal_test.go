@@ -0,0 +1,59 @@
+package wal_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/example/gitea-jenkins-webhook/internal/wal"
+)
+
+func TestLogReplaysUnackedEntriesAfterReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "webhooks.wal")
+	l, err := wal.Open(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	var ids []uint64
+	for _, payload := range []string{"first", "second", "third"} {
+		id, err := l.Append(payload)
+		if err != nil {
+			t.Fatalf("append: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := l.Ack(ids[1]); err != nil {
+		t.Fatalf("ack: %v", err)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	// A crash in the middle of a write leaves a torn last line.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		t.Fatalf("open file: %v", err)
+	}
+	_, _ = f.WriteString(`{"id":4,"payl`)
+	f.Close()
+
+	l, err = wal.Open(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer l.Close()
+	pending := l.Pending()
+	if len(pending) != 2 || pending[0].ID != ids[0] || pending[1].ID != ids[2] {
+		t.Fatalf("expected first and third entries to be pending, got %+v", pending)
+	}
+	if string(pending[0].Payload) != `"first"` || string(pending[1].Payload) != `"third"` {
+		t.Fatalf("unexpected payloads: %s, %s", pending[0].Payload, pending[1].Payload)
+	}
+	id, err := l.Append("fourth")
+	if err != nil {
+		t.Fatalf("append after reopen: %v", err)
+	}
+	if id <= ids[2] {
+		t.Fatalf("expected ids to keep increasing after reopen, got %d", id)
+	}
+}
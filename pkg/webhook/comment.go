@@ -0,0 +1,86 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// IssueCommentEvent представляет событие issue_comment от Gitea: комментарий к issue или pull request.
+type IssueCommentEvent struct {
+	Action     string     `json:"action"` // created, edited или deleted
+	Issue      Issue      `json:"issue"`
+	Comment    IssueNote  `json:"comment"`
+	Repository Repository `json:"repository"`
+	Sender     Sender     `json:"sender"`
+	IsPull     bool       `json:"is_pull"` // Комментарий к pull request (Gitea 1.17+)
+}
+
+// Issue представляет issue или pull request, к которому оставлен комментарий.
+type Issue struct {
+	Number      int64     `json:"number"`
+	Title       string    `json:"title"`
+	PullRequest *struct{} `json:"pull_request"` // Задан, если issue является pull request
+}
+
+// IssueNote представляет комментарий события issue_comment.
+type IssueNote struct {
+	ID   int64  `json:"id"`
+	Body string `json:"body"`
+	User Sender `json:"user"`
+}
+
+// DecodeIssueCommentEvent разбирает тело события issue_comment от Gitea.
+func DecodeIssueCommentEvent(body []byte) (IssueCommentEvent, error) {
+	var evt IssueCommentEvent
+	if err := json.Unmarshal(body, &evt); err != nil {
+		return IssueCommentEvent{}, fmt.Errorf("decode issue comment payload: %w", err)
+	}
+	return evt, nil
+}
+
+// IsPullRequest сообщает, оставлен ли комментарий к pull request, а не к issue.
+func (e IssueCommentEvent) IsPullRequest() bool {
+	return e.IsPull || e.Issue.PullRequest != nil
+}
+
+// Author возвращает имя автора комментария, а если оно не задано - отправителя события.
+func (e IssueCommentEvent) Author() string {
+	if e.Comment.User.Login != "" {
+		return e.Comment.User.Login
+	}
+	return e.Sender.Login
+}
+
+// HasCommand сообщает, содержит ли комментарий команду command: строку, которая после удаления
+// пробелов по краям равна command или начинается с command и пробела (аргументы команды не учитываются).
+// Пустая команда не встречается ни в одном комментарии.
+func (e IssueCommentEvent) HasCommand(command string) bool {
+	if command == "" {
+		return false
+	}
+	for _, line := range strings.Split(e.Comment.Body, "\n") {
+		rest, ok := strings.CutPrefix(strings.TrimSpace(line), command)
+		if ok && (rest == "" || unicode.IsSpace(rune(rest[0]))) {
+			return true
+		}
+	}
+	return false
+}
+
+// AsPullRequestEvent представляет комментарий как PullRequestEvent с действием "retest" для повторной
+// проверки pull request процессором. Событие содержит только номер pull request: ветки и SHA
+// процессор запрашивает у Gitea. Исходное событие сохраняется в поле Comment.
+func (e IssueCommentEvent) AsPullRequestEvent() PullRequestEvent {
+	return PullRequestEvent{
+		Action: "retest",
+		PullRequest: PullRequest{
+			Number: e.Issue.Number,
+			Title:  e.Issue.Title,
+		},
+		Repository: e.Repository,
+		Sender:     e.Sender,
+		Comment:    &e,
+	}
+}
@@ -0,0 +1,61 @@
+package webhook_test
+
+import (
+	"testing"
+
+	"github.com/example/gitea-jenkins-webhook/pkg/webhook"
+)
+
+func TestIssueCommentHasCommand(t *testing.T) {
+	tests := []struct {
+		body    string
+		command string
+		want    bool
+	}{
+		{"/retest", "/retest", true},
+		{"  /retest  ", "/retest", true},
+		{"/retest please", "/retest", true},
+		{"Flaky test.\n\n/retest\n", "/retest", true},
+		{"/retest\tall", "/retest", true},
+		{"/retests", "/retest", false},
+		{"please /retest", "/retest", false},
+		{"/RETEST", "/retest", false},
+		{"/retest", "", false},
+		{"", "/retest", false},
+		{"/ci-rerun", "/ci-rerun", true},
+	}
+	for _, tt := range tests {
+		evt := webhook.IssueCommentEvent{Comment: webhook.IssueNote{Body: tt.body}}
+		if got := evt.HasCommand(tt.command); got != tt.want {
+			t.Errorf("HasCommand(%q) on %q = %v, want %v", tt.command, tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeIssueCommentEvent(t *testing.T) {
+	body := []byte(`{
+		"action": "created",
+		"issue": {"number": 7, "title": "Fix login", "pull_request": {"merged": false}},
+		"comment": {"id": 3, "body": "/retest", "user": {"login": "alice"}},
+		"repository": {"full_name": "org/repo"},
+		"sender": {"login": "alice"}
+	}`)
+
+	comment, err := webhook.DecodeIssueCommentEvent(body)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !comment.IsPullRequest() || comment.Author() != "alice" {
+		t.Fatalf("unexpected comment: %#v", comment)
+	}
+
+	evt := comment.AsPullRequestEvent()
+	if !evt.IsRetest() || evt.Action != "retest" || evt.PRNumber() != 7 || evt.Repository.FullName != "org/repo" {
+		t.Fatalf("unexpected event: %#v", evt)
+	}
+
+	issue, err := webhook.DecodeIssueCommentEvent([]byte(`{"action":"created","issue":{"number":8}}`))
+	if err != nil || issue.IsPullRequest() {
+		t.Fatalf("expected plain issue comment, got %#v (%v)", issue, err)
+	}
+}
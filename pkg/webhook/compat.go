@@ -0,0 +1,58 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Варианты формата события pull_request, которые различает DecodeGiteaPullRequest.
+const (
+	// GiteaPayloadCurrent - формат современных версий Gitea: ссылка на pull request в html_url,
+	// SHA коммитов в head.sha и base.sha.
+	GiteaPayloadCurrent = "current"
+	// GiteaPayloadLegacy - формат старых версий Gitea: ссылка на pull request только в url,
+	// SHA коммитов в head_sha и merge_base самого pull request.
+	GiteaPayloadLegacy = "legacy"
+)
+
+// giteaCompatPullRequest содержит поля pull request, расположение которых
+// отличается между версиями Gitea.
+type giteaCompatPullRequest struct {
+	HTMLURL   string `json:"html_url"`
+	HeadSha   string `json:"head_sha"`
+	MergeBase string `json:"merge_base"`
+}
+
+// DecodeGiteaPullRequest разбирает тело события pull_request от Gitea любой поддерживаемой версии
+// и нормализует различия форматов во внутреннее представление PullRequestEvent:
+// ссылкой на pull request становится html_url (или url, если html_url отсутствует),
+// а пустые SHA веток заполняются из head_sha и merge_base.
+// Вторым значением возвращается обнаруженный вариант формата (GiteaPayloadCurrent или GiteaPayloadLegacy).
+func DecodeGiteaPullRequest(body []byte) (PullRequestEvent, string, error) {
+	var evt PullRequestEvent
+	if err := json.Unmarshal(body, &evt); err != nil {
+		return PullRequestEvent{}, "", fmt.Errorf("decode gitea payload: %w", err)
+	}
+	var compat struct {
+		PullRequest giteaCompatPullRequest `json:"pull_request"`
+	}
+	if err := json.Unmarshal(body, &compat); err != nil {
+		return PullRequestEvent{}, "", fmt.Errorf("decode gitea payload: %w", err)
+	}
+
+	variant := GiteaPayloadCurrent
+	if compat.PullRequest.HTMLURL != "" {
+		evt.PullRequest.URL = compat.PullRequest.HTMLURL
+	} else if evt.PullRequest.URL != "" {
+		variant = GiteaPayloadLegacy
+	}
+	if evt.PullRequest.Head.Sha == "" && compat.PullRequest.HeadSha != "" {
+		evt.PullRequest.Head.Sha = compat.PullRequest.HeadSha
+		variant = GiteaPayloadLegacy
+	}
+	if evt.PullRequest.Base.Sha == "" && compat.PullRequest.MergeBase != "" {
+		evt.PullRequest.Base.Sha = compat.PullRequest.MergeBase
+		variant = GiteaPayloadLegacy
+	}
+	return evt, variant, nil
+}
@@ -0,0 +1,73 @@
+package webhook_test
+
+import (
+	"testing"
+
+	"github.com/example/gitea-jenkins-webhook/pkg/webhook"
+)
+
+func TestDecodeGiteaPullRequestVersions(t *testing.T) {
+	legacy := []byte(`{
+		"action": "opened",
+		"number": 7,
+		"pull_request": {
+			"number": 7,
+			"title": "Fix build",
+			"url": "https://gitea.example.com/org/repo/pulls/7",
+			"head_sha": "abc123",
+			"merge_base": "def456",
+			"base": {"ref": "main"},
+			"head": {"ref": "fix/build"}
+		},
+		"repository": {"id": 1, "name": "repo", "full_name": "org/repo"}
+	}`)
+	current := []byte(`{
+		"action": "opened",
+		"number": 7,
+		"pull_request": {
+			"number": 7,
+			"title": "Fix build",
+			"url": "https://gitea.example.com/api/v1/repos/org/repo/pulls/7",
+			"html_url": "https://gitea.example.com/org/repo/pulls/7",
+			"base": {"ref": "main", "sha": "def456"},
+			"head": {"ref": "fix/build", "sha": "abc123"}
+		},
+		"repository": {"id": 1, "name": "repo", "full_name": "org/repo"}
+	}`)
+
+	cases := []struct {
+		name    string
+		body    []byte
+		variant string
+	}{
+		{"legacy", legacy, webhook.GiteaPayloadLegacy},
+		{"current", current, webhook.GiteaPayloadCurrent},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			evt, variant, err := webhook.DecodeGiteaPullRequest(tc.body)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if variant != tc.variant {
+				t.Fatalf("expected variant %q, got %q", tc.variant, variant)
+			}
+			pr := evt.PullRequest
+			if pr.URL != "https://gitea.example.com/org/repo/pulls/7" {
+				t.Fatalf("unexpected pull request URL %q", pr.URL)
+			}
+			if pr.Head.Sha != "abc123" || pr.Base.Sha != "def456" {
+				t.Fatalf("unexpected SHAs: head=%q base=%q", pr.Head.Sha, pr.Base.Sha)
+			}
+			if pr.Head.Ref != "fix/build" || evt.PRNumber() != 7 || evt.Repository.FullName != "org/repo" {
+				t.Fatalf("unexpected event: %#v", evt)
+			}
+		})
+	}
+}
+
+func TestDecodeGiteaPullRequestInvalidJSON(t *testing.T) {
+	if _, _, err := webhook.DecodeGiteaPullRequest([]byte(`{"action":`)); err == nil {
+		t.Fatal("expected error for malformed payload")
+	}
+}
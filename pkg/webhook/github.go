@@ -0,0 +1,79 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// githubPullRequestEvent представляет событие pull_request в формате GitHub.
+type githubPullRequestEvent struct {
+	Action      string `json:"action"`
+	Number      int64  `json:"number"`
+	PullRequest struct {
+		Number  int64   `json:"number"`
+		Title   string  `json:"title"`
+		Body    string  `json:"body"`
+		HTMLURL string  `json:"html_url"`
+		Draft   bool    `json:"draft"`
+		Base    Branch  `json:"base"`
+		Head    Branch  `json:"head"`
+		Labels  []Label `json:"labels"`
+	} `json:"pull_request"`
+	Repository struct {
+		ID       int64  `json:"id"`
+		Name     string `json:"name"`
+		FullName string `json:"full_name"`
+		HTMLURL  string `json:"html_url"`
+	} `json:"repository"`
+	Sender struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+		Name  string `json:"name"`
+	} `json:"sender"`
+}
+
+// githubActions сопоставляет действия GitHub, названные иначе, с действиями Gitea.
+var githubActions = map[string]string{
+	"synchronize": "synchronized",
+}
+
+// DecodeGitHubPullRequest разбирает тело события pull_request в формате GitHub
+// и преобразует его во внутреннее представление PullRequestEvent.
+// Ссылкой на pull request считается html_url (в GitHub поле url указывает на API).
+func DecodeGitHubPullRequest(body []byte) (PullRequestEvent, error) {
+	var gh githubPullRequestEvent
+	if err := json.Unmarshal(body, &gh); err != nil {
+		return PullRequestEvent{}, fmt.Errorf("decode github payload: %w", err)
+	}
+
+	action := gh.Action
+	if mapped, ok := githubActions[action]; ok {
+		action = mapped
+	}
+
+	return PullRequestEvent{
+		Action: action,
+		Number: gh.Number,
+		PullRequest: PullRequest{
+			Number: gh.PullRequest.Number,
+			Title:  gh.PullRequest.Title,
+			Body:   gh.PullRequest.Body,
+			URL:    gh.PullRequest.HTMLURL,
+			Draft:  gh.PullRequest.Draft,
+			Base:   gh.PullRequest.Base,
+			Head:   gh.PullRequest.Head,
+			Labels: gh.PullRequest.Labels,
+		},
+		Repository: Repository{
+			ID:       gh.Repository.ID,
+			Name:     gh.Repository.Name,
+			FullName: gh.Repository.FullName,
+			HTMLURL:  gh.Repository.HTMLURL,
+		},
+		Sender: Sender{
+			ID:       gh.Sender.ID,
+			Login:    gh.Sender.Login,
+			FullName: gh.Sender.Name,
+		},
+	}, nil
+}
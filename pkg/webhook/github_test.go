@@ -0,0 +1,52 @@
+package webhook_test
+
+import (
+	"testing"
+
+	"github.com/example/gitea-jenkins-webhook/pkg/webhook"
+)
+
+func TestDecodeGitHubPullRequest(t *testing.T) {
+	body := []byte(`{
+		"action": "synchronize",
+		"number": 17,
+		"pull_request": {
+			"number": 17,
+			"title": "Add login",
+			"url": "https://api.github.com/repos/org/repo/pulls/17",
+			"html_url": "https://github.com/org/repo/pull/17",
+			"draft": true,
+			"base": {"ref": "main"},
+			"head": {"ref": "feature/login"},
+			"labels": [{"name": "ci"}]
+		},
+		"repository": {"id": 5, "name": "repo", "full_name": "org/repo", "html_url": "https://github.com/org/repo"},
+		"sender": {"id": 9, "login": "octocat", "name": "The Octocat"}
+	}`)
+
+	evt, err := webhook.DecodeGitHubPullRequest(body)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if evt.Action != "synchronized" {
+		t.Fatalf("expected mapped action, got %q", evt.Action)
+	}
+	if evt.PRNumber() != 17 || evt.PullRequest.Title != "Add login" || !evt.PullRequest.Draft {
+		t.Fatalf("unexpected pull request: %#v", evt.PullRequest)
+	}
+	if evt.PullRequest.URL != "https://github.com/org/repo/pull/17" {
+		t.Fatalf("expected html_url as pull request URL, got %s", evt.PullRequest.URL)
+	}
+	if evt.PullRequest.Base.Ref != "main" || evt.PullRequest.Head.Ref != "feature/login" {
+		t.Fatalf("unexpected branches: %#v", evt.PullRequest)
+	}
+	if len(evt.PullRequest.Labels) != 1 || evt.PullRequest.Labels[0].Name != "ci" {
+		t.Fatalf("unexpected labels: %#v", evt.PullRequest.Labels)
+	}
+	if evt.Repository.FullName != "org/repo" || evt.Repository.HTMLURL != "https://github.com/org/repo" {
+		t.Fatalf("unexpected repository: %#v", evt.Repository)
+	}
+	if evt.Sender.Login != "octocat" || evt.Sender.FullName != "The Octocat" {
+		t.Fatalf("unexpected sender: %#v", evt.Sender)
+	}
+}
@@ -0,0 +1,78 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// PushEvent представляет событие push от Gitea.
+type PushEvent struct {
+	Ref        string     `json:"ref"`
+	Before     string     `json:"before"`
+	After      string     `json:"after"` // SHA головного коммита ветки после push
+	Commits    []Commit   `json:"commits"`
+	Repository Repository `json:"repository"`
+	Sender     Sender     `json:"sender"`
+	Timestamp  time.Time  `json:"-"`
+	TraceID    string     `json:"-"`
+	DeliveryID string     `json:"-"`
+}
+
+// Commit представляет коммит, входящий в событие push.
+type Commit struct {
+	ID      string `json:"id"`
+	Message string `json:"message"`
+	URL     string `json:"url"`
+}
+
+// DecodePushEvent разбирает тело события push от Gitea.
+func DecodePushEvent(body []byte) (PushEvent, error) {
+	var evt PushEvent
+	if err := json.Unmarshal(body, &evt); err != nil {
+		return PushEvent{}, fmt.Errorf("decode push payload: %w", err)
+	}
+	return evt, nil
+}
+
+// Branch возвращает имя ветки без префикса "refs/heads/".
+func (e PushEvent) Branch() string {
+	return strings.TrimPrefix(e.Ref, "refs/heads/")
+}
+
+// CommitMessage возвращает сообщение головного коммита push: коммита с SHA after,
+// а если его нет в списке - последнего коммита. Возвращает пустую строку, если коммитов нет.
+func (e PushEvent) CommitMessage() string {
+	for _, c := range e.Commits {
+		if c.ID == e.After {
+			return c.Message
+		}
+	}
+	if len(e.Commits) == 0 {
+		return ""
+	}
+	return e.Commits[len(e.Commits)-1].Message
+}
+
+// AsPullRequestEvent представляет событие push как PullRequestEvent с действием "push" для обработки
+// процессором: ветка и SHA становятся головной и целевой веткой, первая строка сообщения коммита -
+// заголовком, а исходное событие сохраняется в поле Push. Номер pull request равен нулю.
+func (e PushEvent) AsPullRequestEvent() PullRequestEvent {
+	title, _, _ := strings.Cut(e.CommitMessage(), "\n")
+	branch := e.Branch()
+	return PullRequestEvent{
+		Action: "push",
+		PullRequest: PullRequest{
+			Title: title,
+			Base:  Branch{Ref: branch},
+			Head:  Branch{Ref: branch, Sha: e.After},
+		},
+		Repository: e.Repository,
+		Sender:     e.Sender,
+		Timestamp:  e.Timestamp,
+		TraceID:    e.TraceID,
+		DeliveryID: e.DeliveryID,
+		Push:       &e,
+	}
+}
@@ -0,0 +1,43 @@
+package webhook_test
+
+import (
+	"testing"
+
+	"github.com/example/gitea-jenkins-webhook/pkg/webhook"
+)
+
+func TestDecodePushEvent(t *testing.T) {
+	body := []byte(`{
+		"ref": "refs/heads/feature/login",
+		"before": "000111",
+		"after": "abc123",
+		"commits": [
+			{"id": "abc123", "message": "Add login form\n\nDetails"},
+			{"id": "def456", "message": "WIP"}
+		],
+		"repository": {"id": 1, "name": "repo", "full_name": "org/repo"},
+		"sender": {"login": "alice"}
+	}`)
+
+	push, err := webhook.DecodePushEvent(body)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if push.Branch() != "feature/login" || push.After != "abc123" {
+		t.Fatalf("unexpected push: %#v", push)
+	}
+	if push.CommitMessage() != "Add login form\n\nDetails" {
+		t.Fatalf("expected head commit message, got %q", push.CommitMessage())
+	}
+
+	evt := push.AsPullRequestEvent()
+	if !evt.IsPush() || evt.Action != "push" || evt.PRNumber() != 0 {
+		t.Fatalf("unexpected event: %#v", evt)
+	}
+	if evt.PullRequest.Head.Ref != "feature/login" || evt.PullRequest.Head.Sha != "abc123" || evt.PullRequest.Title != "Add login form" {
+		t.Fatalf("unexpected pull request fields: %#v", evt.PullRequest)
+	}
+	if evt.Repository.FullName != "org/repo" || evt.Sender.Login != "alice" {
+		t.Fatalf("unexpected repository or sender: %#v", evt)
+	}
+}
@@ -1,25 +1,50 @@
 // Package webhook предоставляет типы для работы с событиями вебхуков от Gitea.
 package webhook
 
-import "time"
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+)
 
 // PullRequestEvent представляет событие pull request от Gitea.
 type PullRequestEvent struct {
-	Action      string      `json:"action"`
-	Number      int64       `json:"number"`
-	PullRequest PullRequest `json:"pull_request"`
-	Repository  Repository  `json:"repository"`
-	Sender      Sender      `json:"sender"`
-	Changes     interface{} `json:"changes,omitempty"`
-	Timestamp   time.Time   `json:"-"`
+	Action      string             `json:"action"`
+	Number      int64              `json:"number"`
+	PullRequest PullRequest        `json:"pull_request"`
+	Repository  Repository         `json:"repository"`
+	Sender      Sender             `json:"sender"`
+	Changes     interface{}        `json:"changes,omitempty"`
+	Timestamp   time.Time          `json:"-"`
+	TraceID     string             `json:"-"` // Идентификатор трассировки из заголовка traceparent запроса
+	DeliveryID  string             `json:"-"` // Идентификатор доставки вебхука из заголовка X-Gitea-Delivery
+	Push        *PushEvent         `json:"-"` // Исходное событие push, если событие получено из push (см. PushEvent.AsPullRequestEvent)
+	Comment     *IssueCommentEvent `json:"-"` // Исходный комментарий с командой повторной проверки (см. IssueCommentEvent.AsPullRequestEvent)
+	WALID       uint64             `json:"-"` // Номер записи журнала предзаписи (0 - событие не записано в журнал)
 }
 
 // PullRequest представляет информацию о pull request.
 type PullRequest struct {
-	Number int64  `json:"number"`
-	Title  string `json:"title"`
-	Body   string `json:"body"`
-	URL    string `json:"url"`
+	Number int64   `json:"number"`
+	Title  string  `json:"title"`
+	Body   string  `json:"body"`
+	URL    string  `json:"url"`
+	Draft  bool    `json:"draft"`
+	Base   Branch  `json:"base"`
+	Head   Branch  `json:"head"`
+	Labels []Label `json:"labels"`
+}
+
+// Branch представляет ветку, на которую или из которой открыт pull request.
+type Branch struct {
+	Ref string `json:"ref"`
+	Sha string `json:"sha"` // Последний коммит ветки
+}
+
+// Label представляет метку pull request.
+type Label struct {
+	Name string `json:"name"`
 }
 
 // Repository представляет информацию о репозитории Gitea.
@@ -45,3 +70,66 @@ func (p PullRequest) DisplayName() string {
 	}
 	return "PR"
 }
+
+// OwnerAndName разбирает полное имя репозитория "owner/name" на владельца (организацию или пользователя)
+// и имя. Если полное имя не содержит "/", владелец пуст, а имя равно полному имени.
+func (r Repository) OwnerAndName() (owner, name string) {
+	owner, name, ok := strings.Cut(r.FullName, "/")
+	if !ok {
+		return "", r.FullName
+	}
+	return owner, name
+}
+
+// PRNumber возвращает номер pull request из события. Номер берется из pull_request.number,
+// а если он не задан - из поля number верхнего уровня. Возвращает 0, если номер отсутствует в обоих полях.
+func (e PullRequestEvent) PRNumber() int64 {
+	if e.PullRequest.Number != 0 {
+		return e.PullRequest.Number
+	}
+	return e.Number
+}
+
+// IsPush сообщает, получено ли событие из push, а не из pull request.
+func (e PullRequestEvent) IsPush() bool {
+	return e.Push != nil
+}
+
+// IsRetest сообщает, получено ли событие из комментария с командой повторной проверки.
+func (e PullRequestEvent) IsRetest() bool {
+	return e.Comment != nil
+}
+
+// knownActions - действия событий pull request, которые отправляет Gitea.
+var knownActions = map[string]bool{
+	"opened":                 true,
+	"reopened":               true,
+	"closed":                 true,
+	"edited":                 true,
+	"synchronized":           true,
+	"synchronize":            true,
+	"assigned":               true,
+	"unassigned":             true,
+	"label_updated":          true,
+	"label_cleared":          true,
+	"milestoned":             true,
+	"demilestoned":           true,
+	"reviewed":               true,
+	"review_requested":       true,
+	"review_request_removed": true,
+}
+
+// KnownAction сообщает, известно ли действие события: действие pull request, которое отправляет Gitea,
+// или событие, полученное из push или комментария с командой повторной проверки.
+func (e PullRequestEvent) KnownAction() bool {
+	return e.IsPush() || e.IsRetest() || knownActions[e.Action]
+}
+
+// SyntheticNumber возвращает детерминированный положительный индекс, вычисленный
+// по полному имени репозитория и заголовку pull request. Используется как запасной индекс
+// issue, когда событие не содержит номера pull request.
+func (e PullRequestEvent) SyntheticNumber() int64 {
+	h := fnv.New32a()
+	_, _ = fmt.Fprintf(h, "%s\x00%s", e.Repository.FullName, e.PullRequest.Title)
+	return int64(h.Sum32()%1_000_000) + 1
+}
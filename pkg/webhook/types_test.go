@@ -0,0 +1,47 @@
+package webhook_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/example/gitea-jenkins-webhook/pkg/webhook"
+)
+
+func TestPRNumberFallback(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    int64
+	}{
+		{"pull_request.number", `{"number": 0, "pull_request": {"number": 12}}`, 12},
+		{"pull_request.number wins", `{"number": 99, "pull_request": {"number": 12}}`, 12},
+		{"top-level number", `{"number": 34, "pull_request": {"title": "t"}}`, 34},
+		{"missing", `{"pull_request": {"title": "t"}}`, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var evt webhook.PullRequestEvent
+			if err := json.Unmarshal([]byte(tt.payload), &evt); err != nil {
+				t.Fatalf("decode payload: %v", err)
+			}
+			if got := evt.PRNumber(); got != tt.want {
+				t.Fatalf("expected %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSyntheticNumberIsStable(t *testing.T) {
+	evt := webhook.PullRequestEvent{
+		PullRequest: webhook.PullRequest{Title: "Fix build"},
+		Repository:  webhook.Repository{FullName: "org/repo"},
+	}
+	first := evt.SyntheticNumber()
+	if first <= 0 {
+		t.Fatalf("synthetic number must be positive, got %d", first)
+	}
+	if second := evt.SyntheticNumber(); second != first {
+		t.Fatalf("synthetic number must be stable: %d != %d", first, second)
+	}
+}